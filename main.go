@@ -87,8 +87,10 @@ import (
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/tarot"    // 抽塔罗牌
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/tracemoe" // 搜番
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/wallet"   // 钱包
+	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/weiqi"    // 围棋
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/wife"     // 抽老婆
 	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/wordle"   // 猜单词
+	_ "github.com/FloatTech/ZeroBot-Plugin/plugin/xiangqi"  // 中国象棋
 
 	//                               ^^^^                               //
 	//                          ^^^^^^^^^^^^^^                          //
@@ -0,0 +1,443 @@
+package chess
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/notnil/chess"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom/elo"
+)
+
+// difficulty 人机对战难度
+type difficulty struct {
+	name    string
+	depth   int           // 最大搜索深度(半回合)
+	timeout time.Duration // 每步最长思考时间
+	noise   int           // 对根节点评分的随机扰动(厘兵), 让低难度更像人
+	rating  int           // 计入等级分时机器人的等级分
+}
+
+var difficulties = []difficulty{
+	{name: "简单", depth: 1, timeout: time.Second, noise: 150, rating: 300},
+	{name: "普通", depth: 2, timeout: 3 * time.Second, noise: 30, rating: 600},
+	{name: "困难", depth: 3, timeout: 5 * time.Second, rating: 900},
+	{name: "大师", depth: 4, timeout: 10 * time.Second, rating: 1200},
+}
+
+// 群设置中人机对战计入等级分的开关位
+const engineRatedBit = 1
+
+const (
+	mateScore = 100000
+	maxQDepth = 6 // 静态搜索的最大深度
+)
+
+var pieceValue = [...]int{
+	chess.King:   0,
+	chess.Queen:  900,
+	chess.Rook:   500,
+	chess.Bishop: 330,
+	chess.Knight: 320,
+	chess.Pawn:   100,
+}
+
+// 子力位置表, 以白方视角从第8横线到第1横线排列
+var pieceSquareTable = [...][64]int{
+	chess.King: {
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-30, -40, -40, -50, -50, -40, -40, -30,
+		-20, -30, -30, -40, -40, -30, -30, -20,
+		-10, -20, -20, -20, -20, -20, -20, -10,
+		20, 20, 0, 0, 0, 0, 20, 20,
+		20, 30, 10, 0, 0, 10, 30, 20,
+	},
+	chess.Queen: {
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	},
+	chess.Rook: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		5, 10, 10, 10, 10, 10, 10, 5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		-5, 0, 0, 0, 0, 0, 0, -5,
+		0, 0, 0, 5, 5, 0, 0, 0,
+	},
+	chess.Bishop: {
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	},
+	chess.Knight: {
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	},
+	chess.Pawn: {
+		0, 0, 0, 0, 0, 0, 0, 0,
+		50, 50, 50, 50, 50, 50, 50, 50,
+		10, 10, 20, 30, 30, 20, 10, 10,
+		5, 5, 10, 25, 25, 10, 5, 5,
+		0, 0, 0, 20, 20, 0, 0, 0,
+		5, -5, -10, 0, 0, -10, -5, 5,
+		5, 10, 10, -20, -20, 10, 10, 5,
+		0, 0, 0, 0, 0, 0, 0, 0,
+	},
+}
+
+// difficultyOf 按名称查找难度, 未指定时为普通
+func difficultyOf(name string) *difficulty {
+	for i := range difficulties {
+		if difficulties[i].name == name {
+			return &difficulties[i]
+		}
+	}
+	return &difficulties[1]
+}
+
+// evaluate 静态评估, 返回当前走子方视角的分数(厘兵)
+func evaluate(pos *chess.Position) int {
+	board := pos.Board()
+	score := 0
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		p := board.Piece(sq)
+		if p == chess.NoPiece {
+			continue
+		}
+		idx := int(sq.Rank())*8 + int(sq.File())
+		if p.Color() == chess.White {
+			idx = (7-int(sq.Rank()))*8 + int(sq.File())
+		}
+		v := pieceValue[p.Type()] + pieceSquareTable[p.Type()][idx]
+		if p.Color() == chess.White {
+			score += v
+		} else {
+			score -= v
+		}
+	}
+	if pos.Turn() == chess.Black {
+		return -score
+	}
+	return score
+}
+
+// searcher 基于 alpha-beta 剪枝的迭代加深搜索
+type searcher struct {
+	deadline time.Time
+	nodes    int
+	stopped  bool
+}
+
+// bestMove 在限定的深度与时间内搜索最佳着法, 返回着法与走子方视角的分数
+func bestMove(pos *chess.Position, depth int, timeout time.Duration, noise int) (*chess.Move, int) {
+	s := &searcher{deadline: time.Now().Add(timeout)}
+	moves := orderMoves(pos, pos.ValidMoves())
+	if len(moves) == 0 {
+		return nil, 0
+	}
+	best, bestScore := moves[0], -mateScore-1
+	for d := 1; d <= depth; d++ {
+		iterBest, iterScore := moves[0], -mateScore-1
+		scores := make(map[*chess.Move]int, len(moves))
+		for _, m := range moves {
+			score := -s.negamax(pos.Update(m), d-1, -mateScore-1, -iterScore+noise, 1)
+			if s.stopped {
+				break
+			}
+			if noise > 0 {
+				score += rand.Intn(noise)
+			}
+			scores[m] = score
+			if score > iterScore {
+				iterBest, iterScore = m, score
+			}
+		}
+		if s.stopped && d > 1 {
+			// 未完成的一轮搜索结果不可靠
+			break
+		}
+		best, bestScore = iterBest, iterScore
+		// 下一轮优先搜索本轮较好的着法
+		sort.SliceStable(moves, func(i, j int) bool { return scores[moves[i]] > scores[moves[j]] })
+		if s.stopped || bestScore >= mateScore-depth {
+			break
+		}
+	}
+	return best, bestScore
+}
+
+func (s *searcher) timeout() bool {
+	s.nodes++
+	if !s.stopped && s.nodes&1023 == 0 && time.Now().After(s.deadline) {
+		s.stopped = true
+	}
+	return s.stopped
+}
+
+func (s *searcher) negamax(pos *chess.Position, depth, alpha, beta, ply int) int {
+	if s.timeout() {
+		return 0
+	}
+	if pos.HalfMoveClock() >= 100 {
+		return 0
+	}
+	if depth <= 0 {
+		return s.quiesce(pos, alpha, beta, ply, 0)
+	}
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		if pos.Status() == chess.Checkmate {
+			return -mateScore + ply
+		}
+		return 0
+	}
+	for _, m := range orderMoves(pos, moves) {
+		score := -s.negamax(pos.Update(m), depth-1, -beta, -alpha, ply+1)
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+// quiesce 只搜索吃子与升变, 避免在交换途中停止评估
+func (s *searcher) quiesce(pos *chess.Position, alpha, beta, ply, qdepth int) int {
+	if s.timeout() {
+		return 0
+	}
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		if pos.Status() == chess.Checkmate {
+			return -mateScore + ply
+		}
+		return 0
+	}
+	stand := evaluate(pos)
+	if stand >= beta {
+		return beta
+	}
+	if stand > alpha {
+		alpha = stand
+	}
+	if qdepth >= maxQDepth {
+		return alpha
+	}
+	for _, m := range orderMoves(pos, moves) {
+		if !m.HasTag(chess.Capture) && m.Promo() == chess.NoPieceType {
+			break // 已按吃子与升变优先排序
+		}
+		score := -s.quiesce(pos.Update(m), -beta, -alpha, ply+1, qdepth+1)
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+// orderMoves 按 升变 > 吃子(MVV-LVA) > 将军 > 其他 排序
+func orderMoves(pos *chess.Position, moves []*chess.Move) []*chess.Move {
+	board := pos.Board()
+	key := make(map[*chess.Move]int, len(moves))
+	for _, m := range moves {
+		k := 0
+		if m.Promo() != chess.NoPieceType {
+			k += 20000 + pieceValue[m.Promo()]
+		}
+		if m.HasTag(chess.Capture) {
+			victim := pieceValue[chess.Pawn] // 吃过路兵
+			if p := board.Piece(m.S2()); p != chess.NoPiece {
+				victim = pieceValue[p.Type()]
+			}
+			k += 10000 + victim*10 - pieceValue[board.Piece(m.S1()).Type()]/10
+		}
+		if m.HasTag(chess.Check) {
+			k += 500
+		}
+		key[m] = k
+	}
+	sort.SliceStable(moves, func(i, j int) bool { return key[moves[i]] > key[moves[j]] })
+	return moves
+}
+
+// engineName 机器人在对局中的名称
+func engineName(level *difficulty) string {
+	return "机器人(" + level.name + ")"
+}
+
+// createEngineGame 创建人机对局, 玩家执黑时返回机器人先走要思考的局面
+func createEngineGame(groupCode, senderUin int64, senderName string, selfID int64, level *difficulty, playBlack, rated bool) (msg message.Message, s *engineSearch, err error) {
+	msg = message.Message{message.At(senderUin)}
+	room := &chessRoom{
+		Room: gameroom.Room{
+			SelfID:     selfID,
+			GroupID:    groupCode,
+			Players:    []gameroom.Player{{UID: senderUin, Name: senderName}, {UID: selfID, Name: engineName(level)}},
+			LastAction: time.Now(),
+		},
+		chessGame:   chess.NewGame(),
+		whitePlayer: senderUin,
+		whiteName:   senderName,
+		blackPlayer: selfID,
+		blackName:   engineName(level),
+		aiLevel:     level,
+		aiColor:     chess.Black,
+		rated:       rated,
+	}
+	if playBlack {
+		room.whitePlayer, room.blackPlayer = room.blackPlayer, room.whitePlayer
+		room.whiteName, room.blackName = room.blackName, room.whiteName
+		room.aiColor = chess.White
+	}
+	if err = chessRooms.Create(groupCode, room); err != nil {
+		msg = append(msg, message.Text("本群已有对局, 请等待对局结束或由群主或管理员发送「中断」或「abort」中断对局。"))
+		return msg, nil, nil
+	}
+	hint := "已创建人机对局, 难度: " + level.name
+	if rated {
+		hint += ", 本局计入等级分"
+	} else {
+		hint += ", 本局不计入等级分"
+	}
+	if playBlack {
+		msg = append(msg, message.Text(hint, "\n机器人执白先走, 请稍候。"))
+		return msg, room.newEngineSearch(), nil
+	}
+	boardImgEle, err := getBoardElement(groupCode)
+	if err != nil {
+		return
+	}
+	msg = append(msg, message.Text(hint, "\n你执白先走, 请走棋。"), boardImgEle)
+	return
+}
+
+// engineSearch 机器人思考时的局面快照
+//
+// 思考最长要数秒, 期间不持有房间锁, 以免阻塞其它群的对局与计时检查.
+type engineSearch struct {
+	room  *chessRoom
+	pos   *chess.Position
+	plies int // 快照时的着数, 用于确认思考期间没有新的着法
+}
+
+// newEngineSearch 记录当前局面, 需持有房间锁
+func (room *chessRoom) newEngineSearch() *engineSearch {
+	return &engineSearch{room: room, pos: room.chessGame.Position(), plies: len(room.chessGame.Moves())}
+}
+
+// engineSearchOf 群内人机对局的当前局面, 不是人机对局时返回 nil, 需持有房间锁
+func engineSearchOf(groupCode int64) *engineSearch {
+	room, ok := chessRooms.Load(groupCode)
+	if !ok || room.aiLevel == nil {
+		return nil
+	}
+	return room.newEngineSearch()
+}
+
+// current 思考期间对局没有结束或变化, 需持有房间锁
+func (s *engineSearch) current(groupCode int64) bool {
+	room, ok := chessRooms.Load(groupCode)
+	return ok && room == s.room && len(room.chessGame.Moves()) == s.plies && room.chessGame.Method() == chess.NoMethod
+}
+
+// acceptsDraw 机器人在局面不占优时接受和棋, 不能持有房间锁
+func (s *engineSearch) acceptsDraw() bool {
+	_, score := bestMove(s.pos, 2, time.Second, 0)
+	if s.pos.Turn() != s.room.aiColor {
+		score = -score
+	}
+	return score < 0
+}
+
+// replyEngine 机器人应着并发送结果, 不能持有房间锁
+func replyEngine(ctx *zero.Ctx, s *engineSearch) {
+	replyMessage, err := engineTurn(ctx.Event.GroupID, s)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	if len(replyMessage) == 0 {
+		return
+	}
+	ctx.Send(replyMessage)
+	reportResult(ctx, s.room)
+}
+
+// engineTurn 机器人思考后走棋, 不能持有房间锁, 对局在思考期间结束或变化时返回空消息
+func engineTurn(groupCode int64, s *engineSearch) (message.Message, error) {
+	level := s.room.aiLevel
+	move, _ := bestMove(s.pos, level.depth, level.timeout, level.noise)
+	chessRooms.Lock()
+	defer chessRooms.Unlock()
+	if move == nil || !s.current(groupCode) {
+		return nil, nil
+	}
+	room := s.room
+	san := chess.AlgebraicNotation{}.Encode(s.pos, move)
+	room.Touch()
+	if err := room.chessGame.Move(move); err != nil {
+		return nil, err
+	}
+	uin, _ := room.humanPlayer()
+	return moveResult(message.Message{message.At(uin)}, groupCode, room, san)
+}
+
+// humanPlayer 人机对局中玩家的 QQ 与名称
+func (room *chessRoom) humanPlayer() (int64, string) {
+	if room.aiColor == chess.White {
+		return room.blackPlayer, room.blackName
+	}
+	return room.whitePlayer, room.whiteName
+}
+
+// getEngineELOString 人机对局只更新玩家的等级分, 机器人按难度取固定等级分
+func getEngineELOString(room chessRoom, whiteScore, blackScore float64) (string, error) {
+	if !room.rated {
+		return "", nil
+	}
+	uin, name := room.humanPlayer()
+	score, engineScore := whiteScore, blackScore
+	if room.aiColor == chess.White {
+		score, engineScore = blackScore, whiteScore
+	}
+	rate, err := ratings.GetOrCreate(uin, name)
+	if err != nil {
+		return "", err
+	}
+	rate, _ = elo.Calculate(rate, room.aiLevel.rating, score, engineScore)
+	if err := ratings.Update(uin, name, rate); err != nil {
+		return "", err
+	}
+	return "玩家等级分: \n" + name + ": " + strconv.Itoa(rate) + "\n\n", nil
+}
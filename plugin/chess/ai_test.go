@@ -0,0 +1,69 @@
+package chess
+
+import (
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+func positionOf(t *testing.T, fen string) *chess.Position {
+	t.Helper()
+	opt, err := chess.FEN(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chess.NewGame(opt).Position()
+}
+
+func TestBestMoveTactics(t *testing.T) {
+	tests := []struct {
+		name  string
+		fen   string
+		depth int
+		want  string
+		mate  bool
+	}{
+		{"底线杀", "6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", 2, "a1a8", true},
+		{"黑方底线杀", "r5k1/8/8/8/8/8/5PPP/6K1 b - - 0 1", 2, "a8a1", true},
+		{"学者将杀", "r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/5Q2/PPPP1PPP/RNB1K1NR w KQkq - 4 4", 3, "f3f7", true},
+		{"两步杀", "kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1", 3, "a1a6", true},
+		{"吃掉悬空的后", "4k3/8/8/8/8/2q5/8/2R1K3 w - - 0 1", 2, "c1c3", false},
+		{"马的双击", "q3k3/8/8/3N4/8/8/8/4K3 w - - 0 1", 3, "d5c7", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			move, score := bestMove(positionOf(t, tt.fen), tt.depth, 10*time.Second, 0)
+			if move == nil || move.String() != tt.want {
+				t.Fatalf("bestMove() = %v, want %s", move, tt.want)
+			}
+			if tt.mate && score < mateScore-10 {
+				t.Fatalf("score = %d, want mate", score)
+			}
+		})
+	}
+}
+
+func TestBestMoveAvoidsStalemate(t *testing.T) {
+	// 白后不能走到 c7/b6 逼和
+	pos := positionOf(t, "k7/8/1K6/8/8/8/8/2Q5 w - - 0 1")
+	move, _ := bestMove(pos, 3, 10*time.Second, 0)
+	if move == nil {
+		t.Fatal("没有找到着法")
+	}
+	if next := pos.Update(move); next.Status() == chess.Stalemate {
+		t.Fatalf("bestMove() = %v 导致逼和", move)
+	}
+}
+
+func TestBestMoveTimeout(t *testing.T) {
+	pos := chess.NewGame().Position()
+	start := time.Now()
+	move, _ := bestMove(pos, 8, 200*time.Millisecond, 0)
+	if move == nil {
+		t.Fatal("没有找到着法")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("搜索用时 %v, 超出限制", elapsed)
+	}
+}
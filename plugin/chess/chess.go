@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/FloatTech/floatbox/file"
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
@@ -16,15 +17,33 @@ import (
 	"github.com/wdvxdr1123/ZeroBot/message"
 )
 
-const helpString = `- 参与/创建一盘游戏：「下棋」(chess)
-- 参与/创建一盘盲棋：「盲棋」(blind)
+const helpString = `- 参与/创建一盘游戏：「下棋 [时限]」(chess)，时限格式为「分钟+每步加秒」，如「下棋 10+5」，由创建者决定
+- 参与/创建一盘盲棋：「盲棋 [时限]」(blind)
+- 与机器人对局：「人机对战 [简单|普通|困难|大师] [执黑|执白]」，默认普通难度执白
+- 人机对局是否计入等级分：「开启/关闭人机对战等级分」（仅群主/管理员有效，默认不计入）
 - 投降认输：「认输」 (resign)
 - 请求、接受和棋：「和棋」 (draw)
 - 走棋：!Nxf3 中英文感叹号均可，格式请参考“代数记谱法”(Algebraic notation)
-- 中断对局：「中断」 (abort)（仅群主/管理员有效）
+- 中断对局：「中断」 (abort)（仅群主/管理员有效），6 小时无人走棋的对局会自动中断
+- 观战本群对局并在结束时收到通知：「观战」(watch)，「取消观战」(unwatch)
 - 查看等级分排行榜：「排行榜」(ranking)
 - 查看自己的等级分：「等级分」(rate)
-- 清空等级分：「清空等级分 QQ号」(.clean.rate) （仅超管有效）`
+- 清空等级分：「清空等级分 QQ号」(.clean.rate) （仅超管有效）
+- 查看自己的对局记录：「我的对局 [页码]」
+- 对局复盘动画：「复盘 #编号」
+- 导出对局棋谱：「导出PGN #编号」
+- 查看自己执白/执黑的胜率与常用开局：「对局统计」
+- 做一道与自己水平相近的谜题：「象棋谜题」(chess puzzle)，以「!着法」作答
+- 每日谜题：「每日谜题」(daily puzzle)
+- 放弃谜题并查看答案：「放弃谜题」
+- 查看谜题等级分排行榜：「谜题排行榜」
+- 查看自己的谜题等级分：「谜题等级分」
+- 向任意群或好友发起通信对局：「通信对局 @对手/QQ号 [执黑|执白]」，可跨群、私聊进行，重启后不会丢失
+- 回应通信对局：「接受通信对局 #编号」「拒绝通信对局 #编号」
+- 通信对局走棋：「通信走棋 [#编号] 着法」，只有一局进行中的对局时可省略编号，轮到对手时会通知对方
+- 通信对局认输、和棋、查看棋盘：「通信认输 [#编号]」「通信和棋 [#编号]」「通信棋盘 [#编号]」
+- 查看未结束的通信对局：「我的通信对局」
+- 谜题库：将 lichess 格式的谜题文件 (PuzzleId,FEN,Moves,Rating,...,Themes) 放置于数据目录下的 puzzles.csv`
 
 var (
 	limit       = ctxext.NewLimiterManager(time.Microsecond*2500, 1)
@@ -47,8 +66,10 @@ func init() {
 	// 初始化数据库
 	dbFilePath := engine.DataFolder() + "chess.db"
 	initDatabase(dbFilePath)
+	// 恢复未结束的对局, 并开始超时与限时对局计时
+	chessRooms = newRoomManager()
 	// 注册指令
-	engine.OnFullMatchGroup([]string{"下棋", "chess"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+	engine.OnRegex(`^(下棋|chess)(?:\s*(\d+)\+(\d+))?$`, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			if ctx.Event.Sender == nil {
 				return
@@ -56,31 +77,89 @@ func init() {
 			userUin := ctx.Event.UserID
 			userName := ctx.Event.Sender.NickName
 			groupCode := ctx.Event.GroupID
-			replyMessage, err := game(groupCode, userUin, userName)
+			matched := ctx.State["regex_matched"].([]string)
+			clock, err := parseTimeControl(matched[2], matched[3])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			chessRooms.Lock()
+			replyMessage, err := game(groupCode, userUin, userName, ctx.Event.SelfID, clock)
+			chessRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^人机对战\s*(简单|普通|困难|大师)?\s*(执黑|执白)?$`, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			matched := ctx.State["regex_matched"].([]string)
+			rated := ctx.State["manager"].(*ctrl.Control[*zero.Ctx]).GetData(ctx.Event.GroupID)&engineRatedBit != 0
+			chessRooms.Lock()
+			replyMessage, search, err := createEngineGame(ctx.Event.GroupID, ctx.Event.UserID, ctx.Event.Sender.NickName,
+				ctx.Event.SelfID, difficultyOf(matched[1]), matched[2] == "执黑", rated)
+			chessRooms.Unlock()
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
 			ctx.Send(replyMessage)
+			if search != nil {
+				replyEngine(ctx, search)
+			}
+		})
+
+	engine.OnRegex(`^(开启|关闭)人机对战等级分$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c := ctx.State["manager"].(*ctrl.Control[*zero.Ctx])
+			gid := ctx.Event.GroupID
+			data := c.GetData(gid)
+			status := ctx.State["regex_matched"].([]string)[1]
+			if status == "开启" {
+				data |= engineRatedBit
+			} else {
+				data &^= engineRatedBit
+			}
+			if err := c.SetData(gid, data); err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已", status, "人机对战等级分, 将在下一局人机对战生效"))
 		})
 
 	engine.OnFullMatchGroup([]string{"认输", "resign"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			userUin := ctx.Event.UserID
 			groupCode := ctx.Event.GroupID
+			chessRooms.Lock()
+			room, _ := chessRooms.Load(groupCode)
 			replyMessage, err := resign(groupCode, userUin)
+			chessRooms.Unlock()
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
 			ctx.Send(replyMessage)
+			reportResult(ctx, room)
 		})
 
 	engine.OnFullMatchGroup([]string{"和棋", "draw"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			userUin := ctx.Event.UserID
 			groupCode := ctx.Event.GroupID
-			replyMessage, err := draw(groupCode, userUin)
+			// 机器人思考是否接受和棋时不持有房间锁
+			chessRooms.Lock()
+			search := engineSearchOf(groupCode)
+			chessRooms.Unlock()
+			accepted := search != nil && search.acceptsDraw()
+			chessRooms.Lock()
+			replyMessage, err := draw(groupCode, userUin, accepted && search.current(groupCode))
+			chessRooms.Unlock()
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
@@ -91,7 +170,33 @@ func init() {
 	engine.OnFullMatchGroup([]string{"中断", "abort"}, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).Limit(limit.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			groupCode := ctx.Event.GroupID
+			chessRooms.Lock()
 			replyMessage, err := abort(groupCode)
+			chessRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatchGroup([]string{"观战", "watch"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			chessRooms.Lock()
+			replyMessage, err := watch(ctx.Event.GroupID, ctx.Event.UserID)
+			chessRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatchGroup([]string{"取消观战", "unwatch"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			chessRooms.Lock()
+			replyMessage, err := unwatch(ctx.Event.GroupID, ctx.Event.UserID)
+			chessRooms.Unlock()
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
@@ -99,7 +204,7 @@ func init() {
 			ctx.Send(replyMessage)
 		})
 
-	engine.OnFullMatchGroup([]string{"盲棋", "blind"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+	engine.OnRegex(`^(盲棋|blind)(?:\s*(\d+)\+(\d+))?$`, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			if ctx.Event.Sender == nil {
 				return
@@ -107,7 +212,15 @@ func init() {
 			userUin := ctx.Event.UserID
 			userName := ctx.Event.Sender.NickName
 			groupCode := ctx.Event.GroupID
-			replyMessage, err := blindfold(groupCode, userUin, userName)
+			matched := ctx.State["regex_matched"].([]string)
+			clock, err := parseTimeControl(matched[2], matched[3])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			chessRooms.Lock()
+			replyMessage, err := blindfold(groupCode, userUin, userName, ctx.Event.SelfID, clock)
+			chessRooms.Unlock()
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
@@ -121,12 +234,30 @@ func init() {
 			groupCode := ctx.Event.GroupID
 			userMsgStr := ctx.State["regex_matched"].([]string)[0]
 			moveStr := strings.TrimPrefix(strings.TrimPrefix(userMsgStr, "！"), "!")
-			replyMessage, err := play(groupCode, userUin, moveStr)
+			// 正在做谜题时优先验证谜题答案
+			if session, ok := puzzleSessions.Load(userUin); ok && session.groupCode == groupCode && ctx.Event.Sender != nil {
+				replyMessage, err := solvePuzzle(userUin, ctx.Event.Sender.NickName, moveStr)
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+				ctx.Send(replyMessage)
+				return
+			}
+			chessRooms.Lock()
+			room, _ := chessRooms.Load(groupCode)
+			replyMessage, search, err := play(groupCode, userUin, moveStr)
+			chessRooms.Unlock()
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
+			if search != nil {
+				replyEngine(ctx, search)
+				return
+			}
 			ctx.Send(replyMessage)
+			reportResult(ctx, room)
 		})
 
 	engine.OnFullMatchGroup([]string{"排行榜", "ranking"}).SetBlock(true).Limit(limit.LimitByUser).
@@ -154,6 +285,168 @@ func init() {
 			ctx.Send(replyMessage)
 		})
 
+	engine.OnRegex(`^我的对局\s*(\d*)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			page, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			replyMessage, err := myGames(ctx.Event.UserID, page)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^复盘\s*#?(\d+)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseUint(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			replyMessage, err := replay(uint(id))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^导出(?i:pgn)\s*#?(\d+)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseUint(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			filePath, name, data, err := exportPGN(uint(id))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			// 私聊或上传失败时直接发送棋谱文本
+			if ctx.Event.GroupID != 0 {
+				if resp := ctx.UploadThisGroupFile(file.BOTPATH+"/"+filePath, name, ""); resp.Status == "ok" {
+					return
+				}
+			}
+			ctx.SendChain(message.Text(data))
+		})
+
+	engine.OnFullMatch("对局统计").SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			replyMessage, err := userStats(ctx.Event.UserID, ctx.Event.Sender.NickName)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^(?:国际)?(象棋谜题|每日谜题|(?i:chess puzzle|daily puzzle))$`, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			kind := strings.ToLower(ctx.State["regex_matched"].([]string)[1])
+			daily := kind == "每日谜题" || kind == "daily puzzle"
+			chessRooms.Lock()
+			replyMessage, err := startPuzzle(ctx.Event.GroupID, ctx.Event.UserID, daily)
+			chessRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("放弃谜题", zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			replyMessage, err := giveUpPuzzle(ctx.Event.UserID, ctx.Event.Sender.NickName)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("谜题排行榜").SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			replyMessage, err := getPuzzleRanking()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("谜题等级分").SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			replyMessage, err := puzzleRating(ctx.Event.UserID, ctx.Event.Sender.NickName)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^通信对局\s*(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\]|(\d+))\s*(执黑|执白)?$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			matched := ctx.State["regex_matched"].([]string)
+			opponentUin, _ := strconv.ParseInt(matched[2]+matched[3], 10, 64)
+			sendCorrespondence(ctx)(challengeCorrespondence(ctx.Event.UserID, ctx.Event.Sender.NickName, ctx.Event.GroupID,
+				opponentUin, ctx.CardOrNickName(opponentUin), matched[4] == "执黑"))
+		})
+
+	engine.OnRegex(`^(接受|拒绝)通信对局\s*#?(\d+)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			matched := ctx.State["regex_matched"].([]string)
+			id, _ := strconv.ParseUint(matched[2], 10, 64)
+			sendCorrespondence(ctx)(answerCorrespondence(uint(id), ctx.Event.UserID, ctx.Event.Sender.NickName, ctx.Event.GroupID, matched[1] == "接受"))
+		})
+
+	engine.OnRegex(`^通信走棋\s*(?:#?(\d+)\s+)?(\S+)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			matched := ctx.State["regex_matched"].([]string)
+			id, _ := strconv.ParseUint(matched[1], 10, 64)
+			moveStr := strings.TrimPrefix(strings.TrimPrefix(matched[2], "！"), "!")
+			sendCorrespondence(ctx)(moveCorrespondence(uint(id), ctx.Event.UserID, ctx.Event.Sender.NickName, ctx.Event.GroupID, moveStr))
+		})
+
+	engine.OnRegex(`^通信(认输|和棋|棋盘)\s*#?(\d*)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			matched := ctx.State["regex_matched"].([]string)
+			id, _ := strconv.ParseUint(matched[2], 10, 64)
+			switch matched[1] {
+			case "认输":
+				sendCorrespondence(ctx)(resignCorrespondence(uint(id), ctx.Event.UserID, ctx.Event.Sender.NickName, ctx.Event.GroupID))
+			case "和棋":
+				sendCorrespondence(ctx)(drawCorrespondence(uint(id), ctx.Event.UserID, ctx.Event.Sender.NickName, ctx.Event.GroupID))
+			default:
+				replyMessage, err := showCorrespondence(uint(id), ctx.Event.UserID)
+				sendCorrespondence(ctx)(replyMessage, nil, err)
+			}
+		})
+
+	engine.OnFullMatch("我的通信对局").SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			replyMessage, err := listCorrespondence(ctx.Event.UserID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
 	engine.OnPrefixGroup([]string{"清空等级分", ".clean.rate"}, zero.SuperUserPermission).SetBlock(true).
 		Limit(limit.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
@@ -171,3 +464,25 @@ func init() {
 			ctx.Send(replyMessage)
 		})
 }
+
+// sendCorrespondence 回复通信对局指令, 并在对手所在的群或私聊中通知对手
+func sendCorrespondence(ctx *zero.Ctx) func(message.Message, *correspondenceNotice, error) {
+	return func(replyMessage message.Message, notice *correspondenceNotice, err error) {
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if ctx.Event.GroupID != 0 {
+			replyMessage = append(message.Message{message.At(ctx.Event.UserID)}, replyMessage...)
+		}
+		ctx.Send(replyMessage)
+		if notice == nil {
+			return
+		}
+		if notice.groupCode == 0 {
+			ctx.SendPrivateMessage(notice.uin, notice.msg)
+			return
+		}
+		ctx.SendGroupMessage(notice.groupCode, append(message.Message{message.At(notice.uin)}, notice.msg...))
+	}
+}
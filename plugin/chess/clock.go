@@ -0,0 +1,188 @@
+package chess
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/notnil/chess"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+// 剩余时间低于这些值时提醒走子方
+var lowTimeWarnings = []time.Duration{time.Minute, 10 * time.Second}
+
+// chessClock 对局计时, 走子后为走子方加秒
+type chessClock struct {
+	base      time.Duration
+	increment time.Duration
+	whiteLeft time.Duration
+	blackLeft time.Duration
+	turnStart time.Time // 当前走子方开始计时的时间, 为零值表示尚未开始
+	warned    int       // 当前走子方已发送的提醒次数
+}
+
+// parseTimeControl 解析「分钟+加秒」格式的时限, 如 10+5
+func parseTimeControl(minutes, seconds string) (*chessClock, error) {
+	if minutes == "" {
+		return nil, nil
+	}
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	if m < 1 || m > 180 || s > 60 {
+		return nil, fmt.Errorf("时限「%s+%s」无效, 基础时间应在 1~180 分钟, 每步加秒不超过 60 秒。", minutes, seconds)
+	}
+	base := time.Duration(m) * time.Minute
+	return &chessClock{base: base, increment: time.Duration(s) * time.Second, whiteLeft: base, blackLeft: base}, nil
+}
+
+// name 时限的名称, 如 10+5
+func (c *chessClock) name() string {
+	return strconv.Itoa(int(c.base/time.Minute)) + "+" + strconv.Itoa(int(c.increment/time.Second))
+}
+
+// start 开始为走子方计时
+func (c *chessClock) start(now time.Time) {
+	c.turnStart = now
+	c.warned = 0
+}
+
+// remaining 获取某方的剩余时间, 走子方会扣除本步已用的时间
+func (c *chessClock) remaining(color, turn chess.Color, now time.Time) time.Duration {
+	left := c.whiteLeft
+	if color == chess.Black {
+		left = c.blackLeft
+	}
+	if color == turn && !c.turnStart.IsZero() {
+		left -= now.Sub(c.turnStart)
+	}
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// punch 走子方走完一步后按钟, 超时则返回 false
+func (c *chessClock) punch(turn chess.Color, now time.Time) bool {
+	left := c.remaining(turn, turn, now)
+	if left <= 0 {
+		return false
+	}
+	left += c.increment
+	if turn == chess.White {
+		c.whiteLeft = left
+	} else {
+		c.blackLeft = left
+	}
+	c.start(now)
+	return true
+}
+
+// String 双方剩余时间的文本内容
+func (c *chessClock) String(turn chess.Color, now time.Time) string {
+	return "时限 " + c.name() + " | 白方剩余 " + formatClock(c.remaining(chess.White, turn, now)) +
+		" | 黑方剩余 " + formatClock(c.remaining(chess.Black, turn, now))
+}
+
+func formatClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d", int(d/time.Minute), int(d%time.Minute/time.Second))
+}
+
+// canMate 判断一方是否还有将杀的子力, 只剩王或王加一个轻子时无法将杀
+func canMate(board *chess.Board, color chess.Color) bool {
+	minor := 0
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		p := board.Piece(sq)
+		if p == chess.NoPiece || p.Color() != color {
+			continue
+		}
+		switch p.Type() {
+		case chess.Pawn, chess.Rook, chess.Queen:
+			return true
+		case chess.Bishop, chess.Knight:
+			minor++
+		}
+	}
+	return minor >= 2
+}
+
+// flagFall 走子方超时, 对手无法将杀时判和, 否则判负
+func flagFall(room *chessRoom, groupCode int64) (message.Message, error) {
+	turn := room.chessGame.Position().Turn()
+	loser, winner, opponent := "白方", "黑方", chess.Black
+	if turn == chess.Black {
+		loser, winner, opponent = "黑方", "白方", chess.White
+	}
+	whiteScore, blackScore := 0.5, 0.5
+	var hint string
+	if canMate(room.chessGame.Position().Board(), opponent) {
+		room.chessGame.Resign(turn)
+		if turn == chess.White {
+			whiteScore, blackScore = 0.0, 1.0
+		} else {
+			whiteScore, blackScore = 1.0, 0.0
+		}
+		hint = loser + "超时, " + winner + "胜利。\n"
+	} else {
+		if err := room.chessGame.Draw(chess.DrawOffer); err != nil {
+			return nil, err
+		}
+		hint = loser + "超时, 但" + winner + "子力不足以将杀, 和棋。\n"
+	}
+	chessString := getChessString(*room)
+	eloString := ""
+	if len(room.chessGame.Moves()) > 4 {
+		// 若走子次数超过 4 认为是有效对局, 存入数据库
+		dbService := newDBService()
+		if err := dbService.createPGN(chessString, room.whitePlayer, room.blackPlayer, room.whiteName, room.blackName); err != nil {
+			return nil, err
+		}
+		var err error
+		eloString, err = getELOString(*room, whiteScore, blackScore)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return closeRoom(groupCode, room, message.Message{message.At(room.whitePlayer), message.At(room.blackPlayer),
+		message.Text("游戏结束, ", hint, eloString, chessString)}), nil
+}
+
+// tickClock 检查计时对局, 处理超时并提醒时间不足的玩家
+func tickClock(groupCode int64, room *chessRoom, now time.Time) *gameroom.Event {
+	c := room.clock
+	if c == nil || c.turnStart.IsZero() {
+		return nil
+	}
+	turn := room.chessGame.Position().Turn()
+	left := c.remaining(turn, turn, now)
+	if left <= 0 {
+		msg, err := flagFall(room, groupCode)
+		if err != nil {
+			msg = message.Message{message.Text("ERROR: ", err)}
+		}
+		return &gameroom.Event{Message: msg, Outcome: outcomeOf(room), End: true}
+	}
+	if c.warned >= len(lowTimeWarnings) || left > lowTimeWarnings[c.warned] {
+		return nil
+	}
+	for c.warned < len(lowTimeWarnings) && left <= lowTimeWarnings[c.warned] {
+		c.warned++
+	}
+	player := room.whitePlayer
+	if turn == chess.Black {
+		player = room.blackPlayer
+	}
+	return &gameroom.Event{Message: message.Message{message.At(player),
+		message.Text("你的剩余时间只有 ", formatClock(left), ", 请尽快走棋。")}}
+}
+
+// clockString 棋盘图片下方显示的剩余时间
+func clockString(room *chessRoom) string {
+	if room.clock == nil {
+		return ""
+	}
+	return "\n" + room.clock.String(room.chessGame.Position().Turn(), time.Now())
+}
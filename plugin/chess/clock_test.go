@@ -0,0 +1,51 @@
+package chess
+
+import (
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+func TestChessClock(t *testing.T) {
+	c, err := parseTimeControl("3", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	c.start(now)
+	now = now.Add(10 * time.Second)
+	if !c.punch(chess.White, now) {
+		t.Fatal("白方未超时却按钟失败")
+	}
+	if left := c.remaining(chess.White, chess.Black, now); left != 3*time.Minute-8*time.Second {
+		t.Fatalf("白方剩余 %v, want 2m52s", left)
+	}
+	now = now.Add(3*time.Minute + time.Second)
+	if left := c.remaining(chess.Black, chess.Black, now); left != 0 {
+		t.Fatalf("黑方剩余 %v, want 0", left)
+	}
+	if c.punch(chess.Black, now) {
+		t.Fatal("黑方已超时却按钟成功")
+	}
+	if _, err := parseTimeControl("0", "5"); err == nil {
+		t.Fatal("应拒绝无效的时限")
+	}
+}
+
+func TestCanMate(t *testing.T) {
+	tests := []struct {
+		fen  string
+		want bool
+	}{
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/4KN2 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/3BKN2 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", true},
+	}
+	for _, tt := range tests {
+		if got := canMate(positionOf(t, tt.fen).Board(), chess.White); got != tt.want {
+			t.Errorf("canMate(%s) = %v, want %v", tt.fen, got, tt.want)
+		}
+	}
+}
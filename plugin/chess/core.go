@@ -10,62 +10,60 @@ import (
 	"strings"
 	"time"
 
-	"github.com/FloatTech/floatbox/binary"
 	"github.com/FloatTech/floatbox/file"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/img/text"
-
-	"github.com/RomiChan/syncx"
 	"github.com/jinzhu/gorm"
 	resvg "github.com/kanrichan/resvg-go"
 	"github.com/notnil/chess"
 	cimage "github.com/notnil/chess/image"
 	"github.com/wdvxdr1123/ZeroBot/message"
-)
 
-const eloDefault = 500
-
-var (
-	chessRoomMap syncx.Map[int64, *chessRoom]
-	errNotExist  = errors.New("对局不存在, 发送「下棋」或「chess」可创建对局。")
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
 )
 
+var errNotExist = errors.New("对局不存在, 发送「下棋」或「chess」可创建对局。")
+
 type chessRoom struct {
-	chessGame    *chess.Game
-	whitePlayer  int64
-	whiteName    string
-	blackPlayer  int64
-	blackName    string
-	drawPlayer   int64
-	lastMoveTime int64
-	isBlindfold  bool
-	whiteErr     bool // 违例记录（盲棋用）
-	blackErr     bool
+	gameroom.Room
+	chessGame   *chess.Game
+	whitePlayer int64
+	whiteName   string
+	blackPlayer int64
+	blackName   string
+	drawPlayer  int64
+	isBlindfold bool
+	whiteErr    bool // 违例记录（盲棋用）
+	blackErr    bool
+	aiLevel     *difficulty // 人机对战难度, 非人机对局为 nil
+	aiColor     chess.Color // 机器人执子颜色
+	rated       bool        // 人机对局是否计入等级分
+	clock       *chessClock // 对局时限, 不限时为 nil
 }
 
 // game 下棋
-func game(groupCode, senderUin int64, senderName string) (message.Message, error) {
-	return createGame(false, groupCode, senderUin, senderName)
+func game(groupCode, senderUin int64, senderName string, selfID int64, clock *chessClock) (message.Message, error) {
+	return createGame(false, groupCode, senderUin, senderName, selfID, clock)
 }
 
 // blindfold 盲棋
-func blindfold(groupCode, senderUin int64, senderName string) (message.Message, error) {
-	return createGame(true, groupCode, senderUin, senderName)
+func blindfold(groupCode, senderUin int64, senderName string, selfID int64, clock *chessClock) (message.Message, error) {
+	return createGame(true, groupCode, senderUin, senderName, selfID, clock)
 }
 
 // abort 中断对局
 func abort(groupCode int64) (message.Message, error) {
-	if room, ok := chessRoomMap.Load(groupCode); ok {
+	if room, ok := chessRooms.Load(groupCode); ok {
 		return abortGame(*room, groupCode, "对局已被管理员中断, 游戏结束。")
 	}
 	return nil, errNotExist
 }
 
-// draw 和棋
-func draw(groupCode, senderUin int64) (msg message.Message, err error) {
+// draw 和棋, engineAccepted 为人机对局中机器人是否接受和棋
+func draw(groupCode, senderUin int64, engineAccepted bool) (msg message.Message, err error) {
 	msg = message.Message{message.At(senderUin)}
 	// 检查对局是否存在
-	room, ok := chessRoomMap.Load(groupCode)
+	room, ok := chessRooms.Load(groupCode)
 	if !ok {
 		return nil, errNotExist
 	}
@@ -74,10 +72,15 @@ func draw(groupCode, senderUin int64) (msg message.Message, err error) {
 		return
 	}
 	// 处理和棋逻辑
-	room.lastMoveTime = time.Now().Unix()
-	if room.drawPlayer == 0 {
+	room.Touch()
+	// 人机对局由机器人直接决定是否接受和棋
+	if room.aiLevel != nil && !engineAccepted {
+		msg = append(msg, message.Text("机器人拒绝了和棋, 请继续走棋。"))
+		return
+	}
+	if room.drawPlayer == 0 && room.aiLevel == nil {
 		room.drawPlayer = senderUin
-		chessRoomMap.Store(groupCode, room)
+		chessRooms.Store(groupCode, room)
 		msg = append(msg, message.Text("请求和棋, 发送「和棋」或「draw」接受和棋。走棋视为拒绝和棋。"))
 		return
 	}
@@ -103,7 +106,7 @@ func draw(groupCode, senderUin int64) (msg message.Message, err error) {
 		}
 	}
 	msg = append(msg, message.Text("接受和棋, 游戏结束。\n", eloString, chessString))
-	chessRoomMap.Delete(groupCode)
+	msg = closeRoom(groupCode, room, msg)
 	return
 }
 
@@ -111,7 +114,7 @@ func draw(groupCode, senderUin int64) (msg message.Message, err error) {
 func resign(groupCode, senderUin int64) (msg message.Message, err error) {
 	msg = message.Message{message.At(senderUin)}
 	// 检查对局是否存在
-	room, ok := chessRoomMap.Load(groupCode)
+	room, ok := chessRooms.Load(groupCode)
 	if !ok {
 		return nil, errNotExist
 	}
@@ -121,8 +124,7 @@ func resign(groupCode, senderUin int64) (msg message.Message, err error) {
 	}
 	// 如果对局未建立, 中断对局
 	if room.whitePlayer == 0 || room.blackPlayer == 0 {
-		chessRoomMap.Delete(groupCode)
-		msg = append(msg, message.Text("对局结束"))
+		msg = closeRoom(groupCode, room, append(msg, message.Text("对局结束")))
 		return
 	}
 	// 计算认输方
@@ -163,17 +165,17 @@ func resign(groupCode, senderUin int64) (msg message.Message, err error) {
 	if isAprilFoolsDay() {
 		msg = append(msg, message.Text("对手认输, 游戏结束, 你胜利了。\n", eloString, chessString))
 	}
-	chessRoomMap.Delete(groupCode)
+	msg = closeRoom(groupCode, room, msg)
 	return
 }
 
-// play 走棋
-func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err error) {
+// play 走棋, 人机对局轮到机器人时返回要思考的局面, 由 engineTurn 应着
+func play(groupCode, senderUin int64, moveStr string) (msg message.Message, s *engineSearch, err error) {
 	msg = message.Message{message.At(senderUin)}
 	// 检查对局是否存在
-	room, ok := chessRoomMap.Load(groupCode)
+	room, ok := chessRooms.Load(groupCode)
 	if !ok {
-		return nil, errNotExist
+		return nil, nil, errNotExist
 	}
 	// 不是对局中的玩家, 忽略消息
 	if (senderUin != room.whitePlayer) && (senderUin != room.blackPlayer) && !isAprilFoolsDay() {
@@ -189,7 +191,13 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 		msg = append(msg, message.Text("请等待对手走棋。"))
 		return
 	}
-	room.lastMoveTime = time.Now().Unix()
+	room.Touch()
+	// 限时对局检查走子方是否已超时
+	turn := room.chessGame.Position().Turn()
+	if room.clock != nil && room.clock.remaining(turn, turn, time.Now()) <= 0 {
+		msg, err = flagFall(room, groupCode)
+		return
+	}
 	// 走棋
 	if err = room.chessGame.MoveStr(moveStr); err != nil {
 		// 指令错误时检查
@@ -209,12 +217,12 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 		_flag := false
 		if (currentPlayerColor == chess.White) && !room.whiteErr {
 			room.whiteErr = true
-			chessRoomMap.Store(groupCode, room)
+			chessRooms.Store(groupCode, room)
 			_flag = true
 		}
 		if (currentPlayerColor == chess.Black) && !room.blackErr {
 			room.blackErr = true
-			chessRoomMap.Store(groupCode, room)
+			chessRooms.Store(groupCode, room)
 			_flag = true
 		}
 		if _flag {
@@ -225,27 +233,43 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 		room.chessGame.Resign(currentPlayerColor)
 		chessString := getChessString(*room)
 		msg = append(msg, message.Text("违规两次,游戏结束。\n", chessString))
-
-		chessRoomMap.Delete(groupCode)
+		msg = closeRoom(groupCode, room, msg)
 		return
 	}
+	if room.clock != nil {
+		room.clock.punch(turn, time.Now())
+	}
 	// 走子之后, 视为拒绝和棋
 	if room.drawPlayer != 0 {
 		room.drawPlayer = 0
-		chessRoomMap.Store(groupCode, room)
+		chessRooms.Store(groupCode, room)
+	}
+	// 人机对局由机器人应着
+	if room.aiLevel != nil && room.chessGame.Method() == chess.NoMethod {
+		return nil, room.newEngineSearch(), nil
 	}
+	msg, err = moveResult(msg, groupCode, room, "")
+	return
+}
+
+// moveResult 走子后的棋盘与对局结果, engineMove 为机器人刚走的着法
+func moveResult(msg message.Message, groupCode int64, room *chessRoom, engineMove string) (message.Message, error) {
+	var err error
 	// 生成棋盘图片
 	var boardImgEle message.Segment
 	if !room.isBlindfold {
 		boardImgEle, err = getBoardElement(groupCode)
 		if err != nil {
-			return
+			return nil, err
 		}
 	}
 	// 检查游戏是否结束
 	if room.chessGame.Method() != chess.NoMethod {
 		whiteScore, blackScore := 0.5, 0.5
 		var msgBuilder strings.Builder
+		if engineMove != "" {
+			msgBuilder.WriteString("机器人走了「" + engineMove + "」, ")
+		}
 		msgBuilder.WriteString("游戏结束, ")
 		switch room.chessGame.Method() {
 		case chess.FivefoldRepetition:
@@ -282,12 +306,12 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 			// 若走子次数超过 4 认为是有效对局, 存入数据库
 			dbService := newDBService()
 			if err = dbService.createPGN(chessString, room.whitePlayer, room.blackPlayer, room.whiteName, room.blackName); err != nil {
-				return
+				return nil, err
 			}
 			// 仅有效对局才会计算等级分
 			eloString, err = getELOString(*room, whiteScore, blackScore)
 			if err != nil {
-				return
+				return nil, err
 			}
 		}
 		msgBuilder.WriteString(eloString)
@@ -296,9 +320,8 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 		if !room.isBlindfold {
 			msg = append(msg, boardImgEle)
 		}
-
-		chessRoomMap.Delete(groupCode)
-		return
+		msg = closeRoom(groupCode, room, msg)
+		return msg, nil
 	}
 	// 提示玩家继续游戏
 	var currentPlayer int64
@@ -307,15 +330,21 @@ func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err
 	} else {
 		currentPlayer = room.blackPlayer
 	}
+	if engineMove != "" {
+		msg = message.Message{message.At(currentPlayer), message.Text("机器人走了「", engineMove, "」, 游戏继续。"), boardImgEle}
+		return msg, nil
+	}
 	msg = message.Message{message.At(currentPlayer), message.Text("对手已走子, 游戏继续。"), boardImgEle}
-	return
+	if room.clock != nil {
+		msg = append(msg, message.Text(clockString(room)))
+	}
+	return msg, nil
 }
 
 // rate 获取等级分
 func rate(senderUin int64, senderName string) (msg message.Message, err error) {
 	rate := 0
-	dbService := newDBService()
-	rate, err = dbService.getELORateByUin(senderUin)
+	rate, err = ratings.Get(senderUin)
 	if err != nil {
 		if err != gorm.ErrRecordNotFound {
 			err = errors.New("无法获取等级分信息。")
@@ -329,8 +358,7 @@ func rate(senderUin int64, senderName string) (msg message.Message, err error) {
 
 // cleanUserRate 清空用户等级分
 func cleanUserRate(senderUin int64) (msg message.Message, err error) {
-	dbService := newDBService()
-	err = dbService.cleanELOByUin(senderUin)
+	err = ratings.Reset(senderUin, 100)
 	if err != nil {
 		if err != gorm.ErrRecordNotFound {
 			err = errors.New("无法清空等级分。")
@@ -343,37 +371,34 @@ func cleanUserRate(senderUin int64) (msg message.Message, err error) {
 }
 
 // createGame 创建游戏
-func createGame(isBlindfold bool, groupCode, senderUin int64, senderName string) (msg message.Message, err error) {
-	room, ok := chessRoomMap.Load(groupCode)
+func createGame(isBlindfold bool, groupCode, senderUin int64, senderName string, selfID int64, clock *chessClock) (msg message.Message, err error) {
+	room, ok := chessRooms.Load(groupCode)
 	if !ok {
-		chessRoomMap.Store(groupCode, &chessRoom{
-			chessGame:    chess.NewGame(),
-			whitePlayer:  senderUin,
-			whiteName:    senderName,
-			blackPlayer:  0,
-			blackName:    "",
-			drawPlayer:   0,
-			lastMoveTime: time.Now().Unix(),
-			isBlindfold:  isBlindfold,
-			whiteErr:     false,
-			blackErr:     false,
+		chessRooms.Store(groupCode, &chessRoom{
+			Room: gameroom.Room{
+				SelfID:     selfID,
+				GroupID:    groupCode,
+				Players:    []gameroom.Player{{UID: senderUin, Name: senderName}},
+				LastAction: time.Now(),
+			},
+			chessGame:   chess.NewGame(),
+			whitePlayer: senderUin,
+			whiteName:   senderName,
+			isBlindfold: isBlindfold,
+			clock:       clock,
 		})
 		text := "已创建新的对局, 发送「下棋」或「chess」可加入对局。"
 		if isBlindfold {
 			text = "已创建新的盲棋对局, 发送「盲棋」或「blind」可加入对局。"
 		}
+		if clock != nil {
+			text += "\n本局时限 " + clock.name() + ", 双方各 " + strconv.Itoa(int(clock.base/time.Minute)) + " 分钟, 每步加 " + strconv.Itoa(int(clock.increment/time.Second)) + " 秒。"
+		}
 		msg = append(msg, message.Text(text))
 		return
 	}
 	msg = message.Message{message.At(senderUin)}
 	if room.blackPlayer != 0 {
-		// 检测对局是否已存在超过 6 小时
-		if (time.Now().Unix() - room.lastMoveTime) > 21600 {
-			msg, err = abortGame(*room, groupCode, "对局已存在超过 6 小时, 游戏结束。")
-			msg = append(msg, message.Text("\n\n已有对局已被中断, 如需创建新对局请重新发送指令。"))
-			msg = append(msg, message.At(senderUin))
-			return
-		}
 		// 对局在进行
 		msg = append(msg, message.Text("对局已在进行中, 无法创建或加入对局, 当前对局玩家为: "))
 		if room.whitePlayer != 0 {
@@ -397,9 +422,17 @@ func createGame(isBlindfold bool, groupCode, senderUin int64, senderName string)
 		msg = append(msg, message.Text("已创建普通对局, 请加入或等待普通对局结束之后创建盲棋对局。"))
 		return
 	}
+	if err = room.Join(gameroom.Player{UID: senderUin, Name: senderName}, 2); err != nil {
+		return
+	}
 	room.blackPlayer = senderUin
 	room.blackName = senderName
-	chessRoomMap.Store(groupCode, room)
+	room.Touch()
+	if room.clock != nil {
+		// 双方就位后开始为白方计时
+		room.clock.start(time.Now())
+	}
+	chessRooms.Store(groupCode, room)
 	var boardImgEle message.Segment
 	if !room.isBlindfold {
 		boardImgEle, err = getBoardElement(groupCode)
@@ -411,12 +444,14 @@ func createGame(isBlindfold bool, groupCode, senderUin int64, senderName string)
 	if !isBlindfold {
 		msg = append(msg, boardImgEle)
 	}
+	if room.clock != nil {
+		msg = append(msg, message.Text(clockString(room)))
+	}
 	return
 }
 
 // abortGame 中断游戏
 func abortGame(room chessRoom, groupCode int64, hint string) (message.Message, error) {
-	var msg message.Message
 	err := room.chessGame.Draw(chess.DrawOffer)
 	if err != nil {
 		return nil, err
@@ -429,8 +464,7 @@ func abortGame(room chessRoom, groupCode int64, hint string) (message.Message, e
 		}
 	}
 
-	chessRoomMap.Delete(groupCode)
-	msg = append(msg, message.Text(hint))
+	msg := message.Message{message.Text(hint)}
 	if room.whitePlayer != 0 {
 		msg = append(msg, message.At(room.whitePlayer))
 	}
@@ -438,94 +472,114 @@ func abortGame(room chessRoom, groupCode int64, hint string) (message.Message, e
 		msg = append(msg, message.At(room.blackPlayer))
 	}
 	msg = append(msg, message.Text("\n\n"+chessString))
-	return msg, nil
+	return closeRoom(groupCode, &room, msg), nil
 }
 
 // getBoardElement 获取棋盘图片的消息内容
 func getBoardElement(groupCode int64) (imgMsg message.Segment, err error) {
-	fontdata, err := file.GetLazyData(text.GNUUnifontFontFile, control.Md5File, true)
-	if err != nil {
-		return
-	}
-	room, ok := chessRoomMap.Load(groupCode)
+	room, ok := chessRooms.Load(groupCode)
 	if !ok {
 		return imgMsg, errNotExist
 	}
+	return positionElement(room.chessGame)
+}
+
+// positionElement 以走子方视角生成当前局面的图片, 并高亮上一步
+func positionElement(game *chess.Game) (imgMsg message.Segment, err error) {
 	// 获取高亮方块
 	highlightSquare := make([]chess.Square, 0, 2)
-	moves := room.chessGame.Moves()
+	moves := game.Moves()
 	if len(moves) != 0 {
 		lastMove := moves[len(moves)-1]
 		highlightSquare = append(highlightSquare, lastMove.S1())
 		highlightSquare = append(highlightSquare, lastMove.S2())
 	}
-	// 生成棋盘 svg 文件
-	buf := bytes.NewBuffer([]byte{})
-	fenStr := room.chessGame.FEN()
-	gameTurn := room.chessGame.Position().Turn()
-	pos := &chess.Position{}
-	if err = pos.UnmarshalText(binary.StringToBytes(fenStr)); err != nil {
+	r, err := newBoardRenderer()
+	if err != nil {
 		return
 	}
-	yellow := color.RGBA{255, 255, 0, 1}
-	mark := cimage.MarkSquares(yellow, highlightSquare...)
-	board := pos.Board()
-	fromBlack := cimage.Perspective(gameTurn)
-	err = cimage.SVG(buf, board, fromBlack, mark)
+	defer r.close()
+	out, err := r.render(game.Position(), game.Position().Turn(), 720, highlightSquare...)
 	if err != nil {
 		return
 	}
+	imgMsg = message.ImageBytes(out)
+	return imgMsg, nil
+}
 
-	worker, err := resvg.NewDefaultWorker(context.Background())
+// boardRenderer 将棋盘 svg 渲染为 png, 可连续渲染多张图片
+type boardRenderer struct {
+	worker *resvg.Worker
+	fontdb *resvg.FontDB
+}
+
+// newBoardRenderer 创建渲染器, 用完后需调用 close
+func newBoardRenderer() (*boardRenderer, error) {
+	fontdata, err := file.GetLazyData(text.GNUUnifontFontFile, control.Md5File, true)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer worker.Close()
-
-	tree, err := worker.NewTreeFromData(buf.Bytes(), &resvg.Options{
-		Dpi:        96,
-		FontFamily: "Unifont",
-		FontSize:   24.0,
-	})
+	worker, err := resvg.NewDefaultWorker(context.Background())
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer tree.Close()
-
 	fontdb, err := worker.NewFontDBDefault()
 	if err != nil {
-		return
+		worker.Close()
+		return nil, err
 	}
-	defer fontdb.Close()
+	if err = fontdb.LoadFontData(fontdata); err != nil {
+		fontdb.Close()
+		worker.Close()
+		return nil, err
+	}
+	return &boardRenderer{worker: worker, fontdb: fontdb}, nil
+}
 
-	err = fontdb.LoadFontData(fontdata)
-	if err != nil {
-		return
+func (r *boardRenderer) close() {
+	r.fontdb.Close()
+	r.worker.Close()
+}
+
+// render 以 perspective 一方的视角渲染局面, size 为图片边长
+func (r *boardRenderer) render(position *chess.Position, perspective chess.Color, size int, highlightSquare ...chess.Square) ([]byte, error) {
+	// 生成棋盘 svg 文件
+	buf := bytes.NewBuffer([]byte{})
+	yellow := color.RGBA{255, 255, 0, 1}
+	mark := cimage.MarkSquares(yellow, highlightSquare...)
+	board := position.Board()
+	fromBlack := cimage.Perspective(perspective)
+	if err := cimage.SVG(buf, board, fromBlack, mark); err != nil {
+		return nil, err
 	}
 
-	err = tree.ConvertText(fontdb)
+	tree, err := r.worker.NewTreeFromData(buf.Bytes(), &resvg.Options{
+		Dpi:        96,
+		FontFamily: "Unifont",
+		FontSize:   24.0,
+	})
 	if err != nil {
-		return
+		return nil, err
 	}
+	defer tree.Close()
 
-	pixmap, err := worker.NewPixmap(720, 720)
-	if err != nil {
-		return
+	if err = tree.ConvertText(r.fontdb); err != nil {
+		return nil, err
 	}
-	defer pixmap.Close()
 
-	err = tree.Render(resvg.TransformFromScale(2, 2), pixmap)
+	pixmap, err := r.worker.NewPixmap(uint32(size), uint32(size))
 	if err != nil {
-		return
+		return nil, err
 	}
+	defer pixmap.Close()
 
-	out, err := pixmap.EncodePNG()
-	if err != nil {
-		return
+	// svg 棋盘边长为 360
+	scale := float32(size) / 360
+	if err = tree.Render(resvg.TransformFromScale(scale, scale), pixmap); err != nil {
+		return nil, err
 	}
 
-	imgMsg = message.ImageBytes(out)
-	return imgMsg, nil
+	return pixmap.EncodePNG()
 }
 
 // getELOString 获得玩家等级分的文本内容
@@ -533,13 +587,12 @@ func getELOString(room chessRoom, whiteScore, blackScore float64) (string, error
 	if room.whitePlayer == 0 || room.blackPlayer == 0 {
 		return "", nil
 	}
+	if room.aiLevel != nil {
+		return getEngineELOString(room, whiteScore, blackScore)
+	}
 	var msgBuilder strings.Builder
 	msgBuilder.WriteString("玩家等级分: \n")
-	dbService := newDBService()
-	if err := updateELORate(room.whitePlayer, room.blackPlayer, room.whiteName, room.blackName, whiteScore, blackScore, dbService); err != nil {
-		return "", err
-	}
-	whiteRate, blackRate, err := getELORate(room.whitePlayer, room.blackPlayer, dbService)
+	whiteRate, blackRate, err := ratings.Settle(room.whitePlayer, room.blackPlayer, room.whiteName, room.blackName, whiteScore, blackScore)
 	if err != nil {
 		return "", err
 	}
@@ -556,8 +609,7 @@ func getELOString(room chessRoom, whiteScore, blackScore float64) (string, error
 
 // getRankingString 获取等级分排行榜的文本内容
 func getRanking() (message.Message, error) {
-	dbService := newDBService()
-	eloList, err := dbService.getHighestRateList()
+	eloList, err := ratings.Top(10)
 	if err != nil {
 		return nil, err
 	}
@@ -572,40 +624,6 @@ func getRanking() (message.Message, error) {
 	return message.Message{message.Text(msgBuilder.String())}, nil
 }
 
-// updateELORate 更新 elo 等级分
-// 当数据库中没有玩家的等级分信息时, 自动新建一条记录
-func updateELORate(whiteUin, blackUin int64, whiteName, blackName string, whiteScore, blackScore float64, dbService *chessDBService) error {
-	whiteRate, err := dbService.getELORateByUin(whiteUin)
-	if err != nil {
-		if err != gorm.ErrRecordNotFound {
-			return err
-		}
-		// create white elo
-		if err := dbService.createELO(whiteUin, whiteName, eloDefault); err != nil {
-			return err
-		}
-		whiteRate = eloDefault
-	}
-	blackRate, err := dbService.getELORateByUin(blackUin)
-	if err != nil {
-		if err != gorm.ErrRecordNotFound {
-			return err
-		}
-		// create black elo
-		if err := dbService.createELO(blackUin, blackName, eloDefault); err != nil {
-			return err
-		}
-		blackRate = eloDefault
-	}
-	whiteRate, blackRate = calculateNewRate(whiteRate, blackRate, whiteScore, blackScore)
-	// 更新白棋玩家的 ELO 等级分
-	if err := dbService.updateELOByUin(whiteUin, whiteName, whiteRate); err != nil {
-		return err
-	}
-	// 更新黑棋玩家的 ELO 等级分
-	return dbService.updateELOByUin(blackUin, blackName, blackRate)
-}
-
 // getChessString 获取 PGN 字符串
 func getChessString(room chessRoom) string {
 	game := room.chessGame
@@ -617,19 +635,6 @@ func getChessString(room chessRoom) string {
 	return dataString + whiteString + blackString + chessString
 }
 
-// getELORate 获取玩家的 ELO 等级分
-func getELORate(whiteUin, blackUin int64, dbService *chessDBService) (whiteRate int, blackRate int, err error) {
-	whiteRate, err = dbService.getELORateByUin(whiteUin)
-	if err != nil {
-		return
-	}
-	blackRate, err = dbService.getELORateByUin(blackUin)
-	if err != nil {
-		return
-	}
-	return
-}
-
 // isAprilFoolsDay 判断当前时间是否为愚人节期间
 func isAprilFoolsDay() bool {
 	now := time.Now()
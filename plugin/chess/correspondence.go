@@ -0,0 +1,411 @@
+package chess
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+	"github.com/notnil/chess"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// 通信对局状态
+const (
+	correspondencePending  = iota // 等待对方接受
+	correspondencePlaying         // 进行中
+	correspondenceFinished        // 已结束
+)
+
+// 每个玩家同时进行的通信对局数上限
+const maxCorrespondence = 10
+
+// correspondenceMu 双方可能在不同的群中同时操作同一对局
+var correspondenceMu sync.Mutex
+
+// correspondenceNotice 需要发送给对手的通知, groupCode 为 0 时私聊发送
+type correspondenceNotice struct {
+	uin       int64
+	groupCode int64
+	msg       message.Message
+}
+
+// getActiveCorrespondence 获取玩家参与的通信对局, id 为 0 时若只有一局进行中的对局则自动选择
+func getActiveCorrespondence(id uint, uin int64) (*correspondence, error) {
+	dbService := newDBService()
+	if id == 0 {
+		list, err := dbService.getCorrespondenceListByUin(uin)
+		if err != nil {
+			return nil, err
+		}
+		var playing []correspondence
+		for _, c := range list {
+			if c.Status == correspondencePlaying {
+				playing = append(playing, c)
+			}
+		}
+		switch len(playing) {
+		case 0:
+			return nil, errors.New("你没有进行中的通信对局。")
+		case 1:
+			return &playing[0], nil
+		default:
+			return nil, errors.New("你有多个进行中的通信对局, 请指定编号, 发送「我的通信对局」查看。")
+		}
+	}
+	c, err := dbService.getCorrespondence(id)
+	if err == gorm.ErrRecordNotFound || err == nil && c.WhiteUin != uin && c.BlackUin != uin {
+		return nil, errors.New("没有找到你参与的通信对局 #" + strconv.Itoa(int(id)) + "。")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == correspondenceFinished {
+		return nil, errors.New("通信对局 #" + strconv.Itoa(int(id)) + " 已结束。")
+	}
+	return &c, nil
+}
+
+// game 由保存的着法还原对局
+func (c *correspondence) game() (*chess.Game, error) {
+	game := chess.NewGame()
+	for _, uci := range strings.Fields(c.Moves) {
+		if err := playUCI(game, uci); err != nil {
+			return nil, err
+		}
+	}
+	return game, nil
+}
+
+// room 转换为对局房间, 以复用棋谱与等级分的逻辑
+func (c *correspondence) room(game *chess.Game) chessRoom {
+	return chessRoom{
+		chessGame:   game,
+		whitePlayer: c.WhiteUin,
+		whiteName:   c.WhiteName,
+		blackPlayer: c.BlackUin,
+		blackName:   c.BlackName,
+	}
+}
+
+// opponent 对手的 QQ 与通知位置
+func (c *correspondence) opponent(uin int64) (int64, int64) {
+	if uin == c.WhiteUin {
+		return c.BlackUin, c.BlackGroup
+	}
+	return c.WhiteUin, c.WhiteGroup
+}
+
+// touch 玩家在新的位置操作后, 之后的通知发送到该位置
+func (c *correspondence) touch(uin int64, name string, groupCode int64) {
+	if uin == c.WhiteUin {
+		c.WhiteName, c.WhiteGroup = name, groupCode
+	} else {
+		c.BlackName, c.BlackGroup = name, groupCode
+	}
+}
+
+func (c *correspondence) title() string {
+	return "通信对局 #" + strconv.Itoa(int(c.ID)) + " " + c.WhiteName + "(白) vs " + c.BlackName + "(黑)"
+}
+
+// challengeCorrespondence 向指定玩家发起通信对局
+func challengeCorrespondence(senderUin int64, senderName string, groupCode, opponentUin int64, opponentName string, playBlack bool) (message.Message, *correspondenceNotice, error) {
+	if senderUin == opponentUin {
+		return nil, nil, errors.New("不能向自己发起对局。")
+	}
+	correspondenceMu.Lock()
+	defer correspondenceMu.Unlock()
+	dbService := newDBService()
+	for _, uin := range []int64{senderUin, opponentUin} {
+		list, err := dbService.getCorrespondenceListByUin(uin)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(list) >= maxCorrespondence {
+			return nil, nil, errors.New("玩家 " + strconv.FormatInt(uin, 10) + " 的通信对局已达上限 " + strconv.Itoa(maxCorrespondence) + " 局。")
+		}
+	}
+	c := &correspondence{
+		WhiteUin:   senderUin,
+		WhiteName:  senderName,
+		BlackUin:   opponentUin,
+		BlackName:  opponentName,
+		Challenger: senderUin,
+		Status:     correspondencePending,
+	}
+	if playBlack {
+		c.WhiteUin, c.BlackUin = c.BlackUin, c.WhiteUin
+		c.WhiteName, c.BlackName = c.BlackName, c.WhiteName
+	}
+	// 对手的通知位置在其接受时确定, 在此之前私聊通知
+	c.touch(senderUin, senderName, groupCode)
+	if err := dbService.saveCorrespondence(c); err != nil {
+		return nil, nil, err
+	}
+	id := strconv.Itoa(int(c.ID))
+	reply := message.Message{message.Text("已发起", c.title(), ", 等待对方接受。")}
+	notice := &correspondenceNotice{uin: opponentUin, msg: message.Message{message.Text(
+		senderName, " 向你发起了", c.title(), "\n发送「接受通信对局 #", id, "」或「拒绝通信对局 #", id, "」回应, 可在任意群或私聊中操作。")}}
+	return reply, notice, nil
+}
+
+// answerCorrespondence 接受或拒绝通信对局
+func answerCorrespondence(id uint, senderUin int64, senderName string, groupCode int64, accept bool) (message.Message, *correspondenceNotice, error) {
+	correspondenceMu.Lock()
+	defer correspondenceMu.Unlock()
+	c, err := getActiveCorrespondence(id, senderUin)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Status != correspondencePending || c.Challenger == senderUin {
+		return nil, nil, errors.New("没有等待你接受的通信对局 #" + strconv.Itoa(int(id)) + "。")
+	}
+	opponentUin, opponentGroup := c.opponent(senderUin)
+	c.touch(senderUin, senderName, groupCode)
+	if !accept {
+		c.Status = correspondenceFinished
+		if err = newDBService().saveCorrespondence(c); err != nil {
+			return nil, nil, err
+		}
+		return message.Message{message.Text("已拒绝", c.title())},
+			&correspondenceNotice{uin: opponentUin, groupCode: opponentGroup, msg: message.Message{message.Text(senderName, " 拒绝了", c.title())}}, nil
+	}
+	c.Status = correspondencePlaying
+	if err = newDBService().saveCorrespondence(c); err != nil {
+		return nil, nil, err
+	}
+	game := chess.NewGame()
+	boardImgEle, err := positionElement(game)
+	if err != nil {
+		return nil, nil, err
+	}
+	hint := "已接受" + c.title() + ", 以「通信走棋 #" + strconv.Itoa(int(c.ID)) + " 着法」走棋。"
+	if senderUin == c.WhiteUin {
+		return message.Message{message.Text(hint, "\n请白方走棋。"), boardImgEle},
+			&correspondenceNotice{uin: opponentUin, groupCode: opponentGroup, msg: message.Message{message.Text(senderName, " 接受了", c.title(), ", 等待白方走棋。")}}, nil
+	}
+	return message.Message{message.Text(hint, "\n等待白方走棋。")},
+		&correspondenceNotice{uin: opponentUin, groupCode: opponentGroup, msg: message.Message{message.Text(senderName, " 接受了", c.title(), ", 请白方走棋。"), boardImgEle}}, nil
+}
+
+// moveCorrespondence 通信对局走棋, 并通知对手
+func moveCorrespondence(id uint, senderUin int64, senderName string, groupCode int64, moveStr string) (message.Message, *correspondenceNotice, error) {
+	correspondenceMu.Lock()
+	defer correspondenceMu.Unlock()
+	c, err := getActiveCorrespondence(id, senderUin)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Status != correspondencePlaying {
+		return nil, nil, errors.New("通信对局 #" + strconv.Itoa(int(c.ID)) + " 尚未开始。")
+	}
+	game, err := c.game()
+	if err != nil {
+		return nil, nil, err
+	}
+	turn := game.Position().Turn()
+	if (turn == chess.White) != (senderUin == c.WhiteUin) {
+		return nil, nil, errors.New("请等待对手走棋。")
+	}
+	move, err := decodeMove(game.Position(), moveStr)
+	if err != nil {
+		return nil, nil, errors.New("移动「" + moveStr + "」违规, 请检查, 格式请参考「代数记谱法」(Algebraic notation)。")
+	}
+	san := chess.AlgebraicNotation{}.Encode(game.Position(), move)
+	if err = game.Move(move); err != nil {
+		return nil, nil, err
+	}
+	c.touch(senderUin, senderName, groupCode)
+	c.Moves = strings.TrimSpace(c.Moves + " " + move.String())
+	// 走子之后, 视为拒绝和棋
+	c.DrawPlayer = 0
+	opponentUin, opponentGroup := c.opponent(senderUin)
+	boardImgEle, err := positionElement(game)
+	if err != nil {
+		return nil, nil, err
+	}
+	if game.Method() != chess.NoMethod {
+		whiteScore, blackScore := 0.5, 0.5
+		hint := "和棋。\n"
+		switch game.Outcome() {
+		case chess.WhiteWon:
+			whiteScore, blackScore, hint = 1.0, 0.0, "白方胜利。\n"
+		case chess.BlackWon:
+			whiteScore, blackScore, hint = 0.0, 1.0, "黑方胜利。\n"
+		}
+		result, err := finishCorrespondence(c, game, whiteScore, blackScore, c.title()+" 结束, "+hint)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, boardImgEle)
+		return result, &correspondenceNotice{uin: opponentUin, groupCode: opponentGroup, msg: result}, nil
+	}
+	if err = newDBService().saveCorrespondence(c); err != nil {
+		return nil, nil, err
+	}
+	reply := message.Message{message.Text("已走「", san, "」, 等待对手走棋。")}
+	notice := &correspondenceNotice{uin: opponentUin, groupCode: opponentGroup, msg: message.Message{
+		message.Text(c.title(), "\n", senderName, " 走了「", san, "」, 轮到你走棋了。"), boardImgEle}}
+	return reply, notice, nil
+}
+
+// resignCorrespondence 通信对局认输
+func resignCorrespondence(id uint, senderUin int64, senderName string, groupCode int64) (message.Message, *correspondenceNotice, error) {
+	correspondenceMu.Lock()
+	defer correspondenceMu.Unlock()
+	c, err := getActiveCorrespondence(id, senderUin)
+	if err != nil {
+		return nil, nil, err
+	}
+	opponentUin, opponentGroup := c.opponent(senderUin)
+	c.touch(senderUin, senderName, groupCode)
+	if c.Status == correspondencePending {
+		// 未开始的对局直接取消
+		c.Status = correspondenceFinished
+		if err = newDBService().saveCorrespondence(c); err != nil {
+			return nil, nil, err
+		}
+		msg := message.Message{message.Text(c.title(), " 已取消。")}
+		return msg, &correspondenceNotice{uin: opponentUin, groupCode: opponentGroup, msg: msg}, nil
+	}
+	game, err := c.game()
+	if err != nil {
+		return nil, nil, err
+	}
+	whiteScore, blackScore := 1.0, 0.0
+	resignColor := chess.Black
+	if senderUin == c.WhiteUin {
+		whiteScore, blackScore = 0.0, 1.0
+		resignColor = chess.White
+	}
+	game.Resign(resignColor)
+	msg, err := finishCorrespondence(c, game, whiteScore, blackScore, c.title()+" 结束, "+senderName+" 认输。\n")
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, &correspondenceNotice{uin: opponentUin, groupCode: opponentGroup, msg: msg}, nil
+}
+
+// drawCorrespondence 通信对局请求或接受和棋
+func drawCorrespondence(id uint, senderUin int64, senderName string, groupCode int64) (message.Message, *correspondenceNotice, error) {
+	correspondenceMu.Lock()
+	defer correspondenceMu.Unlock()
+	c, err := getActiveCorrespondence(id, senderUin)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Status != correspondencePlaying {
+		return nil, nil, errors.New("通信对局 #" + strconv.Itoa(int(c.ID)) + " 尚未开始。")
+	}
+	opponentUin, opponentGroup := c.opponent(senderUin)
+	c.touch(senderUin, senderName, groupCode)
+	if c.DrawPlayer == senderUin {
+		return nil, nil, errors.New("已请求和棋, 请等待对手回应。")
+	}
+	if c.DrawPlayer == 0 {
+		c.DrawPlayer = senderUin
+		if err = newDBService().saveCorrespondence(c); err != nil {
+			return nil, nil, err
+		}
+		id := strconv.Itoa(int(c.ID))
+		return message.Message{message.Text("已请求和棋, 等待对手回应。")},
+			&correspondenceNotice{uin: opponentUin, groupCode: opponentGroup, msg: message.Message{message.Text(
+				c.title(), "\n", senderName, " 请求和棋, 发送「通信和棋 #", id, "」接受和棋, 走棋视为拒绝和棋。")}}, nil
+	}
+	game, err := c.game()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = game.Draw(chess.DrawOffer); err != nil {
+		return nil, nil, err
+	}
+	msg, err := finishCorrespondence(c, game, 0.5, 0.5, c.title()+" 结束, 双方同意和棋。\n")
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, &correspondenceNotice{uin: opponentUin, groupCode: opponentGroup, msg: msg}, nil
+}
+
+// finishCorrespondence 结束通信对局, 保存棋谱并更新等级分
+func finishCorrespondence(c *correspondence, game *chess.Game, whiteScore, blackScore float64, hint string) (message.Message, error) {
+	c.Status = correspondenceFinished
+	dbService := newDBService()
+	if err := dbService.saveCorrespondence(c); err != nil {
+		return nil, err
+	}
+	room := c.room(game)
+	chessString := getChessString(room)
+	eloString := ""
+	if len(game.Moves()) > 4 {
+		// 若走子次数超过 4 认为是有效对局, 存入数据库
+		if err := dbService.createPGN(chessString, c.WhiteUin, c.BlackUin, c.WhiteName, c.BlackName); err != nil {
+			return nil, err
+		}
+		var err error
+		eloString, err = getELOString(room, whiteScore, blackScore)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return message.Message{message.Text(hint, eloString, chessString)}, nil
+}
+
+// showCorrespondence 查看通信对局的棋盘
+func showCorrespondence(id uint, senderUin int64) (message.Message, error) {
+	c, err := getActiveCorrespondence(id, senderUin)
+	if err != nil {
+		return nil, err
+	}
+	game, err := c.game()
+	if err != nil {
+		return nil, err
+	}
+	boardImgEle, err := positionElement(game)
+	if err != nil {
+		return nil, err
+	}
+	return message.Message{message.Text(c.title(), "\n", c.stateString(game, senderUin)), boardImgEle}, nil
+}
+
+// stateString 对局当前状态的描述
+func (c *correspondence) stateString(game *chess.Game, uin int64) string {
+	if c.Status == correspondencePending {
+		if c.Challenger == uin {
+			return "等待对方接受"
+		}
+		return "等待你接受"
+	}
+	if (game.Position().Turn() == chess.White) == (uin == c.WhiteUin) {
+		return "轮到你走棋"
+	}
+	return "等待对手走棋"
+}
+
+// listCorrespondence 我的通信对局
+func listCorrespondence(senderUin int64) (message.Message, error) {
+	list, err := newDBService().getCorrespondenceListByUin(senderUin)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("你没有未结束的通信对局, 发送「通信对局 @对手」或「通信对局 QQ号」发起对局。")
+	}
+	var msgBuilder strings.Builder
+	msgBuilder.WriteString("未结束的通信对局: \n\n")
+	for i := range list {
+		c := &list[i]
+		game, err := c.game()
+		if err != nil {
+			continue
+		}
+		msgBuilder.WriteString(c.title())
+		msgBuilder.WriteString(" 第 ")
+		msgBuilder.WriteString(strconv.Itoa(len(game.Moves())/2 + 1))
+		msgBuilder.WriteString(" 回合, ")
+		msgBuilder.WriteString(c.stateString(game, senderUin))
+		msgBuilder.WriteString("\n")
+	}
+	return message.Message{message.Text(msgBuilder.String())}, nil
+}
@@ -4,17 +4,15 @@ import (
 	"os"
 
 	"github.com/jinzhu/gorm"
-)
 
-var chessDB *gorm.DB
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom/elo"
+)
 
-// elo user elo info
-type elo struct {
-	gorm.Model
-	Uin  int64 `gorm:"unique_index"`
-	Name string
-	Rate int
-}
+var (
+	chessDB *gorm.DB
+	// ratings 对局等级分, 沿用原来的 elos 表
+	ratings *elo.Table
+)
 
 // pgn chess pgn info
 type pgn struct {
@@ -26,6 +24,39 @@ type pgn struct {
 	BlackName string
 }
 
+// puzzleRate user puzzle rating info
+type puzzleRate struct {
+	gorm.Model
+	Uin    int64 `gorm:"unique_index"`
+	Name   string
+	Rate   int
+	Solved int
+	Failed int
+}
+
+// puzzleAttempt 玩家做过的谜题, 每道谜题只在首次尝试时计分
+type puzzleAttempt struct {
+	gorm.Model
+	Uin      int64  `gorm:"index"`
+	PuzzleID string `gorm:"index"`
+	Solved   bool
+}
+
+// correspondence 通信对局, 双方可以在不同的群或私聊中随时走棋
+type correspondence struct {
+	gorm.Model
+	WhiteUin   int64 `gorm:"index"`
+	BlackUin   int64 `gorm:"index"`
+	WhiteName  string
+	BlackName  string
+	WhiteGroup int64 // 通知白方的群, 为 0 时私聊通知
+	BlackGroup int64
+	Challenger int64
+	Moves      string // 以空格分隔的 UCI 着法
+	Status     int
+	DrawPlayer int64
+}
+
 // chessDBService 数据库服务
 type chessDBService struct {
 	db *gorm.DB
@@ -52,49 +83,115 @@ func initDatabase(dbPath string) {
 	if err != nil {
 		panic(err)
 	}
-	chessDB.AutoMigrate(&elo{}, &pgn{})
+	chessDB.AutoMigrate(&pgn{}, &puzzleRate{}, &puzzleAttempt{}, &correspondence{})
+	ratings = elo.NewTable(chessDB, "elos")
 }
 
-// createELO 创建 ELO
-func (s *chessDBService) createELO(uin int64, name string, rate int) error {
-	return s.db.Create(&elo{
-		Uin:  uin,
-		Name: name,
-		Rate: rate,
+// createPGN 创建 PGN
+func (s *chessDBService) createPGN(data string, whiteUin int64, blackUin int64, whiteName string, blackName string) error {
+	return s.db.Create(&pgn{
+		Data:      data,
+		WhiteUin:  whiteUin,
+		BlackUin:  blackUin,
+		WhiteName: whiteName,
+		BlackName: blackName,
 	}).Error
 }
 
-// getELORateByUin 获取 ELO 等级分
-func (s *chessDBService) getELORateByUin(uin int64) (int, error) {
-	var elo elo
-	err := s.db.Select("rate").Where("uin = ?", uin).First(&elo).Error
-	return elo.Rate, err
+// getPGNByID 获取对局 PGN
+func (s *chessDBService) getPGNByID(id uint) (pgn, error) {
+	var p pgn
+	err := s.db.Where("id = ?", id).First(&p).Error
+	return p, err
+}
+
+// getPGNListByUin 分页获取玩家参与的对局, 按时间倒序
+func (s *chessDBService) getPGNListByUin(uin int64, offset, limit int) (pgnList []pgn, total int, err error) {
+	query := s.db.Model(&pgn{}).Where("white_uin = ? OR black_uin = ?", uin, uin)
+	if err = query.Count(&total).Error; err != nil {
+		return
+	}
+	err = query.Order("id desc").Offset(offset).Limit(limit).Find(&pgnList).Error
+	return
 }
 
-// getHighestRateList 获取最高的等级分列表
-func (s *chessDBService) getHighestRateList() ([]elo, error) {
-	var eloList []elo
-	err := s.db.Order("rate desc").Limit(10).Find(&eloList).Error
-	return eloList, err
+// getAllPGNByUin 获取玩家参与的全部对局
+func (s *chessDBService) getAllPGNByUin(uin int64) ([]pgn, error) {
+	var pgnList []pgn
+	err := s.db.Where("white_uin = ? OR black_uin = ?", uin, uin).Find(&pgnList).Error
+	return pgnList, err
 }
 
-// updateELOByUin 更新 ELO 等级分
-func (s *chessDBService) updateELOByUin(uin int64, name string, rate int) error {
-	return s.db.Model(&elo{}).Where("uin = ?", uin).Update("name", name).Update("rate", rate).Error
+// getPuzzleRate 获取谜题等级分, 没有记录时返回默认值
+func (s *chessDBService) getPuzzleRate(uin int64) (puzzleRate, error) {
+	r := puzzleRate{Uin: uin, Rate: puzzleRateDefault}
+	err := s.db.Where("uin = ?", uin).First(&r).Error
+	if err == gorm.ErrRecordNotFound {
+		return r, nil
+	}
+	return r, err
 }
 
-// cleanELOByUin 清空用户 ELO 等级分
-func (s *chessDBService) cleanELOByUin(uin int64) error {
-	return s.db.Model(&elo{}).Where("uin = ?", uin).Update("rate", 100).Error
+// hasAttemptedPuzzle 玩家是否做过该谜题
+func (s *chessDBService) hasAttemptedPuzzle(uin int64, puzzleID string) (bool, error) {
+	count := 0
+	err := s.db.Model(&puzzleAttempt{}).Where("uin = ? AND puzzle_id = ?", uin, puzzleID).Count(&count).Error
+	return count > 0, err
 }
 
-// createPGN 创建 PGN
-func (s *chessDBService) createPGN(data string, whiteUin int64, blackUin int64, whiteName string, blackName string) error {
-	return s.db.Create(&pgn{
-		Data:      data,
-		WhiteUin:  whiteUin,
-		BlackUin:  blackUin,
-		WhiteName: whiteName,
-		BlackName: blackName,
-	}).Error
+// recordPuzzle 记录谜题结果, 首次尝试时更新谜题等级分
+func (s *chessDBService) recordPuzzle(uin int64, name, puzzleID string, puzzleRating int, solved bool) (rate puzzleRate, rated bool, err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		txs := &chessDBService{db: tx}
+		attempted, err := txs.hasAttemptedPuzzle(uin, puzzleID)
+		if err != nil || attempted {
+			return err
+		}
+		rate, err = txs.getPuzzleRate(uin)
+		if err != nil {
+			return err
+		}
+		score := 0.0
+		if solved {
+			score = 1.0
+			rate.Solved++
+		} else {
+			rate.Failed++
+		}
+		rate.Rate, _ = elo.Calculate(rate.Rate, puzzleRating, score, 1-score)
+		rate.Name = name
+		if err = tx.Save(&rate).Error; err != nil {
+			return err
+		}
+		rated = true
+		return tx.Create(&puzzleAttempt{Uin: uin, PuzzleID: puzzleID, Solved: solved}).Error
+	})
+	return
+}
+
+// getPuzzleRanking 获取谜题等级分排行榜
+func (s *chessDBService) getPuzzleRanking() ([]puzzleRate, error) {
+	var rateList []puzzleRate
+	err := s.db.Order("rate desc").Limit(10).Find(&rateList).Error
+	return rateList, err
+}
+
+// getCorrespondence 获取通信对局
+func (s *chessDBService) getCorrespondence(id uint) (correspondence, error) {
+	var c correspondence
+	err := s.db.Where("id = ?", id).First(&c).Error
+	return c, err
+}
+
+// saveCorrespondence 创建或更新通信对局
+func (s *chessDBService) saveCorrespondence(c *correspondence) error {
+	return s.db.Save(c).Error
+}
+
+// getCorrespondenceListByUin 获取玩家未结束的通信对局
+func (s *chessDBService) getCorrespondenceListByUin(uin int64) ([]correspondence, error) {
+	var list []correspondence
+	err := s.db.Where("(white_uin = ? OR black_uin = ?) AND status < ?", uin, uin, correspondenceFinished).
+		Order("id").Find(&list).Error
+	return list, err
 }
@@ -0,0 +1,272 @@
+package chess
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	imgdraw "image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/FloatTech/gg/factory"
+	"github.com/jinzhu/gorm"
+	"github.com/notnil/chess"
+	"github.com/notnil/chess/opening"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	historyPageSize = 10
+	maxReplayFrames = 300 // 复盘动画的最大帧数, 避免生成过大的图片
+	replayFrameSize = 360
+)
+
+var (
+	ecoBook     *opening.BookECO
+	ecoBookOnce sync.Once
+)
+
+// getECOBook 开局库解析较慢, 首次使用时再加载
+func getECOBook() *opening.BookECO {
+	ecoBookOnce.Do(func() {
+		ecoBook = opening.NewBookECO()
+	})
+	return ecoBook
+}
+
+// parsePGN 解析数据库中保存的 PGN
+func parsePGN(data string) (*chess.Game, error) {
+	opt, err := chess.PGN(strings.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return chess.NewGame(opt), nil
+}
+
+// getPGN 按编号获取对局
+func getPGN(id uint) (pgn, error) {
+	p, err := newDBService().getPGNByID(id)
+	if err == gorm.ErrRecordNotFound {
+		err = errors.New("没有找到对局 #" + strconv.Itoa(int(id)) + "。")
+	}
+	return p, err
+}
+
+// resultOf 玩家在对局中的结果
+func resultOf(p *pgn, outcome chess.Outcome, uin int64) string {
+	switch {
+	case outcome == chess.Draw:
+		return "和"
+	case outcome == chess.WhiteWon && p.WhiteUin == uin, outcome == chess.BlackWon && p.BlackUin == uin:
+		return "胜"
+	case outcome == chess.WhiteWon, outcome == chess.BlackWon:
+		return "负"
+	default:
+		return "未完成"
+	}
+}
+
+// myGames 我的对局
+func myGames(uin int64, page int) (message.Message, error) {
+	if page < 1 {
+		page = 1
+	}
+	pgnList, total, err := newDBService().getPGNListByUin(uin, (page-1)*historyPageSize, historyPageSize)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, errors.New("没有查找到对局记录, 请至少进行一局对局。")
+	}
+	pages := (total + historyPageSize - 1) / historyPageSize
+	if page > pages {
+		return nil, errors.New("页码超出范围, 共 " + strconv.Itoa(pages) + " 页。")
+	}
+	var msgBuilder strings.Builder
+	msgBuilder.WriteString("对局记录: \n\n")
+	for i := range pgnList {
+		p := &pgnList[i]
+		msgBuilder.WriteString("#")
+		msgBuilder.WriteString(strconv.Itoa(int(p.ID)))
+		msgBuilder.WriteString(" ")
+		msgBuilder.WriteString(p.CreatedAt.Format("2006-01-02"))
+		msgBuilder.WriteString(" ")
+		msgBuilder.WriteString(p.WhiteName)
+		msgBuilder.WriteString(" vs ")
+		msgBuilder.WriteString(p.BlackName)
+		g, err := parsePGN(p.Data)
+		if err != nil {
+			msgBuilder.WriteString(" 棋谱损坏\n")
+			continue
+		}
+		if p.WhiteUin == uin {
+			msgBuilder.WriteString(" 执白")
+		} else {
+			msgBuilder.WriteString(" 执黑")
+		}
+		msgBuilder.WriteString(resultOf(p, g.Outcome(), uin))
+		msgBuilder.WriteString(" ")
+		msgBuilder.WriteString(strconv.Itoa((len(g.Moves()) + 1) / 2))
+		msgBuilder.WriteString(" 回合\n")
+	}
+	msgBuilder.WriteString("\n第 ")
+	msgBuilder.WriteString(strconv.Itoa(page))
+	msgBuilder.WriteString("/")
+	msgBuilder.WriteString(strconv.Itoa(pages))
+	msgBuilder.WriteString(" 页, 发送「复盘 #编号」查看对局动画, 「导出PGN #编号」获取棋谱文件。")
+	return message.Message{message.Text(msgBuilder.String())}, nil
+}
+
+// replay 复盘, 将对局渲染为 gif 动画
+func replay(id uint) (message.Message, error) {
+	p, err := getPGN(id)
+	if err != nil {
+		return nil, err
+	}
+	g, err := parsePGN(p.Data)
+	if err != nil {
+		return nil, err
+	}
+	positions := g.Positions()
+	if len(positions) > maxReplayFrames {
+		return nil, errors.New("对局过长, 无法生成复盘动画, 请发送「导出PGN #" + strconv.Itoa(int(id)) + "」获取棋谱。")
+	}
+	moves := g.Moves()
+	r, err := newBoardRenderer()
+	if err != nil {
+		return nil, err
+	}
+	defer r.close()
+	frames := make([]*image.NRGBA, 0, len(positions))
+	for i, pos := range positions {
+		var highlightSquare []chess.Square
+		if i > 0 {
+			highlightSquare = []chess.Square{moves[i-1].S1(), moves[i-1].S2()}
+		}
+		data, err := r.render(pos, chess.White, replayFrameSize, highlightSquare...)
+		if err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		frame := image.NewNRGBA(img.Bounds())
+		imgdraw.Draw(frame, frame.Bounds(), img, img.Bounds().Min, imgdraw.Src)
+		frames = append(frames, frame)
+	}
+	anim := factory.MergeGif(100, frames)
+	// 终局多停留一会
+	anim.Delay[len(anim.Delay)-1] = 500
+	var buf bytes.Buffer
+	if err = gif.EncodeAll(&buf, anim); err != nil {
+		return nil, err
+	}
+	header := "#" + strconv.Itoa(int(p.ID)) + " " + p.WhiteName + " vs " + p.BlackName + " " + string(g.Outcome())
+	return message.Message{message.Text(header), message.ImageBytes(buf.Bytes())}, nil
+}
+
+// exportPGN 将对局写入临时文件, 返回文件路径与文件名
+func exportPGN(id uint) (filePath, name, data string, err error) {
+	p, err := getPGN(id)
+	if err != nil {
+		return
+	}
+	name = "chess_" + strconv.Itoa(int(p.ID)) + ".pgn"
+	filePath = path.Join(tempFileDir, name)
+	err = os.WriteFile(filePath, []byte(p.Data), 0644)
+	return filePath, name, p.Data, err
+}
+
+// colorStats 某一执子颜色的战绩
+type colorStats struct {
+	games, wins, draws, losses int
+}
+
+func (s colorStats) String() string {
+	if s.games == 0 {
+		return "暂无对局"
+	}
+	return strconv.Itoa(s.games) + " 局 " + strconv.Itoa(s.wins) + " 胜 " + strconv.Itoa(s.draws) + " 和 " +
+		strconv.Itoa(s.losses) + " 负, 胜率 " + strconv.Itoa(s.wins*100/s.games) + "%"
+}
+
+// userStats 玩家的对局统计
+func userStats(uin int64, name string) (message.Message, error) {
+	pgnList, err := newDBService().getAllPGNByUin(uin)
+	if err != nil {
+		return nil, err
+	}
+	if len(pgnList) == 0 {
+		return nil, errors.New("没有查找到对局记录, 请至少进行一局对局。")
+	}
+	var white, black colorStats
+	openings := make(map[string]int)
+	titles := make(map[string]string)
+	book := getECOBook()
+	for i := range pgnList {
+		p := &pgnList[i]
+		g, err := parsePGN(p.Data)
+		if err != nil {
+			continue
+		}
+		s := &black
+		if p.WhiteUin == uin {
+			s = &white
+		}
+		s.games++
+		switch resultOf(p, g.Outcome(), uin) {
+		case "胜":
+			s.wins++
+		case "和":
+			s.draws++
+		case "负":
+			s.losses++
+		}
+		if o := book.Find(g.Moves()); o != nil {
+			openings[o.Code()]++
+			if _, ok := titles[o.Code()]; !ok {
+				titles[o.Code()] = o.Title()
+			}
+		}
+	}
+	codes := make([]string, 0, len(openings))
+	for code := range openings {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if openings[codes[i]] != openings[codes[j]] {
+			return openings[codes[i]] > openings[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	var msgBuilder strings.Builder
+	msgBuilder.WriteString("玩家「")
+	msgBuilder.WriteString(name)
+	msgBuilder.WriteString("」的对局统计: \n\n执白: ")
+	msgBuilder.WriteString(white.String())
+	msgBuilder.WriteString("\n执黑: ")
+	msgBuilder.WriteString(black.String())
+	msgBuilder.WriteString("\n\n常用开局: \n")
+	if len(codes) == 0 {
+		msgBuilder.WriteString("暂无\n")
+	}
+	for i, code := range codes {
+		if i >= 3 {
+			break
+		}
+		msgBuilder.WriteString(code)
+		msgBuilder.WriteString(" ")
+		msgBuilder.WriteString(titles[code])
+		msgBuilder.WriteString(": ")
+		msgBuilder.WriteString(strconv.Itoa(openings[code]))
+		msgBuilder.WriteString(" 局\n")
+	}
+	return message.Message{message.Text(msgBuilder.String())}, nil
+}
@@ -0,0 +1,361 @@
+package chess
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RomiChan/syncx"
+	"github.com/notnil/chess"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const (
+	puzzleRateDefault = 1500
+	puzzleFileName    = "puzzles.csv"
+	puzzleRateRange   = 200 // 随机谜题优先选择与玩家等级分相差不超过该值的题目
+)
+
+// puzzle 谜题, 采用 lichess 谜题库的格式
+// 第一步为对手的着法, 之后由玩家与对手交替走棋
+type puzzle struct {
+	id     string
+	fen    string
+	moves  []string // UCI 格式
+	rating int
+	themes []string
+}
+
+// puzzleSession 玩家正在做的谜题
+type puzzleSession struct {
+	puzzle    *puzzle
+	game      *chess.Game
+	groupCode int64
+	step      int // 玩家下一步应走的着法在 moves 中的下标
+}
+
+var (
+	puzzleSessions syncx.Map[int64, *puzzleSession]
+	puzzleMu       sync.Mutex
+	puzzleList     []*puzzle
+	puzzleModTime  time.Time
+)
+
+// loadPuzzles 读取数据目录中的谜题文件, 文件修改后自动重新加载
+func loadPuzzles() ([]*puzzle, error) {
+	puzzleMu.Lock()
+	defer puzzleMu.Unlock()
+	filePath := engine.DataFolder() + puzzleFileName
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, errors.New("没有找到谜题文件, 请将 lichess 格式的谜题库放置于 " + filePath)
+	}
+	if puzzleList != nil && info.ModTime().Equal(puzzleModTime) {
+		return puzzleList, nil
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	list, err := parsePuzzles(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("谜题文件中没有有效的谜题。")
+	}
+	puzzleList, puzzleModTime = list, info.ModTime()
+	return puzzleList, nil
+}
+
+// parsePuzzles 解析 PuzzleId,FEN,Moves,Rating,RatingDeviation,Popularity,NbPlays,Themes,... 格式的谜题
+// 只要求前四列, 无效的行会被跳过
+func parsePuzzles(r io.Reader) ([]*puzzle, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	var list []*puzzle
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return list, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 4 || record[0] == "PuzzleId" {
+			continue
+		}
+		moves := strings.Fields(record[2])
+		rating, err := strconv.Atoi(record[3])
+		if len(moves) < 2 || err != nil {
+			continue
+		}
+		if _, err := chess.FEN(record[1]); err != nil {
+			continue
+		}
+		p := &puzzle{id: record[0], fen: record[1], moves: moves, rating: rating}
+		if len(record) > 7 {
+			p.themes = strings.Fields(record[7])
+		}
+		list = append(list, p)
+	}
+}
+
+// dailyPuzzle 每日谜题, 同一天所有人的题目相同, 按 now 所在时区的日期换题
+func dailyPuzzle(list []*puzzle, now time.Time) *puzzle {
+	days := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Unix()/86400 + 1
+	return list[int(days%int64(len(list)))]
+}
+
+// randomPuzzle 随机选择与玩家等级分接近的谜题
+func randomPuzzle(list []*puzzle, rate int) *puzzle {
+	candidates := make([]*puzzle, 0, 64)
+	for _, p := range list {
+		if p.rating >= rate-puzzleRateRange && p.rating <= rate+puzzleRateRange {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = list
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// startPuzzle 开始做题
+func startPuzzle(groupCode, senderUin int64, daily bool) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	if room, ok := chessRooms.Load(groupCode); ok && (room.whitePlayer == senderUin || room.blackPlayer == senderUin) {
+		msg = append(msg, message.Text("你正在对局中, 请在对局结束后再做谜题。"))
+		return
+	}
+	// 未完成的谜题需先作答或放弃(计为失败), 不能换题
+	if session, ok := puzzleSessions.Load(senderUin); ok {
+		msg = append(msg, message.Text("你还有未完成的谜题 #", session.puzzle.id, ", 请先作答或发送「放弃谜题」。"))
+		return
+	}
+	list, err := loadPuzzles()
+	if err != nil {
+		return nil, err
+	}
+	var p *puzzle
+	if daily {
+		p = dailyPuzzle(list, time.Now())
+	} else {
+		rate, err := newDBService().getPuzzleRate(senderUin)
+		if err != nil {
+			return nil, err
+		}
+		p = randomPuzzle(list, rate.Rate)
+	}
+	opt, err := chess.FEN(p.fen)
+	if err != nil {
+		return nil, err
+	}
+	game := chess.NewGame(opt)
+	// 第一步为对手的着法
+	if err = playUCI(game, p.moves[0]); err != nil {
+		return nil, errors.New("谜题 " + p.id + " 的着法无效。")
+	}
+	session := &puzzleSession{puzzle: p, game: game, groupCode: groupCode, step: 1}
+	puzzleSessions.Store(senderUin, session)
+	boardImgEle, err := session.boardElement()
+	if err != nil {
+		return
+	}
+	var hint strings.Builder
+	if daily {
+		hint.WriteString("今日谜题")
+	} else {
+		hint.WriteString("谜题")
+	}
+	hint.WriteString(" #")
+	hint.WriteString(p.id)
+	hint.WriteString(" (难度 ")
+	hint.WriteString(strconv.Itoa(p.rating))
+	hint.WriteString(")\n")
+	if len(p.themes) > 0 {
+		hint.WriteString("主题: ")
+		hint.WriteString(strings.Join(p.themes, ", "))
+		hint.WriteString("\n")
+	}
+	hint.WriteString("对手走了「")
+	hint.WriteString(session.lastMoveString())
+	hint.WriteString("」, 轮到")
+	if game.Position().Turn() == chess.White {
+		hint.WriteString("白方")
+	} else {
+		hint.WriteString("黑方")
+	}
+	hint.WriteString("找出最佳着法, 以「!着法」作答, 发送「放弃谜题」查看答案。")
+	msg = append(msg, message.Text(hint.String()), boardImgEle)
+	return
+}
+
+// solvePuzzle 验证玩家的着法, 正确则走出对手的应着
+func solvePuzzle(senderUin int64, senderName, moveStr string) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	session, ok := puzzleSessions.Load(senderUin)
+	if !ok {
+		return nil, errors.New("没有正在进行的谜题, 发送「象棋谜题」开始做题。")
+	}
+	p := session.puzzle
+	pos := session.game.Position()
+	move, err := decodeMove(pos, moveStr)
+	if err != nil {
+		msg = append(msg, message.Text("移动「", moveStr, "」违规, 请检查, 格式请参考「代数记谱法」(Algebraic notation)。"))
+		return msg, nil
+	}
+	// 将杀的着法即使与答案不同也视为正确
+	correct := move.String() == p.moves[session.step] || pos.Update(move).Status() == chess.Checkmate
+	if !correct {
+		return finishPuzzle(senderUin, senderName, session, false, "「"+moveStr+"」不是最佳着法, 谜题失败。")
+	}
+	if err = session.game.Move(move); err != nil {
+		return nil, err
+	}
+	session.step++
+	if session.step >= len(p.moves) || session.game.Method() == chess.Checkmate {
+		return finishPuzzle(senderUin, senderName, session, true, "正确! 谜题完成。")
+	}
+	// 对手应着
+	if err = playUCI(session.game, p.moves[session.step]); err != nil {
+		puzzleSessions.Delete(senderUin)
+		return nil, errors.New("谜题 " + p.id + " 的着法无效。")
+	}
+	session.step++
+	boardImgEle, err := session.boardElement()
+	if err != nil {
+		return
+	}
+	msg = append(msg, message.Text("正确! 对手走了「", session.lastMoveString(), "」, 请继续。"), boardImgEle)
+	return
+}
+
+// giveUpPuzzle 放弃谜题并查看答案
+func giveUpPuzzle(senderUin int64, senderName string) (message.Message, error) {
+	session, ok := puzzleSessions.Load(senderUin)
+	if !ok {
+		return nil, errors.New("没有正在进行的谜题。")
+	}
+	return finishPuzzle(senderUin, senderName, session, false, "已放弃谜题。")
+}
+
+// finishPuzzle 结束谜题, 首次做该题时更新谜题等级分
+func finishPuzzle(senderUin int64, senderName string, session *puzzleSession, solved bool, hint string) (message.Message, error) {
+	puzzleSessions.Delete(senderUin)
+	p := session.puzzle
+	rate, rated, err := newDBService().recordPuzzle(senderUin, senderName, p.id, p.rating, solved)
+	if err != nil {
+		return nil, err
+	}
+	var msgBuilder strings.Builder
+	msgBuilder.WriteString(hint)
+	if !solved {
+		msgBuilder.WriteString("\n答案: ")
+		msgBuilder.WriteString(session.solutionString())
+	}
+	if rated {
+		msgBuilder.WriteString("\n谜题等级分: ")
+		msgBuilder.WriteString(strconv.Itoa(rate.Rate))
+	} else {
+		msgBuilder.WriteString("\n已做过该谜题, 不计等级分。")
+	}
+	return message.Message{message.At(senderUin), message.Text(msgBuilder.String())}, nil
+}
+
+// decodeMove 解析代数记谱法或 UCI 格式的着法
+func decodeMove(pos *chess.Position, moveStr string) (*chess.Move, error) {
+	if m, err := (chess.AlgebraicNotation{}).Decode(pos, moveStr); err == nil {
+		return m, nil
+	}
+	return decodeUCI(pos, moveStr)
+}
+
+// decodeUCI 解析 UCI 格式的着法, 返回带有吃子、将军等标记的合法着法
+func decodeUCI(pos *chess.Position, uci string) (*chess.Move, error) {
+	for _, valid := range pos.ValidMoves() {
+		if valid.String() == uci {
+			return valid, nil
+		}
+	}
+	return nil, errors.New("invalid move " + uci)
+}
+
+// playUCI 走出 UCI 格式的着法
+func playUCI(game *chess.Game, uci string) error {
+	m, err := decodeUCI(game.Position(), uci)
+	if err != nil {
+		return err
+	}
+	return game.Move(m)
+}
+
+// boardElement 以玩家视角显示当前局面
+func (session *puzzleSession) boardElement() (message.Segment, error) {
+	return positionElement(session.game)
+}
+
+// lastMoveString 对手上一步着法的代数记谱法表示
+func (session *puzzleSession) lastMoveString() string {
+	positions := session.game.Positions()
+	moves := session.game.Moves()
+	return chess.AlgebraicNotation{}.Encode(positions[len(positions)-2], moves[len(moves)-1])
+}
+
+// solutionString 从当前局面开始的剩余答案
+func (session *puzzleSession) solutionString() string {
+	game := session.game.Clone()
+	sans := make([]string, 0, len(session.puzzle.moves)-session.step)
+	for _, uci := range session.puzzle.moves[session.step:] {
+		pos := game.Position()
+		m, err := decodeUCI(pos, uci)
+		if err != nil {
+			sans = append(sans, uci)
+			continue
+		}
+		sans = append(sans, chess.AlgebraicNotation{}.Encode(pos, m))
+		if err = game.Move(m); err != nil {
+			break
+		}
+	}
+	return strings.Join(sans, " ")
+}
+
+// getPuzzleRanking 谜题等级分排行榜
+func getPuzzleRanking() (message.Message, error) {
+	rateList, err := newDBService().getPuzzleRanking()
+	if err != nil {
+		return nil, err
+	}
+	var msgBuilder strings.Builder
+	msgBuilder.WriteString("当前谜题等级分排行榜: \n\n")
+	for _, r := range rateList {
+		msgBuilder.WriteString(r.Name)
+		msgBuilder.WriteString(": ")
+		msgBuilder.WriteString(strconv.Itoa(r.Rate))
+		msgBuilder.WriteString(" (")
+		msgBuilder.WriteString(strconv.Itoa(r.Solved))
+		msgBuilder.WriteString("/")
+		msgBuilder.WriteString(strconv.Itoa(r.Solved + r.Failed))
+		msgBuilder.WriteString(")\n")
+	}
+	return message.Message{message.Text(msgBuilder.String())}, nil
+}
+
+// puzzleRating 查看自己的谜题等级分
+func puzzleRating(senderUin int64, senderName string) (message.Message, error) {
+	r, err := newDBService().getPuzzleRate(senderUin)
+	if err != nil {
+		return nil, err
+	}
+	return message.Message{message.Text("玩家「", senderName, "」目前的谜题等级分: ", r.Rate,
+		", 已解出 ", r.Solved, " 题, 失败 ", r.Failed, " 题")}, nil
+}
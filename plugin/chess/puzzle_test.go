@@ -0,0 +1,79 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+const testPuzzles = `PuzzleId,FEN,Moves,Rating,RatingDeviation,Popularity,NbPlays,Themes,GameUrl,OpeningTags
+00008,r6k/pp2r2p/4Rp1Q/3p4/8/1N1P2R1/PqP2bPP/7K b - - 0 24,f2g3 e6e7 b2b1 b3c1 b1c1 h6c1,1913,75,94,6230,crushing hangingPiece long middlegame,https://lichess.org/787zsVup/black#47,
+broken,not a fen,e2e4 e7e5,1500,,,,,,
+0000D,5rk1/1p3ppp/pq3b2/8/8/1P1Q1N2/P4PPP/3R2K1 w - - 2 27,d3d6 f8d8 d6d8 f6d8,1517,73,97,22985,advantage endgame short,https://lichess.org/F8M8OS71#53,
+`
+
+func TestParsePuzzles(t *testing.T) {
+	list, err := parsePuzzles(strings.NewReader(testPuzzles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("解析出 %d 道谜题, want 2", len(list))
+	}
+	p := list[0]
+	if p.id != "00008" || p.rating != 1913 || len(p.moves) != 6 || len(p.themes) != 4 {
+		t.Fatalf("谜题解析错误: %+v", p)
+	}
+}
+
+func TestPuzzleSolution(t *testing.T) {
+	list, err := parsePuzzles(strings.NewReader(testPuzzles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := list[0]
+	opt, err := chess.FEN(p.fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := chess.NewGame(opt)
+	if err = playUCI(game, p.moves[0]); err != nil {
+		t.Fatal(err)
+	}
+	session := &puzzleSession{puzzle: p, game: game, step: 1}
+	if got := session.lastMoveString(); got != "Bxg3" {
+		t.Fatalf("lastMoveString() = %s, want Bxg3", got)
+	}
+	if got := session.solutionString(); got != "Rxe7 Qb1+ Nc1 Qxc1+ Qxc1" {
+		t.Fatalf("solutionString() = %s", got)
+	}
+	// 代数记谱法与 UCI 格式均可作答
+	for _, s := range []string{"Rxe7", "e6e7"} {
+		m, err := decodeMove(game.Position(), s)
+		if err != nil || m.String() != p.moves[1] {
+			t.Fatalf("decodeMove(%s) = %v, %v", s, m, err)
+		}
+	}
+	if _, err := decodeMove(game.Position(), "e6e9"); err == nil {
+		t.Fatal("应拒绝无效的着法")
+	}
+}
+
+func TestDailyPuzzle(t *testing.T) {
+	list, err := parsePuzzles(strings.NewReader(testPuzzles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 按当地日期换题, 东八区的凌晨与深夜是同一天
+	cst := time.FixedZone("CST", 8*3600)
+	morning := time.Date(2026, 3, 1, 0, 30, 0, 0, cst)
+	night := time.Date(2026, 3, 1, 23, 30, 0, 0, cst)
+	if dailyPuzzle(list, morning) != dailyPuzzle(list, night) {
+		t.Fatal("同一天的每日谜题不同")
+	}
+	if dailyPuzzle(list, night) == dailyPuzzle(list, night.Add(time.Hour)) {
+		t.Fatal("次日的每日谜题相同")
+	}
+}
@@ -0,0 +1,210 @@
+package chess
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/notnil/chess"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+// roomTimeout 无人走棋多久后中断对局
+const roomTimeout = 6 * time.Hour
+
+// chessRooms 各群正在进行的对局, 重启后恢复
+var chessRooms *gameroom.Manager[*chessRoom]
+
+func newRoomManager() *gameroom.Manager[*chessRoom] {
+	return gameroom.New(gameroom.Options[*chessRoom]{
+		Name:    "chess",
+		Brief:   "国际象棋",
+		Timeout: roomTimeout,
+		OnTimeout: func(groupCode int64, room *chessRoom) *gameroom.Event {
+			msg, err := abortGame(*room, groupCode, "对局已超过 6 小时无人走棋, 游戏结束。")
+			if err != nil {
+				msg = message.Message{message.Text("ERROR: ", err)}
+			}
+			return &gameroom.Event{Message: msg}
+		},
+		OnTick: tickClock,
+		New: func() *chessRoom {
+			return &chessRoom{}
+		},
+	})
+}
+
+// savedRoom 对局的持久化内容, 着法以 UCI 格式保存
+type savedRoom struct {
+	gameroom.Room
+	Moves       string      `json:"moves"`
+	WhitePlayer int64       `json:"white_player"`
+	WhiteName   string      `json:"white_name"`
+	BlackPlayer int64       `json:"black_player"`
+	BlackName   string      `json:"black_name"`
+	DrawPlayer  int64       `json:"draw_player"`
+	IsBlindfold bool        `json:"is_blindfold"`
+	WhiteErr    bool        `json:"white_err"`
+	BlackErr    bool        `json:"black_err"`
+	AILevel     string      `json:"ai_level,omitempty"`
+	AIColor     chess.Color `json:"ai_color"`
+	Rated       bool        `json:"rated"`
+	Clock       *savedClock `json:"clock,omitempty"`
+}
+
+// savedClock 对局计时的持久化内容, 不含走子方本步已用的时间, 恢复后重新开始为走子方计时
+type savedClock struct {
+	Base      time.Duration `json:"base"`
+	Increment time.Duration `json:"increment"`
+	WhiteLeft time.Duration `json:"white_left"`
+	BlackLeft time.Duration `json:"black_left"`
+	Started   bool          `json:"started"`
+}
+
+// MarshalJSON 保存对局
+func (room *chessRoom) MarshalJSON() ([]byte, error) {
+	moves := make([]string, 0, len(room.chessGame.Moves()))
+	for _, m := range room.chessGame.Moves() {
+		moves = append(moves, m.String())
+	}
+	s := savedRoom{
+		Room:        room.Room,
+		Moves:       strings.Join(moves, " "),
+		WhitePlayer: room.whitePlayer,
+		WhiteName:   room.whiteName,
+		BlackPlayer: room.blackPlayer,
+		BlackName:   room.blackName,
+		DrawPlayer:  room.drawPlayer,
+		IsBlindfold: room.isBlindfold,
+		WhiteErr:    room.whiteErr,
+		BlackErr:    room.blackErr,
+		AIColor:     room.aiColor,
+		Rated:       room.rated,
+	}
+	if room.aiLevel != nil {
+		s.AILevel = room.aiLevel.name
+	}
+	if c := room.clock; c != nil {
+		s.Clock = &savedClock{
+			Base:      c.base,
+			Increment: c.increment,
+			WhiteLeft: c.whiteLeft,
+			BlackLeft: c.blackLeft,
+			Started:   !c.turnStart.IsZero(),
+		}
+	}
+	return json.Marshal(&s)
+}
+
+// UnmarshalJSON 恢复对局
+func (room *chessRoom) UnmarshalJSON(data []byte) error {
+	var s savedRoom
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	game := chess.NewGame()
+	for _, uci := range strings.Fields(s.Moves) {
+		if err := playUCI(game, uci); err != nil {
+			return err
+		}
+	}
+	*room = chessRoom{
+		Room:        s.Room,
+		chessGame:   game,
+		whitePlayer: s.WhitePlayer,
+		whiteName:   s.WhiteName,
+		blackPlayer: s.BlackPlayer,
+		blackName:   s.BlackName,
+		drawPlayer:  s.DrawPlayer,
+		isBlindfold: s.IsBlindfold,
+		whiteErr:    s.WhiteErr,
+		blackErr:    s.BlackErr,
+		aiColor:     s.AIColor,
+		rated:       s.Rated,
+	}
+	if s.AILevel != "" {
+		room.aiLevel = difficultyOf(s.AILevel)
+	}
+	if c := s.Clock; c != nil {
+		room.clock = &chessClock{base: c.Base, increment: c.Increment, whiteLeft: c.WhiteLeft, blackLeft: c.BlackLeft}
+		if c.Started {
+			room.clock.start(time.Now())
+		}
+	}
+	return nil
+}
+
+// outcomeOf 有效对局结束后的胜者, 人机对局与和棋没有胜者
+func outcomeOf(room *chessRoom) *gameroom.Outcome {
+	if room == nil || room.aiLevel != nil || len(room.chessGame.Moves()) <= 4 {
+		return nil
+	}
+	var o gameroom.Outcome
+	switch room.chessGame.Outcome() {
+	case chess.WhiteWon:
+		o = gameroom.Win(room.whitePlayer)
+	case chess.BlackWon:
+		o = gameroom.Win(room.blackPlayer)
+	default:
+		return nil
+	}
+	return &o
+}
+
+// reportResult 对局结束后为胜者增加群等级经验与钱包奖励
+func reportResult(ctx *zero.Ctx, room *chessRoom) {
+	if o := outcomeOf(room); o != nil {
+		chessRooms.Report(ctx, ctx.Event.GroupID, *o)
+	}
+}
+
+// closeRoom 删除已结束的对局, 并通知观战者
+func closeRoom(groupCode int64, room *chessRoom, msg message.Message) message.Message {
+	chessRooms.Delete(groupCode)
+	return append(msg, room.Audience()...)
+}
+
+// watch 观战, 对局结束时会通知观战者
+func watch(groupCode, senderUin int64) (msg message.Message, err error) {
+	room, ok := chessRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	msg = message.Message{message.At(senderUin)}
+	if !room.Watch(senderUin) {
+		msg = append(msg, message.Text("你已经在对局或观战中了。"))
+		return
+	}
+	if room.blackPlayer == 0 {
+		msg = append(msg, message.Text("开始观战, 对局尚未开始, 对局结束时会通知你。"))
+		return
+	}
+	msg = append(msg, message.Text("开始观战, 对局结束时会通知你。当前对局: ", room.whiteName, "(白) vs ", room.blackName, "(黑)"))
+	if !room.isBlindfold {
+		var boardImgEle message.Segment
+		boardImgEle, err = positionElement(room.chessGame)
+		if err != nil {
+			return
+		}
+		msg = append(msg, boardImgEle)
+	}
+	if room.clock != nil {
+		msg = append(msg, message.Text(clockString(room)))
+	}
+	return
+}
+
+// unwatch 取消观战
+func unwatch(groupCode, senderUin int64) (message.Message, error) {
+	room, ok := chessRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if !room.Unwatch(senderUin) {
+		return message.Message{message.At(senderUin), message.Text("你没有在观战。")}, nil
+	}
+	return message.Message{message.At(senderUin), message.Text("已取消观战。")}, nil
+}
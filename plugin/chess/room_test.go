@@ -0,0 +1,56 @@
+package chess
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+func TestChessRoomJSON(t *testing.T) {
+	clock, err := parseTimeControl("5", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.start(time.Now())
+	room := &chessRoom{
+		Room:        gameroom.Room{SelfID: 1, GroupID: 2, Spectators: []int64{5}},
+		chessGame:   chess.NewGame(),
+		whitePlayer: 3,
+		whiteName:   "白",
+		blackPlayer: 1,
+		blackName:   engineName(difficultyOf("困难")),
+		whiteErr:    true,
+		aiLevel:     difficultyOf("困难"),
+		aiColor:     chess.Black,
+		clock:       clock,
+	}
+	for _, m := range []string{"e4", "e5", "Nf3", "Nc6", "Bc4", "Bc5", "O-O"} {
+		if err := room.chessGame.MoveStr(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := json.Marshal(room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &chessRoom{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restored.chessGame.Position().String(), room.chessGame.Position().String(); got != want {
+		t.Fatalf("局面 %s, want %s", got, want)
+	}
+	if restored.aiLevel == nil || restored.aiLevel.name != "困难" || restored.aiColor != chess.Black {
+		t.Fatalf("人机设置未恢复: %+v", restored.aiLevel)
+	}
+	if !restored.whiteErr || restored.whiteName != "白" || restored.GroupID != 2 || len(restored.Spectators) != 1 {
+		t.Fatalf("对局信息未恢复: %+v", restored)
+	}
+	if restored.clock == nil || restored.clock.base != 5*time.Minute || restored.clock.turnStart.IsZero() {
+		t.Fatalf("计时未恢复: %+v", restored.clock)
+	}
+}
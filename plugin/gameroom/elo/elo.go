@@ -0,0 +1,121 @@
+// Package elo 棋类游戏共用的 ELO 等级分计算与等级分表
+package elo
+
+import (
+	"math"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Default 新玩家的等级分
+const Default = 500
+
+// Rating 玩家的等级分
+type Rating struct {
+	gorm.Model
+	Uin  int64 `gorm:"unique_index"`
+	Name string
+	Rate int
+}
+
+// Table 保存在数据库中指定表的等级分
+type Table struct {
+	db   *gorm.DB
+	name string
+}
+
+// NewTable 在 db 中以 name 为表名保存等级分, 表不存在时自动创建
+func NewTable(db *gorm.DB, name string) *Table {
+	db.Table(name).AutoMigrate(&Rating{})
+	return &Table{db: db, name: name}
+}
+
+// Create 新建玩家的等级分
+func (t *Table) Create(uin int64, name string, rate int) error {
+	return t.db.Table(t.name).Create(&Rating{
+		Uin:  uin,
+		Name: name,
+		Rate: rate,
+	}).Error
+}
+
+// Get 获取玩家的等级分, 没有记录时返回 gorm.ErrRecordNotFound
+func (t *Table) Get(uin int64) (int, error) {
+	var r Rating
+	err := t.db.Table(t.name).Select("rate").Where("uin = ?", uin).First(&r).Error
+	return r.Rate, err
+}
+
+// GetOrCreate 获取玩家的等级分, 没有记录时以 Default 新建一条
+func (t *Table) GetOrCreate(uin int64, name string) (int, error) {
+	rate, err := t.Get(uin)
+	if err == gorm.ErrRecordNotFound {
+		return Default, t.Create(uin, name, Default)
+	}
+	return rate, err
+}
+
+// Update 更新玩家的名字与等级分
+func (t *Table) Update(uin int64, name string, rate int) error {
+	return t.db.Table(t.name).Where("uin = ?", uin).Update("name", name).Update("rate", rate).Error
+}
+
+// Reset 把玩家的等级分重置为 rate
+func (t *Table) Reset(uin int64, rate int) error {
+	return t.db.Table(t.name).Where("uin = ?", uin).Update("rate", rate).Error
+}
+
+// Top 获取等级分最高的 n 名玩家
+func (t *Table) Top(n int) ([]Rating, error) {
+	var list []Rating
+	err := t.db.Table(t.name).Order("rate desc").Limit(n).Find(&list).Error
+	return list, err
+}
+
+// Settle 按一局的得分更新双方的等级分, 没有记录的玩家自动新建, 返回双方新的等级分
+func (t *Table) Settle(uinA, uinB int64, nameA, nameB string, scoreA, scoreB float64) (rateA, rateB int, err error) {
+	if rateA, err = t.GetOrCreate(uinA, nameA); err != nil {
+		return
+	}
+	if rateB, err = t.GetOrCreate(uinB, nameB); err != nil {
+		return
+	}
+	rateA, rateB = Calculate(rateA, rateB, scoreA, scoreB)
+	if err = t.Update(uinA, nameA, rateA); err != nil {
+		return
+	}
+	err = t.Update(uinB, nameB, rateB)
+	return
+}
+
+// Calculate 按双方的得分计算新的等级分
+func Calculate(rateA, rateB int, scoreA, scoreB float64) (int, int) {
+	k := getKFactor(rateA, rateB)
+	exceptionA := calculateException(rateA, rateB)
+	exceptionB := calculateException(rateB, rateA)
+	rateA = calculateRate(rateA, scoreA, exceptionA, k)
+	rateB = calculateRate(rateB, scoreB, exceptionB, k)
+	return rateA, rateB
+}
+
+func calculateException(rate int, opponentRate int) float64 {
+	return 1.0 / (1.0 + math.Pow(10.0, float64(opponentRate-rate)/400.0))
+}
+
+func calculateRate(rate int, score float64, exception float64, k int) int {
+	newRate := int(math.Round(float64(rate) + float64(k)*(score-exception)))
+	if newRate < 1 {
+		newRate = 1
+	}
+	return newRate
+}
+
+func getKFactor(rateA, rateB int) int {
+	if rateA > 2400 && rateB > 2400 {
+		return 16
+	}
+	if rateA > 2100 && rateB > 2100 {
+		return 24
+	}
+	return 32
+}
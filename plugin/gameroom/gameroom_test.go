@@ -0,0 +1,150 @@
+package gameroom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoomTurn(t *testing.T) {
+	r := Room{Players: []Player{{UID: 1}}}
+	if err := r.Join(Player{UID: 2}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Join(Player{UID: 2}, 3); err != ErrJoined {
+		t.Fatalf("重复加入: %v", err)
+	}
+	if err := r.Join(Player{UID: 3}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Join(Player{UID: 4}, 3); err != ErrFull {
+		t.Fatalf("人满加入: %v", err)
+	}
+	if p := r.Next(); p.UID != 2 {
+		t.Fatalf("下一位是 %d, 应为 2", p.UID)
+	}
+	// 轮到的玩家离开, 由下一位行动
+	r.Leave(2)
+	if p := r.Current(); p.UID != 3 {
+		t.Fatalf("当前是 %d, 应为 3", p.UID)
+	}
+	// 之前的玩家离开, 不影响当前玩家
+	r.Leave(1)
+	if p := r.Current(); p.UID != 3 {
+		t.Fatalf("当前是 %d, 应为 3", p.UID)
+	}
+	r.Leave(3)
+	if p := r.Current(); p.UID != 0 || r.Turn != 0 {
+		t.Fatalf("空房间当前是 %d, 下标 %d", p.UID, r.Turn)
+	}
+}
+
+func TestRoomWatch(t *testing.T) {
+	r := Room{Players: []Player{{UID: 1}}}
+	if r.Watch(1) {
+		t.Fatal("玩家不应观战")
+	}
+	if !r.Watch(2) || r.Watch(2) {
+		t.Fatal("重复观战")
+	}
+	if len(r.Audience()) != 1 {
+		t.Fatalf("观战者 %v", r.Spectators)
+	}
+	// 观战者加入对局后不再观战
+	if err := r.Join(Player{UID: 2}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Spectators) != 0 {
+		t.Fatalf("观战者 %v", r.Spectators)
+	}
+}
+
+type testRoom struct {
+	Room
+}
+
+func TestManagerTimeout(t *testing.T) {
+	var warned, timeout int
+	m := &Manager[*testRoom]{
+		opts: Options[*testRoom]{
+			Timeout: time.Minute,
+			Warning: 10 * time.Second,
+			OnWarn: func(int64, *testRoom) *Event {
+				warned++
+				return &Event{}
+			},
+			OnTimeout: func(int64, *testRoom) *Event {
+				timeout++
+				return &Event{Outcome: &Outcome{}}
+			},
+		},
+		rooms: make(map[int64]*testRoom),
+	}
+	start := time.Now()
+	room := &testRoom{Room{LastAction: start}}
+	if err := m.Create(1, room); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Create(1, room); err != ErrExists {
+		t.Fatalf("重复创建: %v", err)
+	}
+	if n := m.check(start.Add(30 * time.Second)); len(n) != 0 {
+		t.Fatalf("未到提醒时间: %v", n)
+	}
+	m.check(start.Add(55 * time.Second))
+	m.check(start.Add(56 * time.Second))
+	if warned != 1 {
+		t.Fatalf("提醒了 %d 次", warned)
+	}
+	// 行动后重新计时
+	room.Touch()
+	m.check(room.LastAction.Add(55 * time.Second))
+	if warned != 2 {
+		t.Fatalf("提醒了 %d 次", warned)
+	}
+	n := m.check(room.LastAction.Add(time.Minute))
+	if timeout != 1 || len(n) != 1 || n[0].event.Outcome == nil {
+		t.Fatalf("超时 %d 次, 消息 %v", timeout, n)
+	}
+	if _, ok := m.Load(1); ok {
+		t.Fatal("超时后房间未删除")
+	}
+}
+
+func TestManagerTick(t *testing.T) {
+	m := &Manager[*testRoom]{
+		opts: Options[*testRoom]{
+			OnTick: func(_ int64, r *testRoom, now time.Time) *Event {
+				if now.Sub(r.LastAction) < time.Second {
+					return nil
+				}
+				return &Event{End: true}
+			},
+		},
+		rooms: map[int64]*testRoom{1: {Room{LastAction: time.Now()}}},
+	}
+	if n := m.check(time.Now()); len(n) != 0 {
+		t.Fatalf("未结束: %v", n)
+	}
+	if n := m.check(time.Now().Add(time.Second)); len(n) != 1 || len(m.rooms) != 0 {
+		t.Fatalf("结束后消息 %v, 房间 %v", n, m.rooms)
+	}
+}
+
+func TestTakeReward(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.Local)
+	total := 0
+	for i := 0; i < DailyRewardLimit/WinReward+2; i++ {
+		n, err := takeReward(1, WinReward, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += n
+	}
+	if total != DailyRewardLimit {
+		t.Fatalf("当日共发放 %d, 应为 %d", total, DailyRewardLimit)
+	}
+	// 第二天重新计算
+	if n, _ := takeReward(1, WinReward, now.AddDate(0, 0, 1)); n != WinReward {
+		t.Fatalf("次日发放 %d, 应为 %d", n, WinReward)
+	}
+}
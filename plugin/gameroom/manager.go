@@ -0,0 +1,268 @@
+package gameroom
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// tickInterval 检查超时与计时的间隔
+const tickInterval = time.Second
+
+// Event 计时检查时产生的消息
+type Event struct {
+	Message message.Message
+	Outcome *Outcome // 不为空时汇报对局结果
+	End     bool     // 结束对局并删除房间
+}
+
+// Options 游戏的设置
+type Options[R Roomer] struct {
+	Name    string        // 游戏标识, 用作持久化的键与钱包流水的来源
+	Brief   string        // 游戏名称, 用于钱包流水的原因
+	Timeout time.Duration // 无人行动多久后结束对局, 为 0 时不限
+	Warning time.Duration // 超时前多久提醒, 为 0 时不提醒
+	// OnWarn 即将超时, 返回要发送到房间的消息
+	OnWarn func(key int64, room R) *Event
+	// OnTimeout 已超时, 返回要发送到房间的消息, 房间随后被删除
+	OnTimeout func(key int64, room R) *Event
+	// OnTick 每次计时检查时调用, 用于棋钟等自定义计时
+	OnTick func(key int64, room R, now time.Time) *Event
+	// New 创建空房间用于从数据库恢复, 为空时不持久化, R 需可被 json 编解码
+	New func() R
+	// Key 消息对应的房间的键, 为空时使用 KeyOf, 如按用户区分时返回用户号
+	Key func(ctx *zero.Ctx) int64
+}
+
+// Manager 管理一种游戏的所有房间
+//
+// Load, Store, Delete 与 Range 需在 Lock 与 Unlock 之间调用,
+// 开启持久化时 Unlock 会保存有变化的房间.
+type Manager[R Roomer] struct {
+	mu    sync.Mutex
+	opts  Options[R]
+	rooms map[int64]R
+	saved map[int64]string // 上次保存的内容, 只写入有变化的房间
+}
+
+// New 创建房间管理器, 有超时或计时设置时在后台检查
+func New[R Roomer](opts Options[R]) *Manager[R] {
+	m := &Manager[R]{
+		opts:  opts,
+		rooms: make(map[int64]R),
+		saved: make(map[int64]string),
+	}
+	if opts.New != nil {
+		m.restore()
+	}
+	if opts.Timeout > 0 || opts.OnTick != nil {
+		go func() {
+			for range time.NewTicker(tickInterval).C {
+				m.tick(time.Now())
+			}
+		}()
+	}
+	return m
+}
+
+// Lock 锁定所有房间
+func (m *Manager[R]) Lock() {
+	m.mu.Lock()
+}
+
+// Unlock 解锁, 开启持久化时保存有变化的房间
+func (m *Manager[R]) Unlock() {
+	if m.opts.New != nil {
+		m.persist()
+	}
+	m.mu.Unlock()
+}
+
+// Load 获取房间
+func (m *Manager[R]) Load(key int64) (R, bool) {
+	room, ok := m.rooms[key]
+	return room, ok
+}
+
+// Store 保存房间
+func (m *Manager[R]) Store(key int64, room R) {
+	m.rooms[key] = room
+}
+
+// Delete 删除房间
+func (m *Manager[R]) Delete(key int64) {
+	delete(m.rooms, key)
+}
+
+// Range 遍历所有房间, f 返回 false 时停止
+func (m *Manager[R]) Range(f func(key int64, room R) bool) {
+	for key, room := range m.rooms {
+		if !f(key, room) {
+			return
+		}
+	}
+}
+
+// Create 创建房间, 已存在时返回 ErrExists
+func (m *Manager[R]) Create(key int64, room R) error {
+	if _, ok := m.rooms[key]; ok {
+		return ErrExists
+	}
+	m.rooms[key] = room
+	return nil
+}
+
+// Exists 房间是否存在, 会自行加锁, 可用于指令的触发条件
+func (m *Manager[R]) Exists(key int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.rooms[key]
+	return ok
+}
+
+// KeyOf 消息对应的房间的键
+func (m *Manager[R]) KeyOf(ctx *zero.Ctx) int64 {
+	if m.opts.Key != nil {
+		return m.opts.Key(ctx)
+	}
+	return KeyOf(ctx)
+}
+
+// Rule 消息对应的房间存在时触发, 可附加额外的条件
+func (m *Manager[R]) Rule(cond ...func(ctx *zero.Ctx, room R) bool) zero.Rule {
+	return func(ctx *zero.Ctx) bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		room, ok := m.rooms[m.KeyOf(ctx)]
+		if !ok {
+			return false
+		}
+		for _, c := range cond {
+			if !c(ctx, room) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// notice 计时检查后需要发送的消息
+type notice struct {
+	selfID  int64
+	key     int64
+	groupID int64
+	event   *Event
+}
+
+// check 检查所有房间的计时与超时
+func (m *Manager[R]) check(now time.Time) []notice {
+	var notices []notice
+	for key, room := range m.rooms {
+		base := room.Base()
+		add := func(e *Event) {
+			if e == nil {
+				return
+			}
+			notices = append(notices, notice{base.SelfID, key, base.GroupID, e})
+			if e.End {
+				delete(m.rooms, key)
+			}
+		}
+		if m.opts.OnTick != nil {
+			e := m.opts.OnTick(key, room, now)
+			add(e)
+			if e != nil && e.End {
+				continue
+			}
+		}
+		if m.opts.Timeout <= 0 {
+			continue
+		}
+		idle := now.Sub(base.LastAction)
+		switch {
+		case idle >= m.opts.Timeout:
+			delete(m.rooms, key)
+			if m.opts.OnTimeout != nil {
+				add(m.opts.OnTimeout(key, room))
+			}
+		case m.opts.Warning > 0 && !base.warned && idle >= m.opts.Timeout-m.opts.Warning:
+			base.warned = true
+			if m.opts.OnWarn != nil {
+				add(m.opts.OnWarn(key, room))
+			}
+		}
+	}
+	return notices
+}
+
+func (m *Manager[R]) tick(now time.Time) {
+	m.Lock()
+	notices := m.check(now)
+	m.Unlock()
+	for _, n := range notices {
+		ctx := zero.GetBot(n.selfID)
+		if ctx == nil {
+			continue
+		}
+		if len(n.event.Message) > 0 {
+			if n.groupID != 0 {
+				ctx.SendGroupMessage(n.groupID, n.event.Message)
+			} else {
+				ctx.SendPrivateMessage(-n.key, n.event.Message)
+			}
+		}
+		if n.event.Outcome != nil {
+			m.Report(ctx, n.groupID, *n.event.Outcome)
+		}
+	}
+}
+
+// persist 保存有变化的房间, 删除已结束的房间
+func (m *Manager[R]) persist() {
+	for key, room := range m.rooms {
+		data, err := json.Marshal(room)
+		if err != nil {
+			logrus.Warnln("[gameroom] 编码", m.opts.Name, "房间", key, "失败:", err)
+			continue
+		}
+		if m.saved[key] == string(data) {
+			continue
+		}
+		if err = saveRoom(m.opts.Name, key, string(data)); err != nil {
+			logrus.Warnln("[gameroom] 保存", m.opts.Name, "房间", key, "失败:", err)
+			continue
+		}
+		m.saved[key] = string(data)
+	}
+	for key := range m.saved {
+		if _, ok := m.rooms[key]; ok {
+			continue
+		}
+		if err := deleteRoom(m.opts.Name, key); err != nil {
+			logrus.Warnln("[gameroom] 删除", m.opts.Name, "房间", key, "失败:", err)
+			continue
+		}
+		delete(m.saved, key)
+	}
+}
+
+// restore 从数据库恢复房间, 重启期间不计入超时
+func (m *Manager[R]) restore() {
+	err := loadRooms(m.opts.Name, func(key int64, data string) {
+		room := m.opts.New()
+		if err := json.Unmarshal([]byte(data), room); err != nil {
+			logrus.Warnln("[gameroom] 恢复", m.opts.Name, "房间", key, "失败:", err)
+			return
+		}
+		room.Base().Touch()
+		m.rooms[key] = room
+		m.saved[key] = data
+	})
+	if err != nil {
+		logrus.Warnln("[gameroom] 读取", m.opts.Name, "房间失败:", err)
+	}
+}
@@ -0,0 +1,54 @@
+package gameroom
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/score/exp"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+const (
+	// WinReward 游戏胜利时建议发放的钱包奖励
+	WinReward = 10
+	// DailyRewardLimit 每人每天从所有游戏获得的钱包奖励上限
+	DailyRewardLimit = 50
+)
+
+// Outcome 对局结果
+type Outcome struct {
+	Winners []int64
+	Exp     int // 每位胜者增加的群等级经验
+	Reward  int // 每位胜者获得的钱包奖励
+}
+
+// Win 单人胜利, 按建议值奖励经验与钱包
+func Win(winners ...int64) Outcome {
+	return Outcome{Winners: winners, Exp: exp.GameWinExp, Reward: WinReward}
+}
+
+// Report 向群等级与钱包汇报对局结果, 私聊房间 groupID 为 0, 只发放钱包奖励
+//
+// 钱包奖励每人每天至多 DailyRewardLimit, 达到上限后只增加经验
+func (m *Manager[R]) Report(ctx *zero.Ctx, groupID int64, o Outcome) {
+	for _, uid := range o.Winners {
+		if uid == 0 {
+			continue
+		}
+		if o.Exp > 0 {
+			exp.AwardInGroup(ctx, groupID, uid, o.Exp)
+		}
+		if o.Reward <= 0 {
+			continue
+		}
+		amount, err := takeReward(uid, o.Reward, time.Now())
+		if err == nil && amount > 0 {
+			err = ledger.Earn(uid, amount, m.opts.Name, 0, m.opts.Brief+"胜利")
+		}
+		if err != nil {
+			logrus.Warnln("[gameroom] 发放", m.opts.Name, "奖励失败:", err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Package gameroom 回合制游戏框架
+//
+// 提供按群或用户区分的房间、加入与离开、轮流行动、超时提醒、观战、
+// 房间持久化以及向群等级与钱包汇报结果, 各游戏只需实现规则与渲染.
+// 游戏的房间类型嵌入 Room, 并交由 Manager 统一管理.
+package gameroom
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+var (
+	// ErrExists 房间已存在
+	ErrExists = errors.New("已经有正在进行的游戏...")
+	// ErrFull 房间人数已满
+	ErrFull = errors.New("房间人数已满")
+	// ErrJoined 已在房间中
+	ErrJoined = errors.New("已经在房间中了")
+)
+
+// Player 玩家
+type Player struct {
+	UID  int64  `json:"uid"`
+	Name string `json:"name"`
+}
+
+// Room 房间的公共部分, 由各游戏的房间类型嵌入
+type Room struct {
+	SelfID     int64     `json:"self_id"`  // 创建房间的机器人, 用于主动发送消息
+	GroupID    int64     `json:"group_id"` // 为 0 时是私聊房间
+	Players    []Player  `json:"players"`
+	Spectators []int64   `json:"spectators"`
+	Turn       int       `json:"turn"` // 当前行动的玩家在 Players 中的下标
+	LastAction time.Time `json:"last_action"`
+	warned     bool      // 本轮是否已发送超时提醒
+}
+
+// Base 返回房间的公共部分, 嵌入 Room 的类型由此满足 Roomer
+func (r *Room) Base() *Room {
+	return r
+}
+
+// Roomer 可由 Manager 管理的房间
+type Roomer interface {
+	Base() *Room
+}
+
+// KeyOf 消息所在房间的键, 群聊为群号, 私聊为用户号的相反数
+func KeyOf(ctx *zero.Ctx) int64 {
+	if ctx.Event.GroupID != 0 {
+		return ctx.Event.GroupID
+	}
+	return -ctx.Event.UserID
+}
+
+// NewRoom 由消息创建房间, 发送者为第一位玩家
+func NewRoom(ctx *zero.Ctx) Room {
+	r := Room{SelfID: ctx.Event.SelfID, GroupID: ctx.Event.GroupID, LastAction: time.Now()}
+	if ctx.Event.Sender != nil {
+		r.Players = []Player{{UID: ctx.Event.UserID, Name: ctx.Event.Sender.NickName}}
+	}
+	return r
+}
+
+// Touch 记录一次行动, 重新开始超时计时
+func (r *Room) Touch() {
+	r.LastAction = time.Now()
+	r.warned = false
+}
+
+// IndexOf 玩家在房间中的下标, 不在房间中时返回 -1
+func (r *Room) IndexOf(uid int64) int {
+	return slices.IndexFunc(r.Players, func(p Player) bool {
+		return p.UID == uid
+	})
+}
+
+// IsPlayer 是否为房间中的玩家
+func (r *Room) IsPlayer(uid int64) bool {
+	return r.IndexOf(uid) >= 0
+}
+
+// Join 加入房间, max 为 0 时不限人数
+func (r *Room) Join(p Player, max int) error {
+	if r.IsPlayer(p.UID) {
+		return ErrJoined
+	}
+	if max > 0 && len(r.Players) >= max {
+		return ErrFull
+	}
+	r.Players = append(r.Players, p)
+	r.Unwatch(p.UID)
+	return nil
+}
+
+// Leave 离开房间, 轮到的玩家离开时由下一位玩家行动
+func (r *Room) Leave(uid int64) bool {
+	i := r.IndexOf(uid)
+	if i < 0 {
+		return false
+	}
+	r.Players = slices.Delete(r.Players, i, i+1)
+	if i < r.Turn || r.Turn >= len(r.Players) {
+		r.Turn--
+	}
+	if r.Turn < 0 {
+		r.Turn = 0
+	}
+	if len(r.Players) > 0 {
+		r.Turn %= len(r.Players)
+	}
+	return true
+}
+
+// Current 当前行动的玩家
+func (r *Room) Current() Player {
+	if len(r.Players) == 0 {
+		return Player{}
+	}
+	return r.Players[r.Turn]
+}
+
+// Next 轮到下一位玩家
+func (r *Room) Next() Player {
+	if len(r.Players) == 0 {
+		return Player{}
+	}
+	r.Turn = (r.Turn + 1) % len(r.Players)
+	return r.Players[r.Turn]
+}
+
+// Watch 观战, 玩家无需观战
+func (r *Room) Watch(uid int64) bool {
+	if r.IsPlayer(uid) || slices.Contains(r.Spectators, uid) {
+		return false
+	}
+	r.Spectators = append(r.Spectators, uid)
+	return true
+}
+
+// Unwatch 取消观战
+func (r *Room) Unwatch(uid int64) bool {
+	i := slices.Index(r.Spectators, uid)
+	if i < 0 {
+		return false
+	}
+	r.Spectators = slices.Delete(r.Spectators, i, i+1)
+	return true
+}
+
+// Audience @ 所有观战者, 用于对局结束时通知
+func (r *Room) Audience() message.Message {
+	msg := make(message.Message, 0, len(r.Spectators))
+	for _, uid := range r.Spectators {
+		msg = append(msg, message.At(uid))
+	}
+	return msg
+}
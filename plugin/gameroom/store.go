@@ -0,0 +1,125 @@
+package gameroom
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/floatbox/file"
+	sql "github.com/FloatTech/sqlite"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+const (
+	roomTable   = "room"
+	rewardTable = "reward"
+)
+
+// record 持久化的房间
+type record struct {
+	ID   string `db:"id"` // 游戏标识_房间的键
+	Game string `db:"game"`
+	Room int64  `db:"room"`
+	Data string `db:"data"` // json 编码的房间
+}
+
+// reward 用户当日已从游戏获得的钱包奖励
+type reward struct {
+	Key   string `db:"key"` // 用户_日期
+	UID   int64  `db:"uid"`
+	Date  int    `db:"date"`
+	Total int    `db:"total"`
+}
+
+// storage 房间与奖励数据库, 在第一次使用时打开
+type storage struct {
+	sync.Mutex
+	once sync.Once
+	err  error
+	db   sql.Sqlite
+}
+
+var rdb = &storage{
+	db: sql.New("data/gameroom/rooms.db"),
+}
+
+func (s *storage) open() error {
+	s.once.Do(func() {
+		if file.IsNotExist("data/gameroom") {
+			if s.err = os.MkdirAll("data/gameroom", 0755); s.err != nil {
+				return
+			}
+		}
+		if s.err = s.db.Open(time.Hour * 24); s.err != nil {
+			return
+		}
+		if s.err = s.db.Create(roomTable, &record{}); s.err != nil {
+			return
+		}
+		s.err = s.db.Create(rewardTable, &reward{})
+	})
+	return s.err
+}
+
+func saveRoom(game string, key int64, data string) error {
+	if err := rdb.open(); err != nil {
+		return err
+	}
+	rdb.Lock()
+	defer rdb.Unlock()
+	return rdb.db.Insert(roomTable, &record{
+		ID:   game + "_" + strconv.FormatInt(key, 10),
+		Game: game,
+		Room: key,
+		Data: data,
+	})
+}
+
+func deleteRoom(game string, key int64) error {
+	if err := rdb.open(); err != nil {
+		return err
+	}
+	rdb.Lock()
+	defer rdb.Unlock()
+	return rdb.db.Del(roomTable, "WHERE id = ?", game+"_"+strconv.FormatInt(key, 10))
+}
+
+func loadRooms(game string, f func(key int64, data string)) error {
+	if err := rdb.open(); err != nil {
+		return err
+	}
+	rdb.Lock()
+	defer rdb.Unlock()
+	var r record
+	err := rdb.db.FindFor(roomTable, &r, "WHERE game = ?", func() error {
+		f(r.Room, r.Data)
+		return nil
+	}, game)
+	if errors.Is(err, sql.ErrNullResult) {
+		return nil
+	}
+	return err
+}
+
+// takeReward 占用用户当日的奖励额度, 返回不超过 DailyRewardLimit 的实际可发放金额
+func takeReward(uid int64, amount int, t time.Time) (int, error) {
+	if err := rdb.open(); err != nil {
+		return 0, err
+	}
+	rdb.Lock()
+	defer rdb.Unlock()
+	date := ledger.DateOf(t)
+	// 只保留当天的额度
+	_ = rdb.db.Del(rewardTable, "WHERE date < ?", date)
+	r := reward{Key: strconv.FormatInt(uid, 10) + "_" + strconv.Itoa(date), UID: uid, Date: date}
+	_ = rdb.db.Find(rewardTable, &r, "WHERE key = ?", r.Key)
+	amount = min(amount, DailyRewardLimit-r.Total)
+	if amount <= 0 {
+		return 0, nil
+	}
+	r.Total += amount
+	return amount, rdb.db.Insert(rewardTable, &r)
+}
@@ -4,7 +4,6 @@ package handou
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"image"
 	"image/color"
 	"math"
@@ -26,6 +25,8 @@ import (
 	"github.com/FloatTech/zbputils/img/text"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
 )
 
 type idiomJSON struct {
@@ -69,7 +70,7 @@ var (
 		Help: "- 个人猜成语\n" +
 			"- 团队猜成语\n",
 		PublicDataFolder: "Handou",
-	}).ApplySingle(ctxext.NewGroupSingle("已经有正在进行的游戏..."))
+	})
 	userHabitsFile = file.BOTPATH + "/" + en.DataFolder() + "userHabits.json"
 	idiomFilePath  = file.BOTPATH + "/" + en.DataFolder() + "idiom.json"
 	initialized    = fcext.DoOnceOnSuccess(
@@ -130,106 +131,136 @@ func init() {
 		idiomData := idiomInfoMap[target]
 		game := newHandouGame(idiomData)
 		_, img, _ := game("")
-		anser := anserOutString(idiomData)
-		worldLength := len(idiomData.Chars)
+		room := &handouRoom{
+			Room:      gameroom.NewRoom(ctx),
+			messageID: ctx.Event.MessageID,
+			length:    len(idiomData.Chars),
+			answer:    anserOutString(idiomData),
+			team:      ctx.State["regex_matched"].([]string)[1] == "团队",
+			play:      game,
+		}
+		rooms.Lock()
+		err := rooms.Create(gameroom.KeyOf(ctx), room)
+		rooms.Unlock()
+		if err != nil {
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err)))
+			return
+		}
 		ctx.Send(
 			message.ReplyWithMessage(ctx.Event.MessageID,
 				message.ImageBytes(img),
-				message.Text("你有", 7, "次机会猜出", worldLength, "字成语\n首字拼音为：", idiomData.Pinyin[0]),
+				message.Text("你有", 7, "次机会猜出", room.length, "字成语\n首字拼音为：", idiomData.Pinyin[0]),
 			),
 		)
-		var next *zero.FutureEvent
-		if ctx.State["regex_matched"].([]string)[1] == "个人" {
-			next = zero.NewFutureEvent("message", 999, false, zero.RegexRule(fmt.Sprintf(`^([\p{Han}，,]){%d}$`, worldLength)),
-				zero.OnlyGroup, ctx.CheckSession())
-		} else {
-			next = zero.NewFutureEvent("message", 999, false, zero.RegexRule(fmt.Sprintf(`^([\p{Han}，,]){%d}$`, worldLength)),
-				zero.OnlyGroup, zero.CheckGroup(ctx.Event.GroupID))
+	})
+	en.OnRegex(`^[\p{Han}，,]+$`, zero.OnlyGroup, rooms.Rule(canGuess)).Handle(func(ctx *zero.Ctx) {
+		guess := ctx.Event.Message.String()
+		if err := updateHabits(guess); err != nil {
+			logrus.Warn("更新用户习惯库时发生错误: ", err)
 		}
-		var err error
-		var win bool
-		recv, cancel := next.Repeat()
-		defer cancel()
-		tick := time.NewTimer(105 * time.Second)
-		after := time.NewTimer(120 * time.Second)
-		for {
-			select {
-			case <-tick.C:
-				ctx.SendChain(message.Text("猜成语，你还有15s作答时间"))
-			case <-after.C:
+		key := gameroom.KeyOf(ctx)
+		rooms.Lock()
+		room, ok := rooms.Load(key)
+		if !ok {
+			rooms.Unlock()
+			return
+		}
+		room.Touch()
+		win, img, err := room.play(guess)
+		if win || err == errTimesRunOut {
+			rooms.Delete(key)
+		}
+		rooms.Unlock()
+		switch {
+		case win:
+			ctx.Send(
+				message.ReplyWithMessage(ctx.Event.MessageID,
+					message.ImageBytes(img),
+					message.Text("太棒了，你猜出来了！\n答案是: ", room.answer),
+				),
+			)
+			rooms.Report(ctx, ctx.Event.GroupID, gameroom.Win(ctx.Event.UserID))
+		case err == errTimesRunOut:
+			ctx.Send(
+				message.ReplyWithMessage(ctx.Event.MessageID,
+					message.ImageBytes(img),
+					message.Text("游戏结束...\n答案是: ", room.answer),
+				),
+			)
+		case err == errLengthNotEnough:
+			ctx.Send(
+				message.ReplyWithMessage(ctx.Event.MessageID,
+					message.Text("成语长度错误"),
+				),
+			)
+		case err == errHadGuessed:
+			ctx.Send(
+				message.ReplyWithMessage(ctx.Event.MessageID,
+					message.Text("该成语已经猜过了"),
+				),
+			)
+		case err == errUnknownWord:
+			ctx.Send(
+				message.ReplyWithMessage(ctx.Event.MessageID,
+					message.Text("你确定存在这样的成语吗？"),
+				),
+			)
+		default:
+			if img != nil {
 				ctx.Send(
 					message.ReplyWithMessage(ctx.Event.MessageID,
-						message.Text("猜成语超时，游戏结束...\n答案是: ", anser),
+						message.ImageBytes(img),
+					),
+				)
+			} else {
+				ctx.Send(
+					message.ReplyWithMessage(ctx.Event.MessageID,
+						message.Text("回答错误。"),
 					),
 				)
-				return
-			case c := <-recv:
-				tick.Reset(105 * time.Second)
-				after.Reset(120 * time.Second)
-				err = updateHabits(c.Event.Message.String())
-				if err != nil {
-					logrus.Warn("更新用户习惯库时发生错误: ", err)
-				}
-				win, img, err = game(c.Event.Message.String())
-				switch {
-				case win:
-					tick.Stop()
-					after.Stop()
-					ctx.Send(
-						message.ReplyWithMessage(c.Event.MessageID,
-							message.ImageBytes(img),
-							message.Text("太棒了，你猜出来了！\n答案是: ", anser),
-						),
-					)
-					return
-				case err == errTimesRunOut:
-					tick.Stop()
-					after.Stop()
-					ctx.Send(
-						message.ReplyWithMessage(c.Event.MessageID,
-							message.ImageBytes(img),
-							message.Text("游戏结束...\n答案是: ", anser),
-						),
-					)
-					return
-				case err == errLengthNotEnough:
-					ctx.Send(
-						message.ReplyWithMessage(c.Event.MessageID,
-							message.Text("成语长度错误"),
-						),
-					)
-				case err == errHadGuessed:
-					ctx.Send(
-						message.ReplyWithMessage(c.Event.MessageID,
-							message.Text("该成语已经猜过了"),
-						),
-					)
-				case err == errUnknownWord:
-					ctx.Send(
-						message.ReplyWithMessage(c.Event.MessageID,
-							message.Text("你确定存在这样的成语吗？"),
-						),
-					)
-				default:
-					if img != nil {
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.ImageBytes(img),
-							),
-						)
-					} else {
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.Text("回答错误。"),
-							),
-						)
-					}
-				}
 			}
 		}
 	})
 }
 
+// handouRoom 一局猜成语
+type handouRoom struct {
+	gameroom.Room
+	messageID any // 开局的消息, 超时时回复
+	length    int // 成语的字数
+	answer    string
+	team      bool // 团队模式群内所有人都可以作答, 个人模式只有开局者可以作答
+	play      func(string) (bool, []byte, error)
+}
+
+// rooms 各群正在进行的猜成语
+var rooms = gameroom.New(gameroom.Options[*handouRoom]{
+	Name:    "handou",
+	Brief:   "猜成语",
+	Timeout: 120 * time.Second,
+	Warning: 15 * time.Second,
+	OnWarn: func(int64, *handouRoom) *gameroom.Event {
+		return &gameroom.Event{Message: message.Message{message.Text("猜成语，你还有15s作答时间")}}
+	},
+	OnTimeout: func(_ int64, room *handouRoom) *gameroom.Event {
+		return &gameroom.Event{Message: message.ReplyWithMessage(room.messageID,
+			message.Text("猜成语超时，游戏结束...\n答案是: ", room.answer),
+		)}
+	},
+})
+
+// canGuess 成语字数正确, 且个人模式下只有开局者可以作答, 只有已知的成语才阻止后续插件处理
+func canGuess(ctx *zero.Ctx, room *handouRoom) bool {
+	s := ctx.Event.Message.String()
+	if len([]rune(s)) != room.length || !(room.team || room.IsPlayer(ctx.Event.UserID)) {
+		return false
+	}
+	if _, ok := idiomInfoMap[s]; ok || s == room.answer {
+		ctx.Block()
+	}
+	return true
+}
+
 func poolIdiom() string {
 	prioritizedData := prioritizeData(habitsIdiomKeys)
 	if len(prioritizedData) > 0 {
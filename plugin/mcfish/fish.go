@@ -2,7 +2,6 @@
 package mcfish
 
 import (
-	"math/rand"
 	"strconv"
 	"strings"
 	"time"
@@ -12,10 +11,13 @@ import (
 	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 )
 
 func init() {
-	engine.OnRegex(`^进行(([1-5]\d|[1-9])次)?钓鱼$`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+	engine.OnRegex(`^进行(([1-5]\d|[1-9])次)?钓鱼$`, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 		numberOfPole, err := dbdata.getNumberFor(uid, "竿")
 		if err != nil {
@@ -72,7 +74,7 @@ func init() {
 						ctx.SendChain(message.Text("你钱包当前只有", money, wallet.GetWalletName(), ",无法完成支付"))
 						return
 					}
-					err = wallet.InsertWalletOf(uid, -100)
+					err = ledger.Spend(uid, 100, "mcfish", 0, "购买鱼竿")
 					if err != nil {
 						ctx.SendChain(message.Text("[ERROR at fish.go.3]:", err))
 						return
@@ -102,6 +104,12 @@ func init() {
 		if equipInfo.Durable < fishNumber {
 			fishNumber = equipInfo.Durable
 		}
+		zoneInfo, err := dbdata.getUserZone(uid)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at fish.go.1.1]:", err))
+			return
+		}
+		env := newFishingEnv(zoneInfo.Zone, time.Now())
 		residue, err := dbdata.updateFishInfo(uid, fishNumber)
 		if err != nil {
 			ctx.SendChain(message.Text("[ERROR at fish.go.1]:", err))
@@ -113,6 +121,7 @@ func init() {
 		}
 		fishNumber = residue
 		msg := ""
+		var eaten map[string]int // 美西螈吃掉的鱼
 		if equipInfo.Equip != "美西螈" {
 			equipInfo.Durable -= fishNumber
 			err = dbdata.updateUserEquip(equipInfo)
@@ -143,6 +152,7 @@ func init() {
 				ctx.SendChain(message.Text("美西螈因为没吃到鱼,钓鱼时一直没回来,你失去了美西螈"))
 				return
 			}
+			eaten = fishNames
 			msg = "(美西螈掉落翻5倍，吃3倍鱼：\n吃掉了："
 			fishNumber = 0
 			for name, number := range fishNames {
@@ -153,8 +163,8 @@ func init() {
 			fishNumber /= 3
 		}
 		waitTime := 120 / (equipInfo.Induce + 1)
-		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你开始去钓鱼了,请耐心等待鱼上钩(预计要", time.Second*time.Duration(waitTime), ")"))
-		timer := time.NewTimer(time.Second * time.Duration(rand.Intn(waitTime)+1))
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你来到[", env, "]开始钓鱼了,请耐心等待鱼上钩(预计要", time.Second*time.Duration(waitTime), ")"))
+		timer := time.NewTimer(time.Second * time.Duration(rng.Intn(waitTime)+1))
 		for {
 			<-timer.C
 			timer.Stop()
@@ -172,179 +182,62 @@ func init() {
 			return
 		}
 
-		localProbabilities := make(map[string]probabilityLimit, len(probabilities))
-		for k, v := range probabilities {
-			localProbabilities[k] = v
-		}
-
-		if number > 100 || equipInfo.Equip == "美西螈" { // 放大概率
-			localProbabilities["treasure"] = probabilityLimit{
-				Min: 0,
-				Max: 2,
-			}
-			localProbabilities["pole"] = probabilityLimit{
-				Min: 2,
-				Max: 10,
-			}
-			localProbabilities["fish"] = probabilityLimit{
-				Min: 10,
-				Max: 45,
-			}
-			localProbabilities["waste"] = probabilityLimit{
-				Min: 45,
-				Max: 90,
-			}
-		}
-		if number2 != 0 {
-			info := localProbabilities["waste"]
-			info.Max = 100
-			localProbabilities["waste"] = info
-		}
-		for name, info := range localProbabilities {
-			switch name {
-			case "treasure":
-				info.Max += equipInfo.Favor
-				localProbabilities[name] = info
-			case "pole":
-				info.Min += equipInfo.Favor
-				info.Max += equipInfo.Favor * 2
-				localProbabilities[name] = info
-			case "fish":
-				info.Min += equipInfo.Favor * 2
-				info.Max += equipInfo.Favor * 3
-				localProbabilities[name] = info
-			case "waste":
-				info.Min += equipInfo.Favor * 3
-				localProbabilities[name] = info
-			}
-		}
+		localProbabilities := fishProbabilities(equipInfo, number, number2 != 0)
+		// 地点、时段、季节与天气加成
+		env.applyBonus(localProbabilities)
 		// 钓鱼结算
 		picName := ""
 		thingNameList := make(map[string]int)
 		for i := fishNumber; i > 0; i-- {
-			thingName := ""
-			typeOfThing := ""
 			number := 1
-			dice := rand.Intn(100)
-			switch {
-			case dice >= localProbabilities["waste"].Min && dice < localProbabilities["waste"].Max: // 垃圾
-				typeOfThing = "waste"
-				thingName = wasteList[rand.Intn(len(wasteList))]
-				picName = thingName
-			case dice >= localProbabilities["treasure"].Min && dice < localProbabilities["treasure"].Max: // 宝藏
-				dice = rand.Intn(100)
-				switch {
-				case dice >= localProbabilities["美西螈"].Min && dice < localProbabilities["美西螈"].Max:
-					typeOfThing = "pole"
-					picName = "美西螈"
-					thingName = "美西螈"
-				case dice >= localProbabilities["唱片"].Min && dice < localProbabilities["唱片"].Max:
-					typeOfThing = "article"
-					picName = "唱片"
-					thingName = "唱片"
-				case dice >= localProbabilities["海之眷顾"].Min && dice < localProbabilities["海之眷顾"].Max:
-					typeOfThing = "article"
-					picName = "book"
-					thingName = "海之眷顾"
-				case dice >= localProbabilities["净化书"].Min && dice < localProbabilities["净化书"].Max:
-					typeOfThing = "article"
-					picName = "book"
-					thingName = "净化书"
-				case dice >= localProbabilities["宝藏诅咒"].Min && dice < localProbabilities["宝藏诅咒"].Max:
-					typeOfThing = "article"
-					picName = "book"
-					thingName = "宝藏诅咒"
-				case dice >= localProbabilities["海豚"].Min && dice < localProbabilities["海豚"].Max:
-					typeOfThing = "fish"
-					picName = "海豚"
-					thingName = "海豚"
-				default:
-					typeOfThing = "article"
-					picName = "book"
-					thingName = "诱钓"
-				}
-			case dice >= localProbabilities["pole"].Min && dice < localProbabilities["pole"].Max: // 鱼竿
-				typeOfThing = "pole"
-				dice := rand.Intn(100)
-				switch {
-				case dice >= localProbabilities["铁竿"].Min && dice < localProbabilities["铁竿"].Max:
-					thingName = "铁竿"
-				case dice >= localProbabilities["金竿"].Min && dice < localProbabilities["金竿"].Max:
-					thingName = "金竿"
-				case dice >= localProbabilities["钻石竿"].Min && dice < localProbabilities["钻石竿"].Max:
-					thingName = "钻石竿"
-				case dice >= localProbabilities["下界合金竿"].Min && dice < localProbabilities["下界合金竿"].Max:
-					thingName = "下界合金竿"
-				default:
-					thingName = "木竿"
-				}
-				picName = thingName
-			case dice >= localProbabilities["fish"].Min && dice < localProbabilities["fish"].Max: // 鱼类
-				typeOfThing = "fish"
-				dice = rand.Intn(100)
-				switch {
-				case dice >= localProbabilities["墨鱼"].Min && dice < localProbabilities["墨鱼"].Max:
-					thingName = "墨鱼"
-				case dice >= localProbabilities["鳕鱼"].Min && dice < localProbabilities["鳕鱼"].Max:
-					thingName = "鳕鱼"
-				case dice >= localProbabilities["鲑鱼"].Min && dice < localProbabilities["鲑鱼"].Max:
-					thingName = "鲑鱼"
-				case dice >= localProbabilities["热带鱼"].Min && dice < localProbabilities["热带鱼"].Max:
-					thingName = "热带鱼"
-				case dice >= localProbabilities["河豚"].Min && dice < localProbabilities["河豚"].Max:
-					thingName = "河豚"
-				default:
-					thingName = "鹦鹉螺"
-				}
-				picName = thingName
-			default:
+			thingName, typeOfThing, pic := catchOnce(localProbabilities, env)
+			if thingName == "" {
 				thingNameList["赛博空气"]++
+				continue
 			}
-			if thingName != "" {
-				newThing := article{}
-				if strings.Contains(thingName, "竿") {
-					info := strconv.Itoa(rand.Intn(durationList[thingName])+1) +
-						"/" + strconv.Itoa(rand.Intn(10)) + "/" +
-						strconv.Itoa(rand.Intn(3)) + "/" + strconv.Itoa(rand.Intn(2))
+			picName = pic
+			newThing := article{}
+			if strings.Contains(thingName, "竿") {
+				newThing = article{
+					Duration: time.Now().Unix()*100 + int64(i),
+					Type:     typeOfThing,
+					Name:     thingName,
+					Number:   number,
+					Other:    newPoleOther(thingName),
+				}
+			} else {
+				thingInfo, err := dbdata.getUserThingInfo(uid, thingName)
+				if err != nil {
+					ctx.SendChain(message.Text("[ERROR at fish.go.6]:", err))
+					return
+				}
+				if len(thingInfo) == 0 {
 					newThing = article{
 						Duration: time.Now().Unix()*100 + int64(i),
 						Type:     typeOfThing,
 						Name:     thingName,
-						Number:   number,
-						Other:    info,
 					}
 				} else {
-					thingInfo, err := dbdata.getUserThingInfo(uid, thingName)
-					if err != nil {
-						ctx.SendChain(message.Text("[ERROR at fish.go.6]:", err))
-						return
-					}
-					if len(thingInfo) == 0 {
-						newThing = article{
-							Duration: time.Now().Unix()*100 + int64(i),
-							Type:     typeOfThing,
-							Name:     thingName,
-						}
-					} else {
-						newThing = thingInfo[0]
-					}
-					if equipInfo.Equip == "美西螈" && thingName != "美西螈" {
-						number += 4
-					}
-					newThing.Number += number
+					newThing = thingInfo[0]
 				}
-				err = dbdata.updateUserThingInfo(uid, newThing)
-				if err != nil {
-					ctx.SendChain(message.Text("[ERROR at fish.go.7]:", err))
-					return
+				if equipInfo.Equip == "美西螈" && thingName != "美西螈" {
+					number += 4
 				}
-				thingNameList[thingName] += number
+				newThing.Number += number
+			}
+			err = dbdata.updateUserThingInfo(uid, newThing)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR at fish.go.7]:", err))
+				return
 			}
+			thingNameList[thingName] += number
 		}
 		err = dbdata.updateCurseFor(uid, "fish", fishNumber)
 		if err != nil {
 			logrus.Warnln(err)
 		}
+		// 计入群内进行中的钓鱼比赛
+		msg += recordCatch(ctx, uid, thingNameList, eaten)
 		if len(thingNameList) == 1 {
 			thingName := ""
 			numberOfFish := 0
@@ -374,3 +267,146 @@ func init() {
 		ctx.Send(msgInfo)
 	})
 }
+
+// fishProbabilities 根据装备、背包中鱼的数量与是否有海豚计算各物品的概率范围
+func fishProbabilities(equipInfo equip, fishCount int, hasDolphin bool) map[string]probabilityLimit {
+	localProbabilities := make(map[string]probabilityLimit, len(probabilities))
+	for k, v := range probabilities {
+		localProbabilities[k] = v
+	}
+
+	if fishCount > 100 || equipInfo.Equip == "美西螈" { // 放大概率
+		localProbabilities["treasure"] = probabilityLimit{
+			Min: 0,
+			Max: 2,
+		}
+		localProbabilities["pole"] = probabilityLimit{
+			Min: 2,
+			Max: 10,
+		}
+		localProbabilities["fish"] = probabilityLimit{
+			Min: 10,
+			Max: 45,
+		}
+		localProbabilities["waste"] = probabilityLimit{
+			Min: 45,
+			Max: 90,
+		}
+	}
+	if hasDolphin {
+		info := localProbabilities["waste"]
+		info.Max = 100
+		localProbabilities["waste"] = info
+	}
+	for name, info := range localProbabilities {
+		switch name {
+		case "treasure":
+			info.Max += equipInfo.Favor
+			localProbabilities[name] = info
+		case "pole":
+			info.Min += equipInfo.Favor
+			info.Max += equipInfo.Favor * 2
+			localProbabilities[name] = info
+		case "fish":
+			info.Min += equipInfo.Favor * 2
+			info.Max += equipInfo.Favor * 3
+			localProbabilities[name] = info
+		case "waste":
+			info.Min += equipInfo.Favor * 3
+			localProbabilities[name] = info
+		}
+	}
+	return localProbabilities
+}
+
+// catchOnce 进行一次钓鱼, 返回钓到的物品, 物品类型与图片名, 空竿时物品为空
+func catchOnce(localProbabilities map[string]probabilityLimit, env *fishingEnv) (thingName, typeOfThing, picName string) {
+	dice := rng.Intn(100)
+	switch {
+	case dice >= localProbabilities["waste"].Min && dice < localProbabilities["waste"].Max: // 垃圾
+		typeOfThing = "waste"
+		if thingName = env.pick("waste"); thingName == "" {
+			thingName = defaultWasteList[rng.Intn(len(defaultWasteList))]
+		}
+		picName = thingName
+	case dice >= localProbabilities["treasure"].Min && dice < localProbabilities["treasure"].Max: // 宝藏
+		dice = rng.Intn(100)
+		switch {
+		case dice >= localProbabilities["美西螈"].Min && dice < localProbabilities["美西螈"].Max:
+			typeOfThing = "pole"
+			picName = "美西螈"
+			thingName = "美西螈"
+		case dice >= localProbabilities["唱片"].Min && dice < localProbabilities["唱片"].Max:
+			typeOfThing = "article"
+			picName = "唱片"
+			thingName = "唱片"
+		case dice >= localProbabilities["海之眷顾"].Min && dice < localProbabilities["海之眷顾"].Max:
+			typeOfThing = "article"
+			picName = "book"
+			thingName = "海之眷顾"
+		case dice >= localProbabilities["净化书"].Min && dice < localProbabilities["净化书"].Max:
+			typeOfThing = "article"
+			picName = "book"
+			thingName = "净化书"
+		case dice >= localProbabilities["宝藏诅咒"].Min && dice < localProbabilities["宝藏诅咒"].Max:
+			typeOfThing = "article"
+			picName = "book"
+			thingName = "宝藏诅咒"
+		case dice >= localProbabilities["海豚"].Min && dice < localProbabilities["海豚"].Max:
+			typeOfThing = "fish"
+			picName = "海豚"
+			thingName = "海豚"
+		default:
+			typeOfThing = "article"
+			picName = "book"
+			thingName = "诱钓"
+		}
+	case dice >= localProbabilities["pole"].Min && dice < localProbabilities["pole"].Max: // 鱼竿
+		typeOfThing = "pole"
+		dice := rng.Intn(100)
+		switch {
+		case dice >= localProbabilities["铁竿"].Min && dice < localProbabilities["铁竿"].Max:
+			thingName = "铁竿"
+		case dice >= localProbabilities["金竿"].Min && dice < localProbabilities["金竿"].Max:
+			thingName = "金竿"
+		case dice >= localProbabilities["钻石竿"].Min && dice < localProbabilities["钻石竿"].Max:
+			thingName = "钻石竿"
+		case dice >= localProbabilities["下界合金竿"].Min && dice < localProbabilities["下界合金竿"].Max:
+			thingName = "下界合金竿"
+		default:
+			thingName = "木竿"
+		}
+		picName = thingName
+	case dice >= localProbabilities["fish"].Min && dice < localProbabilities["fish"].Max: // 鱼类
+		typeOfThing = "fish"
+		if thingName = env.pick("fish"); thingName == "" {
+			dice = rng.Intn(100)
+			switch {
+			case dice >= localProbabilities["墨鱼"].Min && dice < localProbabilities["墨鱼"].Max:
+				thingName = "墨鱼"
+			case dice >= localProbabilities["鳕鱼"].Min && dice < localProbabilities["鳕鱼"].Max:
+				thingName = "鳕鱼"
+			case dice >= localProbabilities["鲑鱼"].Min && dice < localProbabilities["鲑鱼"].Max:
+				thingName = "鲑鱼"
+			case dice >= localProbabilities["热带鱼"].Min && dice < localProbabilities["热带鱼"].Max:
+				thingName = "热带鱼"
+			case dice >= localProbabilities["河豚"].Min && dice < localProbabilities["河豚"].Max:
+				thingName = "河豚"
+			default:
+				thingName = "鹦鹉螺"
+			}
+		}
+		picName = thingName
+	}
+	if isExtraThing(thingName) {
+		picName = "" // 拓展包物品没有图片
+	}
+	return
+}
+
+// newPoleOther 随机生成钓到的鱼竿的耐久/维修次数/诱钓/眷顾
+func newPoleOther(name string) string {
+	return strconv.Itoa(rng.Intn(durationList[name])+1) +
+		"/" + strconv.Itoa(rng.Intn(10)) + "/" +
+		strconv.Itoa(rng.Intn(3)) + "/" + strconv.Itoa(rng.Intn(2))
+}
@@ -3,7 +3,6 @@ package mcfish
 
 import (
 	"encoding/json"
-	"math/rand"
 	"os"
 	"strconv"
 	"strings"
@@ -31,6 +30,9 @@ const FishLimit = 50
 // version 规则版本号
 const version = "5.6.2"
 
+// starterPoleOther 初始木竿的耐久/维修次数/诱钓/眷顾
+const starterPoleOther = "30/0/0/0"
+
 // 各物品信息
 type jsonInfo struct {
 	ZoneInfo    []zoneInfo    `json:"分类"` // 区域概率
@@ -142,7 +144,26 @@ var (
 			"- 合成[xx竿|三叉戟]\n" +
 			"- 出售所有垃圾\n" +
 			"- 当前装备概率明细\n" +
-			"- 查看钓鱼规则\n",
+			"- 查看钓鱼规则\n" +
+			"----------钓鱼地点----------\n" +
+			"- 钓鱼地点 / 钓鱼天气\n" +
+			"- 前往[海洋|河流|沼泽|...]\n" +
+			"- 重载钓鱼拓展包 (超级用户)\n" +
+			"各地点有独立的掉落表, 时段、季节与每日天气会影响上钩概率; 拓展包放在McFish/packs/*.json\n" +
+			"----------玩家市场----------\n" +
+			"- 挂单 物品 数量 单价\n" +
+			"- 钓鱼市场 [页码]\n" +
+			"- 购买挂单 编号 [数量]\n" +
+			"- 撤单 编号\n" +
+			"- 我的挂单\n" +
+			"- 设置市场税率 x (超级用户)\n" +
+			"成交时卖家缴纳交易税(默认5%), 挂单3天未售出自动退回背包\n" +
+			"----------钓鱼比赛----------\n" +
+			"- 举办钓鱼比赛 [总价值|最稀有] 时长[分钟|小时] [x分钟后开始] [报名费x] [奖金x] (管理员)\n" +
+			"- 取消钓鱼比赛 (管理员)\n" +
+			"- 报名钓鱼比赛\n" +
+			"- 钓鱼比赛排行\n" +
+			"比赛期间在本群钓到的东西自动计入成绩, 结束后前三名按50%/30%/20%瓜分奖池(奖金+报名费)\n",
 		PublicDataFolder: "McFish",
 	}).ApplySingle(ctxext.DefaultSingle)
 	getdb = fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
@@ -395,8 +416,9 @@ func (sql *fishdb) pickFishFor(uid int64, number int) (fishNames map[string]int,
 	}
 	fishInfo := article{}
 	k := 0
-	for i := number; i > 0 && k < len(fishList); {
-		_ = sql.db.Find(name, &fishInfo, "WHERE Name = ?", fishList[k])
+	fishes := getFishList()
+	for i := number; i > 0 && k < len(fishes); {
+		_ = sql.db.Find(name, &fishInfo, "WHERE Name = ?", fishes[k])
 		if fishInfo.Number <= 0 {
 			k++
 			continue
@@ -571,20 +593,15 @@ func (sql *fishdb) refreshStroeInfo() (ok bool, err error) {
 		}
 		refresh = true
 	}
-	for _, name := range thingList {
+	for _, name := range getThingList() {
 		thing := storeDiscount{}
 		switch refresh {
 		case true:
-			thingDiscount := 50 + rand.Intn(150)
-			thing = storeDiscount{
-				Name:     name,
-				Discount: thingDiscount,
-			}
 			thingInfo := store{}
 			_ = sql.db.Find("store", &thingInfo, "WHERE Name = ?", name)
-			if thingInfo.Number > 150 {
-				// 控制价格浮动区间： -10%到10%
-				thing.Discount = 90 + rand.Intn(20)
+			thing = storeDiscount{
+				Name:     name,
+				Discount: rollDiscount(thingInfo.Number),
 			}
 			err = sql.db.Insert("stroeDiscount", &thing)
 			if err != nil {
@@ -612,12 +629,13 @@ func (sql *fishdb) refreshStroeInfo() (ok bool, err error) {
 	}
 	if refresh {
 		// 每天调控1种鱼
-		fish := fishList[rand.Intn(len(fishList))]
+		fishes := getFishList()
+		fish := fishes[rng.Intn(len(fishes))]
 		thingInfo := store{
 			Duration: time.Now().Unix(),
 			Name:     fish,
 			Type:     "fish",
-			Price:    priceList[fish] * discountList[fish] / 100,
+			Price:    priceOf(fish) * discountList[fish] / 100,
 		}
 		_ = sql.db.Find("store", &thingInfo, "WHERE Name = ?", fish)
 		thingInfo.Number += 100 - discountList[fish]
@@ -630,8 +648,8 @@ func (sql *fishdb) refreshStroeInfo() (ok bool, err error) {
 			Duration: time.Now().Unix(),
 			Name:     "初始木竿",
 			Type:     "pole",
-			Price:    priceList["木竿"] + priceList["木竿"]*discountList["木竿"]/100,
-			Other:    "30/0/0/0",
+			Price:    starterPolePrice(),
+			Other:    starterPoleOther,
 		}
 		_ = sql.db.Find("store", &thingInfo, "WHERE Name = '初始木竿'")
 		thingInfo.Number++
@@ -643,6 +661,15 @@ func (sql *fishdb) refreshStroeInfo() (ok bool, err error) {
 	return true, nil
 }
 
+// rollDiscount 每日价格波动(%), stock 为商店中该物品的库存
+func rollDiscount(stock int) int {
+	if stock > 150 {
+		// 控制价格浮动区间： -10%到10%
+		return 90 + rng.Intn(20)
+	}
+	return 50 + rng.Intn(150)
+}
+
 // 获取商店信息
 func (sql *fishdb) getStoreInfo() (thingInfos []store, err error) {
 	sql.Lock()
@@ -826,7 +853,7 @@ func (sql *fishdb) updateCanSalesFor(uid int64, saleName string, sales int) erro
 
 // 检测物品是否是垃圾
 func checkIsWaste(thing string) bool {
-	for _, v := range wasteList {
+	for _, v := range getWasteList() {
 		if v == thing {
 			return true
 		}
@@ -0,0 +1,614 @@
+package mcfish
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/floatbox/math"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/gg/factory"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+// 玩家市场挂单
+type marketOrder struct {
+	ID     int64  // 挂单编号
+	Seller int64  // 卖家
+	Name   string // 物品名称
+	Type   string
+	Number int    // 剩余数量
+	Price  int    // 单价
+	Other  string // 耐久/维修次数/诱钓/眷顾
+	Expire int64  // 到期时间
+}
+
+// 市场设置, 只有一行
+type marketConfig struct {
+	ID  int64 // 固定为 1
+	Tax int   // 交易税(%)
+}
+
+const (
+	marketExpire     = 3 * 24 * time.Hour // 挂单有效期
+	marketMaxOrders  = 10                 // 每人最多挂单数
+	marketPageSize   = 10
+	marketDefaultTax = 5 // 默认交易税(%)
+)
+
+var marketmu sync.Mutex
+
+func init() {
+	engine.OnRegex(`^挂单\s*(\S+?)\s+(\d+)\s+(\d+)$`, isThing, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		matched := ctx.State["regex_matched"].([]string)
+		thingName := matched[1]
+		number, _ := strconv.Atoi(matched[2])
+		price, _ := strconv.Atoi(matched[3])
+		if checkIsWaste(thingName) {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("垃圾就不要拿出来卖了"))
+			return
+		}
+		if number <= 0 || price <= 0 || price > 1000000 {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("数量应大于0, 单价应在1~1000000之间"))
+			return
+		}
+		isPole := strings.Contains(thingName, "竿") || thingName == "三叉戟"
+		if isPole {
+			number = 1
+			// 检测物品交易次数
+			n, err := dbdata.checkCanSalesFor(uid, thingName, number)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR at market.go.1]:", err))
+				return
+			}
+			if n <= 0 {
+				ctx.SendChain(message.Text("一天只能交易10把鱼竿,明天再来吧"))
+				return
+			}
+		}
+		if err := dbdata.expireOrders(); err != nil {
+			logrus.Warnln("[mcfish] 退回过期挂单失败:", err)
+		}
+		if n, err := dbdata.countOrdersOf(uid); err != nil || n >= marketMaxOrders {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你最多同时挂", marketMaxOrders, "单"))
+			return
+		}
+		articles, err := dbdata.getUserThingInfo(uid, thingName)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.2]:", err))
+			return
+		}
+		if len(articles) == 0 {
+			ctx.SendChain(message.Text("你的背包不存在该物品"))
+			return
+		}
+		index := 0
+		if len(articles) > 1 {
+			msg := make(message.Message, 0, 3+len(articles))
+			msg = append(msg, message.Reply(ctx.Event.MessageID), message.Text("找到以下物品:\n"))
+			for i, info := range articles {
+				msg = append(msg, message.Text("[", i, "] ", info.Name, "(", info.Other, ")\n"))
+			}
+			msg = append(msg, message.Text("————————\n输入对应序号进行挂单,或回复“取消”取消"))
+			ctx.Send(msg)
+			// 等待用户下一步选择
+			recv, cancel := zero.NewFutureEvent("message", 999, false, zero.RegexRule(`^(取消|\d+)$`), zero.CheckUser(ctx.Event.UserID)).Repeat()
+			defer cancel()
+			selected := false
+			for !selected {
+				select {
+				case <-time.After(time.Second * 120):
+					ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("等待超时,取消挂单")))
+					return
+				case e := <-recv:
+					nextcmd := e.Event.Message.String()
+					if nextcmd == "取消" {
+						ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("已取消挂单")))
+						return
+					}
+					index, err = strconv.Atoi(nextcmd)
+					if err != nil || index > len(articles)-1 {
+						ctx.SendChain(message.At(ctx.Event.UserID), message.Text("请输入正确的序号"))
+						continue
+					}
+					selected = true
+				}
+			}
+		}
+		thing := articles[index]
+		if thing.Number < number {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你只有", thing.Number, "个", thingName))
+			return
+		}
+		order, err := dbdata.placeOrder(uid, thing, number, price)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.3]:", err))
+			return
+		}
+		if isPole {
+			err = dbdata.updateCurseFor(uid, "sell", 1)
+			if err != nil {
+				logrus.Warnln(err)
+			}
+			err = dbdata.updateCanSalesFor(uid, thingName, number)
+			if err != nil {
+				logrus.Warnln(err)
+			}
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(
+			"挂单成功, 编号", order.ID, ": ", number, "个", order.displayName(), " 单价", price,
+			"\n成交时收取", dbdata.marketTax(), "%交易税, ", marketExpire/time.Hour/24, "天后未售出将自动退回"))
+	})
+	engine.OnRegex(`^钓鱼市场\s*(\d*)$`, getdb).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+		page, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+		if page < 1 {
+			page = 1
+		}
+		if err := dbdata.expireOrders(); err != nil {
+			logrus.Warnln("[mcfish] 退回过期挂单失败:", err)
+		}
+		orders, total, err := dbdata.getOrders(page)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.4]:", err))
+			return
+		}
+		if len(orders) == 0 {
+			ctx.SendChain(message.Text("市场上还没有挂单, 发送\"挂单 物品 数量 单价\"出售你的物品"))
+			return
+		}
+		picImage, err := drawMarketImage(ctx, orders, page, (total+marketPageSize-1)/marketPageSize)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.5]:", err))
+			return
+		}
+		pic, err := factory.ToBytes(picImage)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.6]:", err))
+			return
+		}
+		ctx.SendChain(message.ImageBytes(pic))
+	})
+	engine.OnRegex(`^购买挂单\s*(\d+)\s*(\d*)$`, getdb, jail.CheckFree).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		matched := ctx.State["regex_matched"].([]string)
+		id, _ := strconv.ParseInt(matched[1], 10, 64)
+		number, _ := strconv.Atoi(matched[2])
+		if number <= 0 {
+			number = 1
+		}
+		if err := dbdata.expireOrders(); err != nil {
+			logrus.Warnln("[mcfish] 退回过期挂单失败:", err)
+		}
+		order, ok := dbdata.getOrder(id)
+		if !ok {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("没有这个挂单"))
+			return
+		}
+		if order.Seller == uid {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("不能购买自己的挂单, 可以发送\"撤单 ", id, "\"下架"))
+			return
+		}
+		// 检测物品交易次数
+		number, err := dbdata.checkCanSalesFor(uid, order.Name, math.Min(number, order.Number))
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.7]:", err))
+			return
+		}
+		if number <= 0 {
+			ctx.SendChain(message.Text("今天的交易次数已用完,明天再来吧"))
+			return
+		}
+		cost, income, err := dbdata.buyOrder(uid, id, number)
+		if errors.Is(err, ledger.ErrNotEnough) {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你的", wallet.GetWalletName(), "不足以支付", order.Price*number))
+			return
+		}
+		if err != nil {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(err))
+			return
+		}
+		if strings.Contains(order.Name, "竿") {
+			err = dbdata.updateCurseFor(uid, "buy", 1)
+			if err != nil {
+				logrus.Warnln(err)
+			}
+		}
+		// 更新交易限制
+		err = dbdata.updateCanSalesFor(uid, order.Name, number)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR,记录鱼类交易数量失败，此次交易不记录]:", err))
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你用", cost, "购买了", number, "个", order.displayName()))
+		if ctx.Event.GroupID != 0 {
+			ctx.SendChain(message.At(order.Seller), message.Text("你的挂单", id, "卖出了", number, "个", order.Name, ", 扣税后收入", income))
+		}
+	})
+	engine.OnRegex(`^撤单\s*(\d+)$`, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+		id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+		err := dbdata.cancelOrder(ctx.Event.UserID, id)
+		if err != nil {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(err))
+			return
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("撤单成功, 物品已退回背包"))
+	})
+	engine.OnFullMatch("我的挂单", getdb).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+		if err := dbdata.expireOrders(); err != nil {
+			logrus.Warnln("[mcfish] 退回过期挂单失败:", err)
+		}
+		orders, err := dbdata.getOrdersOf(ctx.Event.UserID)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.8]:", err))
+			return
+		}
+		if len(orders) == 0 {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你没有挂单"))
+			return
+		}
+		msg := make(message.Message, 0, 2+len(orders))
+		msg = append(msg, message.Reply(ctx.Event.MessageID), message.Text("你的挂单:\n"))
+		for _, o := range orders {
+			msg = append(msg, message.Text("[", o.ID, "] ", o.displayName(), " 数量:", o.Number, " 单价:", o.Price,
+				" 剩余", time.Until(time.Unix(o.Expire, 0)).Round(time.Minute), "\n"))
+		}
+		ctx.Send(msg)
+	})
+	engine.OnRegex(`^设置市场税率\s*(\d+)$`, zero.SuperUserPermission, getdb).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		tax, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+		if tax > 50 {
+			ctx.SendChain(message.Text("税率应在0~50之间"))
+			return
+		}
+		err := dbdata.setMarketTax(tax)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at market.go.9]:", err))
+			return
+		}
+		ctx.SendChain(message.Text("市场税率已设置为", tax, "%"))
+	})
+}
+
+func (o *marketOrder) isPole() bool {
+	return strings.Contains(o.Name, "竿") || o.Name == "三叉戟"
+}
+
+func (o *marketOrder) displayName() string {
+	if o.Other != "" && o.Name != "美西螈" {
+		return o.Name + "(" + o.Other + ")"
+	}
+	return o.Name
+}
+
+// 获取市场税率
+func (sql *fishdb) marketTax() int {
+	sql.Lock()
+	defer sql.Unlock()
+	info := marketConfig{ID: 1, Tax: marketDefaultTax}
+	if sql.db.Create("marketConfig", &info) != nil {
+		return info.Tax
+	}
+	if sql.db.Find("marketConfig", &info, "WHERE ID = 1") != nil {
+		// 迁移旧版记在商店波动表中的税率
+		old := storeDiscount{}
+		if sql.db.Find("stroeDiscount", &old, "WHERE Name = 'marketTax'") == nil {
+			info.Tax = old.Discount
+			if sql.db.Insert("marketConfig", &info) == nil {
+				_ = sql.db.Del("stroeDiscount", "WHERE Name = 'marketTax'")
+			}
+		}
+	}
+	return info.Tax
+}
+
+// 设置市场税率
+func (sql *fishdb) setMarketTax(tax int) error {
+	sql.Lock()
+	defer sql.Unlock()
+	info := marketConfig{ID: 1, Tax: tax}
+	err := sql.db.Create("marketConfig", &info)
+	if err != nil {
+		return err
+	}
+	err = sql.db.Insert("marketConfig", &info)
+	if err == nil {
+		_ = sql.db.Del("stroeDiscount", "WHERE Name = 'marketTax'")
+	}
+	return err
+}
+
+// 挂单, 从背包中扣除物品
+func (sql *fishdb) placeOrder(uid int64, thing article, number, price int) (order marketOrder, err error) {
+	marketmu.Lock()
+	defer marketmu.Unlock()
+	thing.Number -= number
+	err = sql.updateUserThingInfo(uid, thing)
+	if err != nil {
+		return
+	}
+	order = marketOrder{
+		Seller: uid,
+		Name:   thing.Name,
+		Type:   thing.Type,
+		Number: number,
+		Price:  price,
+		Other:  thing.Other,
+		Expire: time.Now().Add(marketExpire).Unix(),
+	}
+	sql.Lock()
+	defer sql.Unlock()
+	err = sql.db.Create("market", &order)
+	if err != nil {
+		return
+	}
+	var max struct{ N int64 }
+	_ = sql.db.Query("SELECT IFNULL(MAX(ID), 0) FROM market", &max)
+	order.ID = max.N + 1
+	err = sql.db.Insert("market", &order)
+	return
+}
+
+// 获取一页挂单与挂单总数
+func (sql *fishdb) getOrders(page int) (orders []marketOrder, total int, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	order := marketOrder{}
+	err = sql.db.Create("market", &order)
+	if err != nil {
+		return
+	}
+	var n struct{ N int }
+	_ = sql.db.Query("SELECT COUNT(1) FROM market", &n)
+	total = n.N
+	if total == 0 {
+		return
+	}
+	err = sql.db.FindFor("market", &order, "ORDER BY Name, Price ASC LIMIT ? OFFSET ?", func() error {
+		orders = append(orders, order)
+		return nil
+	}, marketPageSize, (page-1)*marketPageSize)
+	return
+}
+
+// 获取用户的挂单
+func (sql *fishdb) getOrdersOf(uid int64) (orders []marketOrder, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	order := marketOrder{}
+	err = sql.db.Create("market", &order)
+	if err != nil {
+		return
+	}
+	if !sql.db.CanFind("market", "WHERE Seller = ?", uid) {
+		return
+	}
+	err = sql.db.FindFor("market", &order, "WHERE Seller = ? ORDER BY ID", func() error {
+		orders = append(orders, order)
+		return nil
+	}, uid)
+	return
+}
+
+func (sql *fishdb) countOrdersOf(uid int64) (int, error) {
+	orders, err := sql.getOrdersOf(uid)
+	return len(orders), err
+}
+
+func (sql *fishdb) getOrder(id int64) (order marketOrder, ok bool) {
+	sql.Lock()
+	defer sql.Unlock()
+	if sql.db.Create("market", &order) != nil {
+		return
+	}
+	ok = sql.db.Find("market", &order, "WHERE ID = ?", id) == nil
+	return
+}
+
+// 更新挂单, 数量为0时删除
+func (sql *fishdb) updateOrder(order *marketOrder) error {
+	sql.Lock()
+	defer sql.Unlock()
+	if order.Number <= 0 {
+		return sql.db.Del("market", "WHERE ID = ?", order.ID)
+	}
+	return sql.db.Insert("market", order)
+}
+
+// giveOrderThing 把挂单中的物品放入背包
+func (sql *fishdb) giveOrderThing(uid int64, order *marketOrder, number int) error {
+	newThing := article{
+		Duration: time.Now().Unix()*100 + order.ID%100,
+		Type:     order.Type,
+		Name:     order.Name,
+		Number:   number,
+		Other:    order.Other,
+	}
+	if !order.isPole() {
+		things, err := sql.getUserThingInfo(uid, order.Name)
+		if err != nil {
+			return err
+		}
+		if len(things) != 0 {
+			newThing = things[0]
+			newThing.Number += number
+		}
+	}
+	return sql.updateUserThingInfo(uid, newThing)
+}
+
+// 购买挂单, 返回花费与卖家的税后收入
+func (sql *fishdb) buyOrder(uid, id int64, number int) (cost, income int, err error) {
+	marketmu.Lock()
+	defer marketmu.Unlock()
+	order, ok := sql.getOrder(id)
+	if !ok {
+		return 0, 0, errors.New("你慢了一步,挂单已经被买走了")
+	}
+	number = math.Min(number, order.Number)
+	cost = order.Price * number
+	err = ledger.Spend(uid, cost, "mcfish", order.Seller, "市场购买"+order.Name)
+	if err != nil {
+		return
+	}
+	order.Number -= number
+	err = sql.updateOrder(&order)
+	if err == nil {
+		err = sql.giveOrderThing(uid, &order, number)
+		if err != nil { // 物品没能放入背包, 把数量还给挂单
+			order.Number += number
+			if rerr := sql.updateOrder(&order); rerr != nil {
+				logrus.Warnln("[mcfish] 恢复挂单", order.ID, "失败:", rerr)
+			}
+		}
+	}
+	if err != nil {
+		_ = ledger.Earn(uid, cost, "mcfish", order.Seller, "市场购买"+order.Name+"退回")
+		return
+	}
+	income = cost - cost*sql.marketTax()/100
+	err = ledger.Earn(order.Seller, income, "mcfish", uid, "市场出售"+order.Name)
+	if err != nil {
+		logrus.Warnln("[mcfish] 支付市场货款失败:", err)
+		err = nil
+	}
+	return
+}
+
+// 撤单, 物品退回背包
+func (sql *fishdb) cancelOrder(uid, id int64) error {
+	marketmu.Lock()
+	defer marketmu.Unlock()
+	order, ok := sql.getOrder(id)
+	if !ok || order.Seller != uid {
+		return errors.New("你没有这个挂单")
+	}
+	err := sql.giveOrderThing(uid, &order, order.Number)
+	if err != nil {
+		return err
+	}
+	order.Number = 0
+	return sql.updateOrder(&order)
+}
+
+// expireOrders 退回过期的挂单
+func (sql *fishdb) expireOrders() error {
+	marketmu.Lock()
+	defer marketmu.Unlock()
+	var expired []marketOrder
+	sql.Lock()
+	order := marketOrder{}
+	err := sql.db.Create("market", &order)
+	if err == nil && sql.db.CanFind("market", "WHERE Expire < ?", time.Now().Unix()) {
+		err = sql.db.FindFor("market", &order, "WHERE Expire < ?", func() error {
+			expired = append(expired, order)
+			return nil
+		}, time.Now().Unix())
+	}
+	sql.Unlock()
+	if err != nil {
+		return err
+	}
+	for i := range expired {
+		if err = sql.giveOrderThing(expired[i].Seller, &expired[i], expired[i].Number); err != nil {
+			return err
+		}
+		expired[i].Number = 0
+		if err = sql.updateOrder(&expired[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func drawMarketImage(ctx *zero.Ctx, orders []marketOrder, page, pages int) (picImage image.Image, err error) {
+	fontdata, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	canvas := gg.NewContext(1, 1)
+	err = canvas.ParseFontFace(fontdata, 100)
+	if err != nil {
+		return nil, err
+	}
+	titleW, titleH := canvas.MeasureString("玩家市场")
+
+	err = canvas.ParseFontFace(fontdata, 50)
+	if err != nil {
+		return nil, err
+	}
+	_, textH := canvas.MeasureString("高度")
+	idW, _ := canvas.MeasureString("编号")
+	nameW, _ := canvas.MeasureString("下界合金竿(100/100/0/0)")
+	numberW, _ := canvas.MeasureString("10000")
+	priceW, _ := canvas.MeasureString("1000000")
+	sellerW, _ := canvas.MeasureString("一二三四五六")
+
+	bolckW := int(10 + idW + 50 + nameW + 50 + numberW + 50 + priceW + 50 + sellerW + 10)
+	backY := 10 + int(titleH*2+10) + 10 + (len(orders)+3)*int(textH*2) + 10
+	canvas = gg.NewContext(bolckW, math.Max(backY, 500))
+	// 画底色
+	canvas.DrawRectangle(0, 0, float64(bolckW), float64(math.Max(backY, 500)))
+	canvas.SetRGBA255(150, 150, 150, 255)
+	canvas.Fill()
+
+	// 放字
+	canvas.SetColor(color.Black)
+	err = canvas.ParseFontFace(fontdata, 100)
+	if err != nil {
+		return nil, err
+	}
+	canvas.DrawString("玩家市场", 10, 10+titleH*1.2)
+	canvas.DrawLine(10, titleH*1.6, titleW, titleH*1.6)
+	canvas.SetLineWidth(3)
+	canvas.SetRGBA255(0, 0, 0, 255)
+	canvas.Stroke()
+
+	textDy := 10 + titleH*1.7
+	if err = canvas.ParseFontFace(fontdata, 50); err != nil {
+		return nil, err
+	}
+	idX := 10 + idW/2
+	nameX := 10 + idW + 50 + nameW/2
+	numberX := 10 + idW + 50 + nameW + 50 + numberW/2
+	priceX := 10 + idW + 50 + nameW + 50 + numberW + 50 + priceW/2
+	sellerX := 10 + idW + 50 + nameW + 50 + numberW + 50 + priceW + 50 + sellerW/2
+	canvas.DrawStringAnchored("编号", idX, textDy+textH/2, 0.5, 0.5)
+	canvas.DrawStringAnchored("名称", nameX, textDy+textH/2, 0.5, 0.5)
+	canvas.DrawStringAnchored("数量", numberX, textDy+textH/2, 0.5, 0.5)
+	canvas.DrawStringAnchored("单价", priceX, textDy+textH/2, 0.5, 0.5)
+	canvas.DrawStringAnchored("卖家", sellerX, textDy+textH/2, 0.5, 0.5)
+
+	for _, info := range orders {
+		textDy += textH * 2
+		seller := ctx.CardOrNickName(info.Seller)
+		if r := []rune(seller); len(r) > 6 {
+			seller = string(r[:5]) + "…"
+		}
+		canvas.DrawStringAnchored(strconv.FormatInt(info.ID, 10), idX, textDy+textH/2, 0.5, 0.5)
+		canvas.DrawStringAnchored(info.displayName(), nameX, textDy+textH/2, 0.5, 0.5)
+		canvas.DrawStringAnchored(strconv.Itoa(info.Number), numberX, textDy+textH/2, 0.5, 0.5)
+		canvas.DrawStringAnchored(strconv.Itoa(info.Price), priceX, textDy+textH/2, 0.5, 0.5)
+		canvas.DrawStringAnchored(seller, sellerX, textDy+textH/2, 0.5, 0.5)
+	}
+	textDy += textH * 2
+	if err = canvas.ParseFontFace(fontdata, 35); err != nil {
+		return nil, err
+	}
+	canvas.DrawStringAnchored("第"+strconv.Itoa(page)+"/"+strconv.Itoa(pages)+"页  发送\"购买挂单 编号 [数量]\"购买, 成交时卖家缴纳"+
+		strconv.Itoa(dbdata.marketTax())+"%交易税", 10, textDy+10+textH/2, 0, 0.5)
+	return canvas.Image(), nil
+}
@@ -20,6 +20,8 @@ import (
 	"github.com/FloatTech/zbputils/img/text"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
 )
 
 func init() {
@@ -42,7 +44,7 @@ func init() {
 		}
 		ctx.SendChain(message.ImageBytes(pic))
 	})
-	engine.OnRegex(`^消除(绑定|宝藏)诅咒(\d*)$`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+	engine.OnRegex(`^消除(绑定|宝藏)诅咒(\d*)$`, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 		number, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[2])
 		if number == 0 {
@@ -105,7 +107,7 @@ func init() {
 			ctx.SendChain(message.Text("[ERROR at fish.go.5.1]:", err))
 			return
 		}
-		msg := make(message.Message, 0, 20+len(thingList))
+		msg := make(message.Message, 0, 20+len(getThingList()))
 		msg = append(msg, message.At(uid), message.Text("\n大类概率:\n"))
 		probableList := make([]int, 4)
 		for _, info := range articlesInfo.ZoneInfo {
@@ -157,7 +159,10 @@ func init() {
 			}
 		}
 		msg = append(msg, message.Text("-----------\n鱼类概率:\n"))
-		for _, name := range fishList {
+		for _, name := range getFishList() {
+			if _, ok := probabilities[name]; !ok {
+				continue // 拓展包中的鱼只在对应地点出现
+			}
 			if name != "海豚" {
 				msg = append(msg, message.Text(name, " : ",
 					strconv.FormatFloat(float64(probabilities[name].Max-probabilities[name].Min)*float64(probableList[2])/100, 'f', 2, 64),
@@ -168,7 +173,7 @@ func init() {
 					"%\n"))
 			}
 		}
-		msg = append(msg, message.Text("-----------"))
+		msg = append(msg, message.Text("-----------\n以上为基础概率, 实际会受地点、时段、季节与天气影响, 发送\"钓鱼地点\"查看"))
 		ctx.Send(msg)
 	})
 	engine.OnFullMatch("查看钓鱼规则", getdb).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
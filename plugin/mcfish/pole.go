@@ -2,7 +2,6 @@
 package mcfish
 
 import (
-	"math/rand"
 	"strconv"
 	"strings"
 	"time"
@@ -10,10 +9,12 @@ import (
 	"github.com/FloatTech/zbputils/ctxext"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
 )
 
 func init() {
-	engine.OnRegex(`^装备(`+strings.Join(poleList, "|")+`)$`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+	engine.OnRegex(`^装备(`+strings.Join(poleList, "|")+`)$`, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 		equipInfo, err := dbdata.getUserEquip(uid)
 		if err != nil {
@@ -153,7 +154,7 @@ func init() {
 			),
 		)
 	})
-	engine.OnFullMatchGroup([]string{"修复鱼竿", "维修鱼竿"}, getdb).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+	engine.OnFullMatchGroup([]string{"修复鱼竿", "维修鱼竿"}, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 		equipInfo, err := dbdata.getUserEquip(uid)
 		if err != nil {
@@ -254,14 +255,14 @@ func init() {
 			equipInfo.Durable = durationList[equipInfo.Equip]
 		}
 		msg := ""
-		if newEquipInfo.Induce != 0 && rand.Intn(100) < 50 {
+		if newEquipInfo.Induce != 0 && rng.Intn(100) < 50 {
 			equipInfo.Induce += newEquipInfo.Induce
 			if equipInfo.Induce > 3 {
 				equipInfo.Induce = 3
 			}
 			msg += ",诱钓等级提升至" + enchantLevel[equipInfo.Induce]
 		}
-		if newEquipInfo.Favor != 0 && rand.Intn(100) < 50 {
+		if newEquipInfo.Favor != 0 && rng.Intn(100) < 50 {
 			equipInfo.Favor += newEquipInfo.Favor
 			if equipInfo.Favor > 3 {
 				equipInfo.Favor = 3
@@ -285,7 +286,7 @@ func init() {
 			),
 		)
 	})
-	engine.OnRegex(`^附魔(诱钓|海之眷顾)$`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+	engine.OnRegex(`^附魔(诱钓|海之眷顾)$`, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 		equipInfo, err := dbdata.getUserEquip(uid)
 		if err != nil {
@@ -311,7 +312,7 @@ func init() {
 		err = dbdata.updateUserThingInfo(uid, bookInfo)
 		number := 0
 		if err == nil {
-			if rand.Intn(100) > 50 {
+			if rng.Intn(100) > 50 {
 				ctx.SendChain(message.Text("附魔失败了"))
 				return
 			}
@@ -342,7 +343,7 @@ func init() {
 		}
 		ctx.SendChain(message.Text("附魔成功,", book, "等级提高至", enchantLevel[number]))
 	})
-	engine.OnRegex(`^合成(.+竿|三叉戟)$`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+	engine.OnRegex(`^合成(.+竿|三叉戟)$`, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 		thingList := []string{"木竿", "铁竿", "金竿", "钻石竿", "下界合金竿", "三叉戟"}
 		thingName := ctx.State["regex_matched"].([]string)[1]
@@ -442,7 +443,7 @@ func init() {
 									return
 								}
 							}
-							if rand.Intn(100) < 90 {
+							if rng.Intn(100) < 90 {
 								attribute := strconv.Itoa(durationList[thingName]) + "/0/" + strconv.Itoa(avgInduce) + "/" + strconv.Itoa(avgFavor)
 								newthing := article{
 									Duration: time.Now().Unix() + int64(batch*10),
@@ -519,7 +520,7 @@ func init() {
 			favorLevel += poles[index].Favor
 			induceLevel += poles[index].Induce
 		}
-		if rand.Intn(100) >= 90 {
+		if rng.Intn(100) >= 90 {
 			ctx.Send(
 				message.ReplyWithMessage(ctx.Event.MessageID,
 					message.Text("合成失败,材料已销毁"),
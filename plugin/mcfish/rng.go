@@ -0,0 +1,35 @@
+package mcfish
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockedRand 并发安全的随机数
+type lockedRand struct {
+	sync.Mutex
+	r *rand.Rand
+}
+
+// rng 钓鱼中所有随机数的来源, 固定种子后可以复现钓鱼、商店波动、附魔与合成的结果
+var rng = &lockedRand{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// setRandSeed 替换随机数来源的种子, 用于模拟与测试
+func setRandSeed(seed int64) {
+	rng.Lock()
+	defer rng.Unlock()
+	rng.r = rand.New(rand.NewSource(seed))
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.Lock()
+	defer l.Unlock()
+	return l.r.Intn(n)
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.Lock()
+	defer l.Unlock()
+	return l.r.Float64()
+}
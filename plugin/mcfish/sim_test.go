@@ -0,0 +1,224 @@
+package mcfish
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test ./plugin/mcfish -run TestSimulateEconomy -v -args -mcfish.players 200 -mcfish.days 60
+var (
+	simPlayers = flag.Int("mcfish.players", 20, "模拟的玩家数")
+	simDays    = flag.Int("mcfish.days", 14, "模拟的天数")
+	simSeed    = flag.Int64("mcfish.seed", 1, "随机数种子")
+)
+
+// 测试使用仓库中的物品信息, 在init读取之前放入数据目录, 无需联网下载
+var _ = func() error {
+	data, err := os.ReadFile("testdata/articlesInfo.json")
+	if err == nil {
+		err = os.MkdirAll(engine.DataFolder(), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(engine.DataFolder()+"articlesInfo.json", data, 0644)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}()
+
+// 模拟中的玩家, 每天钓满次数后把鱼、垃圾和多余的鱼竿卖给商店
+type simPlayer struct {
+	wallet int
+	equip  equip
+	pack   map[string]int // 非鱼竿物品
+	poles  []article      // 背包中的鱼竿
+}
+
+type simDay struct {
+	prices map[string]int // 当日单价
+	wealth []int          // 从低到高
+	items  int            // 玩家持有的物品总数
+	stock  int            // 商店库存总数
+	earned int            // 当日卖给商店的总收入
+}
+
+// simulate 用真实的概率、波动与定价规则模拟海洋中的钓鱼经济
+func simulate(seed int64, players, days int) []simDay {
+	setRandSeed(seed)
+	defer setRandSeed(time.Now().UnixNano())
+	oldDiscount := discountList
+	discountList = make(map[string]int, len(getThingList()))
+	defer func() { discountList = oldDiscount }()
+
+	stock := make(map[string]int, len(getThingList()))
+	ps := make([]simPlayer, players)
+	for i := range ps {
+		ps[i] = simPlayer{wallet: 500, pack: map[string]int{}}
+	}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	report := make([]simDay, 0, days)
+	for d := 0; d < days; d++ {
+		for _, name := range getThingList() {
+			discountList[name] = rollDiscount(stock[name])
+		}
+		env := newFishingEnv(defaultZone, start.AddDate(0, 0, d))
+		day := simDay{prices: make(map[string]int, len(getFishList()))}
+		for i := range ps {
+			day.earned += ps[i].play(env, stock)
+		}
+		for _, name := range getFishList() {
+			day.prices[name] = thingPrice(name, "")
+		}
+		for i := range ps {
+			day.wealth = append(day.wealth, ps[i].wallet)
+			day.items += len(ps[i].poles)
+			for _, n := range ps[i].pack {
+				day.items += n
+			}
+		}
+		sort.Ints(day.wealth)
+		for _, n := range stock {
+			day.stock += n
+		}
+		report = append(report, day)
+	}
+	return report
+}
+
+// play 钓一天鱼并出售收获, 返回卖给商店的收入
+func (p *simPlayer) play(env *fishingEnv, stock map[string]int) (earned int) {
+	if p.equip.Durable <= 0 && !p.equipPole() {
+		cost := buyCost(starterPolePrice(), 1, -1, 0)
+		if p.wallet < cost {
+			return
+		}
+		p.wallet -= cost
+		p.poles = append(p.poles, article{Name: "木竿", Type: "pole", Number: 1, Other: starterPoleOther})
+		p.equipPole()
+	}
+	fishCount := 0
+	for name, n := range p.pack {
+		if strings.Contains(name, "鱼") {
+			fishCount += n
+		}
+	}
+	local := fishProbabilities(p.equip, fishCount, p.pack["海豚"] != 0)
+	env.applyBonus(local)
+	for i := 0; i < FishLimit; i++ {
+		if p.equip.Durable <= 0 && !p.equipPole() {
+			break
+		}
+		p.equip.Durable--
+		name, typ, _ := catchOnce(local, env)
+		switch {
+		case name == "":
+		case strings.Contains(name, "竿"):
+			p.poles = append(p.poles, article{Name: name, Type: typ, Number: 1, Other: newPoleOther(name)})
+		default:
+			p.pack[name]++
+		}
+	}
+	for name, n := range p.pack {
+		if typ := typeOf(name); typ != "fish" && typ != "waste" || name == "海豚" {
+			continue
+		}
+		earned += sellPrice(thingPrice(name, "")) * n
+		if !checkIsWaste(name) {
+			stock[name] = min(stock[name]+n, 255)
+		}
+		delete(p.pack, name)
+	}
+	// 留一根最值钱的鱼竿备用
+	sort.Slice(p.poles, func(i, j int) bool {
+		return thingPrice(p.poles[i].Name, p.poles[i].Other) > thingPrice(p.poles[j].Name, p.poles[j].Other)
+	})
+	for len(p.poles) > 1 {
+		last := p.poles[len(p.poles)-1]
+		earned += sellPrice(max(thingPrice(last.Name, last.Other), 0))
+		p.poles = p.poles[:len(p.poles)-1]
+	}
+	p.wallet += earned
+	return
+}
+
+// equipPole 装备背包中的鱼竿
+func (p *simPlayer) equipPole() bool {
+	if len(p.poles) == 0 {
+		return false
+	}
+	pole := p.poles[0]
+	p.poles = p.poles[1:]
+	info := strings.Split(pole.Other, "/")
+	durable, _ := strconv.Atoi(info[0])
+	induce, _ := strconv.Atoi(info[2])
+	favor, _ := strconv.Atoi(info[3])
+	p.equip = equip{Equip: pole.Name, Durable: durable, Induce: induce, Favor: favor}
+	return durable > 0
+}
+
+func typeOf(name string) string {
+	for _, info := range getArticles() {
+		if info.Name == name {
+			return info.Type
+		}
+	}
+	return ""
+}
+
+func gini(sorted []int) float64 {
+	total, weighted := 0, 0
+	for i, v := range sorted {
+		total += v
+		weighted += (i + 1) * v
+	}
+	if total == 0 {
+		return 0
+	}
+	n := len(sorted)
+	return float64(2*weighted)/float64(n*total) - float64(n+1)/float64(n)
+}
+
+func TestSimulationIsDeterministic(t *testing.T) {
+	a := simulate(42, 5, 3)
+	b := simulate(42, 5, 3)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("相同的种子得到了不同的模拟结果")
+	}
+}
+
+func TestSimulateEconomy(t *testing.T) {
+	report := simulate(*simSeed, *simPlayers, *simDays)
+	var sb strings.Builder
+	sb.WriteString("\n天数\t中位数\tP90\t最富\t基尼\t持有物品\t商店库存\t当日收入")
+	for _, name := range getFishList() {
+		sb.WriteString("\t")
+		sb.WriteString(name)
+	}
+	for d, day := range report {
+		n := len(day.wealth)
+		sb.WriteString("\n" + strconv.Itoa(d+1))
+		sb.WriteString("\t" + strconv.Itoa(day.wealth[n/2]))
+		sb.WriteString("\t" + strconv.Itoa(day.wealth[n*9/10]))
+		sb.WriteString("\t" + strconv.Itoa(day.wealth[n-1]))
+		sb.WriteString("\t" + strconv.FormatFloat(gini(day.wealth), 'f', 3, 64))
+		sb.WriteString("\t" + strconv.Itoa(day.items))
+		sb.WriteString("\t" + strconv.Itoa(day.stock))
+		sb.WriteString("\t" + strconv.Itoa(day.earned))
+		for _, name := range getFishList() {
+			sb.WriteString("\t" + strconv.Itoa(day.prices[name]))
+		}
+	}
+	t.Log("规则V"+version, sb.String())
+	for _, day := range report {
+		if day.wealth[0] < 0 {
+			t.Fatal("模拟中出现了负资产")
+		}
+	}
+}
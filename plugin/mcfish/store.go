@@ -19,6 +19,9 @@ import (
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/extension/rate"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 )
 
 var (
@@ -43,6 +46,16 @@ func limitSet(ctx *zero.Ctx) *rate.Limiter {
 	return storeLimiter.Load(ctx.Event.UserID)
 }
 
+// isThing 匹配的是否为物品, 包括拓展包中的物品
+func isThing(ctx *zero.Ctx) bool {
+	return isThingName(ctx.State["regex_matched"].([]string)[1])
+}
+
+// isStoreThing 匹配的是否为商店可购买的物品
+func isStoreThing(ctx *zero.Ctx) bool {
+	return ctx.State["regex_matched"].([]string)[1] == "初始木竿" || isThing(ctx)
+}
+
 func init() {
 	engine.OnFullMatchGroup([]string{"钓鱼看板", "钓鱼商店"}, getdb, refreshFish).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
 		infos, err := dbdata.getStoreInfo()
@@ -67,7 +80,7 @@ func init() {
 		}
 		ctx.SendChain(message.ImageBytes(pic))
 	})
-	engine.OnRegex(`^出售(`+strings.Join(thingList, "|")+`)\s*(\d*)$`, getdb, refreshFish).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+	engine.OnRegex(`^出售(\S+?)\s*(\d*)$`, isThing, getdb, jail.CheckFree, refreshFish).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 		thingName := ctx.State["regex_matched"].([]string)[1]
 		number, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[2])
@@ -153,20 +166,8 @@ func init() {
 			number = thing.Number
 		}
 
-		var pice int
-		if strings.Contains(thingName, "竿") || thingName == "三叉戟" {
-			poleInfo := strings.Split(articles[index].Other, "/")
-			durable, _ := strconv.Atoi(poleInfo[0])
-			maintenance, _ := strconv.Atoi(poleInfo[1])
-			induceLevel, _ := strconv.Atoi(poleInfo[2])
-			favorLevel, _ := strconv.Atoi(poleInfo[3])
-			pice = (priceList[thingName] - (durationList[thingName] - durable) - maintenance*2 +
-				induceLevel*600*discountList["诱钓"]/100 +
-				favorLevel*1800*discountList["海之眷顾"]/100) * discountList[thingName] / 100
-		} else {
-			pice = priceList[thingName] * discountList[thingName] / 100
-		}
-		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("是否接受商店将以", pice*number*8/10, "收购", number, "个", thingName, "?\n回答\"是\"或\"否\"")))
+		pice := thingPrice(thingName, articles[index].Other)
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("是否接受商店将以", sellPrice(pice*number), "收购", number, "个", thingName, "?\n回答\"是\"或\"否\"")))
 		// 等待用户下一步选择
 		recv, cancel1 := zero.NewFutureEvent("message", 999, false, zero.RegexRule(`^(是|否)$`), zero.CheckUser(ctx.Event.UserID)).Repeat()
 		defer cancel1()
@@ -254,7 +255,7 @@ func init() {
 		}
 		newCommodity := store{}
 		if strings.Contains(thing.Name, "竿") || thing.Name == "三叉戟" {
-			if pice >= priceList[thing.Name]*2 { // 无附魔的不要
+			if pice >= priceOf(thing.Name)*2 { // 无附魔的不要
 				newCommodity = store{
 					Duration: time.Now().Unix(),
 					Type:     "pole",
@@ -297,8 +298,8 @@ func init() {
 				return
 			}
 		}
-		pice = pice * 8 / 10
-		err = wallet.InsertWalletOf(uid, pice*number)
+		pice = sellPrice(pice)
+		err = ledger.Earn(uid, pice*number, "mcfish", 0, "出售"+thingName)
 		if err != nil {
 			ctx.SendChain(message.Text("[ERROR at store.go.10]:", err))
 			return
@@ -317,7 +318,7 @@ func init() {
 
 		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("成功出售", thingName, "：", number, "个", ",你赚到了", pice*number, msg)))
 	})
-	engine.OnRegex(`^出售所有垃圾`, getdb, refreshFish).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+	engine.OnRegex(`^出售所有垃圾`, getdb, jail.CheckFree, refreshFish).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 
 		articles, err := dbdata.getUserTypeInfo(uid, "waste")
@@ -341,7 +342,7 @@ func init() {
 
 		pice := 0
 		for _, info := range articles {
-			pice += (priceList[info.Name] * discountList[info.Name] / 100) * info.Number * 8 / 10
+			pice += sellPrice((priceOf(info.Name) * discountList[info.Name] / 100) * info.Number)
 		}
 
 		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("是否接受回收站将以", pice, "收购全部垃圾", "?\n回答\"是\"或\"否\"")))
@@ -386,14 +387,14 @@ func init() {
 				return
 			}
 		}
-		err = wallet.InsertWalletOf(uid, pice)
+		err = ledger.Earn(uid, pice, "mcfish", 0, "出售垃圾")
 		if err != nil {
 			ctx.SendChain(message.Text("[ERROR，出售垃圾失败，回收站卷款跑路了]:", err))
 			return
 		}
 		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("出售成功,你赚到了", pice, msg)))
 	})
-	engine.OnRegex(`^购买(`+strings.Join(thingList, "|")+`|初始木竿)\s*(\d*)$`, getdb, refreshFish).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
+	engine.OnRegex(`^购买(\S+?)\s*(\d*)$`, isStoreThing, getdb, jail.CheckFree, refreshFish).SetBlock(true).Limit(limitSet).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 		thingName := ctx.State["regex_matched"].([]string)[1]
 		number, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[2])
@@ -463,22 +464,10 @@ func init() {
 		index := 0
 		pice := make([]int, 0, len(thingInfos))
 		for _, info := range thingInfos {
-			if strings.Contains(thingName, "竿") || thingName == "三叉戟" {
-				poleInfo := strings.Split(info.Other, "/")
-				durable, _ := strconv.Atoi(poleInfo[0])
-				maintenance, _ := strconv.Atoi(poleInfo[1])
-				induceLevel, _ := strconv.Atoi(poleInfo[2])
-				favorLevel, _ := strconv.Atoi(poleInfo[3])
-				thingPice := (priceList[info.Name] - (durationList[info.Name] - durable) - maintenance*2 +
-					induceLevel*600*discountList["诱钓"]/100 +
-					favorLevel*1800*discountList["海之眷顾"]/100) * discountList[info.Name] / 100
-				if strings.Contains(thingName, "初始木竿") {
-					thingPice = priceList["木竿"] + priceList["木竿"]*discountList["木竿"]/100
-				}
-				pice = append(pice, thingPice)
+			if strings.Contains(thingName, "初始木竿") {
+				pice = append(pice, starterPolePrice())
 			} else {
-				thingPice := priceList[info.Name] * discountList[info.Name] / 100
-				pice = append(pice, thingPice)
+				pice = append(pice, thingPrice(info.Name, info.Other))
 			}
 		}
 		if len(thingInfos) > 1 {
@@ -536,8 +525,6 @@ func init() {
 			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("商店数量不足")))
 			return
 		}
-		price := pice[index] * number
-
 		msg := ""
 		times := math.Min(3, number)
 		coupon, err := dbdata.useCouponAt(uid, times)
@@ -546,7 +533,6 @@ func init() {
 		}
 		if coupon != -1 {
 			msg += "\n(半价福利还有" + strconv.Itoa(3-coupon) + "次)"
-			price = pice[index]*(number-coupon) + (pice[index]/2)*coupon
 		} else {
 			err = dbdata.updateBuyTimeFor(uid, 1)
 			if err != nil {
@@ -560,8 +546,8 @@ func init() {
 		}
 		if curse != 0 {
 			msg += "\n(你身上绑定了" + strconv.Itoa(curse) + "层诅咒)"
-			price = price * (100 + 10*curse) / 100
 		}
+		price := buyCost(pice[index], number, coupon, curse)
 
 		money := wallet.GetWalletOf(uid)
 		if money < price {
@@ -607,7 +593,7 @@ func init() {
 			ctx.SendChain(message.Text("[ERROR at store.go.12]:", err))
 			return
 		}
-		err = wallet.InsertWalletOf(uid, -price)
+		err = ledger.Spend(uid, price, "mcfish", 0, "购买"+thingName)
 		if err != nil {
 			ctx.SendChain(message.Text("[ERROR at store.go.13]:", err))
 			return
@@ -660,6 +646,46 @@ func init() {
 	})
 }
 
+// starterPolePrice 每日上架的初始木竿的单价
+func starterPolePrice() int {
+	return priceOf("木竿") + priceOf("木竿")*discountList["木竿"]/100
+}
+
+// sellPrice 商店以今日价格的八成收购
+func sellPrice(pice int) int {
+	return pice * 8 / 10
+}
+
+// buyCost 在商店购买number个单价为pice的物品的花费, coupon为使用的半价券数(-1为未使用), curse为诅咒层数
+func buyCost(pice, number, coupon, curse int) int {
+	price := pice * number
+	if coupon != -1 {
+		price = pice*(number-coupon) + (pice/2)*coupon
+	}
+	if curse != 0 {
+		price = price * (100 + 10*curse) / 100
+	}
+	return price
+}
+
+// thingPrice 物品今日的单价, 鱼竿按耐久、维修次数与附魔计算
+func thingPrice(name, other string) int {
+	if !strings.Contains(name, "竿") && name != "三叉戟" {
+		return priceOf(name) * discountList[name] / 100
+	}
+	poleInfo := strings.Split(other, "/")
+	if len(poleInfo) < 4 {
+		return priceOf(name) * discountList[name] / 100
+	}
+	durable, _ := strconv.Atoi(poleInfo[0])
+	maintenance, _ := strconv.Atoi(poleInfo[1])
+	induceLevel, _ := strconv.Atoi(poleInfo[2])
+	favorLevel, _ := strconv.Atoi(poleInfo[3])
+	return (priceOf(name) - (durationList[name] - durable) - maintenance*2 +
+		induceLevel*600*discountList["诱钓"]/100 +
+		favorLevel*1800*discountList["海之眷顾"]/100) * discountList[name] / 100
+}
+
 func drawStroeEmptyImage() (picImage image.Image, err error) {
 	fontdata, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
 	if err != nil {
@@ -742,8 +768,8 @@ func drawStroeInfoImage(stroeInfo []store) (picImage image.Image, err error) {
 	textDx, textDh := canvas.MeasureString("下界合金竿(均价1000)")
 	valueDx, _ := canvas.MeasureString("+100%")
 	i := 0
-	for _, name := range thingList {
-		text := name + "(均价" + strconv.Itoa(priceList[name]) + ") "
+	for _, name := range getThingList() {
+		text := name + "(均价" + strconv.Itoa(priceOf(name)) + ") "
 
 		if i == 2 {
 			i = 0
@@ -799,12 +825,12 @@ func drawStroeInfoImage(stroeInfo []store) (picImage image.Image, err error) {
 			maintenance, _ := strconv.Atoi(poleInfo[1])
 			induceLevel, _ := strconv.Atoi(poleInfo[2])
 			favorLevel, _ := strconv.Atoi(poleInfo[3])
-			pice = (priceList[info.Name] - (durationList[info.Name] - durable) - maintenance*2 + induceLevel*600 + favorLevel*1800) * discountList[info.Name] / 100
+			pice = (priceOf(info.Name) - (durationList[info.Name] - durable) - maintenance*2 + induceLevel*600 + favorLevel*1800) * discountList[info.Name] / 100
 			if strings.Contains(name, "初始木竿") {
-				pice = priceList["木竿"] + priceList["木竿"]*discountList["木竿"]/100
+				pice = starterPolePrice()
 			}
 		} else {
-			pice = priceList[info.Name] * discountList[info.Name] / 100
+			pice = priceOf(info.Name) * discountList[info.Name] / 100
 		}
 
 		canvas.DrawStringAnchored(name, 10+nameW/2, textDy+textH/2, 0.5, 0.5)
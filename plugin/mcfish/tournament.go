@@ -0,0 +1,500 @@
+package mcfish
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	sql "github.com/FloatTech/sqlite"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+// 钓鱼比赛
+type tournament struct {
+	ID      int64
+	SelfID  int64  // 举办时的bot, 用于公布结果
+	GroupID int64  // 群号
+	Owner   int64  // 举办者
+	Mode    string // 总价值 | 最稀有
+	Fee     int    // 报名费
+	Bonus   int    // 举办者提供的奖金
+	Start   int64
+	End     int64
+	Status  int // 0未开始 1进行中 2已结束 3已取消
+}
+
+// 参赛记录
+type entrant struct {
+	Key    string // 比赛ID_用户
+	TID    int64
+	UID    int64
+	Score  int    // 总价值 或 最稀有收获的稀有度
+	Best   string // 最稀有的收获
+	Number int    // 收获数量
+	Paid   int    // 已交报名费
+}
+
+type tournamentdb struct {
+	sync.Mutex
+	db sql.Sqlite
+}
+
+const (
+	modeValue  = "总价值"
+	modeRarest = "最稀有"
+)
+
+// 前三名奖池分成(%)
+var prizeShare = [...]int{50, 30, 20}
+
+var tdb = &tournamentdb{}
+
+func init() {
+	tdb.db = sql.New(engine.DataFolder() + "tournament.db")
+	err := tdb.db.Open(time.Hour)
+	if err == nil {
+		err = tdb.db.Create("tournament", &tournament{})
+	}
+	if err == nil {
+		err = tdb.db.Create("entrant", &entrant{})
+	}
+	if err != nil {
+		logrus.Errorln("[mcfish] 打开比赛数据库失败:", err)
+		return
+	}
+
+	// 定时开始与结算比赛, 重启后继续
+	go func() {
+		for range time.NewTicker(time.Minute).C {
+			tdb.tick()
+		}
+	}()
+
+	engine.OnRegex(`^举办钓鱼比赛\s*(总价值|最稀有)\s*(\d+)\s*(分钟|小时)(?:\s*(\d+)分钟后开始)?(?:\s*报名费\s*(\d+))?(?:\s*奖金\s*(\d+))?$`,
+		zero.OnlyGroup, zero.AdminPermission, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByGroup).Handle(func(ctx *zero.Ctx) {
+		matched := ctx.State["regex_matched"].([]string)
+		n, _ := strconv.Atoi(matched[2])
+		d := time.Duration(n) * time.Minute
+		if matched[3] == "小时" {
+			d = time.Duration(n) * time.Hour
+		}
+		if d < 10*time.Minute || d > 7*24*time.Hour {
+			ctx.SendChain(message.Text("比赛时长应在10分钟到7天之间"))
+			return
+		}
+		delay, _ := strconv.Atoi(matched[4])
+		fee, _ := strconv.Atoi(matched[5])
+		bonus, _ := strconv.Atoi(matched[6])
+		start := time.Now().Add(time.Duration(delay) * time.Minute)
+		t := tournament{
+			SelfID:  ctx.Event.SelfID,
+			GroupID: ctx.Event.GroupID,
+			Owner:   ctx.Event.UserID,
+			Mode:    matched[1],
+			Fee:     fee,
+			Bonus:   bonus,
+			Start:   start.Unix(),
+			End:     start.Add(d).Unix(),
+		}
+		if delay == 0 {
+			t.Status = 1
+		}
+		err := tdb.create(&t)
+		if errors.Is(err, ledger.ErrNotEnough) {
+			ctx.SendChain(message.Text("你的", wallet.GetWalletName(), "不足以提供", bonus, "奖金"))
+			return
+		}
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at tournament.go.1]:", err))
+			return
+		}
+		ctx.SendChain(message.Text(t.describe(), "\n\n", joinTips(&t)))
+	})
+	engine.OnFullMatch("取消钓鱼比赛", zero.OnlyGroup, zero.AdminPermission).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		t, err := tdb.cancel(ctx.Event.GroupID)
+		if err != nil {
+			ctx.SendChain(message.Text(err))
+			return
+		}
+		ctx.SendChain(message.Text("钓鱼比赛#", t.ID, "已取消, 报名费与奖金已退回"))
+	})
+	engine.OnFullMatch("报名钓鱼比赛", zero.OnlyGroup, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).Handle(func(ctx *zero.Ctx) {
+		t, err := tdb.join(ctx.Event.GroupID, ctx.Event.UserID)
+		if errors.Is(err, ledger.ErrNotEnough) {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你的", wallet.GetWalletName(), "不足以支付报名费"))
+			return
+		}
+		if err != nil {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(err))
+			return
+		}
+		msg := "报名成功"
+		if t.Fee > 0 {
+			msg += ", 已支付报名费" + strconv.Itoa(t.Fee) + wallet.GetWalletName()
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(msg, "\n比赛期间在本群钓到的东西都会计入成绩"))
+	})
+	engine.OnFullMatchGroup([]string{"钓鱼比赛", "钓鱼比赛排行"}, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByGroup).Handle(func(ctx *zero.Ctx) {
+		t, ok := tdb.current(ctx.Event.GroupID)
+		if !ok {
+			ctx.SendChain(message.Text("本群当前没有钓鱼比赛\n管理员可以发送\"举办钓鱼比赛 总价值|最稀有 时长[分钟|小时] [x分钟后开始] [报名费x] [奖金x]\"举办"))
+			return
+		}
+		ctx.SendChain(message.Text(t.describe(), "\n\n", tdb.leaderboard(ctx, &t, 10)))
+	})
+}
+
+// rarityOf 物品的稀有度, 越难钓到越高
+func rarityOf(name string) int {
+	for _, info := range getArticles() {
+		if info.Name != name {
+			continue
+		}
+		zone := probabilities[info.Type]
+		zoneP := zone.Max - zone.Min
+		if zoneP <= 0 {
+			zoneP = 1
+		}
+		p := info.Probability
+		if p <= 0 {
+			// 没有单独概率的物品在同类中均分
+			same := 0
+			for _, v := range getArticles() {
+				if v.Type == info.Type {
+					same++
+				}
+			}
+			p = 100 / max(same, 1)
+		}
+		return 1000000 / (zoneP * max(p, 1))
+	}
+	return 0
+}
+
+// recordCatch 把群内的钓鱼收获计入进行中的比赛, 返回提示信息
+//
+// 总价值模式下会扣除美西螈吃掉的鱼(见 pickFishFor)的价值
+func recordCatch(ctx *zero.Ctx, uid int64, things, eaten map[string]int) string {
+	gid := ctx.Event.GroupID
+	if gid == 0 {
+		return ""
+	}
+	t, ok := tdb.current(gid)
+	if !ok || t.Status != 1 {
+		return ""
+	}
+	tdb.Lock()
+	defer tdb.Unlock()
+	key := strconv.FormatInt(t.ID, 10) + "_" + strconv.FormatInt(uid, 10)
+	e := entrant{Key: key, TID: t.ID, UID: uid}
+	err := tdb.db.Find("entrant", &e, "WHERE Key = ?", key)
+	if err != nil && t.Fee > 0 {
+		// 有报名费的比赛需要先报名
+		return ""
+	}
+	before := e.Score
+	for name, number := range things {
+		if name == "赛博空气" || number <= 0 {
+			continue
+		}
+		e.Number += number
+		switch t.Mode {
+		case modeValue:
+			e.Score += priceOf(name) * number
+		case modeRarest:
+			if r := rarityOf(name); r > e.Score {
+				e.Score = r
+				e.Best = name
+			}
+		}
+	}
+	if t.Mode == modeValue {
+		for name, number := range eaten {
+			e.Score -= priceOf(name) * number
+		}
+	}
+	if err = tdb.db.Insert("entrant", &e); err != nil {
+		logrus.Warnln("[mcfish] 记录比赛成绩失败:", err)
+		return ""
+	}
+	switch {
+	case t.Mode == modeValue:
+		diff := strconv.Itoa(e.Score - before)
+		if e.Score >= before {
+			diff = "+" + diff
+		}
+		return "\n(钓鱼比赛#" + strconv.FormatInt(t.ID, 10) + " 总价值" + diff + ")"
+	case e.Score > before:
+		return "\n(钓鱼比赛#" + strconv.FormatInt(t.ID, 10) + " 新纪录: " + e.Best + ", 稀有度" + strconv.Itoa(e.Score) + ")"
+	}
+	return ""
+}
+
+func joinTips(t *tournament) string {
+	if t.Fee > 0 {
+		return "发送\"报名钓鱼比赛\"报名, 报名费" + strconv.Itoa(t.Fee) + wallet.GetWalletName() + ", 全部计入奖池"
+	}
+	return "免费参赛, 比赛期间在本群钓鱼即自动参赛"
+}
+
+func (t *tournament) describe() string {
+	var sb strings.Builder
+	sb.WriteString("钓鱼比赛#")
+	sb.WriteString(strconv.FormatInt(t.ID, 10))
+	sb.WriteString(" [")
+	sb.WriteString(t.Mode)
+	sb.WriteString("]\n")
+	switch t.Status {
+	case 0:
+		sb.WriteString("未开始, ")
+	case 1:
+		sb.WriteString("进行中, ")
+	}
+	sb.WriteString(time.Unix(t.Start, 0).Format("01/02 15:04"))
+	sb.WriteString(" ~ ")
+	sb.WriteString(time.Unix(t.End, 0).Format("01/02 15:04"))
+	if t.Mode == modeValue {
+		sb.WriteString("\n按比赛期间钓到物品的总价值排名")
+	} else {
+		sb.WriteString("\n按比赛期间钓到的最稀有物品排名")
+	}
+	sb.WriteString("\n奖金: ")
+	sb.WriteString(strconv.Itoa(t.Bonus))
+	sb.WriteString(wallet.GetWalletName())
+	if t.Fee > 0 {
+		sb.WriteString(" + 全部报名费")
+	}
+	sb.WriteString("\n前三名按50%/30%/20%瓜分奖池")
+	return sb.String()
+}
+
+func (sql *tournamentdb) create(t *tournament) error {
+	sql.Lock()
+	defer sql.Unlock()
+	if sql.db.CanFind("tournament", "WHERE GroupID = ? AND Status IN (0, 1)", t.GroupID) {
+		return errors.New("本群已经有一场钓鱼比赛了")
+	}
+	var n struct{ N int64 }
+	_ = sql.db.Query("SELECT IFNULL(MAX(ID), 0) FROM tournament;", &n)
+	t.ID = n.N + 1
+	reason := "钓鱼比赛奖金#" + strconv.FormatInt(t.ID, 10)
+	if t.Bonus > 0 {
+		if err := ledger.Spend(t.Owner, t.Bonus, "mcfish", 0, reason); err != nil {
+			return err
+		}
+	}
+	err := sql.db.Insert("tournament", t)
+	if err != nil && t.Bonus > 0 {
+		_ = ledger.Earn(t.Owner, t.Bonus, "mcfish", 0, reason+"退回")
+	}
+	return err
+}
+
+// current 群内未开始或进行中的比赛
+func (sql *tournamentdb) current(gid int64) (t tournament, ok bool) {
+	sql.Lock()
+	defer sql.Unlock()
+	err := sql.db.Find("tournament", &t, "WHERE GroupID = ? AND Status IN (0, 1)", gid)
+	return t, err == nil
+}
+
+func (sql *tournamentdb) join(gid, uid int64) (t tournament, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	if err = sql.db.Find("tournament", &t, "WHERE GroupID = ? AND Status IN (0, 1)", gid); err != nil {
+		return t, errors.New("本群当前没有钓鱼比赛")
+	}
+	key := strconv.FormatInt(t.ID, 10) + "_" + strconv.FormatInt(uid, 10)
+	if sql.db.CanFind("entrant", "WHERE Key = ?", key) {
+		return t, errors.New("你已经报名了")
+	}
+	reason := "钓鱼比赛报名费#" + strconv.FormatInt(t.ID, 10)
+	if t.Fee > 0 {
+		if err = ledger.Spend(uid, t.Fee, "mcfish", 0, reason); err != nil {
+			return
+		}
+	}
+	err = sql.db.Insert("entrant", &entrant{Key: key, TID: t.ID, UID: uid, Paid: t.Fee})
+	if err != nil && t.Fee > 0 {
+		_ = ledger.Earn(uid, t.Fee, "mcfish", 0, reason+"退回")
+	}
+	return
+}
+
+// cancel 取消比赛并退回报名费与奖金
+func (sql *tournamentdb) cancel(gid int64) (t tournament, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	if err = sql.db.Find("tournament", &t, "WHERE GroupID = ? AND Status IN (0, 1)", gid); err != nil {
+		return t, errors.New("本群当前没有钓鱼比赛")
+	}
+	t.Status = 3
+	if err = sql.db.Insert("tournament", &t); err != nil {
+		return
+	}
+	id := strconv.FormatInt(t.ID, 10)
+	if t.Bonus > 0 {
+		_ = ledger.Earn(t.Owner, t.Bonus, "mcfish", 0, "钓鱼比赛奖金退回#"+id)
+	}
+	for _, e := range sql.entrants(t.ID) {
+		if e.Paid > 0 {
+			_ = ledger.Earn(e.UID, e.Paid, "mcfish", 0, "钓鱼比赛报名费退回#"+id)
+		}
+	}
+	return
+}
+
+// entrants 按成绩排序的参赛者 no lock
+func (sql *tournamentdb) entrants(tid int64) (list []entrant) {
+	var e entrant
+	_ = sql.db.FindFor("entrant", &e, "WHERE TID = ? ORDER BY Score DESC, Number DESC", func() error {
+		list = append(list, e)
+		return nil
+	}, tid)
+	return
+}
+
+func (sql *tournamentdb) leaderboard(ctx *zero.Ctx, t *tournament, n int) string {
+	sql.Lock()
+	list := sql.entrants(t.ID)
+	sql.Unlock()
+	pool := t.Bonus
+	for _, e := range list {
+		pool += e.Paid
+	}
+	var sb strings.Builder
+	sb.WriteString("当前奖池: ")
+	sb.WriteString(strconv.Itoa(pool))
+	sb.WriteString(wallet.GetWalletName())
+	sb.WriteString("\n参赛人数: ")
+	sb.WriteString(strconv.Itoa(len(list)))
+	for i, e := range list {
+		if i >= n {
+			break
+		}
+		sb.WriteString("\n")
+		sb.WriteString(strconv.Itoa(i + 1))
+		sb.WriteString(". ")
+		sb.WriteString(ctx.CardOrNickName(e.UID))
+		sb.WriteString("  ")
+		if t.Mode == modeValue {
+			sb.WriteString(strconv.Itoa(e.Score))
+		} else if e.Best != "" {
+			sb.WriteString(e.Best)
+			sb.WriteString("(稀有度")
+			sb.WriteString(strconv.Itoa(e.Score))
+			sb.WriteString(")")
+		} else {
+			sb.WriteString("暂无收获")
+		}
+	}
+	return sb.String()
+}
+
+// tick 开始到时的比赛, 结算结束的比赛并公布结果
+func (sql *tournamentdb) tick() {
+	now := time.Now().Unix()
+	type notice struct {
+		t   tournament
+		msg message.Message
+	}
+	var notices []notice
+	sql.Lock()
+	var list []tournament
+	var t tournament
+	_ = sql.db.FindFor("tournament", &t, "WHERE Status IN (0, 1) AND (Start <= ? OR End <= ?)", func() error {
+		list = append(list, t)
+		return nil
+	}, now, now)
+	for _, t := range list {
+		if t.End > now {
+			if t.Status == 1 {
+				continue
+			}
+			t.Status = 1
+			if err := sql.db.Insert("tournament", &t); err != nil {
+				logrus.Warnln("[mcfish] 开始比赛失败:", err)
+				continue
+			}
+			notices = append(notices, notice{t, message.Message{message.Text(t.describe(), "\n\n比赛开始了! ", joinTips(&t))}})
+			continue
+		}
+		t.Status = 2
+		if err := sql.db.Insert("tournament", &t); err != nil {
+			logrus.Warnln("[mcfish] 结算比赛失败:", err)
+			continue
+		}
+		notices = append(notices, notice{t, sql.settle(&t)})
+	}
+	sql.Unlock()
+	for _, n := range notices {
+		ctx := zero.GetBot(n.t.SelfID)
+		if ctx == nil {
+			continue
+		}
+		ctx.SendGroupMessage(n.t.GroupID, n.msg)
+	}
+}
+
+// settle 发放奖金 no lock
+func (sql *tournamentdb) settle(t *tournament) message.Message {
+	id := strconv.FormatInt(t.ID, 10)
+	list := sql.entrants(t.ID)
+	pool := t.Bonus
+	for _, e := range list {
+		pool += e.Paid
+	}
+	// 没有成绩的不参与分奖
+	winners := make([]entrant, 0, len(prizeShare))
+	for _, e := range list {
+		if len(winners) < len(prizeShare) && e.Score > 0 {
+			winners = append(winners, e)
+		}
+	}
+	msg := message.Message{message.Text("钓鱼比赛#", id, " [", t.Mode, "] 结束了!")}
+	if len(winners) == 0 {
+		if t.Bonus > 0 {
+			_ = ledger.Earn(t.Owner, t.Bonus, "mcfish", 0, "钓鱼比赛奖金退回#"+id)
+		}
+		for _, e := range list {
+			if e.Paid > 0 {
+				_ = ledger.Earn(e.UID, e.Paid, "mcfish", 0, "钓鱼比赛报名费退回#"+id)
+			}
+		}
+		return append(msg, message.Text("\n没有人钓到东西, 报名费与奖金已退回"))
+	}
+	// 人数不足三人时按比例重新分配
+	total := 0
+	for i := range winners {
+		total += prizeShare[i]
+	}
+	given := 0
+	for i, e := range winners {
+		prize := pool * prizeShare[i] / total
+		if i == len(winners)-1 {
+			prize = pool - given
+		}
+		given += prize
+		if prize > 0 {
+			if err := ledger.Earn(e.UID, prize, "mcfish", 0, "钓鱼比赛奖金#"+id); err != nil {
+				logrus.Warnln("[mcfish] 发放比赛奖金失败:", err)
+			}
+		}
+		score := strconv.Itoa(e.Score)
+		if t.Mode == modeRarest {
+			score = e.Best + "(稀有度" + score + ")"
+		}
+		msg = append(msg, message.Text("\n第", i+1, "名: "), message.At(e.UID),
+			message.Text(" ", score, ", 获得", prize, wallet.GetWalletName()))
+	}
+	return msg
+}
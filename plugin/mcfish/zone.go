@@ -0,0 +1,691 @@
+package mcfish
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+)
+
+// 拓展包, 放在 McFish/packs/*.json 中, 发送"重载钓鱼拓展包"生效
+type contentPack struct {
+	Name        string                        `json:"名称"`
+	Articles    []articleInfo                 `json:"物品,omitempty"`   // 新增的鱼类(fish)与垃圾(waste)
+	Zones       []fishZone                    `json:"地点,omitempty"`   // 新增地点, 同名时覆盖
+	Weathers    []weather                     `json:"天气,omitempty"`   // 新增天气, 同名时覆盖
+	TimeBonus   map[string]map[string]float64 `json:"时段加成,omitempty"` // 清晨|白天|黄昏|夜晚 -> 加成
+	SeasonBonus map[string]map[string]float64 `json:"季节加成,omitempty"` // 春|夏|秋|冬 -> 加成
+}
+
+// 钓鱼地点
+type fishZone struct {
+	Name  string             `json:"名称"`
+	Desc  string             `json:"描述"`
+	Loot  []lootEntry        `json:"掉落,omitempty"` // 鱼类与垃圾的掉落表, 某一类为空时使用默认规则
+	Bonus map[string]float64 `json:"加成,omitempty"` // 大类(treasure|pole|fish|waste)概率倍率
+}
+
+type lootEntry struct {
+	Name   string   `json:"名称"`
+	Weight int      `json:"权重"`
+	Time   []string `json:"时段,omitempty"` // 为空时全天可钓
+	Season []string `json:"季节,omitempty"` // 为空时全年可钓
+}
+
+// 天气, 每天变化一次
+type weather struct {
+	Name   string             `json:"名称"`
+	Weight int                `json:"权重"`
+	Desc   string             `json:"描述"`
+	Bonus  map[string]float64 `json:"加成,omitempty"` // 大类或物品 -> 倍率
+}
+
+type zoneState struct {
+	ID   int64  // 用户
+	Zone string // 所在地点
+}
+
+// 生效中的钓鱼内容
+type fishContent struct {
+	packs       []string
+	zones       []fishZone
+	weathers    []weather
+	timeBonus   map[string]map[string]float64
+	seasonBonus map[string]map[string]float64
+	extra       map[string]articleInfo // 拓展包物品
+}
+
+const defaultZone = "海洋"
+
+var (
+	categories  = []string{"treasure", "pole", "fish", "waste"}
+	timeOfDay   = []string{"清晨", "白天", "黄昏", "夜晚"}
+	seasons     = []string{"春", "夏", "秋", "冬"}
+	builtinPack = contentPack{
+		Name: "原版",
+		Zones: []fishZone{
+			{Name: defaultZone, Desc: "一望无际的大海, 什么都可能钓到"},
+			{
+				Name: "河流",
+				Desc: "水流平缓, 鱼多宝藏少",
+				Loot: []lootEntry{
+					{Name: "鳕鱼", Weight: 40},
+					{Name: "鲑鱼", Weight: 40},
+					{Name: "热带鱼", Weight: 15, Season: []string{"夏"}},
+					{Name: "河豚", Weight: 5},
+				},
+				Bonus: map[string]float64{"treasure": 0.5, "fish": 1.2},
+			},
+			{
+				Name: "沼泽",
+				Desc: "阴森潮湿, 垃圾遍地但藏着宝贝",
+				Loot: []lootEntry{
+					{Name: "鳕鱼", Weight: 60},
+					{Name: "墨鱼", Weight: 20, Time: []string{"黄昏", "夜晚"}},
+					{Name: "鹦鹉螺", Weight: 20, Time: []string{"夜晚"}},
+				},
+				Bonus: map[string]float64{"treasure": 1.5, "fish": 0.8, "waste": 1.3},
+			},
+		},
+		Weathers: []weather{
+			{Name: "晴", Weight: 40, Desc: "风和日丽"},
+			{Name: "多云", Weight: 25, Desc: "不冷不热"},
+			{Name: "雨", Weight: 20, Desc: "鱼儿更爱咬钩", Bonus: map[string]float64{"fish": 1.3}},
+			{Name: "雷暴", Weight: 5, Desc: "危险, 但宝藏被冲了出来", Bonus: map[string]float64{"treasure": 2, "fish": 0.7}},
+			{Name: "大雾", Weight: 10, Desc: "看不清水面, 容易钩到杂物", Bonus: map[string]float64{"waste": 1.3, "pole": 1.5}},
+		},
+		TimeBonus: map[string]map[string]float64{
+			"清晨": {"fish": 1.2},
+			"黄昏": {"fish": 1.2},
+			"夜晚": {"treasure": 1.5, "fish": 0.9},
+		},
+		SeasonBonus: map[string]map[string]float64{
+			"春": {"fish": 1.1},
+			"夏": {"waste": 1.2, "热带鱼": 2},
+			"秋": {"fish": 1.2},
+			"冬": {"fish": 0.8, "treasure": 1.2},
+		},
+	}
+	contentmu        sync.RWMutex
+	content          = &fishContent{}
+	baseArticles     []articleInfo // 原版物品
+	defaultWasteList []string      // 原版垃圾, 未配置垃圾掉落表的地点使用
+)
+
+func init() {
+	baseArticles = articlesInfo.ArticleInfo
+	defaultWasteList = wasteList
+	if err := loadContent(); err != nil {
+		logrus.Warnln("[mcfish] 加载钓鱼拓展包失败, 仅使用原版内容:", err)
+		c, extra, _ := buildContent(nil)
+		applyContent(c, extra)
+	}
+	// 只匹配存在的地点, 以免吞掉其它以"前往"开头的消息
+	engine.OnRegex(`^前往\s*(\S+)$`, isZone, getdb, jail.CheckFree).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		name := ctx.State["regex_matched"].([]string)[1]
+		zone, ok := zoneOf(name)
+		if !ok {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("没有这个地点, 可以前往: ", strings.Join(zoneNames(), "|")))
+			return
+		}
+		err := dbdata.setUserZone(ctx.Event.UserID, zone.Name)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at zone.go.1]:", err))
+			return
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你来到了", zone.Name, ": ", zone.Desc))
+	})
+	engine.OnFullMatchGroup([]string{"钓鱼地点", "钓鱼天气"}, getdb).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		current, err := dbdata.getUserZone(ctx.Event.UserID)
+		if err != nil {
+			ctx.SendChain(message.Text("[ERROR at zone.go.2]:", err))
+			return
+		}
+		ctx.SendChain(message.Text(describeZones(current.Zone, time.Now())))
+	})
+	engine.OnFullMatch("重载钓鱼拓展包", zero.SuperUserPermission).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		if err := loadContent(); err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err, "\n已保留原有内容"))
+			return
+		}
+		contentmu.RLock()
+		msg := "重载成功, 已加载" + strconv.Itoa(len(content.packs)) + "个拓展包"
+		if len(content.packs) > 0 {
+			msg += ": " + strings.Join(content.packs, ", ")
+		}
+		msg += "\n共" + strconv.Itoa(len(content.zones)) + "个地点, " + strconv.Itoa(len(content.extra)) + "个拓展物品"
+		contentmu.RUnlock()
+		ctx.SendChain(message.Text(msg))
+	})
+}
+
+// loadContent 读取拓展包目录, 全部校验通过后才替换当前内容
+func loadContent() error {
+	dir := engine.DataFolder() + "packs/"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	packs := make([]contentPack, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(dir + e.Name())
+		if err != nil {
+			return err
+		}
+		var p contentPack
+		if err = json.Unmarshal(data, &p); err != nil {
+			return errors.New(e.Name() + ": " + err.Error())
+		}
+		if p.Name == "" {
+			p.Name = strings.TrimSuffix(e.Name(), ".json")
+		}
+		packs = append(packs, p)
+	}
+	c, extra, err := buildContent(packs)
+	if err != nil {
+		return err
+	}
+	applyContent(c, extra)
+	return nil
+}
+
+// buildContent 在原版内容上依次合并拓展包并校验
+func buildContent(packs []contentPack) (c *fishContent, extra []articleInfo, err error) {
+	c = &fishContent{
+		timeBonus:   map[string]map[string]float64{},
+		seasonBonus: map[string]map[string]float64{},
+		extra:       map[string]articleInfo{},
+	}
+	known := make(map[string]string, len(baseArticles)) // 名称 -> 类型
+	for _, info := range baseArticles {
+		known[info.Name] = info.Type
+	}
+	for _, p := range append([]contentPack{builtinPack}, packs...) {
+		for _, info := range p.Articles {
+			switch {
+			case info.Name == "" || strings.ContainsAny(info.Name, " \t\n|") || strings.Contains(info.Name, "竿"):
+				return nil, nil, errors.New(p.Name + ": 物品名称不能为空, 不能含有空白、'|'或'竿': " + info.Name)
+			case known[info.Name] != "":
+				return nil, nil, errors.New(p.Name + ": 物品重复: " + info.Name)
+			case info.Type != "fish" && info.Type != "waste":
+				return nil, nil, errors.New(p.Name + ": 物品[" + info.Name + "]的类型只能是fish或waste")
+			case info.Price <= 0:
+				return nil, nil, errors.New(p.Name + ": 物品[" + info.Name + "]的价格应大于0")
+			}
+			info.Probability, info.Durable = 0, 0
+			known[info.Name] = info.Type
+			c.extra[info.Name] = info
+			extra = append(extra, info)
+		}
+		for _, z := range p.Zones {
+			if z.Name == "" || strings.ContainsAny(z.Name, " \t\n") {
+				return nil, nil, errors.New(p.Name + ": 地点名称不能为空或含有空白")
+			}
+			for _, l := range z.Loot {
+				if t := known[l.Name]; t != "fish" && t != "waste" {
+					return nil, nil, errors.New(p.Name + ": 地点[" + z.Name + "]的掉落只能是鱼类或垃圾: " + l.Name)
+				}
+				if l.Weight <= 0 {
+					return nil, nil, errors.New(p.Name + ": 地点[" + z.Name + "]中[" + l.Name + "]的权重应大于0")
+				}
+				if err = checkNames(l.Time, timeOfDay); err != nil {
+					return nil, nil, errors.New(p.Name + ": 地点[" + z.Name + "]: " + err.Error())
+				}
+				if err = checkNames(l.Season, seasons); err != nil {
+					return nil, nil, errors.New(p.Name + ": 地点[" + z.Name + "]: " + err.Error())
+				}
+			}
+			if err = checkBonus(z.Bonus, nil); err != nil {
+				return nil, nil, errors.New(p.Name + ": 地点[" + z.Name + "]: " + err.Error())
+			}
+			c.zones = upsert(c.zones, z, func(v fishZone) string { return v.Name })
+		}
+		for _, w := range p.Weathers {
+			if w.Name == "" || w.Weight <= 0 {
+				return nil, nil, errors.New(p.Name + ": 天气名称不能为空且权重应大于0")
+			}
+			if err = checkBonus(w.Bonus, known); err != nil {
+				return nil, nil, errors.New(p.Name + ": 天气[" + w.Name + "]: " + err.Error())
+			}
+			c.weathers = upsert(c.weathers, w, func(v weather) string { return v.Name })
+		}
+		if err = mergeBonus(c.timeBonus, p.TimeBonus, timeOfDay, known); err != nil {
+			return nil, nil, errors.New(p.Name + ": 时段加成: " + err.Error())
+		}
+		if err = mergeBonus(c.seasonBonus, p.SeasonBonus, seasons, known); err != nil {
+			return nil, nil, errors.New(p.Name + ": 季节加成: " + err.Error())
+		}
+		if p.Name != builtinPack.Name {
+			c.packs = append(c.packs, p.Name)
+		}
+	}
+	if _, ok := c.zone(defaultZone); !ok {
+		return nil, nil, errors.New("缺少默认地点: " + defaultZone)
+	}
+	return c, extra, nil
+}
+
+func upsert[T any](list []T, v T, key func(T) string) []T {
+	for i := range list {
+		if key(list[i]) == key(v) {
+			list[i] = v
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+func checkNames(names, valid []string) error {
+	for _, n := range names {
+		ok := false
+		for _, v := range valid {
+			ok = ok || n == v
+		}
+		if !ok {
+			return errors.New("无效的取值: " + n + ", 可选: " + strings.Join(valid, "|"))
+		}
+	}
+	return nil
+}
+
+// checkBonus 检查加成, known 为空时只允许大类
+func checkBonus(bonus map[string]float64, known map[string]string) error {
+	for k, v := range bonus {
+		if v < 0 {
+			return errors.New("倍率不能为负数: " + k)
+		}
+		if checkNames([]string{k}, categories) == nil || known[k] != "" {
+			continue
+		}
+		return errors.New("无效的加成对象: " + k)
+	}
+	return nil
+}
+
+func mergeBonus(dst, src map[string]map[string]float64, valid []string, known map[string]string) error {
+	for k, bonus := range src {
+		if err := checkNames([]string{k}, valid); err != nil {
+			return err
+		}
+		if err := checkBonus(bonus, known); err != nil {
+			return err
+		}
+		if dst[k] == nil {
+			dst[k] = map[string]float64{}
+		}
+		for name, v := range bonus {
+			dst[k][name] = v
+		}
+	}
+	return nil
+}
+
+// applyContent 替换生效内容, 并把拓展包物品加入交易列表
+func applyContent(c *fishContent, extra []articleInfo) {
+	articles := make([]articleInfo, 0, len(baseArticles)+len(extra))
+	articles = append(articles, baseArticles...)
+	articles = append(articles, extra...)
+	things := make([]string, 0, len(articles))
+	fishes := make([]string, 0, len(baseArticles)+len(extra))
+	wastes := make([]string, 0, len(defaultWasteList)+len(extra))
+	prices := make(map[string]int, len(articles))
+	for _, info := range articles {
+		switch {
+		case info.Type == "fish" || info.Name == "海豚":
+			fishes = append(fishes, info.Name)
+		case info.Type == "waste":
+			wastes = append(wastes, info.Name)
+		}
+		if info.Name != "宝藏诅咒" {
+			things = append(things, info.Name)
+			prices[info.Name] = info.Price
+		}
+	}
+	contentmu.Lock()
+	defer contentmu.Unlock()
+	content = c
+	articlesInfo.ArticleInfo = articles
+	thingList, fishList, wasteList, priceList = things, fishes, wastes, prices
+}
+
+func (c *fishContent) zone(name string) (*fishZone, bool) {
+	for i := range c.zones {
+		if c.zones[i].Name == name {
+			return &c.zones[i], true
+		}
+	}
+	return nil, false
+}
+
+func zoneOf(name string) (*fishZone, bool) {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	return content.zone(name)
+}
+
+func zoneNames() []string {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	names := make([]string, len(content.zones))
+	for i, z := range content.zones {
+		names[i] = z.Name
+	}
+	return names
+}
+
+// isZone 匹配的是否为地点, 拓展包重载后无需重新注册指令
+func isZone(ctx *zero.Ctx) bool {
+	_, ok := zoneOf(ctx.State["regex_matched"].([]string)[1])
+	return ok
+}
+
+// isThingName 是否为可交易的物品, 拓展包重载后无需重新注册指令
+func isThingName(name string) bool {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	for _, v := range thingList {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 以下列表在重载拓展包时整体替换而不会原地修改,
+// contentmu 之外的代码需通过这些函数取得当前引用后再读取
+
+func getThingList() []string {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	return thingList
+}
+
+func getFishList() []string {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	return fishList
+}
+
+func getWasteList() []string {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	return wasteList
+}
+
+func getArticles() []articleInfo {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	return articlesInfo.ArticleInfo
+}
+
+// priceOf 物品的基础价格
+func priceOf(name string) int {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	return priceList[name]
+}
+
+// isExtraThing 是否为拓展包物品(没有图片)
+func isExtraThing(name string) bool {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	_, ok := content.extra[name]
+	return ok
+}
+
+func timeOfDayAt(t time.Time) string {
+	switch h := t.Hour(); {
+	case h >= 5 && h < 8:
+		return "清晨"
+	case h >= 8 && h < 17:
+		return "白天"
+	case h >= 17 && h < 19:
+		return "黄昏"
+	default:
+		return "夜晚"
+	}
+}
+
+// seasonAt 3~5月为春, 6~8月为夏, 9~11月为秋, 12~2月为冬
+func seasonAt(t time.Time) string {
+	return seasons[(int(t.Month())+9)%12/3]
+}
+
+// weatherAt 当天的天气, 以日期为种子, 重启后不变
+func (c *fishContent) weatherAt(t time.Time) weather {
+	total := 0
+	for _, w := range c.weathers {
+		total += w.Weight
+	}
+	if total == 0 {
+		return weather{Name: "晴"}
+	}
+	y, m, d := t.Date()
+	dice := rand.New(rand.NewSource(int64(y*10000 + int(m)*100 + d))).Intn(total)
+	for _, w := range c.weathers {
+		if dice < w.Weight {
+			return w
+		}
+		dice -= w.Weight
+	}
+	return c.weathers[len(c.weathers)-1]
+}
+
+// fishingEnv 钓鱼时的环境
+type fishingEnv struct {
+	zone    fishZone
+	time    string
+	season  string
+	weather weather
+	bonus   map[string]float64 // 大类与物品的总倍率
+}
+
+func newFishingEnv(zoneName string, t time.Time) *fishingEnv {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	z, ok := content.zone(zoneName)
+	if !ok {
+		z, _ = content.zone(defaultZone)
+	}
+	env := &fishingEnv{
+		zone:    *z,
+		time:    timeOfDayAt(t),
+		season:  seasonAt(t),
+		weather: content.weatherAt(t),
+		bonus:   map[string]float64{},
+	}
+	for _, bonus := range []map[string]float64{z.Bonus, env.weather.Bonus, content.timeBonus[env.time], content.seasonBonus[env.season]} {
+		for k, v := range bonus {
+			if old, ok := env.bonus[k]; ok {
+				v *= old
+			}
+			env.bonus[k] = v
+		}
+	}
+	return env
+}
+
+func (env *fishingEnv) String() string {
+	return env.zone.Name + " · " + env.season + " · " + env.time + " · " + env.weather.Name
+}
+
+func (env *fishingEnv) factor(name string) float64 {
+	if v, ok := env.bonus[name]; ok {
+		return v
+	}
+	return 1
+}
+
+// applyBonus 按倍率调整大类概率, 倍率都为1时保持不变
+func (env *fishingEnv) applyBonus(local map[string]probabilityLimit) {
+	changed := false
+	for _, name := range categories {
+		changed = changed || env.factor(name) != 1
+	}
+	if !changed {
+		return
+	}
+	// 按钓鱼结算时的判定顺序统计各大类实际占用的点数
+	order := []string{"waste", "treasure", "pole", "fish"}
+	width := make(map[string]float64, len(categories))
+	for dice := 0; dice < 100; dice++ {
+		for _, name := range order {
+			if l := local[name]; dice >= l.Min && dice < l.Max {
+				width[name]++
+				break
+			}
+		}
+	}
+	total := 0.0
+	for _, name := range categories {
+		width[name] *= env.factor(name)
+		total += width[name]
+	}
+	scale := 1.0
+	if total > 100 {
+		scale = 100 / total
+	}
+	// 重新连续排布, 剩余部分为空竿
+	lo := 0
+	for _, name := range categories {
+		hi := lo + int(math.Round(width[name]*scale))
+		if hi > 100 {
+			hi = 100
+		}
+		local[name] = probabilityLimit{Min: lo, Max: hi}
+		lo = hi
+	}
+}
+
+// pick 按地点掉落表选取物品, 该类没有可钓的物品时返回空
+func (env *fishingEnv) pick(typ string) string {
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	type candidate struct {
+		name   string
+		weight float64
+	}
+	list := make([]candidate, 0, len(env.zone.Loot))
+	total := 0.0
+	for _, l := range env.zone.Loot {
+		if l.typeOf() != typ || !l.available(env.time, env.season) {
+			continue
+		}
+		w := float64(l.Weight) * env.factor(l.Name)
+		if w <= 0 {
+			continue
+		}
+		list = append(list, candidate{l.Name, w})
+		total += w
+	}
+	if len(list) == 0 {
+		return ""
+	}
+	dice := rng.Float64() * total
+	for _, c := range list {
+		if dice < c.weight {
+			return c.name
+		}
+		dice -= c.weight
+	}
+	return list[len(list)-1].name
+}
+
+// typeOf 掉落物的类型, 调用时需持有 contentmu
+func (l *lootEntry) typeOf() string {
+	if info, ok := content.extra[l.Name]; ok {
+		return info.Type
+	}
+	for _, info := range baseArticles {
+		if info.Name == l.Name {
+			return info.Type
+		}
+	}
+	return ""
+}
+
+func (l *lootEntry) available(timeName, season string) bool {
+	return (len(l.Time) == 0 || checkNames([]string{timeName}, l.Time) == nil) &&
+		(len(l.Season) == 0 || checkNames([]string{season}, l.Season) == nil)
+}
+
+func describeZones(current string, t time.Time) string {
+	env := newFishingEnv(current, t)
+	var sb strings.Builder
+	sb.WriteString("当前: ")
+	sb.WriteString(env.String())
+	if env.weather.Desc != "" {
+		sb.WriteString("\n天气: ")
+		sb.WriteString(env.weather.Desc)
+	}
+	contentmu.RLock()
+	defer contentmu.RUnlock()
+	for _, z := range content.zones {
+		sb.WriteString("\n\n")
+		if z.Name == env.zone.Name {
+			sb.WriteString("[你在这里] ")
+		}
+		sb.WriteString(z.Name)
+		sb.WriteString(": ")
+		sb.WriteString(z.Desc)
+		names := make([]string, 0, len(z.Loot))
+		for _, l := range z.Loot {
+			if l.available(env.time, env.season) {
+				names = append(names, l.Name)
+			}
+		}
+		if len(names) > 0 {
+			sb.WriteString("\n此时可钓: ")
+			sb.WriteString(strings.Join(names, " "))
+		}
+	}
+	if len(content.packs) > 0 {
+		sb.WriteString("\n\n已加载拓展包: ")
+		sb.WriteString(strings.Join(content.packs, ", "))
+	}
+	sb.WriteString("\n\n发送\"前往 地点\"更换钓鱼地点")
+	return sb.String()
+}
+
+// 获取用户所在地点
+func (sql *fishdb) getUserZone(uid int64) (info zoneState, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	info = zoneState{ID: uid, Zone: defaultZone}
+	err = sql.db.Create("zone", &info)
+	if err != nil {
+		return
+	}
+	_ = sql.db.Find("zone", &info, "WHERE ID = ?", uid)
+	return
+}
+
+// 更新用户所在地点
+func (sql *fishdb) setUserZone(uid int64, zone string) (err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	info := zoneState{ID: uid, Zone: zone}
+	err = sql.db.Create("zone", &info)
+	if err != nil {
+		return
+	}
+	return sql.db.Insert("zone", &info)
+}
@@ -0,0 +1,28 @@
+package mcfish
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeasonAt(t *testing.T) {
+	want := map[time.Month]string{
+		time.January:   "冬",
+		time.February:  "冬",
+		time.March:     "春",
+		time.April:     "春",
+		time.May:       "春",
+		time.June:      "夏",
+		time.July:      "夏",
+		time.August:    "夏",
+		time.September: "秋",
+		time.October:   "秋",
+		time.November:  "秋",
+		time.December:  "冬",
+	}
+	for m := time.January; m <= time.December; m++ {
+		if got := seasonAt(time.Date(2026, m, 15, 12, 0, 0, 0, time.Local)); got != want[m] {
+			t.Errorf("%d月: got %s, want %s", m, got, want[m])
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package niuniu
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/niu"
+	"github.com/FloatTech/AnimeAPI/wallet"
+	sql "github.com/FloatTech/sqlite"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+// timedAuction 限时拍卖, 出价时冻结出价者的钱, 被超过时退回
+type timedAuction struct {
+	ID         int64
+	SelfID     int64 // 发起拍卖时的bot, 用于公布结果
+	GID        int64
+	Seller     int64
+	Length     float64
+	StartPrice int
+	Bidder     int64 // 当前最高出价者, 0 为无人出价
+	Bid        int
+	EndTime    int64
+	Status     int // 0进行中 1成交 2流拍 3取消 4成交待付款
+}
+
+type auctiondb struct {
+	sync.Mutex
+	db sql.Sqlite
+}
+
+const (
+	minAuctionTime = 10 * time.Minute
+	maxAuctionTime = 24 * time.Hour
+	// 结束前此时间内出价会延长拍卖, 防止最后一刻抢拍
+	snipeWindow = time.Minute
+)
+
+var (
+	adb = &auctiondb{}
+
+	errAuctionNotFound = errors.New("没有这个拍卖, 发送\"牛牛拍卖行\"查看")
+	errAuctionEnded    = errors.New("这个拍卖已经结束了")
+	errHasNiuNiu       = errors.New("你已经有牛牛了, 出售或注销后才能竞拍")
+)
+
+func init() {
+	adb.db = sql.New(en.DataFolder() + "auction.db")
+	err := adb.db.Open(time.Hour)
+	if err == nil {
+		err = adb.db.Create("auction", &timedAuction{})
+	}
+	if err != nil {
+		logrus.Errorln("[niuniu] 打开拍卖数据库失败:", err)
+		return
+	}
+
+	// 定时结算到期的拍卖, 重启后继续
+	go func() {
+		for range time.NewTicker(30 * time.Second).C {
+			adb.settleExpired()
+		}
+	}()
+
+	en.OnRegex(`^拍卖牛牛\s*(\d+)\s*(?:(\d+)\s*(分钟|小时))?$`, zero.OnlyGroup, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			gid := ctx.Event.GroupID
+			uid := ctx.Event.UserID
+			matched := ctx.State["regex_matched"].([]string)
+			price, _ := strconv.Atoi(matched[1])
+			d := time.Hour
+			if matched[2] != "" {
+				n, _ := strconv.Atoi(matched[2])
+				d = time.Duration(n) * time.Minute
+				if matched[3] == "小时" {
+					d = time.Duration(n) * time.Hour
+				}
+			}
+			if d < minAuctionTime || d > maxAuctionTime {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("拍卖时长应在10分钟到24小时之间"))
+				return
+			}
+			if price <= 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("起拍价至少为1", wallet.GetWalletName()))
+				return
+			}
+			a, err := adb.start(ctx.Event.SelfID, gid, uid, price, d)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			// 牛牛已经交给拍卖行, 不能再赎回
+			retireNiuNiu(gid, uid, niu.ErrAuctioned)
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(fmt.Sprintf(
+				"拍卖#%d 已开始\n牛牛大小: %.2fcm\n起拍价: %d%s\n结束时间: %s\n发送\"出价 %d 金额\"参与竞拍",
+				a.ID, a.Length, a.StartPrice, wallet.GetWalletName(), time.Unix(a.EndTime, 0).Format("01/02 15:04"), a.ID)))
+		})
+	en.OnRegex(`^出价\s*#?(\d+)\s+(\d+)$`, zero.OnlyGroup, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			gid := ctx.Event.GroupID
+			uid := ctx.Event.UserID
+			matched := ctx.State["regex_matched"].([]string)
+			id, _ := strconv.ParseInt(matched[1], 10, 64)
+			amount, _ := strconv.Atoi(matched[2])
+			a, prev, err := adb.bid(gid, uid, id, amount)
+			if errors.Is(err, ledger.ErrNotEnough) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你的", wallet.GetWalletName(), "不够出这个价"))
+				return
+			}
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(fmt.Sprintf(
+				"出价成功! 拍卖#%d 当前最高价%d%s, 已冻结你的出价\n结束时间: %s",
+				a.ID, a.Bid, wallet.GetWalletName(), time.Unix(a.EndTime, 0).Format("01/02 15:04:05"))))
+			if prev.Bidder != 0 && prev.Bidder != uid {
+				ctx.SendChain(message.At(prev.Bidder), message.Text(fmt.Sprintf(
+					" 你在拍卖#%d 的出价被超过了, 已退回%d%s", a.ID, prev.Bid, wallet.GetWalletName())))
+			}
+		})
+	en.OnRegex(`^取消拍卖\s*#?(\d+)$`, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			if err := adb.cancel(ctx.Event.GroupID, ctx.Event.UserID, id); err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("已取消拍卖#", id, ", 牛牛已还给你"))
+		})
+}
+
+// start 把用户的牛牛交给拍卖行
+func (a *auctiondb) start(selfID, gid, uid int64, price int, d time.Duration) (*timedAuction, error) {
+	a.Lock()
+	defer a.Unlock()
+	if a.db.CanFind("auction", "WHERE GID = ? AND Seller = ? AND Status = 0", gid, uid) {
+		return nil, errors.New("你已经有一个正在进行的拍卖了")
+	}
+	gamemu.Lock()
+	defer gamemu.Unlock()
+	length, err := niu.GetWordNiuNiu(gid, uid)
+	if err != nil {
+		return nil, niu.ErrNoNiuNiu
+	}
+	var n struct{ N int64 }
+	_ = a.db.Query("SELECT IFNULL(MAX(ID), 0) FROM auction;", &n)
+	info := timedAuction{
+		ID:         n.N + 1,
+		SelfID:     selfID,
+		GID:        gid,
+		Seller:     uid,
+		Length:     length,
+		StartPrice: price,
+		EndTime:    time.Now().Add(d).Unix(),
+	}
+	if err = a.db.Insert("auction", &info); err != nil {
+		return nil, err
+	}
+	if err = niu.DeleteWordNiuNiu(gid, uid); err != nil {
+		_ = a.db.Del("auction", "WHERE ID = ?", info.ID)
+		return nil, err
+	}
+	return &info, nil
+}
+
+// bid 出价, 返回出价后的拍卖与出价前的拍卖
+func (a *auctiondb) bid(gid, uid, id int64, amount int) (info, prev timedAuction, err error) {
+	a.Lock()
+	defer a.Unlock()
+	err = a.db.Find("auction", &info, "WHERE ID = ? AND GID = ?", id, gid)
+	if err != nil {
+		return info, prev, errAuctionNotFound
+	}
+	now := time.Now()
+	switch {
+	case info.Status != 0 || info.EndTime <= now.Unix():
+		return info, prev, errAuctionEnded
+	case info.Seller == uid:
+		return info, prev, errors.New("不能给自己的牛牛出价")
+	case hasNiuNiu(gid, uid):
+		// 成交时不会覆盖买家已有的牛牛
+		return info, prev, errHasNiuNiu
+	}
+	minBid := info.StartPrice
+	if info.Bidder != 0 {
+		minBid = info.Bid + max(1, info.Bid/20)
+	}
+	if amount < minBid {
+		return info, prev, fmt.Errorf("出价至少为%d%s", minBid, wallet.GetWalletName())
+	}
+	reason := "牛牛拍卖出价#" + strconv.FormatInt(id, 10)
+	// 加价时只冻结差额
+	freeze := amount
+	if info.Bidder == uid {
+		freeze -= info.Bid
+	}
+	if err = ledger.Spend(uid, freeze, "niuniu", info.Seller, reason); err != nil {
+		return info, prev, err
+	}
+	prev = info
+	info.Bidder = uid
+	info.Bid = amount
+	if time.Unix(info.EndTime, 0).Sub(now) < snipeWindow {
+		info.EndTime = now.Add(snipeWindow).Unix()
+	}
+	if err = a.db.Insert("auction", &info); err != nil {
+		_ = ledger.Earn(uid, freeze, "niuniu", info.Seller, reason+"失败退款")
+		return prev, prev, err
+	}
+	if prev.Bidder != 0 && prev.Bidder != uid {
+		err = ledger.Earn(prev.Bidder, prev.Bid, "niuniu", info.Seller, reason+"被超过退款")
+		if err != nil {
+			logrus.Warnln("[niuniu] 拍卖退款失败:", err)
+			err = nil
+		}
+	}
+	return info, prev, nil
+}
+
+// cancel 无人出价时卖家可以取消拍卖
+func (a *auctiondb) cancel(gid, uid, id int64) error {
+	a.Lock()
+	defer a.Unlock()
+	var info timedAuction
+	if err := a.db.Find("auction", &info, "WHERE ID = ? AND GID = ?", id, gid); err != nil {
+		return errAuctionNotFound
+	}
+	switch {
+	case info.Seller != uid:
+		return errors.New("这不是你的拍卖")
+	case info.Status != 0:
+		return errAuctionEnded
+	case info.Bidder != 0:
+		return errors.New("已经有人出价了, 不能取消")
+	}
+	info.Status = 3
+	if err := a.db.Insert("auction", &info); err != nil {
+		return err
+	}
+	return giveNiuNiu(gid, uid, info.Length)
+}
+
+// list 群内进行中的拍卖
+func (a *auctiondb) list(gid int64) (list []timedAuction) {
+	a.Lock()
+	defer a.Unlock()
+	var info timedAuction
+	_ = a.db.FindFor("auction", &info, "WHERE GID = ? AND Status = 0 ORDER BY EndTime", func() error {
+		list = append(list, info)
+		return nil
+	}, gid)
+	return
+}
+
+// settleExpired 结算到期的拍卖并在群内公布结果
+func (a *auctiondb) settleExpired() {
+	a.Lock()
+	var expired []timedAuction
+	var info timedAuction
+	_ = a.db.FindFor("auction", &info, "WHERE (Status = 0 AND EndTime <= ?) OR Status = 4", func() error {
+		expired = append(expired, info)
+		return nil
+	}, time.Now().Unix())
+	msgs := make([]message.Message, len(expired))
+	for i := range expired {
+		info := &expired[i]
+		var err error
+		if info.Status == 0 && info.Bidder != 0 {
+			err = giveNiuNiu(info.GID, info.Bidder, info.Length)
+			switch {
+			case err == nil:
+				// 先记为成交再付款, 付款失败时只重试付款, 不会再给买家退款
+				info.Status = 4
+				err = a.db.Insert("auction", info)
+			case errors.Is(err, errHasNiuNiu):
+				// 买家在拍卖期间注册了新的牛牛, 先清除出价再退款, 避免重试时重复退款
+				bidder, bid := info.Bidder, info.Bid
+				info.Bidder, info.Bid = 0, 0
+				err = a.db.Insert("auction", info)
+				if err != nil {
+					break
+				}
+				err = ledger.Earn(bidder, bid, "niuniu", info.Seller, "牛牛拍卖流拍退款#"+strconv.FormatInt(info.ID, 10))
+				if err != nil {
+					logrus.Warnln("[niuniu] 拍卖退款失败:", err)
+				}
+				msgs[i] = message.Message{message.At(bidder), message.Text(fmt.Sprintf(" 你在拍卖期间已有了新的牛牛, 拍卖#%d 的出价%d%s已退回\n", info.ID, bid, wallet.GetWalletName()))}
+			}
+		}
+		if err == nil && info.Status == 4 {
+			err = ledger.Earn(info.Seller, info.Bid, "niuniu", info.Bidder, "牛牛拍卖成交#"+strconv.FormatInt(info.ID, 10))
+			if err == nil {
+				info.Status = 1
+				msgs[i] = message.Message{
+					message.Text(fmt.Sprintf("拍卖#%d 结束!\n", info.ID)),
+					message.At(info.Bidder),
+					message.Text(fmt.Sprintf(" 以%d%s拍得%.2fcm的牛牛\n", info.Bid, wallet.GetWalletName(), info.Length)),
+					message.At(info.Seller),
+					message.Text(fmt.Sprintf(" 获得了%d%s", info.Bid, wallet.GetWalletName())),
+				}
+			}
+		}
+		if err == nil && info.Status == 0 && info.Bidder == 0 {
+			info.Status = 2
+			text := fmt.Sprintf(" 拍卖#%d 无人成交, 流拍了, 牛牛已还给你", info.ID)
+			err = giveNiuNiu(info.GID, info.Seller, info.Length)
+			if errors.Is(err, errHasNiuNiu) {
+				// 卖家已有新的牛牛, 保留较长的一个
+				err = nil
+				text = fmt.Sprintf(" 拍卖#%d 无人成交, 流拍了, 你已有新的牛牛, 保留了较长的一个", info.ID)
+				if length, gerr := niu.GetWordNiuNiu(info.GID, info.Seller); gerr == nil && length < info.Length {
+					err = niu.SetWordNiuNiu(info.GID, info.Seller, info.Length)
+				}
+			}
+			msgs[i] = append(msgs[i], message.At(info.Seller), message.Text(text))
+		}
+		if err != nil {
+			// 下次再试
+			logrus.Warnln("[niuniu] 拍卖结算失败:", err)
+			msgs[i] = nil
+			continue
+		}
+		if err = a.db.Insert("auction", info); err != nil {
+			logrus.Warnln("[niuniu] 拍卖结算失败:", err)
+		}
+	}
+	a.Unlock()
+	for i := range expired {
+		if msgs[i] == nil {
+			continue
+		}
+		ctx := zero.GetBot(expired[i].SelfID)
+		if ctx == nil {
+			continue
+		}
+		ctx.SendGroupMessage(expired[i].GID, msgs[i])
+	}
+}
+
+// giveNiuNiu 把牛牛交给用户, 用户已有牛牛时返回 errHasNiuNiu
+func giveNiuNiu(gid, uid int64, length float64) error {
+	gamemu.Lock()
+	defer gamemu.Unlock()
+	if _, err := niu.GetWordNiuNiu(gid, uid); err == nil {
+		return errHasNiuNiu
+	}
+	if _, err := niu.Register(gid, uid); err != nil {
+		return err
+	}
+	retireNiuNiu(gid, uid, niu.ErrCanceled)
+	return niu.SetWordNiuNiu(gid, uid, length)
+}
+
+// hasNiuNiu 用户是否已有牛牛
+func hasNiuNiu(gid, uid int64) bool {
+	gamemu.Lock()
+	defer gamemu.Unlock()
+	_, err := niu.GetWordNiuNiu(gid, uid)
+	return err == nil
+}
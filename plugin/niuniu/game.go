@@ -0,0 +1,347 @@
+package niuniu
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/niu"
+	sql "github.com/FloatTech/sqlite"
+	"github.com/RomiChan/syncx"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+// propbag 按规则购买的道具
+type propbag struct {
+	Key   string // 群号_用户_道具名
+	GID   int64
+	UID   int64
+	Name  string
+	Count int
+}
+
+type propdb struct {
+	sync.RWMutex
+	db sql.Sqlite
+}
+
+var (
+	bag = &propdb{}
+	// 长度的读取与写入需要成对进行
+	gamemu sync.Mutex
+	// niuIDs 群号_用户 -> 当前牛牛的ID, 出售、拍卖或注销后作废
+	niuIDs = syncx.Map[string, uuid.UUID]{}
+	// retired 已作废的牛牛ID -> 不能赎回的原因
+	retired = syncx.Map[uuid.UUID, error]{}
+)
+
+func init() {
+	bag.db = sql.New(en.DataFolder() + "props.db")
+	err := bag.db.Open(time.Hour)
+	if err == nil {
+		err = bag.db.Create("bag", &propbag{})
+	}
+	if err != nil {
+		logrus.Errorln("[niuniu] 打开道具数据库失败:", err)
+	}
+}
+
+func bagKey(gid, uid int64, name string) string {
+	return strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10) + "_" + name
+}
+
+// add 增减道具数量, 数量不足时返回错误
+func (b *propdb) add(gid, uid int64, name string, n int) error {
+	b.Lock()
+	defer b.Unlock()
+	info := propbag{Key: bagKey(gid, uid, name), GID: gid, UID: uid, Name: name}
+	_ = b.db.Find("bag", &info, "WHERE Key = ?", info.Key)
+	info.Count += n
+	switch {
+	case info.Count < 0:
+		return fmt.Errorf("你还没有%s呢,不能使用", name)
+	case info.Count == 0:
+		return b.db.Del("bag", "WHERE Key = ?", info.Key)
+	}
+	return b.db.Insert("bag", &info)
+}
+
+func (b *propdb) count(gid, uid int64, name string) int {
+	b.RLock()
+	defer b.RUnlock()
+	var info propbag
+	_ = b.db.Find("bag", &info, "WHERE Key = ?", bagKey(gid, uid, name))
+	return info.Count
+}
+
+func (b *propdb) list(gid, uid int64) (list []propbag) {
+	b.RLock()
+	defer b.RUnlock()
+	var info propbag
+	_ = b.db.FindFor("bag", &info, "WHERE GID = ? AND UID = ? ORDER BY Name", func() error {
+		list = append(list, info)
+		return nil
+	}, gid, uid)
+	return
+}
+
+// bagText 背包内容, 包括旧版本购买的道具
+func bagText(r *ruleset, gid, uid int64) (string, error) {
+	legacy, err := niu.Bag(gid, uid)
+	if err != nil {
+		return "", err
+	}
+	list := bag.list(gid, uid)
+	if len(list) == 0 {
+		return legacy, nil
+	}
+	var sb strings.Builder
+	sb.WriteString("当前牛牛背包如下\n")
+	for _, p := range list {
+		sb.WriteString(p.Name)
+		sb.WriteString(": ")
+		sb.WriteString(strconv.Itoa(p.Count))
+		if _, ok := r.prop(p.Name); !ok {
+			sb.WriteString(" (本群已下架)")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n旧版道具:\n")
+	sb.WriteString(strings.TrimPrefix(legacy, "当前牛牛背包如下\n"))
+	return sb.String(), nil
+}
+
+// takeProp 从背包中取出一个本群规则中的道具
+//
+// 背包中没有时返回 ok == false, 由调用者决定是否使用旧版道具
+func takeProp(r *ruleset, gid, uid int64, name, scope string) (p *propRule, ok bool, err error) {
+	p, ok = r.prop(name)
+	if !ok {
+		return nil, false, nil
+	}
+	if p.Scope != scope {
+		return nil, false, niu.ErrInvalidPropUsageScope
+	}
+	if bag.count(gid, uid, name) <= 0 {
+		return nil, false, nil
+	}
+	return p, true, bag.add(gid, uid, name, -1)
+}
+
+// playDaJiao 按规则打胶
+func playDaJiao(r *ruleset, gid, uid int64, p *propRule) (string, error) {
+	gamemu.Lock()
+	defer gamemu.Unlock()
+	length, err := niu.GetWordNiuNiu(gid, uid)
+	if err != nil {
+		return "", niu.ErrNoNiuNiuTwo
+	}
+	msg, length := dajiao(r, length, p)
+	return msg, niu.SetWordNiuNiu(gid, uid, length)
+}
+
+// playJJ 按规则击剑, 返回对方击剑后的长度
+func playJJ(r *ruleset, gid, uid, adduser int64, p *propRule) (string, float64, error) {
+	if uid == adduser {
+		return "", 0, niu.ErrCannotFight
+	}
+	gamemu.Lock()
+	defer gamemu.Unlock()
+	my, err := niu.GetWordNiuNiu(gid, uid)
+	if err != nil {
+		return "", 0, niu.ErrNoNiuNiu
+	}
+	oppo, err := niu.GetWordNiuNiu(gid, adduser)
+	if err != nil {
+		return "", 0, niu.ErrAdduserNoNiuNiu
+	}
+	msg, my, oppo := fight(r, my, oppo, p)
+	if err = niu.SetWordNiuNiu(gid, uid, my); err != nil {
+		return "", 0, err
+	}
+	return msg, oppo, niu.SetWordNiuNiu(gid, adduser, oppo)
+}
+
+// niuIDOf 返回用户当前牛牛的ID, id 为旧版接口返回的ID, 未知时传 uuid.Nil
+func niuIDOf(gid, uid int64, id uuid.UUID) uuid.UUID {
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	id, _ = niuIDs.LoadOrStore(fmt.Sprintf("%d_%d", gid, uid), id)
+	return id
+}
+
+// retireNiuNiu 牛牛离开用户后作废其ID, 之前被 jj 的记录不能再赎回
+func retireNiuNiu(gid, uid int64, reason error) {
+	key := fmt.Sprintf("%d_%d", gid, uid)
+	if id, ok := niuIDs.LoadAndDelete(key); ok {
+		retired.Store(id, reason)
+	}
+	jjCount.Delete(key)
+}
+
+// redeem 按规则赎回牛牛
+func redeem(r *ruleset, gid, uid int64, rec *niu.PKRecord) (int, error) {
+	gamemu.Lock()
+	defer gamemu.Unlock()
+	if _, err := niu.GetWordNiuNiu(gid, uid); err != nil {
+		return 0, niu.ErrNoNiuNiu
+	}
+	if reason, ok := retired.Load(rec.NiuID); ok {
+		return 0, reason
+	}
+	if id, ok := niuIDs.Load(fmt.Sprintf("%d_%d", gid, uid)); !ok || id != rec.NiuID {
+		return 0, niu.ErrCanceled
+	}
+	price := int(hitGlue(rec.Length))*r.RedeemPerCM + r.RedeemBase
+	if err := ledger.Spend(uid, price, "niuniu", 0, "赎牛牛"); err != nil {
+		return price, err
+	}
+	return price, niu.SetWordNiuNiu(gid, uid, rec.Length)
+}
+
+func dajiao(r *ruleset, length float64, p *propRule) (string, float64) {
+	if p != nil {
+		change := math.Abs(hitGlue(length)) * p.Power
+		if p.Effect == "grow" {
+			length += change
+			return randomChoice([]string{
+				fmt.Sprintf("哈哈，你这一用%s，牛牛就像是被激发了潜能，增加了%.2fcm！看来今天是个大日子呢！", p.Name, change),
+				fmt.Sprintf("使用%s后，你的牛牛就像是开启了加速模式，一下增加了%.2fcm，这成长速度让人惊叹！", p.Name, change),
+			}), length
+		}
+		length -= change
+		return randomChoice([]string{
+			fmt.Sprintf("你使用%s,咿呀咿呀一下使当前长度发生了一些变化，当前长度%.2fcm", p.Name, length),
+			fmt.Sprintf("缩小奇迹’在你身上发生了，牛牛凹进去了%.2fcm，你的选择真是独特！", change),
+		}), length
+	}
+	probability := rand.Intn(100)
+	change := math.Abs(hitGlue(length)) * r.DaJiao.Power
+	switch {
+	case probability < r.DaJiao.Grow:
+		length += change
+		return randomChoice([]string{
+			fmt.Sprintf("你嘿咻嘿咻一下，促进了牛牛发育，牛牛增加%.2fcm了呢！", change),
+			fmt.Sprintf("你打了个舒服痛快的🦶呐，牛牛增加了%.2fcm呢！", change),
+		}), length
+	case probability < r.DaJiao.Grow+r.DaJiao.Stay:
+		return randomChoice([]string{
+			"你打了个🦶，但是什么变化也没有，好奇怪捏~",
+			"你的牛牛刚开始变长了，可过了一会又回来了，什么变化也没有，好奇怪捏~",
+		}), length
+	}
+	length -= change
+	if length < 0 {
+		return randomChoice([]string{
+			fmt.Sprintf("哦吼！？看来你的牛牛凹进去了%.2fcm呢！", change),
+			fmt.Sprintf("笑死，你因为打🦶过度导致牛牛凹进去了%.2fcm！🤣🤣🤣", change),
+		}), length
+	}
+	return randomChoice([]string{
+		fmt.Sprintf("阿哦，你过度打🦶，牛牛缩短%.2fcm了呢！", change),
+		fmt.Sprintf("小打怡情，大打伤身，强打灰飞烟灭！你过度打🦶，牛牛缩短了%.2fcm捏！", change),
+	}), length
+}
+
+func fight(r *ruleset, my, oppo float64, p *propRule) (string, float64, float64) {
+	if p != nil {
+		var change float64
+		if my > oppo {
+			change = hitGlue(my + oppo)
+		} else {
+			change = hitGlue((my + oppo) / 2)
+		}
+		change *= p.Power
+		if p.Effect == "win" {
+			my += change
+			return fmt.Sprintf("凭借%s的力量，你让对方在你的长度面前俯首称臣！你的长度增加了%.2fcm，当前长度达到了%.2fcm", p.Name, change, my),
+				my, oppo - change/1.3
+		}
+		my -= change
+		return fmt.Sprintf("哈哈，看来%s有点儿调皮，让你的长度缩水了%.2fcm！现在你的长度是%.2fcm，下次可得小心使用哦！", p.Name, change, my),
+			my, oppo + 0.7*change
+	}
+	special := rand.Float64() < r.PK.Special
+	switch {
+	case special && oppo <= -100 && my > 0:
+		my += hitGlue(oppo) + rand.Float64()*math.Log2(math.Abs(0.5*(my+oppo)))
+		my *= 0.85
+		return fmt.Sprintf("对方身为魅魔诱惑了你，你同化成魅魔！当前长度%.2fcm！", -my), -my, oppo
+	case special && oppo >= 100 && my > 0:
+		my += math.Min(math.Abs(0.27*my), math.Abs(1.5*my))
+		my *= 0.85
+		return fmt.Sprintf("对方以牛头人的荣誉摧毁了你的牛牛！当前长度%.2fcm！", my), my, oppo
+	case special && my <= -100 && oppo > 0:
+		change := hitGlue(my+oppo) + rand.Float64()*math.Log2(math.Abs(0.5*(my+oppo)))
+		oppo -= change
+		my = (my - change) * 0.85
+		return fmt.Sprintf("你身为魅魔诱惑了对方，吞噬了对方部分长度！当前长度%.2fcm！", my), my, oppo
+	case special && my >= 100 && oppo > 0:
+		my = (my - oppo) * 0.85
+		return fmt.Sprintf("你以牛头人的荣誉摧毁了对方的牛牛！当前长度%.2fcm！", my), my, 0.01
+	}
+	change := fence(oppo) * r.PK.Power
+	if change == 0 {
+		change = rand.Float64() + float64(rand.Intn(3))
+	}
+	if rand.Float64() < winProbability(&r.PK, my, oppo) {
+		my += change
+		oppo -= r.PK.LoserRate * change
+		if my < 0 {
+			return fmt.Sprintf("哦吼！？你的牛牛在长大欸！长大了%.2fcm！", change), my, oppo
+		}
+		return fmt.Sprintf("你以绝对的长度让对方屈服了呢！你的长度增加%.2fcm，当前长度%.2fcm！", change, my), my, oppo
+	}
+	my -= change
+	oppo += r.PK.LoserRate * change
+	if my < 0 {
+		return fmt.Sprintf("哦吼！？看来你的牛牛因为击剑而凹进去了呢🤣🤣🤣！凹进去了%.2fcm！", change), my, oppo
+	}
+	return fmt.Sprintf("对方以绝对的长度让你屈服了呢！你的长度减少%.2fcm，当前长度%.2fcm！", change, my), my, oppo
+}
+
+// winProbability 双方长度差距越大, 胜负越难以预料
+func winProbability(pk *pkRule, a, b float64) float64 {
+	a, b = math.Max(math.Abs(a), 0.01), math.Max(math.Abs(b), 0.01)
+	ratio := math.Max(a, b) / math.Min(a, b)
+	return math.Max(pk.BaseWin*(1-pk.RatioPenalty*(ratio-1)), pk.MinWin)
+}
+
+// fence 根据长度计算变化量
+func fence(rd float64) float64 {
+	rd = math.Abs(rd)
+	if rd == 0 {
+		rd = 1
+	}
+	r := hitGlue(rd)*2 + rand.Float64()*math.Log2(rd)
+	return float64(int(r * rand.Float64()))
+}
+
+func hitGlue(l float64) float64 {
+	l = math.Abs(l)
+	if l < 0.1 {
+		l = 0.1
+	}
+	var logValue float64
+	switch {
+	case l > 1000:
+		logValue = math.Log10(l) * 2
+	case l > 100:
+		logValue = math.Log10(l*1.5) * 2
+	case l > 10:
+		logValue = math.Log2(l * 1.5)
+	case l > 1:
+		logValue = math.Log2(l * 2)
+	default: // 0.1 <= l <= 1
+		logValue = 1
+	}
+	return rand.Float64() * logValue
+}
@@ -4,6 +4,7 @@ package niuniu
 import (
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -18,8 +19,14 @@ import (
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/extension/rate"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 )
 
+// maxPropQuantity 牛牛商店单次购买道具的上限
+const maxPropQuantity = 100
+
 var (
 	en = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
@@ -32,19 +39,24 @@ var (
 			"- 赎牛牛(cd:60分钟)\n" +
 			"- 出售牛牛\n" +
 			"- 牛牛拍卖行\n" +
+			"- 拍卖牛牛 起拍价 [时长(默认1小时,10分钟~24小时)]\n" +
+			"- 出价 拍卖序号 金额 (已有牛牛时不能出价)\n" +
+			"- 取消拍卖 拍卖序号 (无人出价时)\n" +
 			"- 牛牛商店\n" +
 			"- 牛牛背包\n" +
 			"- 注销牛牛\n" +
 			"- 查看我的牛牛\n" +
 			"- 牛子长度排行\n" +
 			"- 牛子深度排行\n" +
-			"\n ps : 出售后的牛牛都会进入牛牛拍卖行哦",
+			"- 牛牛规则\n" +
+			"- 重载牛牛规则 (仅超级用户)\n" +
+			"\n ps : 出售后的牛牛都会进入牛牛拍卖行哦" +
+			"\n 限时拍卖出价时会冻结出价的钱, 被超过时退回, 结束前1分钟内出价会延长1分钟" +
+			"\n 冷却、道具价格与效果、击剑胜率等规则可在 data/niuniu/rules.json 中按群配置",
 		PrivateDataFolder: "niuniu",
 	})
-	dajiaoLimiter = rate.NewManager[string](time.Second*90, 1)
-	jjLimiter     = rate.NewManager[string](time.Second*150, 1)
-	jjCount       = syncx.Map[string, *niu.PKRecord]{}
-	register      = syncx.Map[string, *niu.PKRecord]{}
+	jjCount  = syncx.Map[string, *niu.PKRecord]{}
+	register = syncx.Map[string, *niu.PKRecord]{}
 )
 
 func init() {
@@ -57,8 +69,29 @@ func init() {
 			return
 		}
 
+		timed := adb.list(gid)
+		if len(auction) == 0 && len(timed) == 0 {
+			ctx.SendChain(message.Text(niu.ErrNoNiuNiuINAuction, ", 发送\"拍卖牛牛 起拍价 [时长]\"拍卖你的牛牛"))
+			return
+		}
+
 		var messages message.Message
-		messages = append(messages, ctxext.FakeSenderForwardNode(ctx, message.Text("牛牛拍卖行有以下牛牛")))
+		if len(timed) > 0 {
+			messages = append(messages, ctxext.FakeSenderForwardNode(ctx, message.Text("以下牛牛正在限时竞拍\n发送\"出价 拍卖序号 金额\"参与竞拍")))
+			for _, info := range timed {
+				current := "暂无出价"
+				if info.Bidder != 0 {
+					current = fmt.Sprintf("%d%s (%s)", info.Bid, wallet.GetWalletName(), ctx.CardOrNickName(info.Bidder))
+				}
+				msg := fmt.Sprintf("拍卖序号: %d\n卖家: %s\n牛牛大小: %.2fcm\n起拍价: %d%s\n当前最高价: %s\n结束时间: %s",
+					info.ID, ctx.CardOrNickName(info.Seller), info.Length, info.StartPrice, wallet.GetWalletName(),
+					current, time.Unix(info.EndTime, 0).Format("01/02 15:04:05"))
+				messages = append(messages, ctxext.FakeSenderForwardNode(ctx, message.Text(msg)))
+			}
+		}
+		if len(auction) > 0 {
+			messages = append(messages, ctxext.FakeSenderForwardNode(ctx, message.Text("以下牛牛一口价出售")))
+		}
 		for _, info := range auction {
 			msg := fmt.Sprintf("商品序号: %d\n牛牛原所属: %d\n牛牛价格: %d%s\n牛牛大小: %.2fcm",
 				info.ID, info.UserID, info.Money, wallet.GetWalletName(), info.Length)
@@ -68,7 +101,10 @@ func init() {
 			ctx.Send(message.Text("发送拍卖行失败"))
 			return
 		}
-		ctx.SendChain(message.Reply(ctx.Event.Message), message.Text("请输入对应序号进行购买"))
+		if len(auction) == 0 {
+			return
+		}
+		ctx.SendChain(message.Reply(ctx.Event.Message), message.Text("一口价牛牛请输入对应商品序号进行购买"))
 		recv, cancel := zero.NewFutureEvent("message", 999, false, zero.CheckUser(uid), zero.CheckGroup(gid), zero.RegexRule(`^(\d+)$`)).Repeat()
 		defer cancel()
 		timer := time.NewTimer(120 * time.Second)
@@ -86,21 +122,31 @@ func init() {
 					ctx.SendChain(message.Text("ERROR: ", err))
 					return
 				}
-				msg, err := niu.Auction(gid, uid, n)
+				var msg string
+				err = ledger.Track(uid, "niuniu", 0, "购买拍卖行牛牛", func() (err error) {
+					msg, err = niu.Auction(gid, uid, n)
+					return
+				})
 				if err != nil {
 					ctx.SendChain(message.Text("ERROR:", err))
 					return
 				}
+				// 原有的牛牛被替换, 不能再赎回
+				retireNiuNiu(gid, uid, niu.ErrCanceled)
 				ctx.SendChain(message.Reply(ctx.Event.Message), message.Text(msg))
 				return
 			}
 		}
 	})
-	en.OnFullMatch("出售牛牛", zero.OnlyGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+	en.OnFullMatch("出售牛牛", zero.OnlyGroup, jail.CheckFree).SetBlock(true).Handle(func(ctx *zero.Ctx) {
 		gid := ctx.Event.GroupID
 		uid := ctx.Event.UserID
 		key := fmt.Sprintf("%d_%d", gid, uid)
-		sell, err := niu.Sell(gid, uid)
+		var sell string
+		err := ledger.Track(uid, "niuniu", 0, "出售牛牛", func() (err error) {
+			sell, err = niu.Sell(gid, uid)
+			return
+		})
 		if errors.Is(err, niu.ErrCanceled) || errors.Is(err, niu.ErrNoNiuNiu) {
 			ctx.SendChain(message.Text(err))
 			jjCount.Delete(key)
@@ -111,22 +157,20 @@ func init() {
 		}
 
 		// 数据库操作成功之后，及时删除残留的缓存
-		if _, ok := jjCount.Load(key); ok {
-			jjCount.Delete(key)
-		}
+		retireNiuNiu(gid, uid, niu.ErrAuctioned)
 		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(sell))
 	})
 	en.OnFullMatch("牛牛背包", zero.OnlyGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
 		gid := ctx.Event.GroupID
 		uid := ctx.Event.UserID
-		bag, err := niu.Bag(gid, uid)
+		msg, err := bagText(rulesOf(gid), gid, uid)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR:", err))
 			return
 		}
-		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(bag))
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(msg))
 	})
-	en.OnFullMatch("牛牛商店", zero.OnlyGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+	en.OnFullMatch("牛牛商店", zero.OnlyGroup, jail.CheckFree).SetBlock(true).Handle(func(ctx *zero.Ctx) {
 		gid := ctx.Event.GroupID
 		uid := ctx.Event.UserID
 
@@ -135,16 +179,10 @@ func init() {
 			return
 		}
 
-		propMap := map[int]struct {
-			name        string
-			cost        int
-			scope       string
-			description string
-		}{
-			1: {"伟哥", 100, "打胶", "可以让你打胶每次都增长"},
-			2: {"媚药", 100, "打胶", "可以让你打胶每次都减少"},
-			3: {"击剑神器", 300, "jj", "可以让你每次击剑都立于不败之地"},
-			4: {"击剑神稽", 300, "jj", "可以让你每次击剑都失败"},
+		rules := rulesOf(gid)
+		if len(rules.Props) == 0 {
+			ctx.SendChain(message.Text("本群的牛牛商店暂时没有商品"))
+			return
 		}
 
 		var messages message.Message
@@ -152,14 +190,13 @@ func init() {
 			message.Text("输入对应序号进行购买商品"),
 			message.Text(
 				"使用说明:\n"+
-					"商品id-商品数量\n"+
+					"商品id-商品数量(1~100)\n"+
 					"如想购买10个伟哥\n"+
 					"即:1-10")))
 		messages = append(messages, ctxext.FakeSenderForwardNode(ctx, message.Text("牛牛商店当前售卖的物品如下")))
-		for id := 1; id <= len(propMap); id++ {
-			product := propMap[id]
-			productInfo := fmt.Sprintf("商品%d\n商品名: %s\n商品价格: %dATRI币\n商品作用域: %s\n商品描述: %s",
-				id, product.name, product.cost, product.scope, product.description)
+		for i, product := range rules.Props {
+			productInfo := fmt.Sprintf("商品%d\n商品名: %s\n商品价格: %d%s\n商品作用域: %s\n商品描述: %s",
+				i+1, product.Name, product.Price, wallet.GetWalletName(), product.Scope, product.Desc)
 			messages = append(messages, ctxext.FakeSenderForwardNode(ctx, message.Text(productInfo)))
 		}
 		if id := ctx.Send(messages).ID(); id == 0 {
@@ -181,10 +218,28 @@ func init() {
 
 				// 解析输入的商品ID和数量
 				parts := strings.Split(answer, "-")
-				productID, _ := strconv.Atoi(parts[0])
-				quantity, _ := strconv.Atoi(parts[1])
-
-				if err := niu.Store(gid, uid, productID, quantity); err != nil {
+				productID, err := strconv.Atoi(parts[0])
+				if err != nil || productID < 1 || productID > len(rules.Props) {
+					ctx.SendChain(message.Text("ERROR: ", niu.ErrInvalidProductID))
+					return
+				}
+				quantity, err := strconv.Atoi(parts[1])
+				if err != nil || quantity < 1 || quantity > maxPropQuantity {
+					ctx.SendChain(message.Text("ERROR: 单次只能购买1~", maxPropQuantity, "个道具"))
+					return
+				}
+				product := rules.Props[productID-1]
+				if product.Price <= 0 || product.Price > math.MaxInt/quantity {
+					ctx.SendChain(message.Text("ERROR: 道具价格异常"))
+					return
+				}
+				cost := product.Price * quantity
+				if err := ledger.Spend(uid, cost, "niuniu", 0, "牛牛商店"); err != nil {
+					ctx.SendChain(message.Text("ERROR: ", niu.ErrNoMoney))
+					return
+				}
+				if err := bag.add(gid, uid, product.Name, quantity); err != nil {
+					_ = ledger.Earn(uid, cost, "niuniu", 0, "牛牛商店退款")
 					ctx.SendChain(message.Text("ERROR: ", err))
 					return
 				}
@@ -194,7 +249,7 @@ func init() {
 			}
 		}
 	})
-	en.OnFullMatch("赎牛牛", zero.OnlyGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+	en.OnFullMatch("赎牛牛", zero.OnlyGroup, jail.CheckFree).SetBlock(true).Handle(func(ctx *zero.Ctx) {
 		gid := ctx.Event.GroupID
 		uid := ctx.Event.UserID
 		last, ok := jjCount.Load(fmt.Sprintf("%d_%d", gid, uid))
@@ -231,7 +286,17 @@ func init() {
 					return
 				}
 
-				if err := niu.Redeem(gid, uid, *last); err != nil {
+				price, err := redeem(rulesOf(gid), gid, uid, last)
+				if errors.Is(err, ledger.ErrNotEnough) {
+					ctx.SendChain(message.Text("赎牛牛需要", price, wallet.GetWalletName(), "，快去赚钱吧"))
+					return
+				}
+				if errors.Is(err, niu.ErrAuctioned) || errors.Is(err, niu.ErrCanceled) {
+					ctx.SendChain(message.Text(err))
+					jjCount.Delete(fmt.Sprintf("%d_%d", gid, uid))
+					return
+				}
+				if err != nil {
 					ctx.SendChain(message.Text("ERROR:", err))
 					return
 				}
@@ -281,33 +346,46 @@ func init() {
 		}
 		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(view))
 	})
-	en.OnRegex(`^(?:.*使用(.*))??打胶$`, zero.OnlyGroup).SetBlock(true).Limit(func(ctx *zero.Ctx) *rate.Limiter {
-		lt := dajiaoLimiter.Load(fmt.Sprintf("%d_%d", ctx.Event.GroupID, ctx.Event.UserID))
+	en.OnRegex(`^(?:.*使用(.*))??打胶$`, zero.OnlyGroup, jail.CheckFree).SetBlock(true).Limit(func(ctx *zero.Ctx) *rate.Limiter {
+		cd := rulesOf(ctx.Event.GroupID).DaJiaoCD
+		lt := limiter("dajiao", cd, fmt.Sprintf("%d_%d", ctx.Event.GroupID, ctx.Event.UserID))
 		ctx.State["dajiao_last_touch"] = lt.LastTouch()
+		ctx.State["dajiao_cd"] = cd
 		return lt
 	}, func(ctx *zero.Ctx) {
 		timePass := int(time.Since(time.Unix(ctx.State["dajiao_last_touch"].(int64), 0)).Seconds())
+		cd := ctx.State["dajiao_cd"].(int)
 		ctx.SendChain(message.Text(randomChoice([]string{
 			fmt.Sprintf("才过去了%ds时间,你就又要打🦶了，身体受得住吗", timePass),
-			fmt.Sprintf("不行不行，你的身体会受不了的，歇%ds再来吧", 90-timePass),
-			fmt.Sprintf("休息一下吧，会炸膛的！%ds后再来吧", 90-timePass),
-			fmt.Sprintf("打咩哟，你的牛牛会爆炸的，休息%ds再来吧", 90-timePass),
+			fmt.Sprintf("不行不行，你的身体会受不了的，歇%ds再来吧", cd-timePass),
+			fmt.Sprintf("休息一下吧，会炸膛的！%ds后再来吧", cd-timePass),
+			fmt.Sprintf("打咩哟，你的牛牛会爆炸的，休息%ds再来吧", cd-timePass),
 		})))
 	}).Handle(func(ctx *zero.Ctx) {
 		// 获取群号和用户ID
 		gid := ctx.Event.GroupID
 		uid := ctx.Event.UserID
 		fiancee := ctx.State["regex_matched"].([]string)
+		rules := rulesOf(gid)
 
-		msg, err := niu.HitGlue(gid, uid, fiancee[1])
+		var msg string
+		p, ok, err := takeProp(rules, gid, uid, fiancee[1], "打胶")
+		switch {
+		case err != nil:
+		case ok || fiancee[1] == "":
+			msg, err = playDaJiao(rules, gid, uid, p)
+		default:
+			// 背包中没有时尝试使用旧版道具
+			msg, err = niu.HitGlue(gid, uid, fiancee[1])
+		}
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
-			dajiaoLimiter.Delete(fmt.Sprintf("%d_%d", ctx.Event.GroupID, ctx.Event.UserID))
+			resetLimiter("dajiao", rules.DaJiaoCD, fmt.Sprintf("%d_%d", gid, uid))
 			return
 		}
 		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(msg))
 	})
-	en.OnFullMatch("注册牛牛", zero.OnlyGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+	en.OnFullMatch("注册牛牛", zero.OnlyGroup, jail.CheckFree).SetBlock(true).Handle(func(ctx *zero.Ctx) {
 		gid := ctx.Event.GroupID
 		uid := ctx.Event.UserID
 		msg, err := niu.Register(gid, uid)
@@ -318,36 +396,56 @@ func init() {
 		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(msg))
 	})
 	en.OnMessage(zero.NewPattern(nil).Text(`^(?:.*使用(.*))??jj`).At().AsRule(),
-		zero.OnlyGroup).SetBlock(true).Limit(func(ctx *zero.Ctx) *rate.Limiter {
-		lt := jjLimiter.Load(fmt.Sprintf("%d_%d", ctx.Event.GroupID, ctx.Event.UserID))
+		zero.OnlyGroup, jail.CheckFree).SetBlock(true).Limit(func(ctx *zero.Ctx) *rate.Limiter {
+		cd := rulesOf(ctx.Event.GroupID).JJCD
+		lt := limiter("jj", cd, fmt.Sprintf("%d_%d", ctx.Event.GroupID, ctx.Event.UserID))
 		ctx.State["jj_last_touch"] = lt.LastTouch()
+		ctx.State["jj_cd"] = cd
 		return lt
 	}, func(ctx *zero.Ctx) {
 		timePass := int(time.Since(time.Unix(ctx.State["jj_last_touch"].(int64), 0)).Seconds())
+		cd := ctx.State["jj_cd"].(int)
 		ctx.SendChain(message.Text(randomChoice([]string{
 			fmt.Sprintf("才过去了%ds时间,你就又要击剑了，真是饥渴难耐啊", timePass),
-			fmt.Sprintf("不行不行，你的身体会受不了的，歇%ds再来吧", 150-timePass),
-			fmt.Sprintf("你这种男同就应该被送去集中营！等待%ds再来吧", 150-timePass),
-			fmt.Sprintf("打咩哟！你的牛牛会炸的，休息%ds再来吧", 150-timePass),
+			fmt.Sprintf("不行不行，你的身体会受不了的，歇%ds再来吧", cd-timePass),
+			fmt.Sprintf("你这种男同就应该被送去集中营！等待%ds再来吧", cd-timePass),
+			fmt.Sprintf("打咩哟！你的牛牛会炸的，休息%ds再来吧", cd-timePass),
 		})))
 	},
 	).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		gid := ctx.Event.GroupID
+		rules := rulesOf(gid)
+		key := fmt.Sprintf("%d_%d", gid, uid)
 		patternParsed := ctx.State[zero.KeyPattern].([]zero.PatternParsed)
 		adduser, err := strconv.ParseInt(patternParsed[1].At(), 10, 64)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
-			jjLimiter.Delete(fmt.Sprintf("%d_%d", ctx.Event.GroupID, ctx.Event.UserID))
+			resetLimiter("jj", rules.JJCD, key)
 			return
 		}
-		uid := ctx.Event.UserID
-		gid := ctx.Event.GroupID
-		msg, length, niuID, err := niu.JJ(gid, uid, adduser, patternParsed[0].Text()[1])
+		var (
+			msg    string
+			length float64
+			rec    niu.PKRecord // 使用旧版道具时由 niu 返回对方的牛牛ID
+		)
+		prop := patternParsed[0].Text()[1]
+		p, ok, err := takeProp(rules, gid, uid, prop, "jj")
+		switch {
+		case err != nil:
+		case ok || prop == "":
+			msg, length, err = playJJ(rules, gid, uid, adduser, p)
+		default:
+			// 背包中没有时尝试使用旧版道具
+			msg, length, rec.NiuID, err = niu.JJ(gid, uid, adduser, prop)
+		}
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
-			jjLimiter.Delete(fmt.Sprintf("%d_%d", ctx.Event.GroupID, ctx.Event.UserID))
+			resetLimiter("jj", rules.JJCD, key)
 			return
 		}
 		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(msg))
+		rec.NiuID = niuIDOf(gid, adduser, rec.NiuID)
 		j := fmt.Sprintf("%d_%d", gid, adduser)
 		count, ok := jjCount.Load(j)
 		var c niu.PKRecord
@@ -355,14 +453,14 @@ func init() {
 		if !ok {
 			// 第一次被 jj
 			c = niu.PKRecord{
-				NiuID:     niuID,
+				NiuID:     rec.NiuID,
 				TimeLimit: time.Now(),
 				Count:     1,
 				Length:    length,
 			}
 		} else {
 			c = niu.PKRecord{
-				NiuID:     niuID,
+				NiuID:     count.NiuID,
 				TimeLimit: time.Now(),
 				Count:     count.Count + 1,
 				Length:    count.Length,
@@ -370,7 +468,7 @@ func init() {
 			// 超时了，重置
 			if time.Since(c.TimeLimit) > time.Hour {
 				c = niu.PKRecord{
-					NiuID:     niuID,
+					NiuID:     rec.NiuID,
 					TimeLimit: time.Now(),
 					Count:     1,
 					Length:    length,
@@ -397,7 +495,7 @@ func init() {
 			}
 		}
 	})
-	en.OnFullMatch("注销牛牛", zero.OnlyGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+	en.OnFullMatch("注销牛牛", zero.OnlyGroup, jail.CheckFree).SetBlock(true).Handle(func(ctx *zero.Ctx) {
 		uid := ctx.Event.UserID
 		gid := ctx.Event.GroupID
 		key := fmt.Sprintf("%d_%d", gid, uid)
@@ -409,7 +507,7 @@ func init() {
 				Count:     1,
 			}
 		default:
-			if err := wallet.InsertWalletOf(uid, -data.Count*50); err != nil {
+			if err := ledger.Deduct(uid, data.Count*50, "niuniu", 0, "注销牛牛"); err != nil {
 				ctx.SendChain(message.Text("你的钱不够你注销牛牛了，这次注销需要", data.Count*50, wallet.GetWalletName()))
 				return
 			}
@@ -421,6 +519,8 @@ func init() {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return
 		}
+		// 注销后不能再赎回
+		retireNiuNiu(gid, uid, niu.ErrCanceled)
 		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(msg))
 	})
 }
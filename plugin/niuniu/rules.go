@@ -0,0 +1,276 @@
+package niuniu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/floatbox/binary"
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/RomiChan/syncx"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/extension/rate"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// ruleset 牛牛规则, 在 data/niuniu/rules.json 中配置,
+// default 为默认规则, groups 中可按群号覆盖其中的任意字段
+type ruleset struct {
+	DaJiaoCD    int        `json:"dajiao_cd"`     // 打胶冷却(秒)
+	JJCD        int        `json:"jj_cd"`         // 击剑冷却(秒)
+	DaJiao      dajiaoRule `json:"dajiao"`        // 打胶
+	PK          pkRule     `json:"pk"`            // 击剑
+	RedeemBase  int        `json:"redeem_base"`   // 赎牛牛的基础价格
+	RedeemPerCM int        `json:"redeem_per_cm"` // 赎牛牛时每cm的价格
+	Props       []propRule `json:"props"`         // 商店道具
+}
+
+type dajiaoRule struct {
+	Grow  int     `json:"grow"`  // 变长的概率(%)
+	Stay  int     `json:"stay"`  // 不变的概率(%), 其余为变短
+	Power float64 `json:"power"` // 变化量倍率
+}
+
+type pkRule struct {
+	BaseWin      float64 `json:"base_win"`      // 双方长度相同时的胜率
+	RatioPenalty float64 `json:"ratio_penalty"` // 长度比每多1倍, 胜率降低的比例
+	MinWin       float64 `json:"min_win"`       // 最低胜率
+	Special      float64 `json:"special"`       // 牛头人|魅魔发动特殊能力的概率
+	LoserRate    float64 `json:"loser_rate"`    // 败者损失为胜者增长的倍数
+	Power        float64 `json:"power"`         // 变化量倍率
+}
+
+type propRule struct {
+	Name   string  `json:"name"`
+	Price  int     `json:"price"`
+	Scope  string  `json:"scope"`  // 打胶 | jj
+	Effect string  `json:"effect"` // 打胶: grow 必定变长, shrink 必定变短; jj: win 必胜, lose 必败
+	Power  float64 `json:"power"`  // 变化量倍率
+	Desc   string  `json:"desc"`
+}
+
+var builtinRules = ruleset{
+	DaJiaoCD:    90,
+	JJCD:        150,
+	DaJiao:      dajiaoRule{Grow: 40, Stay: 20, Power: 1},
+	PK:          pkRule{BaseWin: 0.9, RatioPenalty: 0.1, MinWin: 0.01, Special: 0.1, LoserRate: 0.8, Power: 1},
+	RedeemBase:  150,
+	RedeemPerCM: 100,
+	Props: []propRule{
+		{Name: "伟哥", Price: 100, Scope: "打胶", Effect: "grow", Power: 1, Desc: "可以让你打胶每次都增长"},
+		{Name: "媚药", Price: 100, Scope: "打胶", Effect: "shrink", Power: 1, Desc: "可以让你打胶每次都减少"},
+		{Name: "击剑神器", Price: 300, Scope: "jj", Effect: "win", Power: 1, Desc: "可以让你每次击剑都立于不败之地"},
+		{Name: "击剑神稽", Price: 300, Scope: "jj", Effect: "lose", Power: 1, Desc: "可以让你每次击剑都失败"},
+	},
+}
+
+var (
+	rulemu       sync.RWMutex
+	defaultRules = builtinRules
+	groupRules   = map[int64]ruleset{}
+	// 不同冷却时间的限速器
+	limiters = syncx.Map[string, *rate.LimiterManager[string]]{}
+)
+
+func init() {
+	if err := loadRules(); err != nil {
+		logrus.Warnln("[niuniu] 加载牛牛规则失败, 使用内置规则:", err)
+	}
+	en.OnFullMatch("重载牛牛规则", zero.SuperUserPermission).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		if err := loadRules(); err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err, "\n已保留原有规则"))
+			return
+		}
+		rulemu.RLock()
+		n := len(groupRules)
+		rulemu.RUnlock()
+		ctx.SendChain(message.Text("重载成功, 共", n, "个群使用自定义规则"))
+	})
+	en.OnFullMatch("牛牛规则", zero.OnlyGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		gid := ctx.Event.GroupID
+		rulemu.RLock()
+		_, custom := groupRules[gid]
+		rulemu.RUnlock()
+		data, err := text.RenderToBase64(rulesOf(gid).String(custom), text.FontFile, 600, 20)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Image("base64://" + binary.BytesToString(data)))
+	})
+}
+
+// rulesOf 获取群的生效规则
+func rulesOf(gid int64) *ruleset {
+	rulemu.RLock()
+	defer rulemu.RUnlock()
+	if r, ok := groupRules[gid]; ok {
+		return &r
+	}
+	r := defaultRules
+	return &r
+}
+
+// loadRules 从文件加载规则, 文件不存在时写入内置规则, 出错时不改变当前规则
+func loadRules() error {
+	path := en.DataFolder() + "rules.json"
+	if file.IsNotExist(path) {
+		data, err := json.MarshalIndent(struct {
+			Default ruleset            `json:"default"`
+			Groups  map[string]ruleset `json:"groups"`
+		}{builtinRules, map[string]ruleset{}}, "", "\t")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0644)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f struct {
+		Default json.RawMessage            `json:"default"`
+		Groups  map[string]json.RawMessage `json:"groups"`
+	}
+	if err = json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	def, err := overlay(&builtinRules, f.Default)
+	if err != nil {
+		return errors.New("default: " + err.Error())
+	}
+	groups := make(map[int64]ruleset, len(f.Groups))
+	for k, raw := range f.Groups {
+		gid, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return errors.New("无效的群号: " + k)
+		}
+		r, err := overlay(&def, raw)
+		if err != nil {
+			return errors.New(k + ": " + err.Error())
+		}
+		groups[gid] = r
+	}
+	rulemu.Lock()
+	defaultRules = def
+	groupRules = groups
+	rulemu.Unlock()
+	return nil
+}
+
+// overlay 在 base 上覆盖 raw 中出现的字段, 并检查规则是否合法
+func overlay(base *ruleset, raw json.RawMessage) (r ruleset, err error) {
+	r = *base
+	r.Props = nil
+	if len(raw) > 0 {
+		if err = json.Unmarshal(raw, &r); err != nil {
+			return
+		}
+	}
+	if r.Props == nil {
+		r.Props = base.Props
+	}
+	return r, r.validate()
+}
+
+func (r *ruleset) validate() error {
+	switch {
+	case r.DaJiaoCD < 0 || r.JJCD < 0:
+		return errors.New("冷却时间不能为负数")
+	case r.DaJiao.Grow < 0 || r.DaJiao.Stay < 0 || r.DaJiao.Grow+r.DaJiao.Stay > 100:
+		return errors.New("打胶概率应在0~100之间")
+	case r.DaJiao.Power <= 0 || r.PK.Power <= 0:
+		return errors.New("变化量倍率应大于0")
+	case r.PK.MinWin < 0 || r.PK.BaseWin > 1 || r.PK.MinWin > r.PK.BaseWin:
+		return errors.New("击剑胜率应满足 0 <= min_win <= base_win <= 1")
+	case r.PK.RatioPenalty < 0 || r.PK.LoserRate < 0:
+		return errors.New("ratio_penalty 与 loser_rate 不能为负数")
+	case r.PK.Special < 0 || r.PK.Special > 1:
+		return errors.New("special 应在0~1之间")
+	case r.RedeemBase < 0 || r.RedeemPerCM < 0:
+		return errors.New("赎牛牛价格不能为负数")
+	}
+	names := make(map[string]struct{}, len(r.Props))
+	for _, p := range r.Props {
+		if _, ok := names[p.Name]; ok || p.Name == "" {
+			return errors.New("道具名称为空或重复: " + p.Name)
+		}
+		names[p.Name] = struct{}{}
+		if p.Price <= 0 || p.Power <= 0 {
+			return errors.New("道具[" + p.Name + "]的价格与倍率应大于0")
+		}
+		switch {
+		case p.Scope == "打胶" && (p.Effect == "grow" || p.Effect == "shrink"):
+		case p.Scope == "jj" && (p.Effect == "win" || p.Effect == "lose"):
+		default:
+			return errors.New("道具[" + p.Name + "]的作用域与效果不匹配")
+		}
+	}
+	return nil
+}
+
+// prop 按名称查找道具
+func (r *ruleset) prop(name string) (*propRule, bool) {
+	for i := range r.Props {
+		if r.Props[i].Name == name {
+			return &r.Props[i], true
+		}
+	}
+	return nil, false
+}
+
+// limiter 获取对应冷却时间的限速器
+func limiter(kind string, cd int, key string) *rate.Limiter {
+	m, _ := limiters.LoadOrStore(kind+strconv.Itoa(cd), rate.NewManager[string](time.Duration(cd)*time.Second, 1))
+	return m.Load(key)
+}
+
+// resetLimiter 操作失败时重置冷却
+func resetLimiter(kind string, cd int, key string) {
+	if m, ok := limiters.Load(kind + strconv.Itoa(cd)); ok {
+		m.Delete(key)
+	}
+}
+
+func (p *propRule) effectName() string {
+	switch p.Effect {
+	case "grow":
+		return "必定变长"
+	case "shrink":
+		return "必定变短"
+	case "win":
+		return "必胜"
+	default:
+		return "必败"
+	}
+}
+
+// String 规则说明
+func (r *ruleset) String(custom bool) string {
+	var sb strings.Builder
+	sb.WriteString("本群牛牛规则")
+	if custom {
+		sb.WriteString("(自定义)")
+	}
+	fmt.Fprintf(&sb, "\n\n打胶冷却: %d秒\n击剑冷却: %d秒", r.DaJiaoCD, r.JJCD)
+	fmt.Fprintf(&sb, "\n\n打胶: %d%%变长, %d%%不变, %d%%变短, 变化倍率x%g",
+		r.DaJiao.Grow, r.DaJiao.Stay, 100-r.DaJiao.Grow-r.DaJiao.Stay, r.DaJiao.Power)
+	fmt.Fprintf(&sb, "\n击剑: 长度相同时胜率%g%%, 长度比每多1倍胜率降低%g%%, 最低%g%%",
+		r.PK.BaseWin*100, r.PK.RatioPenalty*100, r.PK.MinWin*100)
+	fmt.Fprintf(&sb, "\n败者损失为胜者增长的%g倍, 变化倍率x%g", r.PK.LoserRate, r.PK.Power)
+	fmt.Fprintf(&sb, "\n牛头人|魅魔发动特殊能力的概率: %g%%", r.PK.Special*100)
+	fmt.Fprintf(&sb, "\n\n赎牛牛: %d%s + 每cm %d%s", r.RedeemBase, wallet.GetWalletName(), r.RedeemPerCM, wallet.GetWalletName())
+	sb.WriteString("\n\n商店道具:")
+	for i, p := range r.Props {
+		fmt.Fprintf(&sb, "\n%d. %s  %d%s  [%s]%s x%g\n    %s", i+1, p.Name, p.Price, wallet.GetWalletName(), p.Scope, p.effectName(), p.Power, p.Desc)
+	}
+	return sb.String()
+}
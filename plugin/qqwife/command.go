@@ -39,6 +39,7 @@ type updateinfo struct {
 	CanMatch   int     // 嫁婚开关
 	CanNtr     int     // Ntr开关
 	CDtime     float64 // CD时间
+	Weighted   int     // 加权娶群友开关
 }
 
 // 结婚证信息
@@ -56,13 +57,15 @@ var (
 	engine = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "一群一天一夫一妻制群老婆",
-		Help: "- 娶群友\n- 群老婆列表\n- [允许|禁止]自由恋爱\n- [允许|禁止]牛头人\n- 设置CD为xx小时    →(默认12小时)\n- 重置花名册\n- 重置所有花名册(用于清除所有群数据及其设置)\n- 查好感度[对方Q号|@对方QQ]\n- 好感度列表\n- 好感度数据整理 (当好感度列表出现重复名字时使用)\n" +
+		Help: "- 娶群友\n- 群老婆列表\n- [允许|禁止]自由恋爱\n- [允许|禁止]牛头人\n- 设置CD为xx小时    →(默认12小时)\n- 重置花名册\n- 重置所有花名册(用于清除所有群数据及其设置)\n- 查好感度[对方Q号|@对方QQ]\n- 好感度列表\n- 好感度数据整理 (当好感度列表出现重复名字时使用)\n- 我的婚史[@对方QQ]\n- CP排行\n- 群关系图[显示的关系数][@对方QQ]    →(默认显示好感度最高的20条关系, @某人时以ta为中心)\n- [开启|关闭]加权娶群友    →(好感度越高、在一起次数越多越容易被娶到)\n" +
 			"--------------------------------\n以下指令存在CD,不跨天刷新,前两个受指令开关\n--------------------------------\n" +
 			"- (娶|嫁)@对方QQ\n自由选择对象, 自由恋爱(好感度越高成功率越高,保底30%概率)\n" +
 			"- 当[对方Q号|@对方QQ]的小三\n我和你才是真爱, 为了你我愿意付出一切(好感度越高成功率越高,保底10%概率)\n" +
 			"- 闹离婚\n你谁啊, 给我滚(好感度越高成功率越低)\n" +
 			"- 买礼物给[对方Q号|@对方QQ]\n使用小熊饼干获取好感度\n" +
 			"- 做媒 @攻方QQ @受方QQ\n身为管理, 群友的xing福是要搭把手的(攻受双方好感度越高成功率越高,保底30%概率)\n" +
+			"--------------------------------\n礼物商店(目录见 data/qqwife/gifts.json, 修改后即时生效)\n--------------------------------\n" +
+			"- 礼物商店\n- 购买礼物 礼物名 [数量(1~100)]\n- 我的礼物\n- 赠送 礼物名@对方QQ\n送出礼物随机增减好感度, 部分礼物附带效果:\n减少自己的技能CD、当天保护对方不被牛头人、下次(娶|嫁)对方必定成功\n" +
 			"--------------------------------\n好感度规则\n--------------------------------\n" +
 			"\"娶群友\"&\"(娶|嫁)@对方QQ\"指令好感度随机增加1~5。\n\"A牛B的C\"会导致C恨A, 好感度-5;\nB为了报复A, 好感度+5(什么柜子play)\nA为BC做媒,成功B、C对A好感度+1反之-1\n做媒成功BC好感度+1" +
 			"\nTips: 群老婆列表过0点刷新",
@@ -74,6 +77,9 @@ var (
 		if err == nil {
 			// 创建群配置表
 			err = 民政局.db.Create("updateinfo", &updateinfo{})
+			if err == nil {
+				err = 民政局.升级设置表()
+			}
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:", err))
 				return false
@@ -90,6 +96,24 @@ var (
 				ctx.SendChain(message.Text("[ERROR]:", err))
 				return false
 			}
+			// 创建婚史表
+			err = 民政局.db.Create("marriage", &marriage{})
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return false
+			}
+			// 创建礼物背包表
+			err = 民政局.db.Create("giftbag", &giftbag{})
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return false
+			}
+			// 创建礼物效果表
+			err = 民政局.db.Create("giftbuff", &giftbuff{})
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return false
+			}
 			return true
 		}
 		ctx.SendChain(message.Text("[ERROR]:", err))
@@ -160,6 +184,9 @@ func init() {
 			}
 			// 随机抽娶
 			fiancee := qqgrouplist[rand.Intn(len(qqgrouplist))]
+			if groupInfo, err := 民政局.查看设置(gid); err == nil && groupInfo.Weighted == 1 {
+				fiancee = weightedPick(gid, uid, qqgrouplist)
+			}
 			if fiancee == uid { // 如果是自己
 				switch rand.Intn(10) {
 				case 1:
@@ -195,6 +222,7 @@ func init() {
 					"(", fiancee, ")哒\n当前你们好感度为", favor,
 				),
 			)
+			anniversary(ctx, gid, uid, fiancee)
 		})
 	engine.OnFullMatch("群老婆列表", zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
@@ -308,6 +336,19 @@ func (sql *婚姻登记) 查看设置(gid int64) (dbinfo updateinfo, err error)
 	return
 }
 
+// 升级设置表 旧版本的群配置表没有加权娶群友开关一列
+func (sql *婚姻登记) 升级设置表() error {
+	sql.Lock()
+	defer sql.Unlock()
+	var c struct{ N int }
+	err := sql.db.Query("SELECT COUNT(1) FROM pragma_table_info('updateinfo') WHERE name = 'Weighted';", &c)
+	if err != nil || c.N > 0 {
+		return err
+	}
+	_, err = sql.db.Exec("ALTER TABLE updateinfo ADD COLUMN Weighted INTEGER NOT NULL DEFAULT 0;")
+	return err
+}
+
 func (sql *婚姻登记) 更新设置(dbinfo updateinfo) error {
 	sql.Lock()
 	defer sql.Unlock()
@@ -362,7 +403,11 @@ func (sql *婚姻登记) 登记(gid, uid, target int64, username, targetname str
 		Targetname: targetname,
 		Updatetime: time.Now().Format("15:04:05"),
 	}
-	return sql.db.Insert(gidstr, &uidinfo)
+	err := sql.db.Insert(gidstr, &uidinfo)
+	if err != nil || target == 0 {
+		return err
+	}
+	return sql.记录婚史(gid, &uidinfo)
 }
 
 func (sql *婚姻登记) 花名册(gid int64) (list [][4]string, err error) {
@@ -418,7 +463,7 @@ func (sql *婚姻登记) 清理花名册(gid ...int64) error {
 		grouplist, err := sql.db.ListTables()
 		if err == nil {
 			for _, listName := range grouplist {
-				if listName == "favorability" {
+				if listName == "favorability" || listName == "marriage" || listName == "giftbag" || listName == "giftbuff" {
 					continue
 				}
 				err = sql.db.Drop(listName)
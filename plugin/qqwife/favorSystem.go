@@ -22,6 +22,8 @@ import (
 
 	// 货币系统
 	"github.com/FloatTech/AnimeAPI/wallet"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 )
 
 // 好感度系统
@@ -102,7 +104,7 @@ func init() {
 				newFavor = -newFavor
 			}
 			// 记录结果
-			err = wallet.InsertWalletOf(uid, -moneyToFavor)
+			err = ledger.Spend(uid, moneyToFavor, "qqwife", gay, "买礼物")
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:钱包坏掉力:\n", err))
 				return
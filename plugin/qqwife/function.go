@@ -127,7 +127,8 @@ func init() {
 			if favor < 30 {
 				favor = 30 // 保底30%概率
 			}
-			if rand.Intn(101) >= favor {
+			// 送过钻戒之类的礼物必定成功
+			if !民政局.检查效果(gid, uid, fiancee, buffGuarantee, true) && rand.Intn(101) >= favor {
 				ctx.SendChain(message.Text(sendtext[1][rand.Intn(len(sendtext[1]))]))
 				return
 			}
@@ -165,6 +166,7 @@ func init() {
 					"(", fiancee, ")哒\n当前你们好感度为", favor,
 				),
 			)
+			anniversary(ctx, gid, uid, fiancee)
 		})
 	// NTR技能
 	engine.OnMessage(zero.NewPattern(nil).Text(`^当`).At().Text(`的小三`).AsRule(), zero.OnlyGroup, getdb, checkMistress).SetBlock(true).Limit(ctxext.LimitByUser).
@@ -251,6 +253,7 @@ func init() {
 					"(", fiancee, ")哒\n当前你们好感度为", favor,
 				),
 			)
+			anniversary(ctx, gid, ntrID, targetID)
 		})
 	// 做媒技能
 	engine.OnMessage(zero.NewPattern(nil).Text(`做媒`).At().At().AsRule(), zero.OnlyGroup, zero.AdminPermission, getdb, checkMatchmaker).SetBlock(true).Limit(ctxext.LimitByUser).
@@ -316,6 +319,7 @@ func init() {
 					"(", gayZero, ")哒",
 				),
 			)
+			anniversary(ctx, gid, gayOne, gayZero)
 		})
 	engine.OnFullMatchGroup([]string{"闹离婚", "办离婚"}, zero.OnlyGroup, getdb, checkDivorce).Limit(ctxext.LimitByUser).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
@@ -529,6 +533,10 @@ func checkMistress(ctx *zero.Ctx) bool {
 		ctx.SendChain(message.Text("笨蛋！你们已经在一起了！"))
 		return false
 	}
+	if 民政局.检查效果(gid, fianceeInfo.User, 0, buffAntiNTR, false) || 民政局.检查效果(gid, fianceeInfo.Target, 0, buffAntiNTR, false) {
+		ctx.SendChain(message.Text("ta们今天戴着护身符, 牛头人退散!"))
+		return false
+	}
 	// 获取用户信息
 	userInfo, _ := 民政局.查户口(gid, uid)
 	switch {
@@ -0,0 +1,453 @@
+package qqwife
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/gg/factory"
+	control "github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+// 礼物, 从 data/qqwife/gifts.json 读取
+type gift struct {
+	Name     string     `json:"name"`
+	Price    int        `json:"price"`
+	MinFavor int        `json:"min_favor"` // 好感度变化下限
+	MaxFavor int        `json:"max_favor"` // 好感度变化上限
+	Rarity   string     `json:"rarity"`    // 普通 | 稀有 | 史诗 | 传说
+	Effect   giftEffect `json:"effect"`
+	Desc     string     `json:"desc"`
+}
+
+// 礼物附带的效果
+type giftEffect struct {
+	CDHours   float64 `json:"cd_hours"`  // 减少赠送者在本群的技能CD(小时)
+	AntiNTR   bool    `json:"anti_ntr"`  // 今天对方不会被牛头人
+	Guarantee bool    `json:"guarantee"` // 下次向对方(娶|嫁)必定成功
+}
+
+// 礼物背包
+type giftbag struct {
+	Key    string // 用户_礼物名
+	UID    int64
+	Name   string
+	Number int
+}
+
+// 礼物效果记录
+type giftbuff struct {
+	Key     string // 群号_用户_对象_类型
+	GroupID int64
+	UserID  int64
+	Target  int64
+	Type    string
+	Until   int64 // 失效时间
+}
+
+const (
+	buffAntiNTR   = "防牛头人"
+	buffGuarantee = "必定成功"
+	// maxGiftNumber 单次最多购买的礼物数量
+	maxGiftNumber = 100
+)
+
+var defaultGifts = []gift{
+	{Name: "棒棒糖", Price: 20, MinFavor: 1, MaxFavor: 3, Rarity: "普通", Desc: "甜甜的"},
+	{Name: "玫瑰花", Price: 66, MinFavor: 2, MaxFavor: 6, Rarity: "普通", Desc: "爱情的象征"},
+	{Name: "女装", Price: 100, MinFavor: -5, MaxFavor: 10, Rarity: "稀有", Desc: "喜不喜欢看对方心情"},
+	{Name: "巧克力", Price: 120, MinFavor: 3, MaxFavor: 8, Rarity: "稀有", Desc: "心形的"},
+	{Name: "闹钟", Price: 300, MinFavor: 0, MaxFavor: 2, Rarity: "稀有", Effect: giftEffect{CDHours: 6}, Desc: "减少自己6小时技能CD"},
+	{Name: "护身符", Price: 500, MinFavor: 1, MaxFavor: 3, Rarity: "史诗", Effect: giftEffect{AntiNTR: true}, Desc: "今天对方不会被牛头人"},
+	{Name: "钻戒", Price: 1314, MinFavor: 5, MaxFavor: 15, Rarity: "传说", Effect: giftEffect{Guarantee: true}, Desc: "下次向对方(娶|嫁)必定成功"},
+}
+
+var rarityColor = map[string]color.RGBA{
+	"普通": {R: 0, G: 0, B: 0, A: 255},
+	"稀有": {R: 30, G: 90, B: 200, A: 255},
+	"史诗": {R: 140, G: 50, B: 190, A: 255},
+	"传说": {R: 220, G: 130, B: 0, A: 255},
+}
+
+func init() {
+	engine.OnFullMatch("礼物商店", getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			gifts, err := loadGifts()
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			picImage, err := drawGiftStoreImage(gifts)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			pic, err := factory.ToBytes(picImage)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.ImageBytes(pic))
+		})
+	engine.OnRegex(`^购买礼物\s*(\S+?)\s*(\d*)$`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			uid := ctx.Event.UserID
+			name := ctx.State["regex_matched"].([]string)[1]
+			number := 1
+			if s := ctx.State["regex_matched"].([]string)[2]; s != "" {
+				n, err := strconv.Atoi(s)
+				if err != nil || n < 1 || n > maxGiftNumber {
+					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("单次只能购买1~", maxGiftNumber, "个礼物"))
+					return
+				}
+				number = n
+			}
+			g, err := findGift(name)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			if g.Price <= 0 || g.Price > math.MaxInt/number {
+				ctx.SendChain(message.Text("[ERROR]:礼物", g.Name, "的价格无效"))
+				return
+			}
+			cost := g.Price * number
+			err = ledger.Spend(uid, cost, "qqwife", 0, "购买礼物"+g.Name)
+			if errors.Is(err, ledger.ErrNotEnough) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你的", wallet.GetWalletName(), "不足", cost))
+				return
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:钱包坏掉力:\n", err))
+				return
+			}
+			total, err := 民政局.更新礼物(uid, g.Name, number)
+			if err != nil {
+				_ = ledger.Earn(uid, cost, "qqwife", 0, "购买礼物失败退款")
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你花了", cost, wallet.GetWalletName(), "买了", number, "个", g.Name, ", 现在有", total, "个"))
+		})
+	engine.OnFullMatchGroup([]string{"我的礼物", "礼物背包"}, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			bag, err := 民政局.查礼物(ctx.Event.UserID)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			if len(bag) == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你还没有礼物, 发送\"礼物商店\"看看吧"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("你的礼物:")
+			for _, b := range bag {
+				sb.WriteString("\n")
+				sb.WriteString(b.Name)
+				sb.WriteString(" x")
+				sb.WriteString(strconv.Itoa(b.Number))
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(sb.String()))
+		})
+	engine.OnMessage(zero.NewPattern(nil).Text(`^赠送\s*(\S+)$`).At().AsRule(), zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			gid := ctx.Event.GroupID
+			uid := ctx.Event.UserID
+			patternParsed := ctx.State[zero.KeyPattern].([]zero.PatternParsed)
+			name := patternParsed[0].Text()[1]
+			target, _ := strconv.ParseInt(patternParsed[1].At(), 10, 64)
+			if target == uid {
+				ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.At(uid), message.Text("你想送给自己什么礼物呢?")))
+				return
+			}
+			g, err := findGift(name)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			_, err = 民政局.更新礼物(uid, g.Name, -1)
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你没有", g.Name, ", 先去\"购买礼物", g.Name, "\"吧"))
+				return
+			}
+			change := g.MinFavor
+			if g.MaxFavor > g.MinFavor {
+				change += rand.Intn(g.MaxFavor - g.MinFavor + 1)
+			}
+			favor, err := 民政局.更新好感度(uid, target, change)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:好感度数据库发生问题力\n", err))
+				return
+			}
+			msg := "你把" + g.Name + "送给了" + ctx.CardOrNickName(target)
+			switch {
+			case change > 0:
+				msg += ", ta很喜欢, 你们的好感度升至" + strconv.Itoa(favor)
+			case change < 0:
+				msg += ", ta很不喜欢, 你们的好感度降低至" + strconv.Itoa(favor)
+			default:
+				msg += ", ta没什么反应, 你们的好感度为" + strconv.Itoa(favor)
+			}
+			if g.Effect.CDHours > 0 {
+				err = 民政局.减少CD(gid, uid, g.Effect.CDHours)
+				if err == nil {
+					msg += "\n你的技能CD减少了" + strconv.FormatFloat(g.Effect.CDHours, 'f', -1, 64) + "小时"
+				}
+			}
+			if g.Effect.AntiNTR {
+				now := time.Now()
+				tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+				err = 民政局.添加效果(gid, target, 0, buffAntiNTR, tomorrow)
+				if err == nil {
+					msg += "\n今天ta不会被牛头人了"
+				}
+			}
+			if g.Effect.Guarantee {
+				err = 民政局.添加效果(gid, uid, target, buffGuarantee, time.Now().AddDate(0, 0, 7))
+				if err == nil {
+					msg += "\n7天内你下次向ta(娶|嫁)必定成功"
+				}
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(msg))
+		})
+}
+
+// loadGifts 每次从文件读取礼物目录, 修改后无需重启, 文件不存在时写入默认目录
+func loadGifts() ([]gift, error) {
+	path := engine.DataFolder() + "gifts.json"
+	if file.IsNotExist(path) {
+		data, err := json.MarshalIndent(defaultGifts, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		return defaultGifts, os.WriteFile(path, data, 0644)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var gifts []gift
+	err = json.Unmarshal(data, &gifts)
+	if err != nil {
+		return nil, errors.New("礼物目录格式错误: " + err.Error())
+	}
+	for _, g := range gifts {
+		if g.Name == "" || g.Price <= 0 || g.MaxFavor < g.MinFavor {
+			return nil, errors.New("礼物目录中的[" + g.Name + "]配置有误")
+		}
+	}
+	return gifts, nil
+}
+
+func findGift(name string) (g gift, err error) {
+	gifts, err := loadGifts()
+	if err != nil {
+		return
+	}
+	for _, g = range gifts {
+		if g.Name == name {
+			return g, nil
+		}
+	}
+	return g, errors.New("没有叫[" + name + "]的礼物")
+}
+
+// 更新礼物数量, 数量不足时返回错误
+func (sql *婚姻登记) 更新礼物(uid int64, name string, number int) (total int, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	info := giftbag{Key: strconv.FormatInt(uid, 10) + "_" + name, UID: uid, Name: name}
+	_ = sql.db.Find("giftbag", &info, "WHERE Key = ?", info.Key)
+	info.Number += number
+	switch {
+	case info.Number < 0:
+		return 0, errors.New("礼物数量不足")
+	case info.Number == 0:
+		return 0, sql.db.Del("giftbag", "WHERE Key = ?", info.Key)
+	}
+	return info.Number, sql.db.Insert("giftbag", &info)
+}
+
+func (sql *婚姻登记) 查礼物(uid int64) (bag []giftbag, err error) {
+	sql.RLock()
+	defer sql.RUnlock()
+	var info giftbag
+	_ = sql.db.FindFor("giftbag", &info, "WHERE UID = ? ORDER BY Name", func() error {
+		bag = append(bag, info)
+		return nil
+	}, uid)
+	return
+}
+
+// 减少CD Time 是 cdsheet 的主键, 不能原地修改, 逐条删除后以新的时间重新写入
+func (sql *婚姻登记) 减少CD(gid, uid int64, hours float64) error {
+	sql.Lock()
+	defer sql.Unlock()
+	var (
+		info  cdsheet
+		sheet []cdsheet
+	)
+	_ = sql.db.FindFor("cdsheet", &info, "WHERE GroupID = ? AND UserID = ?", func() error {
+		sheet = append(sheet, info)
+		return nil
+	}, gid, uid)
+	for _, cd := range sheet {
+		err := sql.db.Del("cdsheet", "WHERE GroupID = ? AND UserID = ? AND ModeID = ?", cd.GroupID, cd.UserID, cd.ModeID)
+		if err != nil {
+			return err
+		}
+		cd.Time -= int64(hours * 3600)
+		// 避免与其他记录的时间相同而覆盖对方
+		for sql.db.CanFind("cdsheet", "WHERE Time = ?", cd.Time) {
+			cd.Time--
+		}
+		if err = sql.db.Insert("cdsheet", &cd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sql *婚姻登记) 添加效果(gid, uid, target int64, buffType string, until time.Time) error {
+	sql.Lock()
+	defer sql.Unlock()
+	return sql.db.Insert("giftbuff", &giftbuff{
+		Key:     strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10) + "_" + strconv.FormatInt(target, 10) + "_" + buffType,
+		GroupID: gid,
+		UserID:  uid,
+		Target:  target,
+		Type:    buffType,
+		Until:   until.Unix(),
+	})
+}
+
+// 查询效果是否生效, consume 为真时使用后移除
+func (sql *婚姻登记) 检查效果(gid, uid, target int64, buffType string, consume bool) bool {
+	sql.Lock()
+	defer sql.Unlock()
+	key := strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10) + "_" + strconv.FormatInt(target, 10) + "_" + buffType
+	var buff giftbuff
+	err := sql.db.Find("giftbuff", &buff, "WHERE Key = ?", key)
+	if err != nil {
+		return false
+	}
+	if buff.Until < time.Now().Unix() {
+		_ = sql.db.Del("giftbuff", "WHERE Key = ?", key)
+		return false
+	}
+	if consume {
+		_ = sql.db.Del("giftbuff", "WHERE Key = ?", key)
+	}
+	return true
+}
+
+func drawGiftStoreImage(gifts []gift) (picImage image.Image, err error) {
+	fontdata, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	canvas := gg.NewContext(1, 1)
+	err = canvas.ParseFontFace(fontdata, 100)
+	if err != nil {
+		return nil, err
+	}
+	titleW, titleH := canvas.MeasureString("礼物商店")
+
+	err = canvas.ParseFontFace(fontdata, 50)
+	if err != nil {
+		return nil, err
+	}
+	_, textH := canvas.MeasureString("高度")
+	nameW, _ := canvas.MeasureString("名称名称名称")
+	rarityW, _ := canvas.MeasureString("稀有度")
+	priceW, _ := canvas.MeasureString("100000")
+	favorW, _ := canvas.MeasureString("-10~+10")
+
+	err = canvas.ParseFontFace(fontdata, 35)
+	if err != nil {
+		return nil, err
+	}
+	descW := 0.0
+	for _, g := range gifts {
+		w, _ := canvas.MeasureString(g.Desc)
+		descW = max(descW, w)
+	}
+	descW = max(descW, 200)
+
+	bolckW := int(10 + nameW + 50 + rarityW + 50 + priceW + 50 + favorW + 50 + descW + 10)
+	backY := 10 + int(titleH*2+10) + 10 + (len(gifts)+2)*int(textH*2) + 10
+	canvas = gg.NewContext(bolckW, backY)
+	// 画底色
+	canvas.DrawRectangle(0, 0, float64(bolckW), float64(backY))
+	canvas.SetRGBA255(150, 150, 150, 255)
+	canvas.Fill()
+
+	// 放字
+	canvas.SetColor(color.Black)
+	err = canvas.ParseFontFace(fontdata, 100)
+	if err != nil {
+		return nil, err
+	}
+	canvas.DrawString("礼物商店", 10, 10+titleH*1.2)
+	canvas.DrawLine(10, titleH*1.6, titleW, titleH*1.6)
+	canvas.SetLineWidth(3)
+	canvas.SetRGBA255(0, 0, 0, 255)
+	canvas.Stroke()
+
+	textDy := 10 + titleH*1.7
+	if err = canvas.ParseFontFace(fontdata, 50); err != nil {
+		return nil, err
+	}
+	x := 10.0
+	columns := []struct {
+		name string
+		w    float64
+	}{{"名称", nameW}, {"稀有度", rarityW}, {"价格", priceW}, {"好感度", favorW}, {"效果", descW}}
+	for _, c := range columns {
+		canvas.DrawStringAnchored(c.name, x+c.w/2, textDy+textH/2, 0.5, 0.5)
+		x += c.w + 50
+	}
+	for _, g := range gifts {
+		textDy += textH * 2
+		canvas.SetColor(rarityColor[g.Rarity])
+		if err = canvas.ParseFontFace(fontdata, 50); err != nil {
+			return nil, err
+		}
+		values := []string{
+			g.Name,
+			g.Rarity,
+			strconv.Itoa(g.Price),
+			strconv.Itoa(g.MinFavor) + "~" + strconv.Itoa(g.MaxFavor),
+		}
+		x = 10
+		for i, v := range values {
+			canvas.DrawStringAnchored(v, x+columns[i].w/2, textDy+textH/2, 0.5, 0.5)
+			x += columns[i].w + 50
+		}
+		if err = canvas.ParseFontFace(fontdata, 35); err != nil {
+			return nil, err
+		}
+		canvas.DrawStringAnchored(g.Desc, x, textDy+textH/2, 0, 0.5)
+	}
+	textDy += textH * 2
+	canvas.SetColor(color.Black)
+	canvas.DrawStringAnchored("注:发送\"购买礼物 名称 数量\"购买, \"赠送 名称@对方\"送出", 10, textDy+textH/2, 0, 0.5)
+	return canvas.Image(), nil
+}
@@ -0,0 +1,354 @@
+package qqwife
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/floatbox/web"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/gg/factory"
+	control "github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/kanban/banner"
+)
+
+// 关系图中的一条边
+type graphEdge struct {
+	a, b  int // 节点下标
+	favor int
+}
+
+type point struct {
+	x, y float64
+}
+
+const (
+	graphSize    = 1200.0 // 画布边长
+	graphAvatar  = 80.0   // 头像直径
+	graphDefault = 20     // 默认显示的关系数
+	graphMax     = 60     // 最多显示的关系数
+)
+
+func init() {
+	engine.OnRegex(`^群关系图\s*(\d*)\s*(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\])?$`, zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			n, _ := strconv.Atoi(matched[1])
+			if n <= 0 {
+				n = graphDefault
+			}
+			if n > graphMax {
+				n = graphMax
+			}
+			var center int64
+			if matched[3] != "" {
+				center, _ = strconv.ParseInt(matched[3], 10, 64)
+			}
+			members := make(map[int64]struct{})
+			for _, v := range ctx.GetThisGroupMemberListNoCache().Array() {
+				members[v.Get("user_id").Int()] = struct{}{}
+			}
+			list, err := 民政局.群好感度(members, center)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			if len(list) == 0 {
+				if center != 0 {
+					ctx.SendChain(message.Text(ctx.CardOrNickName(center), "在本群还没有好感度记录哦"))
+					return
+				}
+				ctx.SendChain(message.Text("本群还没有好感度记录哦"))
+				return
+			}
+			if len(list) > n {
+				list = list[:n]
+			}
+			// 整理节点与边
+			var (
+				nodes []int64
+				index = make(map[int64]int)
+				edges = make([]graphEdge, 0, len(list))
+			)
+			node := func(uid int64) int {
+				if i, ok := index[uid]; ok {
+					return i
+				}
+				index[uid] = len(nodes)
+				nodes = append(nodes, uid)
+				return len(nodes) - 1
+			}
+			if center != 0 {
+				node(center)
+			}
+			for _, info := range list {
+				a, b, _ := splitUserinfo(info.Userinfo)
+				edges = append(edges, graphEdge{a: node(a), b: node(b), favor: info.Favor})
+			}
+			pinned := -1
+			if center != 0 {
+				pinned = 0
+			}
+			names := make([]string, len(nodes))
+			for i, uid := range nodes {
+				names[i] = ctx.CardOrNickName(uid)
+			}
+			img, err := drawRelationGraph(nodes, names, edges, forceLayout(len(nodes), edges, pinned))
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			data, err := factory.ToBytes(img)
+			if err != nil {
+				ctx.SendChain(message.Text("[qqwife]ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.ImageBytes(data))
+		})
+}
+
+// 拆分好感度记录中的两个用户
+func splitUserinfo(userinfo string) (a, b int64, ok bool) {
+	userList := strings.Split(userinfo, "+")
+	if len(userList) != 2 {
+		return
+	}
+	a, err := strconv.ParseInt(userList[0], 10, 64)
+	if err != nil {
+		return
+	}
+	b, err = strconv.ParseInt(userList[1], 10, 64)
+	if err != nil {
+		return
+	}
+	return a, b, a != b && a != 0 && b != 0
+}
+
+// 群好感度 获取双方都在群内的好感度记录, 按好感度从高到低
+//
+// center 不为 0 时只保留与 center 相关的记录以及 center 的好友之间的记录
+func (sql *婚姻登记) 群好感度(members map[int64]struct{}, center int64) (list favorList, err error) {
+	sql.RLock()
+	defer sql.RUnlock()
+	var all favorList
+	info := favorability{}
+	err = sql.db.FindFor("favorability", &info, "WHERE Favor > 0", func() error {
+		a, b, ok := splitUserinfo(info.Userinfo)
+		if !ok {
+			return nil
+		}
+		if _, ok := members[a]; !ok {
+			return nil
+		}
+		if _, ok := members[b]; !ok {
+			return nil
+		}
+		all = append(all, info)
+		return nil
+	})
+	if len(all) == 0 {
+		// 没有记录
+		return nil, nil
+	}
+	if center == 0 {
+		sort.Sort(all)
+		return all, nil
+	}
+	friends := make(map[int64]struct{})
+	for _, info := range all {
+		a, b, _ := splitUserinfo(info.Userinfo)
+		switch center {
+		case a:
+			friends[b] = struct{}{}
+		case b:
+			friends[a] = struct{}{}
+		}
+	}
+	for _, info := range all {
+		a, b, _ := splitUserinfo(info.Userinfo)
+		_, oka := friends[a]
+		_, okb := friends[b]
+		if a == center || b == center || (oka && okb) {
+			list = append(list, info)
+		}
+	}
+	// 先放与中心相关的, 再按好感度排序
+	sort.SliceStable(list, func(i, j int) bool {
+		ai, bi, _ := splitUserinfo(list[i].Userinfo)
+		aj, bj, _ := splitUserinfo(list[j].Userinfo)
+		ci := ai == center || bi == center
+		cj := aj == center || bj == center
+		if ci != cj {
+			return ci
+		}
+		return list[i].Favor > list[j].Favor
+	})
+	return list, nil
+}
+
+// forceLayout Fruchterman-Reingold 力导向布局, 返回 [0,1] 内的坐标
+//
+// pinned >= 0 时该节点固定在中心
+func forceLayout(n int, edges []graphEdge, pinned int) []point {
+	pos := make([]point, n)
+	if n == 0 {
+		return pos
+	}
+	// 固定种子, 同样的数据得到同样的图
+	r := rand.New(rand.NewSource(int64(n)*31 + int64(len(edges))))
+	for i := range pos {
+		pos[i] = point{r.Float64(), r.Float64()}
+	}
+	if pinned >= 0 {
+		pos[pinned] = point{0.5, 0.5}
+	}
+	k := math.Sqrt(1.0 / float64(n)) // 理想距离
+	temp := 0.1
+	disp := make([]point, n)
+	for iter := 0; iter < 300; iter++ {
+		for i := range disp {
+			disp[i] = point{}
+		}
+		// 斥力
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				dx, dy := pos[i].x-pos[j].x, pos[i].y-pos[j].y
+				d := math.Max(math.Hypot(dx, dy), 0.01)
+				f := k * k / d
+				disp[i].x += dx / d * f
+				disp[i].y += dy / d * f
+				disp[j].x -= dx / d * f
+				disp[j].y -= dy / d * f
+			}
+		}
+		// 引力, 好感度越高越近
+		for _, e := range edges {
+			dx, dy := pos[e.a].x-pos[e.b].x, pos[e.a].y-pos[e.b].y
+			d := math.Max(math.Hypot(dx, dy), 0.01)
+			f := d * d / k * (0.5 + float64(e.favor)/100)
+			disp[e.a].x -= dx / d * f
+			disp[e.a].y -= dy / d * f
+			disp[e.b].x += dx / d * f
+			disp[e.b].y += dy / d * f
+		}
+		for i := range pos {
+			if i == pinned {
+				continue
+			}
+			// 向中心的微弱引力, 防止不相连的部分飘走
+			disp[i].x += (0.5 - pos[i].x) * k
+			disp[i].y += (0.5 - pos[i].y) * k
+			d := math.Hypot(disp[i].x, disp[i].y)
+			if d > 0 {
+				step := math.Min(d, temp)
+				pos[i].x += disp[i].x / d * step
+				pos[i].y += disp[i].y / d * step
+			}
+		}
+		temp *= 0.98
+	}
+	// 缩放到 [0,1]
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range pos {
+		minX, maxX = math.Min(minX, p.x), math.Max(maxX, p.x)
+		minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+	}
+	if pinned >= 0 {
+		// 保持中心节点在中间
+		half := math.Max(math.Max(0.5-minX, maxX-0.5), math.Max(0.5-minY, maxY-0.5))
+		minX, minY, maxX, maxY = 0.5-half, 0.5-half, 0.5+half, 0.5+half
+	}
+	w, h := math.Max(maxX-minX, 1e-6), math.Max(maxY-minY, 1e-6)
+	for i := range pos {
+		pos[i] = point{(pos[i].x - minX) / w, (pos[i].y - minY) / h}
+		if n == 1 {
+			pos[i] = point{0.5, 0.5}
+		}
+	}
+	return pos
+}
+
+func drawRelationGraph(nodes []int64, names []string, edges []graphEdge, pos []point) (image.Image, error) {
+	const (
+		top    = 150.0
+		margin = graphAvatar
+		bottom = 60.0
+	)
+	canvas := gg.NewContext(int(graphSize), int(graphSize+top+bottom))
+	canvas.SetRGB255(250, 245, 248)
+	canvas.Clear()
+	bold, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	if err = canvas.ParseFontFace(bold, 80); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB255(40, 40, 40)
+	canvas.DrawStringAnchored("群关系图", graphSize/2, top/2, 0.5, 0.5)
+	at := func(p point) (float64, float64) {
+		return margin + p.x*(graphSize-margin*2), top + margin/2 + p.y*(graphSize-margin*2)
+	}
+	// 连线, 好感度越高越粗越红
+	if err = canvas.ParseFontFace(data, 22); err != nil {
+		return nil, err
+	}
+	for _, e := range edges {
+		x1, y1 := at(pos[e.a])
+		x2, y2 := at(pos[e.b])
+		canvas.SetLineWidth(1 + float64(e.favor)/12)
+		canvas.SetRGBA255(231, 27, 100, 60+e.favor*195/100)
+		canvas.DrawLine(x1, y1, x2, y2)
+		canvas.Stroke()
+	}
+	for _, e := range edges {
+		x1, y1 := at(pos[e.a])
+		x2, y2 := at(pos[e.b])
+		s := strconv.Itoa(e.favor)
+		w, h := canvas.MeasureString(s)
+		canvas.DrawRoundedRectangle((x1+x2)/2-w/2-6, (y1+y2)/2-h/2-4, w+12, h+8, 6)
+		canvas.SetRGBA255(255, 255, 255, 220)
+		canvas.Fill()
+		canvas.SetRGB255(231, 27, 100)
+		canvas.DrawStringAnchored(s, (x1+x2)/2, (y1+y2)/2, 0.5, 0.5)
+	}
+	// 头像与昵称
+	for i, uid := range nodes {
+		x, y := at(pos[i])
+		canvas.DrawCircle(x, y, graphAvatar/2+3)
+		canvas.SetRGB255(255, 255, 255)
+		canvas.Fill()
+		if b, err := web.GetData("https://q4.qlogo.cn/g?b=qq&nk=" + strconv.FormatInt(uid, 10) + "&s=100"); err == nil {
+			if avatar, _, err := image.Decode(bytes.NewReader(b)); err == nil {
+				canvas.DrawImageAnchored(factory.Size(avatar, graphAvatar, graphAvatar).Circle(0).Image(), int(x), int(y), 0.5, 0.5)
+			}
+		}
+		name := slicename(names[i], canvas)
+		w, h := canvas.MeasureString(name)
+		canvas.DrawRoundedRectangle(x-w/2-6, y+graphAvatar/2+6, w+12, h+8, 6)
+		canvas.SetRGBA255(255, 255, 255, 200)
+		canvas.Fill()
+		canvas.SetRGB255(40, 40, 40)
+		canvas.DrawStringAnchored(name, x, y+graphAvatar/2+10+h/2, 0.5, 0.5)
+	}
+	if err = canvas.ParseFontFace(data, 20); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB255(150, 150, 150)
+	canvas.DrawStringAnchored("Created By Zerobot-Plugin "+banner.Version, graphSize/2, graphSize+top+bottom/2, 0.5, 0.5)
+	return canvas.Image(), nil
+}
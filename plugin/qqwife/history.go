@@ -0,0 +1,319 @@
+package qqwife
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/gg/factory"
+	control "github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// 婚史, 不随花名册重置
+type marriage struct {
+	ID         int64  // 编号
+	GroupID    int64  // 群号
+	User       int64  // 攻
+	Target     int64  // 受
+	Username   string // 攻方名称
+	Targetname string // 受方名称
+	Time       int64  // 登记时间
+}
+
+// CP 次数统计
+type cpcount struct {
+	User   int64
+	Target int64
+	Count  int64
+}
+
+type number struct {
+	N int64
+}
+
+// 与某人结为CP的次数
+type cptimes struct {
+	Target int64
+	Count  int64
+}
+
+// 第几次结为CP时发送纪念日消息, 之后每100次一次
+var anniversaries = [...]int64{3, 5, 10, 20, 50, 100}
+
+func init() {
+	engine.OnRegex(`^(开启|关闭)加权娶群友$`, zero.OnlyGroup, zero.AdminPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			groupInfo, err := 民政局.查看设置(ctx.Event.GroupID)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			if ctx.State["regex_matched"].([]string)[1] == "开启" {
+				groupInfo.Weighted = 1
+			} else {
+				groupInfo.Weighted = 0
+			}
+			err = 民政局.更新设置(groupInfo)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.Text("设置成功"))
+		})
+	engine.OnRegex(`^我的婚史\s*(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\])?$`, zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			gid := ctx.Event.GroupID
+			uid := ctx.Event.UserID
+			if s := ctx.State["regex_matched"].([]string)[2]; s != "" {
+				uid, _ = strconv.ParseInt(s, 10, 64)
+			}
+			records, err := 民政局.查婚史(gid, uid)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			if len(records) == 0 {
+				ctx.SendChain(message.Text(ctx.CardOrNickName(uid), "在本群还没有结过婚哦"))
+				return
+			}
+			asUser := 0
+			partners := make(map[int64]int, len(records))
+			var best int64
+			for _, r := range records {
+				partner := r.User
+				if r.User == uid {
+					asUser++
+					partner = r.Target
+				}
+				partners[partner]++
+				if partners[partner] > partners[best] {
+					best = partner
+				}
+			}
+			var sb strings.Builder
+			sb.WriteString(ctx.CardOrNickName(uid))
+			sb.WriteString("的婚史\n共结婚")
+			sb.WriteString(strconv.Itoa(len(records)))
+			sb.WriteString("次, 娶")
+			sb.WriteString(strconv.Itoa(asUser))
+			sb.WriteString("次, 嫁")
+			sb.WriteString(strconv.Itoa(len(records) - asUser))
+			sb.WriteString("次\n最常在一起的是[")
+			sb.WriteString(ctx.CardOrNickName(best))
+			sb.WriteString("], 共")
+			sb.WriteString(strconv.Itoa(partners[best]))
+			sb.WriteString("次\n最近的记录:")
+			for i, r := range records {
+				if i >= 10 {
+					break
+				}
+				sb.WriteString("\n")
+				sb.WriteString(time.Unix(r.Time, 0).Format("2006/01/02"))
+				if r.User == uid {
+					sb.WriteString(" 娶了 ")
+					sb.WriteString(r.Targetname)
+				} else {
+					sb.WriteString(" 嫁给 ")
+					sb.WriteString(r.Username)
+				}
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+	engine.OnFullMatch("CP排行", zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			list, err := 民政局.CP排行(ctx.Event.GroupID, 10)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			if len(list) == 0 {
+				ctx.SendChain(message.Text("本群还没有人结过婚哦"))
+				return
+			}
+			/***********设置图片的大小和底色***********/
+			fontSize := 50.0
+			canvas := gg.NewContext(1500, int(250+fontSize*float64(len(list))))
+			canvas.SetRGB(1, 1, 1) // 白色
+			canvas.Clear()
+			data, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+			if err != nil {
+				ctx.SendChain(message.Text("[qqwife]ERROR: ", err))
+				return
+			}
+			canvas.SetRGB(0, 0, 0)
+			if err = canvas.ParseFontFace(data, fontSize*2); err != nil {
+				ctx.SendChain(message.Text("[qqwife]ERROR: ", err))
+				return
+			}
+			sl, h := canvas.MeasureString("CP排行")
+			canvas.DrawString("CP排行", (1500-sl)/2, 160-h)
+			canvas.DrawString("————————————————————", 0, 250-h)
+			if err = canvas.ParseFontFace(data, fontSize); err != nil {
+				ctx.SendChain(message.Text("[qqwife]ERROR: ", err))
+				return
+			}
+			_, h = canvas.MeasureString("焯")
+			for i, cp := range list {
+				canvas.DrawString(strconv.Itoa(i+1)+".", 0, float64(260+50*i)-h)
+				canvas.DrawString(slicename(ctx.CardOrNickName(cp.User), canvas), 100, float64(260+50*i)-h)
+				canvas.DrawString("←→", 500, float64(260+50*i)-h)
+				canvas.DrawString(slicename(ctx.CardOrNickName(cp.Target), canvas), 600, float64(260+50*i)-h)
+				canvas.DrawString(strconv.FormatInt(cp.Count, 10)+"次", 1200, float64(260+50*i)-h)
+			}
+			data, err = factory.ToBytes(canvas.Image())
+			if err != nil {
+				ctx.SendChain(message.Text("[qqwife]ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.ImageBytes(data))
+		})
+}
+
+// 按好感度与婚史加权抽取对象, 自己的权重固定为基础值
+func weightedPick(gid, uid int64, candidates []int64) int64 {
+	favors, times, err := 民政局.加权数据(gid, uid)
+	if err != nil {
+		return candidates[rand.Intn(len(candidates))]
+	}
+	weights := make([]int, len(candidates))
+	total := 0
+	for i, c := range candidates {
+		w := 10
+		if c != uid {
+			w += favors[c] + 5*int(min(times[c], 10))
+		}
+		// 好感度可能为负, 保证每个人都有被抽到的可能
+		weights[i] = max(w, 1)
+		total += weights[i]
+	}
+	n := rand.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return candidates[i]
+		}
+		n -= w
+	}
+	return candidates[len(candidates)-1]
+}
+
+// 第N次结为CP时发送纪念日消息
+func anniversary(ctx *zero.Ctx, gid, uid, target int64) {
+	times, err := 民政局.结婚次数(gid, uid, target)
+	if err != nil {
+		return
+	}
+	isAnniversary := times%100 == 0
+	for _, n := range anniversaries {
+		if times == n {
+			isAnniversary = true
+			break
+		}
+	}
+	if !isAnniversary {
+		return
+	}
+	ctx.SendChain(
+		message.At(uid), message.Text(" 和 "), message.At(target),
+		message.Text("\n今天是你们第", times, "次结为CP的纪念日🎉\n百年好合, 早生贵子~"),
+	)
+}
+
+func (sql *婚姻登记) 查婚史(gid, uid int64) (records []marriage, err error) {
+	sql.RLock()
+	defer sql.RUnlock()
+	var r marriage
+	err = sql.db.FindFor("marriage", &r, "WHERE GroupID = ? AND (User = ? OR Target = ?) ORDER BY ID DESC", func() error {
+		records = append(records, r)
+		return nil
+	}, gid, uid, uid)
+	if len(records) == 0 {
+		// 没有记录
+		err = nil
+	}
+	return
+}
+
+func (sql *婚姻登记) 结婚次数(gid, uid, target int64) (int64, error) {
+	sql.RLock()
+	defer sql.RUnlock()
+	var n number
+	err := sql.db.Query("SELECT COUNT(1) FROM marriage WHERE GroupID = ? AND ((User = ? AND Target = ?) OR (User = ? AND Target = ?));",
+		&n, gid, uid, target, target, uid)
+	return n.N, err
+}
+
+// 加权数据 一次性获取 uid 与所有人的好感度, 以及在本群与所有人结为CP的次数
+func (sql *婚姻登记) 加权数据(gid, uid int64) (favors map[int64]int, times map[int64]int64, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	err = sql.db.Create("favorability", &favorability{})
+	if err != nil {
+		return
+	}
+	favors = make(map[int64]int)
+	uidStr := strconv.FormatInt(uid, 10)
+	var info favorability
+	// 没有记录时视为 0
+	_ = sql.db.FindFor("favorability", &info, "WHERE Userinfo glob ?", func() error {
+		a, b, ok := strings.Cut(info.Userinfo, "+")
+		if !ok {
+			return nil
+		}
+		var target string
+		switch uidStr {
+		case a:
+			target = b
+		case b:
+			target = a
+		default:
+			return nil
+		}
+		if t, err := strconv.ParseInt(target, 10, 64); err == nil {
+			favors[t] = info.Favor
+		}
+		return nil
+	}, "*"+uidStr+"*")
+	times = make(map[int64]int64)
+	var cp cptimes
+	_ = sql.db.QueryFor("SELECT CASE WHEN User = ? THEN Target ELSE User END AS t, COUNT(1) FROM marriage WHERE GroupID = ? AND (User = ? OR Target = ?) GROUP BY t;", &cp, func() error {
+		times[cp.Target] = cp.Count
+		return nil
+	}, uid, gid, uid, uid)
+	return
+}
+
+func (sql *婚姻登记) CP排行(gid int64, n int) (list []cpcount, err error) {
+	sql.RLock()
+	defer sql.RUnlock()
+	if !sql.db.CanFind("marriage", "WHERE GroupID = ?", gid) {
+		return
+	}
+	var cp cpcount
+	err = sql.db.QueryFor("SELECT MIN(User, Target) AS a, MAX(User, Target) AS b, COUNT(1) AS n FROM marriage WHERE GroupID = ? GROUP BY a, b ORDER BY n DESC LIMIT ?;", &cp, func() error {
+		list = append(list, cp)
+		return nil
+	}, gid, n)
+	return
+}
+
+// 记录婚史 no lock
+func (sql *婚姻登记) 记录婚史(gid int64, info *userinfo) error {
+	var n number
+	_ = sql.db.Query("SELECT IFNULL(MAX(ID), 0) FROM marriage;", &n)
+	return sql.db.Insert("marriage", &marriage{
+		ID:         n.N + 1,
+		GroupID:    gid,
+		User:       info.User,
+		Target:     info.Target,
+		Username:   info.Username,
+		Targetname: info.Targetname,
+		Time:       time.Now().Unix(),
+	})
+}
@@ -0,0 +1,275 @@
+package robbery
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/zbputils/ctxext"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/extension/rate"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+// bounty 悬赏
+type bounty struct {
+	ID       int64 `db:"id"`
+	GroupID  int64 `db:"group_id"`
+	PosterID int64 `db:"poster_id"` // 发布悬赏的受害者
+	TargetID int64 `db:"target_id"` // 被悬赏的劫匪
+	Reward   int   `db:"reward"`    // 赏金
+	Time     int64 `db:"time"`
+}
+
+// caseValidity 受害者可以悬赏多久之前的劫匪
+const caseValidity = time.Hour * 24 * 7
+
+var catchLimiter = rate.NewManager[int64](time.Minute*10, 1)
+
+func init() {
+	engine.OnRegex(`^保释\s?(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\]|(\d+))`, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			uid := ctx.Event.UserID
+			matched := ctx.State["regex_matched"].([]string)
+			prisonerID, _ := strconv.ParseInt(matched[2]+matched[3], 10, 64)
+			p, ok := jail.Get(prisonerID)
+			if !ok {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("对方没有在坐牢"))
+				return
+			}
+			err := ledger.Spend(uid, p.Bail, "robbery", prisonerID, "保释")
+			if errors.Is(err, ledger.ErrNotEnough) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你的钱不够支付保释金", p.Bail, wallet.GetWalletName()))
+				return
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			err = jail.Release(prisonerID)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.At(prisonerID), message.Text("你的朋友", ctx.CardOrNickName(uid), "支付了", p.Bail, wallet.GetWalletName(), "将你保释出狱"))
+		})
+
+	engine.OnFullMatch("查看监狱", zero.OnlyGroup).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			prisoners := jail.GetGroupPrisoners(ctx.Event.GroupID)
+			if len(prisoners) == 0 {
+				ctx.SendChain(message.Text("监狱里空空如也"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("本群在押人员:")
+			for _, p := range prisoners {
+				sb.WriteString("\n")
+				sb.WriteString(ctx.CardOrNickName(p.UID))
+				sb.WriteString("(")
+				sb.WriteString(strconv.FormatInt(p.UID, 10))
+				sb.WriteString(") ")
+				sb.WriteString(p.Reason)
+				sb.WriteString(" 剩余")
+				sb.WriteString(jail.FormatLeft(p))
+				sb.WriteString(" 保释金")
+				sb.WriteString(strconv.Itoa(p.Bail))
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+
+	engine.OnRegex(`^悬赏\s?(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\]|(\d+))\s+(\d+)$`, zero.OnlyGroup, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			uid := ctx.Event.UserID
+			gid := ctx.Event.GroupID
+			matched := ctx.State["regex_matched"].([]string)
+			targetID, _ := strconv.ParseInt(matched[2]+matched[3], 10, 64)
+			reward, _ := strconv.Atoi(matched[4])
+			if reward <= 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("赏金必须大于0"))
+				return
+			}
+			if !police.hasCase(gid, uid, targetID, time.Now().Add(-caseValidity)) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("对方最近没有打劫过你，不能悬赏"))
+				return
+			}
+			id, err := police.postBounty(gid, uid, targetID, reward)
+			if errors.Is(err, ledger.ErrNotEnough) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你的钱不够支付赏金"))
+				return
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.Text("悬赏#", id, "发布成功！抓住", ctx.CardOrNickName(targetID), "的人将获得", reward, wallet.GetWalletName()))
+		})
+
+	engine.OnRegex(`^撤销悬赏\s*#?(\d+)$`, zero.OnlyGroup, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			reward, err := police.cancelBounty(ctx.Event.GroupID, ctx.Event.UserID, id)
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("已撤销悬赏#", id, "，退还", reward, wallet.GetWalletName()))
+		})
+
+	engine.OnFullMatch("悬赏榜", zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			bounties := police.getBounties(ctx.Event.GroupID, 0)
+			if len(bounties) == 0 {
+				ctx.SendChain(message.Text("本群暂无悬赏"))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("本群悬赏榜:")
+			for _, b := range bounties {
+				sb.WriteString("\n#")
+				sb.WriteString(strconv.FormatInt(b.ID, 10))
+				sb.WriteString(" 劫匪: ")
+				sb.WriteString(ctx.CardOrNickName(b.TargetID))
+				sb.WriteString("(")
+				sb.WriteString(strconv.FormatInt(b.TargetID, 10))
+				sb.WriteString(") 赏金: ")
+				sb.WriteString(strconv.Itoa(b.Reward))
+				sb.WriteString(" 悬赏人: ")
+				sb.WriteString(ctx.CardOrNickName(b.PosterID))
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+
+	engine.OnRegex(`^抓捕\s?(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\]|(\d+))`, zero.OnlyGroup, getdb, jail.CheckFree).SetBlock(true).
+		Limit(func(ctx *zero.Ctx) *rate.Limiter {
+			return catchLimiter.Load(ctx.Event.UserID)
+		}, func(ctx *zero.Ctx) {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你刚刚抓捕过，休息一下吧"))
+		}).
+		Handle(func(ctx *zero.Ctx) {
+			uid := ctx.Event.UserID
+			gid := ctx.Event.GroupID
+			matched := ctx.State["regex_matched"].([]string)
+			targetID, _ := strconv.ParseInt(matched[2]+matched[3], 10, 64)
+			if targetID == uid {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("不能抓捕自己"))
+				return
+			}
+			bounties := police.getBounties(gid, targetID)
+			if len(bounties) == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("对方没有被悬赏"))
+				return
+			}
+			// 悬赏人亲自抓捕会拿回自己的赏金
+			for _, b := range bounties {
+				if b.PosterID == uid {
+					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你悬赏了对方，不能亲自抓捕"))
+					return
+				}
+			}
+			if _, ok := jail.Get(targetID); ok {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("对方已经在坐牢了"))
+				return
+			}
+			rule := police.getRuleset(gid)
+			if rand.Intn(100) >= rule.CatchRate {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("抓捕失败，让劫匪跑掉了"))
+				return
+			}
+			reward, err := police.claimBounties(gid, targetID, uid)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			jailHours := rule.JailHours
+			if jailHours < 1 {
+				jailHours = 1
+			}
+			err = jail.Imprison(gid, targetID, time.Duration(jailHours)*time.Hour, rule.Bail, "被悬赏抓捕")
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.At(uid), message.Text("抓捕成功！获得赏金", reward, wallet.GetWalletName()))
+			ctx.SendChain(message.At(targetID), message.Text("你被抓进了监狱，刑期", jailHours, "小时"))
+		})
+}
+
+func (sql *robberyRepo) postBounty(gid, uid, targetID int64, reward int) (id int64, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	var c count
+	_ = sql.db.Query("SELECT IFNULL(MAX(id), 0) FROM bounty;", &c)
+	id = c.N + 1
+	err = ledger.Spend(uid, reward, "robbery", targetID, "悬赏#"+strconv.FormatInt(id, 10))
+	if err != nil {
+		return
+	}
+	err = sql.db.Insert("bounty", &bounty{
+		ID:       id,
+		GroupID:  gid,
+		PosterID: uid,
+		TargetID: targetID,
+		Reward:   reward,
+		Time:     time.Now().Unix(),
+	})
+	if err != nil {
+		_ = ledger.Earn(uid, reward, "robbery", targetID, "悬赏退回#"+strconv.FormatInt(id, 10))
+	}
+	return
+}
+
+func (sql *robberyRepo) cancelBounty(gid, uid, id int64) (reward int, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	var b bounty
+	err = sql.db.Find("bounty", &b, "WHERE id = ? AND group_id = ? AND poster_id = ?", id, gid, uid)
+	if err != nil {
+		return 0, errors.New("没有找到你发布的该悬赏")
+	}
+	err = sql.db.Del("bounty", "WHERE id = ?", id)
+	if err != nil {
+		return
+	}
+	return b.Reward, ledger.Earn(uid, b.Reward, "robbery", b.TargetID, "撤销悬赏#"+strconv.FormatInt(id, 10))
+}
+
+// getBounties 获取群内悬赏, targetID 为 0 时获取全部
+func (sql *robberyRepo) getBounties(gid, targetID int64) (bounties []bounty) {
+	sql.RLock()
+	defer sql.RUnlock()
+	cond := "WHERE group_id = ?"
+	args := []any{gid}
+	if targetID != 0 {
+		cond += " AND target_id = ?"
+		args = append(args, targetID)
+	}
+	var b bounty
+	_ = sql.db.FindFor("bounty", &b, cond+" ORDER BY reward DESC", func() error {
+		bounties = append(bounties, b)
+		return nil
+	}, args...)
+	return
+}
+
+// claimBounties 领取某劫匪的全部悬赏
+func (sql *robberyRepo) claimBounties(gid, targetID, hunterID int64) (reward int, err error) {
+	sql.Lock()
+	defer sql.Unlock()
+	var b bounty
+	_ = sql.db.FindFor("bounty", &b, "WHERE group_id = ? AND target_id = ?", func() error {
+		reward += b.Reward
+		return nil
+	}, gid, targetID)
+	err = sql.db.Del("bounty", "WHERE group_id = ? AND target_id = ?", gid, targetID)
+	if err != nil {
+		return 0, err
+	}
+	return reward, ledger.Earn(hunterID, reward, "robbery", targetID, "悬赏赏金")
+}
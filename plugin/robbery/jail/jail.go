@@ -0,0 +1,132 @@
+// Package jail 监狱
+//
+// 坐牢期间不能使用经济相关的指令,
+// 其它插件可在会改动余额或物品的指令的规则中加入 jail.CheckFree, 查询类指令不受影响
+package jail
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/floatbox/file"
+	sql "github.com/FloatTech/sqlite"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// Prisoner 囚犯
+type Prisoner struct {
+	UID    int64  `db:"uid"`
+	GID    int64  `db:"gid"`    // 入狱时所在的群
+	Until  int64  `db:"until"`  // 出狱时间
+	Bail   int    `db:"bail"`   // 保释金
+	Reason string `db:"reason"` // 入狱原因
+}
+
+// storage 监狱数据库
+type storage struct {
+	sync.RWMutex
+	db sql.Sqlite
+}
+
+var jdb = &storage{
+	db: sql.New("data/robbery/jail.db"),
+}
+
+func init() {
+	if file.IsNotExist("data/robbery") {
+		err := os.MkdirAll("data/robbery", 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err := jdb.db.Open(time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	err = jdb.db.Create("prisoner", &Prisoner{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Imprison 关进监狱, 已在狱中则刑期累加
+func Imprison(gid, uid int64, d time.Duration, bail int, reason string) error {
+	jdb.Lock()
+	defer jdb.Unlock()
+	p, ok := jdb.get(uid)
+	start := time.Now()
+	if ok {
+		start = time.Unix(p.Until, 0)
+		bail += p.Bail
+	}
+	return jdb.db.Insert("prisoner", &Prisoner{
+		UID:    uid,
+		GID:    gid,
+		Until:  start.Add(d).Unix(),
+		Bail:   bail,
+		Reason: reason,
+	})
+}
+
+// Release 释放
+func Release(uid int64) error {
+	jdb.Lock()
+	defer jdb.Unlock()
+	return jdb.db.Del("prisoner", "WHERE uid = ?", uid)
+}
+
+// Get 获取在狱中的囚犯信息
+func Get(uid int64) (p Prisoner, ok bool) {
+	jdb.RLock()
+	defer jdb.RUnlock()
+	return jdb.get(uid)
+}
+
+// GetGroupPrisoners 获取某群中入狱的囚犯
+func GetGroupPrisoners(gid int64) (prisoners []Prisoner) {
+	jdb.RLock()
+	defer jdb.RUnlock()
+	var p Prisoner
+	_ = jdb.db.FindFor("prisoner", &p, "WHERE gid = ? AND until > ? ORDER BY until", func() error {
+		prisoners = append(prisoners, p)
+		return nil
+	}, gid, time.Now().Unix())
+	return
+}
+
+// CheckFree 不在狱中则通过, 否则提示剩余刑期
+func CheckFree(ctx *zero.Ctx) bool {
+	p, ok := Get(ctx.Event.UserID)
+	if !ok {
+		return true
+	}
+	ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(
+		"你正在坐牢(", p.Reason, ")，还有", FormatLeft(p), "出狱，期间不能进行该操作。\n可以找朋友花", p.Bail, "保释你"))
+	return false
+}
+
+// FormatLeft 格式化剩余刑期
+func FormatLeft(p Prisoner) string {
+	left := time.Until(time.Unix(p.Until, 0))
+	if left < time.Minute {
+		return "不到1分钟"
+	}
+	h := int(left.Hours())
+	m := int(left.Minutes()) % 60
+	if h == 0 {
+		return strconv.Itoa(m) + "分钟"
+	}
+	return strconv.Itoa(h) + "小时" + strconv.Itoa(m) + "分钟"
+}
+
+// get no lock
+func (s *storage) get(uid int64) (p Prisoner, ok bool) {
+	err := s.db.Find("prisoner", &p, "WHERE uid = ?", uid)
+	if err != nil {
+		return p, false
+	}
+	return p, p.Until > time.Now().Unix()
+}
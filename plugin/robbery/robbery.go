@@ -13,6 +13,8 @@ import (
 	"github.com/FloatTech/zbputils/control"
 
 	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	"github.com/FloatTech/floatbox/math"
 	"github.com/FloatTech/zbputils/ctxext"
 	zero "github.com/wdvxdr1123/ZeroBot"
@@ -24,33 +26,61 @@ type robberyRepo struct {
 	db sql.Sqlite
 }
 
-type robberyRecord struct {
-	UserID   int64  `db:"user_id"`   // 劫匪
-	VictimID int64  `db:"victim_id"` // 受害者
-	Time     string `db:"time"`      // 时间
+// caseFile 打劫成功的案底
+type caseFile struct {
+	ID       int64 `db:"id"`
+	GroupID  int64 `db:"group_id"`  // 群号
+	UserID   int64 `db:"user_id"`   // 劫匪
+	VictimID int64 `db:"victim_id"` // 受害者
+	Amount   int   `db:"amount"`    // 受害者损失
+	Time     int64 `db:"time"`      // 时间
 }
 
-func init() {
-	var police robberyRepo
-	engine := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+type count struct {
+	N int64 `db:"n"`
+}
+
+var (
+	police robberyRepo
+	engine = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "打劫别人的钱包",
 		Help: "- 打劫[对方Q号|@对方QQ]\n" +
-			"1. 受害者钱包少于1000不能被打劫\n" +
-			"2. 打劫成功率 40%\n" +
-			"4. 打劫失败罚款1000（钱不够，钱包归零）\n" +
-			"5. 保险赔付0-80%\n" +
-			"6. 打劫成功获得对方0-5%+500的财产（最高1W）\n" +
-			"7. 每日可打劫或被打劫一次\n" +
-			"8. 打劫失败不计入次数\n",
+			"- 保释[对方Q号|@对方QQ]\n" +
+			"- 查看监狱\n" +
+			"- 悬赏[对方Q号|@对方QQ] [金额]\n" +
+			"- 撤销悬赏[编号]\n" +
+			"- 悬赏榜\n" +
+			"- 抓捕[对方Q号|@对方QQ]\n" +
+			"- 打劫规则\n" +
+			"- 设置打劫规则[参数名] [值]\n" +
+			"- 重置打劫规则\n" +
+			"1. 受害者钱包少于最低余额不能被打劫\n" +
+			"2. 打劫失败会被罚款并入狱, 坐牢期间不能使用经济相关的指令\n" +
+			"3. 朋友可以支付保释金将你保释出狱\n" +
+			"4. 受害者可以悬赏劫匪, 抓捕成功的人获得全部悬赏并将劫匪送进监狱\n" +
+			"5. 打劫失败不计入每日次数\n" +
+			"注：仅超级用户能设置和重置打劫规则, 发送“打劫规则”查看本群生效的参数\n",
 		PrivateDataFolder: "robbery",
 	}).ApplySingle(ctxext.NewGroupSingle("别着急，警察局门口排长队了！"))
-	getdb := fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
+	getdb = fcext.DoOnceOnSuccess(func(ctx *zero.Ctx) bool {
 		police.db = sql.New(engine.DataFolder() + "robbery.db")
 		err := police.db.Open(time.Hour)
 		if err == nil {
-			// 创建CD表
-			err = police.db.Create("criminal_record", &robberyRecord{})
+			// 创建案底表
+			err = police.db.Create("case_file", &caseFile{})
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return false
+			}
+			// 创建规则表
+			err = police.db.Create("ruleset", &ruleset{})
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return false
+			}
+			// 创建悬赏表
+			err = police.db.Create("bounty", &bounty{})
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:", err))
 				return false
@@ -60,123 +90,130 @@ func init() {
 		ctx.SendChain(message.Text("[ERROR]:", err))
 		return false
 	})
+)
 
+func init() {
 	// 打劫功能
-	engine.OnRegex(`^打劫\s?(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\]|(\d+))`, getdb).SetBlock(true).Limit(ctxext.LimitByUser).
+	engine.OnRegex(`^打劫\s?(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\]|(\d+))`, getdb, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
 			uid := ctx.Event.UserID
+			gid := ctx.Event.GroupID
 			fiancee := ctx.State["regex_matched"].([]string)
 			victimID, _ := strconv.ParseInt(fiancee[2]+fiancee[3], 10, 64)
 			if victimID == uid {
 				ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.At(uid), message.Text("不能打劫自己")))
 				return
 			}
+			rule := police.getRuleset(gid)
 
 			// 查询记录
-			ok, err := police.getRecord(victimID, uid)
+			robbed, robbing, err := police.countToday(victimID, uid)
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:", err))
 				return
 			}
 
-			if ok == 1 {
+			if robbed >= rule.DailyLimit {
 				ctx.SendChain(message.Text("对方今天已经被打劫了，给人家留点后路吧"))
 				return
 			}
-			if ok >= 2 {
+			if robbing >= rule.DailyLimit {
 				ctx.SendChain(message.Text("你今天已经成功打劫过了，贪心没有好果汁吃！"))
 				return
 			}
 
 			// 穷人保护
 			victimWallet := wallet.GetWalletOf(victimID)
-			if victimWallet < 1000 {
+			if victimWallet < rule.MinVictim {
 				ctx.SendChain(message.Text("对方太穷了！打劫失败"))
 				return
 			}
 
 			// 判断打劫是否成功
-			if rand.Intn(100) > 60 {
-				updateMoney := wallet.GetWalletOf(uid)
-				if updateMoney >= 1000 {
-					updateMoney = 1000
-				}
-				ctx.SendChain(message.Text("打劫失败,罚款1000"))
-				err := wallet.InsertWalletOf(uid, -updateMoney)
+			if rand.Intn(100) >= rule.SuccessRate {
+				updateMoney := math.Min(wallet.GetWalletOf(uid), rule.Penalty)
+				err := ledger.Deduct(uid, updateMoney, "robbery", victimID, "打劫失败罚款")
 				if err != nil {
 					ctx.SendChain(message.Text("[ERROR]:罚款失败，钱包坏掉力:\n", err))
 					return
 				}
+				msg := "打劫失败,罚款" + strconv.Itoa(updateMoney)
+				if rule.JailHours > 0 {
+					err = jail.Imprison(gid, uid, time.Duration(rule.JailHours)*time.Hour, rule.Bail, "打劫失败")
+					if err != nil {
+						ctx.SendChain(message.Text("[ERROR]:入狱失败，监狱满员了:\n", err))
+						return
+					}
+					msg += ",入狱" + strconv.Itoa(rule.JailHours) + "小时"
+				}
+				ctx.SendChain(message.At(uid), message.Text(msg))
 				return
 			}
-			userIncrMoney := math.Min(rand.Intn(victimWallet/20)+500, 10000)
-			victimDecrMoney := userIncrMoney / (rand.Intn(4) + 1)
+			userIncrMoney := rule.BaseGain
+			if extra := victimWallet * rule.GainRate / 100; extra > 0 {
+				userIncrMoney += rand.Intn(extra)
+			}
+			userIncrMoney = math.Min(userIncrMoney, rule.MaxGain)
+			victimDecrMoney := userIncrMoney * (100 - rand.Intn(rule.InsuranceMax+1)) / 100
 
 			// 记录结果
-			err = wallet.InsertWalletOf(victimID, -victimDecrMoney)
+			err = ledger.Deduct(victimID, victimDecrMoney, "robbery", uid, "被打劫")
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:钱包坏掉力:\n", err))
 				return
 			}
-			err = wallet.InsertWalletOf(uid, +userIncrMoney)
+			err = ledger.Earn(uid, userIncrMoney, "robbery", victimID, "打劫成功")
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:打劫失败，脏款掉入虚无\n", err))
 				return
 			}
 
 			// 写入记录
-			err = police.insertRecord(victimID, uid)
+			err = police.insertRecord(gid, victimID, uid, victimDecrMoney)
 			if err != nil {
 				ctx.SendChain(message.At(uid), message.Text("[ERROR]:犯罪记录写入失败\n", err))
 			}
 
 			ctx.SendChain(message.At(uid), message.Text("打劫成功，钱包增加：", userIncrMoney, wallet.GetWalletName()))
-			ctx.SendChain(message.At(victimID), message.Text("保险公司对您进行了赔付，您实际损失：", victimDecrMoney, wallet.GetWalletName()))
+			ctx.SendChain(message.At(victimID), message.Text("保险公司对您进行了赔付，您实际损失：", victimDecrMoney, wallet.GetWalletName(), "\n可以发送“悬赏”让群友帮你抓住劫匪"))
 		})
 }
 
-// ok==0 可以打劫；ok==1 程序错误 or 受害者进入CD；ok==2 用户进入CD; ok==3 用户和受害者都进入CD；
-func (sql *robberyRepo) getRecord(victimID, uid int64) (ok int, err error) {
-	sql.Lock()
-	defer sql.Unlock()
-	// 创建群表格
-	err = sql.db.Create("criminal_record", &robberyRecord{})
+// countToday 统计今天受害者被打劫的次数与劫匪打劫成功的次数
+func (sql *robberyRepo) countToday(victimID, uid int64) (robbed, robbing int, err error) {
+	sql.RLock()
+	defer sql.RUnlock()
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Unix()
+	var c count
+	err = sql.db.Query("SELECT COUNT(1) FROM case_file WHERE victim_id = ? AND time >= ?;", &c, victimID, today)
 	if err != nil {
-		return 1, err
-	}
-	// 拼接查询SQL
-	limitID := "WHERE victim_id = ? OR user_id = ?"
-	if !sql.db.CanFind("criminal_record", limitID, victimID, uid) {
-		// 没有记录即不用比较
-		return 0, nil
+		return
 	}
-	cdInfo := robberyRecord{}
-
-	err = sql.db.FindFor("criminal_record", &cdInfo, limitID, func() error {
-		if time.Now().Format("2006/01/02") != cdInfo.Time {
-			// // 如果跨天了就删除
-			err = sql.db.Del("criminal_record", limitID, victimID, uid)
-			return nil
-		}
-		// 俩个if是为了保证，重复打劫同一个人，ok == 3
-		if cdInfo.UserID == uid {
-			ok += 2
-		}
-		if cdInfo.VictimID == victimID {
-			// lint 不允许使用 ok += 1
-			ok++
-		}
-		return nil
-	}, victimID, uid)
-	return ok, err
+	robbed = int(c.N)
+	err = sql.db.Query("SELECT COUNT(1) FROM case_file WHERE user_id = ? AND time >= ?;", &c, uid, today)
+	robbing = int(c.N)
+	return
 }
 
-func (sql *robberyRepo) insertRecord(vid int64, uid int64) error {
+func (sql *robberyRepo) insertRecord(gid, vid, uid int64, amount int) error {
 	sql.Lock()
 	defer sql.Unlock()
-	return sql.db.Insert("criminal_record", &robberyRecord{
+	var c count
+	_ = sql.db.Query("SELECT IFNULL(MAX(id), 0) FROM case_file;", &c)
+	return sql.db.Insert("case_file", &caseFile{
+		ID:       c.N + 1,
+		GroupID:  gid,
 		UserID:   uid,
 		VictimID: vid,
-		Time:     time.Now().Format("2006/01/02"),
+		Amount:   amount,
+		Time:     time.Now().Unix(),
 	})
 }
+
+// hasCase 劫匪近期是否在本群打劫过受害者
+func (sql *robberyRepo) hasCase(gid, victimID, uid int64, since time.Time) bool {
+	sql.RLock()
+	defer sql.RUnlock()
+	return sql.db.CanFind("case_file", "WHERE group_id = ? AND victim_id = ? AND user_id = ? AND time >= ?", gid, victimID, uid, since.Unix())
+}
@@ -0,0 +1,158 @@
+package robbery
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// ruleset 每个群的打劫规则, group_id 为 0 的是默认规则
+type ruleset struct {
+	GroupID      int64 `db:"group_id"`
+	SuccessRate  int   `db:"success_rate"`  // 打劫成功率(%)
+	MinVictim    int   `db:"min_victim"`    // 受害者最低余额
+	Penalty      int   `db:"penalty"`       // 失败罚款
+	BaseGain     int   `db:"base_gain"`     // 基础收益
+	GainRate     int   `db:"gain_rate"`     // 额外收益占受害者余额的比例上限(%)
+	MaxGain      int   `db:"max_gain"`      // 收益上限
+	InsuranceMax int   `db:"insurance_max"` // 保险最高赔付(%)
+	DailyLimit   int   `db:"daily_limit"`   // 每日可打劫/被打劫次数
+	JailHours    int   `db:"jail_hours"`    // 失败入狱时长(小时)
+	Bail         int   `db:"bail"`          // 保释金
+	CatchRate    int   `db:"catch_rate"`    // 抓捕成功率(%)
+}
+
+var (
+	defaultRuleset = ruleset{
+		SuccessRate:  40,
+		MinVictim:    1000,
+		Penalty:      1000,
+		BaseGain:     500,
+		GainRate:     5,
+		MaxGain:      10000,
+		InsuranceMax: 80,
+		DailyLimit:   1,
+		JailHours:    2,
+		Bail:         500,
+		CatchRate:    50,
+	}
+	ruleNames = []string{"成功率", "最低余额", "罚款", "基础收益", "收益比例", "收益上限", "保险赔付", "每日次数", "入狱时长", "保释金", "抓捕成功率"}
+)
+
+func init() {
+	engine.OnFullMatch("打劫规则", zero.OnlyGroup, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			rule := police.getRuleset(ctx.Event.GroupID)
+			ctx.SendChain(message.Text("本群打劫规则:\n", rule.String()))
+		})
+	engine.OnRegex(`^设置打劫规则\s*(\S+?)\s*(\d+)$`, zero.OnlyGroup, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			value, _ := strconv.Atoi(matched[2])
+			err := police.setRule(ctx.Event.GroupID, matched[1], value)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err, "\n可设置的参数: ", strings.Join(ruleNames, ",")))
+				return
+			}
+			ctx.SendChain(message.Text("设置成功"))
+		})
+	engine.OnFullMatch("重置打劫规则", zero.OnlyGroup, zero.SuperUserPermission, getdb).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			err := police.resetRuleset(ctx.Event.GroupID)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.Text("已恢复默认规则"))
+		})
+}
+
+// field 按中文名获取参数
+func (r *ruleset) field(name string) *int {
+	switch name {
+	case "成功率":
+		return &r.SuccessRate
+	case "最低余额":
+		return &r.MinVictim
+	case "罚款":
+		return &r.Penalty
+	case "基础收益":
+		return &r.BaseGain
+	case "收益比例":
+		return &r.GainRate
+	case "收益上限":
+		return &r.MaxGain
+	case "保险赔付":
+		return &r.InsuranceMax
+	case "每日次数":
+		return &r.DailyLimit
+	case "入狱时长":
+		return &r.JailHours
+	case "保释金":
+		return &r.Bail
+	case "抓捕成功率":
+		return &r.CatchRate
+	}
+	return nil
+}
+
+// String 参数列表
+func (r *ruleset) String() string {
+	var sb strings.Builder
+	for i, name := range ruleNames {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(name)
+		sb.WriteString(": ")
+		sb.WriteString(strconv.Itoa(*r.field(name)))
+		switch name {
+		case "成功率", "收益比例", "保险赔付", "抓捕成功率":
+			sb.WriteString("%")
+		case "入狱时长":
+			sb.WriteString("小时")
+		}
+	}
+	return sb.String()
+}
+
+// getRuleset 获取群规则, 没有则使用默认规则
+func (sql *robberyRepo) getRuleset(gid int64) (r ruleset) {
+	sql.RLock()
+	defer sql.RUnlock()
+	r = defaultRuleset
+	_ = sql.db.Find("ruleset", &r, "WHERE group_id = ?", gid)
+	return
+}
+
+func (sql *robberyRepo) setRule(gid int64, name string, value int) error {
+	r := police.getRuleset(gid)
+	f := r.field(name)
+	if f == nil {
+		return errors.New("没有该参数")
+	}
+	switch name {
+	case "成功率", "保险赔付", "抓捕成功率":
+		if value > 100 {
+			return errors.New("百分比不能超过100")
+		}
+	case "每日次数":
+		if value < 1 {
+			return errors.New("每日次数至少为1")
+		}
+	}
+	*f = value
+	r.GroupID = gid
+	sql.Lock()
+	defer sql.Unlock()
+	return sql.db.Insert("ruleset", &r)
+}
+
+func (sql *robberyRepo) resetRuleset(gid int64) error {
+	sql.Lock()
+	defer sql.Unlock()
+	return sql.db.Del("ruleset", "WHERE group_id = ?", gid)
+}
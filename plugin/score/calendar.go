@@ -0,0 +1,287 @@
+package score
+
+import (
+	"errors"
+	"image"
+	"strconv"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/gg/factory"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/kanban/banner"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+const (
+	// makeupCardPrice 补签卡单价
+	makeupCardPrice = 200
+	// makeupDays 最多补签多少天前
+	makeupDays = 30
+)
+
+func init() {
+	engine.OnRegex(`^购买补签卡\s*(\d*)$`).Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		n := 1
+		if s := ctx.State["regex_matched"].([]string)[1]; s != "" {
+			n, _ = strconv.Atoi(s)
+		}
+		if n <= 0 || n > 100 {
+			ctx.SendChain(message.Text("ERROR: 一次最多购买100张"))
+			return
+		}
+		price := n * makeupCardPrice
+		err := ledger.Spend(uid, price, "score", 0, "购买补签卡")
+		if errors.Is(err, ledger.ErrNotEnough) {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你的", wallet.GetWalletName(), "不足", price, ", 补签卡单价为", makeupCardPrice))
+			return
+		}
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		mc := sdb.GetMakeupCardByUID(uid)
+		err = sdb.UpdateMakeupCardByUID(uid, mc.Count+n)
+		if err != nil {
+			_ = ledger.Earn(uid, price, "score", 0, "补签卡退款")
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("购买成功, 花费", price, wallet.GetWalletName(), ", 当前补签卡: ", mc.Count+n, "张"))
+	})
+	engine.OnRegex(`^补签\s*(\d{8})?$`).Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		earliest := today.AddDate(0, 0, -makeupDays)
+		logs, err := sdb.GetSignInLogs(uid, earliest.Format("20060102"), today.Format("20060102"))
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		if len(logs) == 0 {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你最近", makeupDays, "天都没有签到过, 无法补签"))
+			return
+		}
+		signed := make(map[string]struct{}, len(logs))
+		for _, l := range logs {
+			signed[l.Date] = struct{}{}
+		}
+		var day time.Time
+		if s := ctx.State["regex_matched"].([]string)[1]; s != "" {
+			day, err = time.ParseInLocation("20060102", s, now.Location())
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if !day.Before(today) || day.Before(earliest) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("只能补签", makeupDays, "天内的漏签"))
+				return
+			}
+			if _, ok := signed[day.Format("20060102")]; ok {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("这一天已经签到过了"))
+				return
+			}
+		} else {
+			// 找到最近漏签的一天
+			for d := today.AddDate(0, 0, -1); !d.Before(earliest); d = d.AddDate(0, 0, -1) {
+				if _, ok := signed[d.Format("20060102")]; !ok {
+					day = d
+					break
+				}
+			}
+			if day.IsZero() {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你最近", makeupDays, "天没有漏签"))
+				return
+			}
+		}
+		mc := sdb.GetMakeupCardByUID(uid)
+		if mc.Count <= 0 {
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你没有补签卡, 发送\"购买补签卡\"购买, 单价", makeupCardPrice, wallet.GetWalletName()))
+			return
+		}
+		err = sdb.UpdateMakeupCardByUID(uid, mc.Count-1)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		err = sdb.AddSignInLog(uid, day.Format("20060102"), true)
+		if err != nil {
+			_ = sdb.UpdateMakeupCardByUID(uid, mc.Count)
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(
+			"补签", day.Format("2006-01-02"), "成功, 剩余补签卡: ", mc.Count-1, "张\n当前连续签到: ", sdb.GetStreak(uid, now), "天"))
+	})
+	engine.OnFullMatch("签到日历").Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		uid := ctx.Event.UserID
+		now := time.Now()
+		first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		last := first.AddDate(0, 1, -1)
+		logs, err := sdb.GetSignInLogs(uid, first.Format("20060102"), last.Format("20060102"))
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		img, err := drawCalendar(&calendar{
+			nickname: ctx.CardOrNickName(uid),
+			month:    first,
+			today:    now.Day(),
+			logs:     logs,
+			streak:   sdb.GetStreak(uid, now),
+			cards:    sdb.GetMakeupCardByUID(uid).Count,
+		})
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		data, err := factory.ToBytes(img)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.ImageBytes(data))
+	})
+}
+
+// streakBonus 连续签到奖励, 每多签一天多1, 最多10, 每满7天再加20
+func streakBonus(streak int) int {
+	if streak < 2 {
+		return 0
+	}
+	bonus := min(streak-1, 10)
+	if streak%7 == 0 {
+		bonus += 20
+	}
+	return bonus
+}
+
+type calendar struct {
+	nickname string
+	month    time.Time // 当月第一天
+	today    int
+	logs     []signinlog
+	streak   int
+	cards    int
+}
+
+func drawCalendar(c *calendar) (image.Image, error) {
+	const (
+		padding = 30.0
+		cellW   = 90.0
+		cellH   = 80.0
+		titleH  = 110.0
+		weekH   = 40.0
+	)
+	days := c.month.AddDate(0, 1, -1).Day()
+	// 周一为一周的第一天
+	offset := (int(c.month.Weekday()) + 6) % 7
+	rows := (offset + days + 6) / 7
+	width := padding*2 + cellW*7
+	height := padding + titleH + weekH + cellH*float64(rows) + 90
+	signed := make(map[int]bool, len(c.logs))
+	for _, l := range c.logs {
+		d, err := strconv.Atoi(l.Date[6:])
+		if err == nil {
+			signed[d] = l.Makeup
+		}
+	}
+
+	canvas := gg.NewContext(int(width), int(height))
+	canvas.SetRGB255(250, 250, 250)
+	canvas.Clear()
+	bold, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	// 标题
+	if err = canvas.ParseFontFace(bold, 40); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB255(40, 40, 40)
+	canvas.DrawStringAnchored(c.month.Format("2006年01月")+" 签到日历", padding, padding+25, 0, 0.5)
+	if err = canvas.ParseFontFace(data, 24); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB255(90, 90, 90)
+	canvas.DrawStringAnchored(c.nickname, padding, padding+75, 0, 0.5)
+	canvas.DrawStringAnchored("连续签到 "+strconv.Itoa(c.streak)+" 天  补签卡 "+strconv.Itoa(c.cards)+" 张", width-padding, padding+75, 1, 0.5)
+	// 星期
+	top := padding + titleH
+	for i, w := range []string{"一", "二", "三", "四", "五", "六", "日"} {
+		if i >= 5 {
+			canvas.SetRGB255(220, 80, 80)
+		} else {
+			canvas.SetRGB255(90, 90, 90)
+		}
+		canvas.DrawStringAnchored(w, padding+cellW*float64(i)+cellW/2, top+weekH/2, 0.5, 0.5)
+	}
+	top += weekH
+	// 日期
+	if err = canvas.ParseFontFace(bold, 30); err != nil {
+		return nil, err
+	}
+	for d := 1; d <= days; d++ {
+		i := offset + d - 1
+		x := padding + cellW*float64(i%7)
+		y := top + cellH*float64(i/7)
+		canvas.DrawRoundedRectangle(x+4, y+4, cellW-8, cellH-8, 10)
+		makeup, ok := signed[d]
+		switch {
+		case ok && makeup:
+			canvas.SetRGB255(250, 190, 90)
+		case ok:
+			canvas.SetRGB255(110, 200, 130)
+		default:
+			canvas.SetRGB255(230, 230, 230)
+		}
+		canvas.Fill()
+		if d == c.today {
+			canvas.DrawRoundedRectangle(x+4, y+4, cellW-8, cellH-8, 10)
+			canvas.SetLineWidth(4)
+			canvas.SetRGB255(70, 130, 220)
+			canvas.Stroke()
+		}
+		if ok {
+			canvas.SetRGB255(255, 255, 255)
+		} else {
+			canvas.SetRGB255(120, 120, 120)
+		}
+		canvas.DrawStringAnchored(strconv.Itoa(d), x+cellW/2, y+cellH/2, 0.5, 0.5)
+	}
+	// 图例
+	if err = canvas.ParseFontFace(data, 20); err != nil {
+		return nil, err
+	}
+	legendY := top + cellH*float64(rows) + 25
+	x := padding
+	for _, l := range []struct {
+		r, g, b int
+		name    string
+	}{{110, 200, 130, "已签到"}, {250, 190, 90, "补签"}, {230, 230, 230, "未签到"}} {
+		canvas.DrawRoundedRectangle(x, legendY-10, 20, 20, 4)
+		canvas.SetRGB255(l.r, l.g, l.b)
+		canvas.Fill()
+		canvas.SetRGB255(90, 90, 90)
+		canvas.DrawStringAnchored(l.name, x+28, legendY, 0, 0.5)
+		w, _ := canvas.MeasureString(l.name)
+		x += 28 + w + 30
+	}
+	canvas.DrawStringAnchored("补签卡 "+strconv.Itoa(makeupCardPrice)+" "+wallet.GetWalletName()+"/张", width-padding, legendY, 1, 0.5)
+	canvas.SetRGB255(150, 150, 150)
+	canvas.DrawStringAnchored("Created By Zerobot-Plugin "+banner.Version, width/2, height-20, 0.5, 0.5)
+	return canvas.Image(), nil
+}
@@ -0,0 +1,301 @@
+// Package exp 群等级与经验
+//
+// 需要在群内发送“开启群等级”后才会生效,
+// 其它插件可通过 Award 为群友增加经验, 如游戏胜利
+package exp
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/floatbox/file"
+	sql "github.com/FloatTech/sqlite"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+// GameWinExp 游戏胜利时建议增加的经验
+const GameWinExp = 20
+
+const (
+	memberTable = "member"
+	configTable = "config"
+	titleTable  = "title"
+)
+
+// Member 群成员的经验
+type Member struct {
+	Key   string `db:"key"` // gid_uid
+	GID   int64  `db:"gid"`
+	UID   int64  `db:"uid"`
+	Exp   int    `db:"exp"`
+	Level int    `db:"level"`
+}
+
+// Config 群设置
+type Config struct {
+	GID     int64 `db:"gid"`
+	Enabled bool  `db:"enabled"` // 是否开启群等级
+	Title   bool  `db:"title"`   // 升级时是否自动设置头衔
+}
+
+// Title 达到某等级时授予的头衔
+type Title struct {
+	Key   string `db:"key"` // gid_level
+	GID   int64  `db:"gid"`
+	Level int    `db:"level"`
+	Name  string `db:"name"`
+}
+
+// Result 一次增加经验的结果
+type Result struct {
+	Before Member
+	After  Member
+}
+
+// LevelUp 是否升级
+func (r Result) LevelUp() bool {
+	return r.After.Level > r.Before.Level
+}
+
+type count struct {
+	N int64 `db:"n"`
+}
+
+// storage 经验数据库
+type storage struct {
+	sync.RWMutex
+	db      sql.Sqlite
+	configs map[int64]Config // 每条消息都要查询, 缓存在内存中
+}
+
+var (
+	// ErrDisabled 本群未开启群等级
+	ErrDisabled = errors.New("本群未开启群等级")
+
+	// DefaultTitles 群内未设置头衔时使用的默认头衔
+	DefaultTitles = []Title{
+		{Level: 1, Name: "初来乍到"},
+		{Level: 5, Name: "小有名气"},
+		{Level: 10, Name: "活跃分子"},
+		{Level: 20, Name: "中流砥柱"},
+		{Level: 30, Name: "元老"},
+		{Level: 50, Name: "传说"},
+	}
+
+	edb = &storage{
+		db:      sql.New("data/score/exp.db"),
+		configs: make(map[int64]Config),
+	}
+)
+
+func init() {
+	if file.IsNotExist("data/score") {
+		err := os.MkdirAll("data/score", 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err := edb.db.Open(time.Hour * 24)
+	if err != nil {
+		panic(err)
+	}
+	err = edb.db.Create(memberTable, &Member{})
+	if err != nil {
+		panic(err)
+	}
+	err = edb.db.Create(configTable, &Config{})
+	if err != nil {
+		panic(err)
+	}
+	err = edb.db.Create(titleTable, &Title{})
+	if err != nil {
+		panic(err)
+	}
+	var c Config
+	_ = edb.db.FindFor(configTable, &c, "", func() error {
+		edb.configs[c.GID] = c
+		return nil
+	})
+}
+
+// ExpOf 升到 level 级所需的总经验
+func ExpOf(level int) int {
+	return 50 * level * (level + 1)
+}
+
+// LevelOf 总经验对应的等级
+func LevelOf(exp int) int {
+	level := 0
+	for ExpOf(level+1) <= exp {
+		level++
+	}
+	return level
+}
+
+// GetConfig 获取群设置
+func GetConfig(gid int64) Config {
+	edb.RLock()
+	defer edb.RUnlock()
+	c, ok := edb.configs[gid]
+	if !ok {
+		c.GID = gid
+	}
+	return c
+}
+
+// SetConfig 保存群设置
+func SetConfig(c Config) error {
+	edb.Lock()
+	defer edb.Unlock()
+	err := edb.db.Insert(configTable, &c)
+	if err != nil {
+		return err
+	}
+	edb.configs[c.GID] = c
+	return nil
+}
+
+// IsEnabled 群是否开启了群等级
+func IsEnabled(gid int64) bool {
+	return GetConfig(gid).Enabled
+}
+
+// GetMember 获取群成员的经验
+func GetMember(gid, uid int64) Member {
+	edb.RLock()
+	defer edb.RUnlock()
+	return edb.member(gid, uid)
+}
+
+// Add 为群成员增加经验, 群未开启时返回 ErrDisabled
+func Add(gid, uid int64, amount int) (r Result, err error) {
+	if !IsEnabled(gid) {
+		return r, ErrDisabled
+	}
+	edb.Lock()
+	defer edb.Unlock()
+	r.Before = edb.member(gid, uid)
+	r.After = r.Before
+	r.After.Exp += amount
+	if r.After.Exp < 0 {
+		r.After.Exp = 0
+	}
+	r.After.Level = LevelOf(r.After.Exp)
+	err = edb.db.Insert(memberTable, &r.After)
+	return
+}
+
+// Award 为当前群的成员增加经验, 升级时发送通知并按设置授予头衔
+//
+// 群未开启群等级时什么也不做
+func Award(ctx *zero.Ctx, uid int64, amount int) {
+	AwardInGroup(ctx, ctx.Event.GroupID, uid, amount)
+}
+
+// AwardInGroup 同 Award, 但指定群号, 用于没有消息事件的定时任务
+func AwardInGroup(ctx *zero.Ctx, gid, uid int64, amount int) {
+	if gid == 0 {
+		return
+	}
+	r, err := Add(gid, uid, amount)
+	if err != nil || !r.LevelUp() {
+		return
+	}
+	msg := "恭喜升到了 Lv." + strconv.Itoa(r.After.Level)
+	if GetConfig(gid).Title {
+		if t, ok := TitleOf(gid, r.After.Level); ok && t.Level > r.Before.Level {
+			ctx.SetGroupSpecialTitle(gid, uid, t.Name)
+			msg += ", 获得头衔「" + t.Name + "」"
+		}
+	}
+	ctx.SendGroupMessage(gid, message.Message{message.At(uid), message.Text(msg)})
+}
+
+// GetRank 获取群内经验前 n 名
+func GetRank(gid int64, n int) (members []Member) {
+	edb.RLock()
+	defer edb.RUnlock()
+	var m Member
+	_ = edb.db.FindFor(memberTable, &m, "WHERE gid = ? ORDER BY exp DESC LIMIT ?", func() error {
+		members = append(members, m)
+		return nil
+	}, gid, n)
+	return
+}
+
+// RankOf 群成员在群内的名次, 从 1 开始, 没有经验时为 0
+func RankOf(gid, uid int64) int {
+	m := GetMember(gid, uid)
+	if m.Exp == 0 {
+		return 0
+	}
+	edb.RLock()
+	defer edb.RUnlock()
+	var c count
+	err := edb.db.Query("SELECT COUNT(1) FROM "+memberTable+" WHERE gid = ? AND exp > ?;", &c, gid, m.Exp)
+	if err != nil {
+		return 0
+	}
+	return int(c.N) + 1
+}
+
+// GetTitles 获取群头衔设置, 按等级从低到高, 未设置时为默认头衔
+func GetTitles(gid int64) (titles []Title) {
+	edb.RLock()
+	defer edb.RUnlock()
+	var t Title
+	_ = edb.db.FindFor(titleTable, &t, "WHERE gid = ? ORDER BY level", func() error {
+		titles = append(titles, t)
+		return nil
+	}, gid)
+	if len(titles) == 0 {
+		titles = append(titles, DefaultTitles...)
+	}
+	return
+}
+
+// SetTitle 设置达到 level 级时授予的头衔, 设置后默认头衔不再生效
+func SetTitle(gid int64, level int, name string) error {
+	edb.Lock()
+	defer edb.Unlock()
+	return edb.db.Insert(titleTable, &Title{
+		Key:   strconv.FormatInt(gid, 10) + "_" + strconv.Itoa(level),
+		GID:   gid,
+		Level: level,
+		Name:  name,
+	})
+}
+
+// DelTitle 删除某等级的头衔
+func DelTitle(gid int64, level int) error {
+	edb.Lock()
+	defer edb.Unlock()
+	return edb.db.Del(titleTable, "WHERE gid = ? AND level = ?", gid, level)
+}
+
+// TitleOf 获取 level 级对应的头衔, 即不高于 level 的最高一档
+func TitleOf(gid int64, level int) (t Title, ok bool) {
+	titles := GetTitles(gid)
+	i := sort.Search(len(titles), func(i int) bool {
+		return titles[i].Level > level
+	})
+	if i == 0 {
+		return t, false
+	}
+	return titles[i-1], true
+}
+
+// member no lock
+func (s *storage) member(gid, uid int64) (m Member) {
+	key := strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10)
+	err := s.db.Find(memberTable, &m, "WHERE key = ?", key)
+	if err != nil {
+		m = Member{Key: key, GID: gid, UID: uid}
+	}
+	return
+}
@@ -0,0 +1,278 @@
+package score
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/floatbox/web"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/gg/factory"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/kanban/banner"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/score/exp"
+)
+
+const (
+	// chatCooldown 发言获得经验的冷却
+	chatCooldown = time.Minute
+	// signinExp 签到获得的经验
+	signinExp = 30
+)
+
+// chatState 防刷屏: 冷却时间内或与上一条相同的发言不加经验
+type chatState struct {
+	last time.Time
+	text string
+}
+
+var (
+	chatmu     sync.Mutex
+	chatStates = map[[2]int64]chatState{}
+	chatPruned time.Time // 上次清理过期发言状态的时间
+)
+
+// pruneChatStates 每个冷却周期清理一次已过冷却的发言状态 no lock
+func pruneChatStates(now time.Time) {
+	if now.Sub(chatPruned) < chatCooldown {
+		return
+	}
+	chatPruned = now
+	for k, st := range chatStates {
+		if now.Sub(st.last) >= chatCooldown {
+			delete(chatStates, k)
+		}
+	}
+}
+
+func init() {
+	engine.OnMessage(zero.OnlyGroup, func(ctx *zero.Ctx) bool {
+		return exp.IsEnabled(ctx.Event.GroupID)
+	}).SetBlock(false).Handle(func(ctx *zero.Ctx) {
+		msg := strings.TrimSpace(ctx.ExtractPlainText())
+		if utf8.RuneCountInString(msg) < 2 {
+			return
+		}
+		key := [2]int64{ctx.Event.GroupID, ctx.Event.UserID}
+		now := time.Now()
+		chatmu.Lock()
+		st := chatStates[key]
+		if now.Sub(st.last) < chatCooldown || st.text == msg {
+			chatmu.Unlock()
+			return
+		}
+		chatStates[key] = chatState{last: now, text: msg}
+		pruneChatStates(now)
+		chatmu.Unlock()
+		exp.Award(ctx, ctx.Event.UserID, 5+rand.Intn(6))
+	})
+	engine.OnRegex(`^(开启|关闭)(群等级|等级头衔)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		matched := ctx.State["regex_matched"].([]string)
+		c := exp.GetConfig(ctx.Event.GroupID)
+		on := matched[1] == "开启"
+		if matched[2] == "群等级" {
+			c.Enabled = on
+		} else {
+			c.Title = on
+		}
+		err := exp.SetConfig(c)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Text("已", matched[1], matched[2]))
+	})
+	engine.OnRegex(`^设置等级头衔\s*(\d+)\s+(\S+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		matched := ctx.State["regex_matched"].([]string)
+		level, _ := strconv.Atoi(matched[1])
+		if len(matched[2]) > 18 {
+			ctx.SendChain(message.Text("头衔太长啦！"))
+			return
+		}
+		err := exp.SetTitle(ctx.Event.GroupID, level, matched[2])
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Text("设置成功, 达到Lv.", level, "时授予头衔「", matched[2], "」"))
+	})
+	engine.OnRegex(`^删除等级头衔\s*(\d+)$`, zero.OnlyGroup, zero.AdminPermission).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		level, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+		err := exp.DelTitle(ctx.Event.GroupID, level)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Text("删除成功"))
+	})
+	engine.OnFullMatch("查看等级头衔", zero.OnlyGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		c := exp.GetConfig(ctx.Event.GroupID)
+		var sb strings.Builder
+		sb.WriteString("群等级: ")
+		sb.WriteString(onOff(c.Enabled))
+		sb.WriteString("\n等级头衔: ")
+		sb.WriteString(onOff(c.Title))
+		for _, t := range exp.GetTitles(ctx.Event.GroupID) {
+			sb.WriteString("\nLv.")
+			sb.WriteString(strconv.Itoa(t.Level))
+			sb.WriteString(" ")
+			sb.WriteString(t.Name)
+		}
+		ctx.SendChain(message.Text(sb.String()))
+	})
+	engine.OnRegex(`^我的群等级\s*(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\])?$`, zero.OnlyGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		gid := ctx.Event.GroupID
+		if !exp.IsEnabled(gid) {
+			ctx.SendChain(message.Text(exp.ErrDisabled, ", 请管理员发送\"开启群等级\""))
+			return
+		}
+		uid := ctx.Event.UserID
+		if s := ctx.State["regex_matched"].([]string)[2]; s != "" {
+			uid, _ = strconv.ParseInt(s, 10, 64)
+		}
+		m := exp.GetMember(gid, uid)
+		msg := ctx.CardOrNickName(uid) + "\nLv." + strconv.Itoa(m.Level)
+		if t, ok := exp.TitleOf(gid, m.Level); ok {
+			msg += " 「" + t.Name + "」"
+		}
+		msg += "\n经验: " + strconv.Itoa(m.Exp) + "/" + strconv.Itoa(exp.ExpOf(m.Level+1))
+		if rank := exp.RankOf(gid, uid); rank > 0 {
+			msg += "\n本群第" + strconv.Itoa(rank) + "名"
+		}
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(msg))
+	})
+	engine.OnFullMatch("群等级排行", zero.OnlyGroup).Limit(ctxext.LimitByGroup).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		gid := ctx.Event.GroupID
+		if !exp.IsEnabled(gid) {
+			ctx.SendChain(message.Text(exp.ErrDisabled, ", 请管理员发送\"开启群等级\""))
+			return
+		}
+		members := exp.GetRank(gid, 10)
+		if len(members) == 0 {
+			ctx.SendChain(message.Text("本群还没有人获得经验"))
+			return
+		}
+		names := make([]string, len(members))
+		for i, m := range members {
+			names[i] = ctx.CardOrNickName(m.UID)
+		}
+		img, err := drawLevelRank(gid, members, names)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		data, err := factory.ToBytes(img)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.ImageBytes(data))
+	})
+}
+
+func onOff(b bool) string {
+	if b {
+		return "开启"
+	}
+	return "关闭"
+}
+
+func drawLevelRank(gid int64, members []exp.Member, names []string) (image.Image, error) {
+	const (
+		width   = 800.0
+		rowH    = 90.0
+		top     = 110.0
+		padding = 30.0
+	)
+	height := top + rowH*float64(len(members)) + 60
+	canvas := gg.NewContext(int(width), int(height))
+	canvas.SetRGB255(245, 245, 250)
+	canvas.Clear()
+	bold, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	if err = canvas.ParseFontFace(bold, 40); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB255(40, 40, 40)
+	canvas.DrawStringAnchored("群等级排行", width/2, top/2, 0.5, 0.5)
+	for i, m := range members {
+		y := top + rowH*float64(i)
+		canvas.DrawRoundedRectangle(padding, y+5, width-padding*2, rowH-10, 12)
+		canvas.SetRGB255(255, 255, 255)
+		canvas.Fill()
+		// 名次
+		if err = canvas.ParseFontFace(bold, 32); err != nil {
+			return nil, err
+		}
+		switch i {
+		case 0:
+			canvas.SetRGB255(230, 180, 40)
+		case 1:
+			canvas.SetRGB255(160, 160, 170)
+		case 2:
+			canvas.SetRGB255(190, 120, 60)
+		default:
+			canvas.SetRGB255(120, 120, 120)
+		}
+		canvas.DrawStringAnchored(strconv.Itoa(i+1), padding+35, y+rowH/2, 0.5, 0.5)
+		// 头像
+		if b, err := web.GetData("https://q4.qlogo.cn/g?b=qq&nk=" + strconv.FormatInt(m.UID, 10) + "&s=100"); err == nil {
+			if avatar, _, err := image.Decode(bytes.NewReader(b)); err == nil {
+				canvas.DrawImage(factory.Size(avatar, 60, 60).Circle(0).Image(), int(padding+70), int(y+15))
+			}
+		}
+		// 昵称与头衔
+		if err = canvas.ParseFontFace(data, 26); err != nil {
+			return nil, err
+		}
+		canvas.SetRGB255(40, 40, 40)
+		name := names[i]
+		if t, ok := exp.TitleOf(gid, m.Level); ok {
+			name += " 「" + t.Name + "」"
+		}
+		canvas.DrawStringAnchored(name, padding+150, y+rowH/2-12, 0, 0.5)
+		// 经验条
+		prev, next := exp.ExpOf(m.Level), exp.ExpOf(m.Level+1)
+		barX, barW := padding+150, width-padding*2-300
+		canvas.DrawRoundedRectangle(barX, y+rowH/2+10, barW, 10, 5)
+		canvas.SetRGB255(225, 225, 230)
+		canvas.Fill()
+		canvas.DrawRoundedRectangle(barX, y+rowH/2+10, barW*float64(m.Exp-prev)/float64(next-prev), 10, 5)
+		canvas.SetRGB255(90, 140, 230)
+		canvas.Fill()
+		// 等级
+		if err = canvas.ParseFontFace(bold, 28); err != nil {
+			return nil, err
+		}
+		canvas.SetRGB255(90, 140, 230)
+		canvas.DrawStringAnchored("Lv."+strconv.Itoa(m.Level), width-padding-20, y+rowH/2-12, 1, 0.5)
+		if err = canvas.ParseFontFace(data, 18); err != nil {
+			return nil, err
+		}
+		canvas.SetRGB255(120, 120, 120)
+		canvas.DrawStringAnchored(strconv.Itoa(m.Exp)+"/"+strconv.Itoa(next), width-padding-20, y+rowH/2+15, 1, 0.5)
+	}
+	if err = canvas.ParseFontFace(data, 18); err != nil {
+		return nil, err
+	}
+	canvas.SetRGB255(150, 150, 150)
+	canvas.DrawStringAnchored("Created By Zerobot-Plugin "+banner.Version, width/2, height-25, 0.5, 0.5)
+	return canvas.Image(), nil
+}
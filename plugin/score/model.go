@@ -40,6 +40,40 @@ func (signintable) TableName() string {
 	return "sign_in"
 }
 
+// signinlog 每日签到记录
+type signinlog struct {
+	UID    int64  `gorm:"column:uid;primary_key;auto_increment:false"`
+	Date   string `gorm:"column:date;primary_key"`     // 20060102
+	Makeup bool   `gorm:"column:makeup;default:false"` // 是否为补签
+}
+
+// TableName ...
+func (signinlog) TableName() string {
+	return "sign_in_log"
+}
+
+// makeupcard 补签卡
+type makeupcard struct {
+	UID   int64 `gorm:"column:uid;primary_key"`
+	Count int   `gorm:"column:count;default:0"`
+}
+
+// TableName ...
+func (makeupcard) TableName() string {
+	return "makeup_card"
+}
+
+// themechoice 签到主题选择
+type themechoice struct {
+	Key   string `gorm:"column:key;primary_key"` // group_群号 或 user_QQ号
+	Theme string `gorm:"column:theme"`
+}
+
+// TableName ...
+func (themechoice) TableName() string {
+	return "theme_choice"
+}
+
 // initialize 初始化ScoreDB数据库
 func initialize(dbpath string) *scoredb {
 	var err error
@@ -55,7 +89,7 @@ func initialize(dbpath string) *scoredb {
 	if err != nil {
 		panic(err)
 	}
-	gdb.AutoMigrate(&scoretable{}).AutoMigrate(&signintable{})
+	gdb.AutoMigrate(&scoretable{}).AutoMigrate(&signintable{}).AutoMigrate(&signinlog{}).AutoMigrate(&makeupcard{}).AutoMigrate(&themechoice{})
 	return &scoredb{
 		db: gdb,
 	}
@@ -139,6 +173,86 @@ func (sdb *scoredb) GetScoreRankByTopN(n int) (st []scoretable, err error) {
 	return
 }
 
+// AddSignInLog 记录某天的签到
+func (sdb *scoredb) AddSignInLog(uid int64, date string, makeup bool) error {
+	sdb.scoremu.Lock()
+	defer sdb.scoremu.Unlock()
+	return sdb.db.Model(&signinlog{}).Create(&signinlog{
+		UID:    uid,
+		Date:   date,
+		Makeup: makeup,
+	}).Error
+}
+
+// GetSignInLogs 取得 [from, to] 日期内的签到记录
+func (sdb *scoredb) GetSignInLogs(uid int64, from, to string) (logs []signinlog, err error) {
+	sdb.scoremu.Lock()
+	defer sdb.scoremu.Unlock()
+	err = sdb.db.Model(&signinlog{}).Where("uid = ? AND date >= ? AND date <= ?", uid, from, to).Order("date").Find(&logs).Error
+	return
+}
+
+// GetStreak 取得截至 today 的连续签到天数, 今天未签到时从昨天算起
+func (sdb *scoredb) GetStreak(uid int64, today time.Time) int {
+	logs, err := sdb.GetSignInLogs(uid, today.AddDate(-1, 0, 0).Format("20060102"), today.Format("20060102"))
+	if err != nil || len(logs) == 0 {
+		return 0
+	}
+	signed := make(map[string]struct{}, len(logs))
+	for _, l := range logs {
+		signed[l.Date] = struct{}{}
+	}
+	day := today
+	if _, ok := signed[day.Format("20060102")]; !ok {
+		day = day.AddDate(0, 0, -1)
+	}
+	streak := 0
+	for {
+		if _, ok := signed[day.Format("20060102")]; !ok {
+			return streak
+		}
+		streak++
+		day = day.AddDate(0, 0, -1)
+	}
+}
+
+// GetMakeupCardByUID 取得补签卡数量
+func (sdb *scoredb) GetMakeupCardByUID(uid int64) (mc makeupcard) {
+	sdb.scoremu.Lock()
+	defer sdb.scoremu.Unlock()
+	sdb.db.Model(&makeupcard{}).FirstOrCreate(&mc, "uid = ? ", uid)
+	return mc
+}
+
+// UpdateMakeupCardByUID 更新补签卡数量
+func (sdb *scoredb) UpdateMakeupCardByUID(uid int64, count int) error {
+	sdb.scoremu.Lock()
+	defer sdb.scoremu.Unlock()
+	return sdb.db.Model(&makeupcard{}).Where("uid = ? ", uid).Update(
+		map[string]any{
+			"count": count,
+		}).Error
+}
+
+// GetThemeChoice 取得主题选择, 没有设置时返回空
+func (sdb *scoredb) GetThemeChoice(key string) string {
+	sdb.scoremu.Lock()
+	defer sdb.scoremu.Unlock()
+	var tc themechoice
+	sdb.db.Model(&themechoice{}).Where("key = ?", key).First(&tc)
+	return tc.Theme
+}
+
+// SetThemeChoice 设置主题选择, theme 为空时删除
+func (sdb *scoredb) SetThemeChoice(key, theme string) error {
+	sdb.scoremu.Lock()
+	defer sdb.scoremu.Unlock()
+	if theme == "" {
+		return sdb.db.Where("key = ?", key).Delete(&themechoice{}).Error
+	}
+	return sdb.db.Save(&themechoice{Key: key, Theme: theme}).Error
+}
+
 type scdata struct {
 	drawedfile string
 	picfile    string
@@ -148,4 +262,5 @@ type scdata struct {
 	score      int // 钱包
 	level      int
 	rank       int
+	streak     int // 连续签到天数
 }
@@ -14,6 +14,9 @@ import (
 
 	"github.com/FloatTech/AnimeAPI/bilibili"
 	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/score/exp"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/bank"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 	"github.com/FloatTech/floatbox/file"
 	"github.com/FloatTech/floatbox/process"
 	"github.com/FloatTech/floatbox/web"
@@ -42,7 +45,7 @@ var (
 	engine    = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault:  false,
 		Brief:             "签到",
-		Help:              "- 签到\n- 获得签到背景[@xxx] | 获得签到背景\n- 设置签到预设(0~3)\n- 查看等级排名\n注:为跨群排名\n- 查看我的钱包\n- 查看钱包排名\n注:为本群排行，若群人数太多不建议使用该功能!!!",
+		Help:              "- 签到\n- 获得签到背景[@xxx] | 获得签到背景\n- 签到日历\n- 购买补签卡[数量]\n- 补签[20060102]\n注:连续签到有额外奖励, 补签不加钱, 默认补签最近漏签的一天\n- 设置签到预设(0~3)\n- 查看签到主题\n- 预览签到主题[名称]\n- 设置(本群)签到主题[名称]\n- 重置(本群)签到主题\n注:主题放在 data/score/theme/ 下, 支持json/yaml, 个人主题优先于本群主题\n- 我的群等级[@xxx]\n- 群等级排行\n- 查看等级头衔\n- 开启/关闭群等级\n- 开启/关闭等级头衔\n- 设置等级头衔[等级] [头衔]\n- 删除等级头衔[等级]\n注:开启群等级后, 发言(每分钟至多1次)、签到与游戏胜利可获得经验, 仅管理员可设置\n- 查看等级排名\n注:为跨群排名\n- 查看我的钱包\n- 查看钱包排名\n注:为本群排行，若群人数太多不建议使用该功能!!!",
 		PrivateDataFolder: "score",
 	})
 	styles = []scoredrawer{
@@ -75,26 +78,19 @@ func init() {
 		}
 	}()
 	engine.OnRegex(`^签到\s?(\d*)$`).Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
-		// 选择key
+		// 选择key, 未指定时按 个人主题 > 本群主题 > 签到预设 选择
 		key := ctx.State["regex_matched"].([]string)[1]
-		gid := ctx.Event.GroupID
-		if gid < 0 {
-			// 个人用户设为负数
-			gid = -ctx.Event.UserID
-		}
-		k := uint8(0)
+		var (
+			drawer scoredrawer
+			err    error
+		)
 		if key == "" {
-			k = uint8(ctx.State["manager"].(*ctrl.Control[*zero.Ctx]).GetData(gid))
+			drawer, err = chooseDrawer(ctx)
 		} else {
-			kn, err := strconv.Atoi(key)
-			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return
-			}
-			k = uint8(kn)
+			drawer, err = getDrawer(key)
 		}
-		if int(k) >= len(styles) {
-			ctx.SendChain(message.Text("ERROR: 未找到签到设定: ", key))
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
 			return
 		}
 		uid := ctx.Event.UserID
@@ -122,7 +118,7 @@ func init() {
 			}
 		}
 		// 更新签到次数
-		err := sdb.InsertOrUpdateSignInCountByUID(uid, si.Count+1)
+		err = sdb.InsertOrUpdateSignInCountByUID(uid, si.Count+1)
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return
@@ -138,14 +134,34 @@ func init() {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return
 		}
+		// 记录连续签到
+		err = sdb.AddSignInLog(uid, today, false)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		streak := sdb.GetStreak(uid, time.Now())
+		bonus := streakBonus(streak)
 		// 更新钱包
 		rank := getrank(level)
-		add := 1 + rand.Intn(10) + rank*5 // 等级越高获得的钱越高
-		err = wallet.InsertWalletOf(uid, add)
+		add := 1 + rand.Intn(10) + rank*5 + bonus // 等级越高获得的钱越高
+		err = ledger.Earn(uid, add, "score", 0, "签到")
 		if err != nil {
 			ctx.SendChain(message.Text("ERROR: ", err))
 			return
 		}
+		// 有贷款时按比例自动还款
+		repaid, err := bank.AutoRepay(uid, add)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+		} else if repaid > 0 {
+			ctx.SendChain(message.At(uid), message.Text("签到收入自动偿还贷款", repaid, wallet.GetWalletName()))
+		}
+		if bonus > 0 {
+			ctx.SendChain(message.At(uid), message.Text("已连续签到", streak, "天，额外获得", bonus, wallet.GetWalletName()))
+		}
+		// 群等级经验
+		exp.Award(ctx, uid, signinExp)
 		alldata := &scdata{
 			drawedfile: drawedFile,
 			picfile:    picFile,
@@ -155,8 +171,9 @@ func init() {
 			score:      wallet.GetWalletOf(uid),
 			level:      level,
 			rank:       rank,
+			streak:     streak,
 		}
-		drawimage, err := styles[k](alldata)
+		drawimage, err := drawer(alldata)
 		if err != nil {
 			ctx.SendChain(message.Text("签到成功，但签到图生成失败，请勿重复签到:\n", err))
 			return
@@ -0,0 +1,552 @@
+package score
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/floatbox/web"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/gg/factory"
+	"github.com/FloatTech/gg/fio"
+	ctrl "github.com/FloatTech/zbpctrl"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/disintegration/imaging"
+	log "github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+	"gopkg.in/yaml.v3"
+
+	"github.com/FloatTech/ZeroBot-Plugin/kanban/banner"
+)
+
+// theme 签到主题, 放在 data/score/theme/ 下, 支持 json 与 yaml
+//
+// 坐标为负数时表示距右边/下边的距离, 0~1 之间的小数表示比例, 宽高小于等于 0 时表示拉伸到距边缘 |值| 处;
+// 文字中的 {nickname} {hour} {inc} {score} {wallet} {level} {rank} {next} {streak} {date} {time} {version} 会被替换
+type theme struct {
+	Name       string          `json:"name" yaml:"name"`
+	Width      int             `json:"width" yaml:"width"`   // 画布宽, 为 0 时与背景相同
+	Height     int             `json:"height" yaml:"height"` // 画布高, 为 0 时与背景相同
+	Background themeBackground `json:"background" yaml:"background"`
+	Boxes      []themeBox      `json:"boxes" yaml:"boxes"`
+	Avatar     *themeAvatar    `json:"avatar" yaml:"avatar"`
+	Progress   *themeBox       `json:"progress" yaml:"progress"` // 经验条, fill 为前景, stroke 为底色
+	Texts      []themeText     `json:"texts" yaml:"texts"`
+}
+
+type themeBackground struct {
+	Source string  `json:"source" yaml:"source"` // online(默认) | file | color
+	Path   string  `json:"path" yaml:"path"`     // source 为 file 时相对主题文件夹的图片路径
+	Color  string  `json:"color" yaml:"color"`   // source 为 color 时的颜色
+	Blur   float64 `json:"blur" yaml:"blur"`
+}
+
+type themeBox struct {
+	X         float64 `json:"x" yaml:"x"`
+	Y         float64 `json:"y" yaml:"y"`
+	W         float64 `json:"w" yaml:"w"`
+	H         float64 `json:"h" yaml:"h"`
+	Radius    float64 `json:"radius" yaml:"radius"`
+	Fill      string  `json:"fill" yaml:"fill"`
+	Stroke    string  `json:"stroke" yaml:"stroke"`
+	LineWidth float64 `json:"line_width" yaml:"line_width"`
+	Blur      float64 `json:"blur" yaml:"blur"` // 毛玻璃效果
+}
+
+type themeAvatar struct {
+	X      float64 `json:"x" yaml:"x"`
+	Y      float64 `json:"y" yaml:"y"`
+	Size   int     `json:"size" yaml:"size"`
+	Circle bool    `json:"circle" yaml:"circle"`
+}
+
+type themeText struct {
+	Text   string  `json:"text" yaml:"text"`
+	X      float64 `json:"x" yaml:"x"`
+	Y      float64 `json:"y" yaml:"y"`
+	AX     float64 `json:"ax" yaml:"ax"` // 锚点, 0 左 0.5 中 1 右
+	AY     float64 `json:"ay" yaml:"ay"`
+	Font   string  `json:"font" yaml:"font"` // regular(默认) | bold | maoken | glowsans
+	Size   float64 `json:"size" yaml:"size"`
+	Color  string  `json:"color" yaml:"color"`
+	Shadow string  `json:"shadow" yaml:"shadow"` // 阴影颜色
+}
+
+var themeFonts = map[string]string{
+	"":         text.FontFile,
+	"regular":  text.FontFile,
+	"bold":     text.BoldFontFile,
+	"maoken":   text.MaokenFontFile,
+	"glowsans": text.GlowSansFontFile,
+}
+
+// exampleTheme 首次启动时写入的示例主题
+const exampleTheme = `{
+	"name": "示例",
+	"background": {"source": "online"},
+	"boxes": [
+		{"x": 40, "y": 40, "w": -40, "h": -40, "radius": 16, "fill": "#ffffff8c", "stroke": "#ffffff64", "line_width": 3, "blur": 2.5}
+	],
+	"avatar": {"x": 70, "y": 70, "size": 160, "circle": true},
+	"progress": {"x": 70, "y": -70, "w": -70, "h": 8, "radius": 4, "fill": "#3c8cdc", "stroke": "#00000020"},
+	"texts": [
+		{"text": "{nickname}", "x": 260, "y": 130, "ay": 0.5, "font": "bold", "size": 44, "color": "#000000"},
+		{"text": "{hour}", "x": 260, "y": 190, "ay": 0.5, "size": 28, "color": "#333333"},
+		{"text": "{wallet} + {inc}", "x": 70, "y": 280, "size": 28, "color": "#000000"},
+		{"text": "当前{wallet}: {score}", "x": 70, "y": 330, "size": 28, "color": "#000000"},
+		{"text": "LEVEL {rank}  连续签到 {streak} 天", "x": 70, "y": 380, "size": 28, "color": "#000000"},
+		{"text": "{level}/{next}", "x": 70, "y": -85, "size": 22, "color": "#000000"},
+		{"text": "{date} {time}", "x": -70, "y": -85, "ax": 1, "size": 22, "color": "#000000"},
+		{"text": "Created By Zerobot-Plugin {version}", "x": 0.5, "y": -12, "ax": 0.5, "size": 18, "color": "#ffffff", "shadow": "#000000"}
+	]
+}
+`
+
+func init() {
+	themePath := engine.DataFolder() + "theme/"
+	if file.IsNotExist(themePath) {
+		err := os.MkdirAll(themePath, 0755)
+		if err != nil {
+			panic(err)
+		}
+		err = os.WriteFile(themePath+"示例.json", []byte(exampleTheme), 0644)
+		if err != nil {
+			panic(err)
+		}
+	}
+	engine.OnFullMatch("查看签到主题").SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		var sb strings.Builder
+		sb.WriteString("内置预设: ")
+		for i := range styles {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(strconv.Itoa(i))
+		}
+		sb.WriteString("\n自定义主题: ")
+		names := listThemes()
+		if len(names) == 0 {
+			sb.WriteString("无")
+		}
+		sb.WriteString(strings.Join(names, ", "))
+		if name := sdb.GetThemeChoice(userThemeKey(ctx.Event.UserID)); name != "" {
+			sb.WriteString("\n你的主题: ")
+			sb.WriteString(name)
+		}
+		if ctx.Event.GroupID != 0 {
+			if name := sdb.GetThemeChoice(groupThemeKey(ctx.Event.GroupID)); name != "" {
+				sb.WriteString("\n本群主题: ")
+				sb.WriteString(name)
+			}
+		}
+		ctx.SendChain(message.Text(sb.String()))
+	})
+	engine.OnRegex(`^预览签到主题\s*(\S+)$`).Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		drawer, err := getDrawer(ctx.State["regex_matched"].([]string)[1])
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		uid := ctx.Event.UserID
+		cachePath := engine.DataFolder() + "cache/"
+		today := time.Now().Format("20060102")
+		level := sdb.GetScoreByUID(uid).Score
+		img, err := drawer(&scdata{
+			drawedfile: cachePath + strconv.FormatInt(uid, 10) + today + "preview.png",
+			picfile:    cachePath + strconv.FormatInt(uid, 10) + today + ".png",
+			uid:        uid,
+			nickname:   ctx.CardOrNickName(uid),
+			score:      wallet.GetWalletOf(uid),
+			level:      level,
+			rank:       getrank(level),
+			streak:     sdb.GetStreak(uid, time.Now()),
+		})
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		data, err := factory.ToBytes(img)
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.ImageBytes(data))
+	})
+	engine.OnRegex(`^设置(本群)?签到主题\s*(\S+)$`).Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		matched := ctx.State["regex_matched"].([]string)
+		key := userThemeKey(ctx.Event.UserID)
+		if matched[1] != "" {
+			if ctx.Event.GroupID == 0 || !zero.AdminPermission(ctx) {
+				ctx.SendChain(message.Text("ERROR: 只有群管理员能设置本群签到主题"))
+				return
+			}
+			key = groupThemeKey(ctx.Event.GroupID)
+		}
+		if _, err := getDrawer(matched[2]); err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		err := sdb.SetThemeChoice(key, matched[2])
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Text("设置成功"))
+	})
+	engine.OnRegex(`^重置(本群)?签到主题$`).Limit(ctxext.LimitByUser).SetBlock(true).Handle(func(ctx *zero.Ctx) {
+		key := userThemeKey(ctx.Event.UserID)
+		if ctx.State["regex_matched"].([]string)[1] != "" {
+			if ctx.Event.GroupID == 0 || !zero.AdminPermission(ctx) {
+				ctx.SendChain(message.Text("ERROR: 只有群管理员能重置本群签到主题"))
+				return
+			}
+			key = groupThemeKey(ctx.Event.GroupID)
+		}
+		err := sdb.SetThemeChoice(key, "")
+		if err != nil {
+			ctx.SendChain(message.Text("ERROR: ", err))
+			return
+		}
+		ctx.SendChain(message.Text("已重置"))
+	})
+}
+
+func userThemeKey(uid int64) string {
+	return "user_" + strconv.FormatInt(uid, 10)
+}
+
+func groupThemeKey(gid int64) string {
+	return "group_" + strconv.FormatInt(gid, 10)
+}
+
+// chooseDrawer 按 个人主题 > 本群主题 > 签到预设 的顺序选择
+//
+// 选择的主题被删除或无法加载时记录日志并回退到下一级, 不影响签到
+func chooseDrawer(ctx *zero.Ctx) (scoredrawer, error) {
+	keys := []string{userThemeKey(ctx.Event.UserID)}
+	if ctx.Event.GroupID != 0 {
+		keys = append(keys, groupThemeKey(ctx.Event.GroupID))
+	}
+	for _, key := range keys {
+		name := sdb.GetThemeChoice(key)
+		if name == "" {
+			continue
+		}
+		drawer, err := getDrawer(name)
+		if err == nil {
+			return drawer, nil
+		}
+		log.Warnln("[score] 加载签到主题", name, "失败, 使用下一级设置:", err)
+	}
+	gid := ctx.Event.GroupID
+	if gid == 0 {
+		// 个人用户设为负数
+		gid = -ctx.Event.UserID
+	}
+	drawer, err := getDrawer(strconv.FormatInt(ctx.State["manager"].(*ctrl.Control[*zero.Ctx]).GetData(gid), 10))
+	if err != nil {
+		log.Warnln("[score] 签到预设无效, 使用默认预设:", err)
+		return styles[0], nil
+	}
+	return drawer, nil
+}
+
+// getDrawer 数字为内置预设, 否则为自定义主题
+func getDrawer(name string) (scoredrawer, error) {
+	if k, err := strconv.Atoi(name); err == nil {
+		if k < 0 || k >= len(styles) {
+			return nil, errors.New("未找到签到设定: " + name)
+		}
+		return styles[k], nil
+	}
+	t, err := loadTheme(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.draw, nil
+}
+
+func listThemes() (names []string) {
+	files, err := os.ReadDir(engine.DataFolder() + "theme/")
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(f.Name(), ext))
+	}
+	return
+}
+
+// loadTheme 每次都从文件读取, 修改主题文件后无需重启
+func loadTheme(name string) (*theme, error) {
+	if strings.ContainsAny(name, `/\.`) {
+		return nil, errors.New("非法的主题名: " + name)
+	}
+	themePath := engine.DataFolder() + "theme/"
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		data, err := os.ReadFile(themePath + name + ext)
+		if err != nil {
+			continue
+		}
+		t := &theme{}
+		if ext == ".json" {
+			err = json.Unmarshal(data, t)
+		} else {
+			err = yaml.Unmarshal(data, t)
+		}
+		if err != nil {
+			return nil, errors.New("主题 " + name + " 格式错误: " + err.Error())
+		}
+		return t, t.validate()
+	}
+	return nil, errors.New("未找到签到主题: " + name)
+}
+
+func (t *theme) validate() error {
+	switch t.Background.Source {
+	case "", "online":
+	case "file":
+		if t.Background.Path == "" || strings.Contains(t.Background.Path, "..") {
+			return errors.New("背景图片路径无效")
+		}
+	case "color":
+		if _, err := parseColor(t.Background.Color); err != nil {
+			return err
+		}
+	default:
+		return errors.New("未知的背景来源: " + t.Background.Source)
+	}
+	for _, b := range t.Boxes {
+		if err := b.validate(); err != nil {
+			return err
+		}
+	}
+	if t.Progress != nil {
+		if err := t.Progress.validate(); err != nil {
+			return err
+		}
+	}
+	for _, tx := range t.Texts {
+		if _, ok := themeFonts[tx.Font]; !ok {
+			return errors.New("未知的字体: " + tx.Font)
+		}
+		if tx.Size <= 0 {
+			return errors.New("字号必须大于0: " + tx.Text)
+		}
+		for _, c := range []string{tx.Color, tx.Shadow} {
+			if _, err := parseColor(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *themeBox) validate() error {
+	for _, c := range []string{b.Fill, b.Stroke} {
+		if _, err := parseColor(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseColor 解析 #RRGGBB 或 #RRGGBBAA, 空串为透明
+func parseColor(s string) (color.NRGBA, error) {
+	if s == "" {
+		return color.NRGBA{}, nil
+	}
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 6 {
+		s += "ff"
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if len(s) != 8 || err != nil {
+		return color.NRGBA{}, errors.New("颜色格式错误: #" + s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// pos 负数表示从末端算起, 0~1 之间的小数表示比例
+func pos(v, total float64) float64 {
+	switch {
+	case v < 0:
+		return total + v
+	case v > 0 && v < 1:
+		return total * v
+	}
+	return v
+}
+
+// rect 计算盒子在画布上的位置
+func (b *themeBox) rect(w, h float64) (x, y, bw, bh float64) {
+	x, y = pos(b.X, w), pos(b.Y, h)
+	bw, bh = b.W, b.H
+	if bw <= 0 {
+		bw = w + bw - x
+	}
+	if bh <= 0 {
+		bh = h + bh - y
+	}
+	return
+}
+
+func (t *theme) draw(a *scdata) (image.Image, error) {
+	var (
+		back      image.Image
+		getAvatar []byte
+		err       error
+	)
+	switch t.Background.Source {
+	case "file":
+		back, err = fio.LoadImage(engine.DataFolder() + "theme/" + t.Background.Path)
+	case "color":
+		w, h := t.Width, t.Height
+		if w <= 0 || h <= 0 {
+			w, h = 1280, 720
+		}
+		c, _ := parseColor(t.Background.Color)
+		canvas := gg.NewContext(w, h)
+		canvas.SetColor(c)
+		canvas.Clear()
+		back = canvas.Image()
+	default:
+		getAvatar, err = initPic(a.picfile, a.uid)
+		if err == nil {
+			back, err = fio.LoadImage(a.picfile)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Width > 0 && t.Height > 0 {
+		back = imaging.Fill(back, t.Width, t.Height, imaging.Center, imaging.Lanczos)
+	} else {
+		// 避免图片过大，最大 1280*720
+		back = factory.Limit(back, 1280, 720)
+	}
+	if t.Background.Blur > 0 {
+		back = imaging.Blur(back, t.Background.Blur)
+	}
+	imgDX, imgDY := back.Bounds().Dx(), back.Bounds().Dy()
+	w, h := float64(imgDX), float64(imgDY)
+	canvas := gg.NewContext(imgDX, imgDY)
+	canvas.DrawImage(back, 0, 0)
+
+	// 面板
+	for _, b := range t.Boxes {
+		x, y, bw, bh := b.rect(w, h)
+		if b.Blur > 0 {
+			canvas.DrawRoundedRectangle(x, y, bw, bh, b.Radius)
+			canvas.Clip()
+			canvas.DrawImage(imaging.Blur(back, b.Blur), 0, 0)
+			canvas.ResetClip()
+		}
+		canvas.DrawRoundedRectangle(x, y, bw, bh, b.Radius)
+		if b.Stroke != "" {
+			c, _ := parseColor(b.Stroke)
+			canvas.SetColor(c)
+			canvas.SetLineWidth(b.LineWidth)
+			canvas.StrokePreserve()
+		}
+		c, _ := parseColor(b.Fill)
+		canvas.SetColor(c)
+		canvas.Fill()
+	}
+
+	// 头像
+	if t.Avatar != nil && t.Avatar.Size > 0 {
+		if getAvatar == nil {
+			getAvatar, err = web.GetData("https://q4.qlogo.cn/g?b=qq&nk=" + strconv.FormatInt(a.uid, 10) + "&s=640")
+			if err != nil {
+				return nil, err
+			}
+		}
+		avatar, _, err := image.Decode(bytes.NewReader(getAvatar))
+		if err != nil {
+			return nil, err
+		}
+		avatarf := factory.Size(avatar, t.Avatar.Size, t.Avatar.Size)
+		if t.Avatar.Circle {
+			avatarf = avatarf.Circle(0)
+		}
+		canvas.DrawImage(avatarf.Image(), int(pos(t.Avatar.X, w)), int(pos(t.Avatar.Y, h)))
+	}
+
+	var nextrankScore int
+	if a.rank < 10 {
+		nextrankScore = rankArray[a.rank+1]
+	} else {
+		nextrankScore = SCOREMAX
+	}
+
+	// 经验条
+	if p := t.Progress; p != nil {
+		x, y, bw, bh := p.rect(w, h)
+		c, _ := parseColor(p.Stroke)
+		canvas.SetColor(c)
+		canvas.DrawRoundedRectangle(x, y, bw, bh, p.Radius)
+		canvas.Fill()
+		c, _ = parseColor(p.Fill)
+		canvas.SetColor(c)
+		canvas.DrawRoundedRectangle(x, y, bw*min(float64(a.level)/float64(nextrankScore), 1), bh, p.Radius)
+		canvas.Fill()
+	}
+
+	// 文字
+	now := time.Now()
+	r := strings.NewReplacer(
+		"{nickname}", a.nickname,
+		"{hour}", getHourWord(now),
+		"{inc}", strconv.Itoa(a.inc),
+		"{score}", strconv.Itoa(a.score),
+		"{wallet}", wallet.GetWalletName(),
+		"{level}", strconv.Itoa(a.level),
+		"{rank}", strconv.Itoa(a.rank),
+		"{next}", strconv.Itoa(nextrankScore),
+		"{streak}", strconv.Itoa(a.streak),
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("15:04:05"),
+		"{version}", banner.Version,
+	)
+	for _, tx := range t.Texts {
+		data, err := file.GetLazyData(themeFonts[tx.Font], control.Md5File, true)
+		if err != nil {
+			return nil, err
+		}
+		if err = canvas.ParseFontFace(data, tx.Size); err != nil {
+			return nil, err
+		}
+		s := r.Replace(tx.Text)
+		x, y := pos(tx.X, w), pos(tx.Y, h)
+		if tx.Shadow != "" {
+			c, _ := parseColor(tx.Shadow)
+			canvas.SetColor(c)
+			canvas.DrawStringAnchored(s, x-2, y+1, tx.AX, tx.AY)
+		}
+		if tx.Color == "" {
+			canvas.SetRGB255(0, 0, 0)
+		} else {
+			c, _ := parseColor(tx.Color)
+			canvas.SetColor(c)
+		}
+		canvas.DrawStringAnchored(s, x, y, tx.AX, tx.AY)
+	}
+	return canvas.Image(), nil
+}
@@ -0,0 +1,153 @@
+package wallet
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/bank"
+)
+
+func init() {
+	// 每日结算利息
+	go func() {
+		for {
+			err := bank.Settle(time.Now())
+			if err != nil {
+				logrus.Warnln("[wallet] 银行结算失败:", err)
+			}
+			now := time.Now()
+			time.Sleep(time.Until(time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 5, 0, now.Location())))
+		}
+	}()
+
+	en.OnRegex(`^(存款|取款|贷款|还款)\s*(\d+)$`, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			uid := ctx.Event.UserID
+			amount, err := strconv.Atoi(matched[2])
+			if err != nil || amount <= 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("输入的金额异常"))
+				return
+			}
+			name := wallet.GetWalletName()
+			var msg string
+			switch matched[1] {
+			case "存款":
+				err = bank.Deposit(uid, amount)
+				msg = "成功存入活期" + strconv.Itoa(amount) + name
+			case "取款":
+				err = bank.Withdraw(uid, amount)
+				msg = "成功从活期取出" + strconv.Itoa(amount) + name
+			case "贷款":
+				err = bank.Borrow(uid, amount)
+				msg = "成功贷款" + strconv.Itoa(amount) + name
+			case "还款":
+				var repaid int
+				repaid, err = bank.Repay(uid, amount)
+				if repaid == 0 && err == nil {
+					ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你没有需要偿还的贷款"))
+					return
+				}
+				msg = "成功还款" + strconv.Itoa(repaid) + name
+			}
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("[ERROR]:", matched[1], "失败:", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(msg))
+		})
+
+	en.OnRegex(`^定期存款\s*(\d+)\s+(\d+)天?$`, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			amount, _ := strconv.Atoi(matched[1])
+			days, _ := strconv.Atoi(matched[2])
+			if amount <= 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("输入的金额异常"))
+				return
+			}
+			err := bank.NewTermDeposit(ctx.Event.UserID, amount, days)
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("[ERROR]:定期存款失败:", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("成功存入", days, "天定期", amount, wallet.GetWalletName(), ",到期后本息自动转入活期"))
+		})
+
+	en.OnRegex(`^提前支取\s*#?(\d+)$`, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			principal, err := bank.CancelTermDeposit(ctx.Event.UserID, id)
+			if err != nil {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("[ERROR]:支取失败:", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("已提前支取定期#", id, ",退还本金", principal, wallet.GetWalletName(), ",利息作废"))
+		})
+
+	en.OnFullMatch("查看我的银行").SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			uid := ctx.Event.UserID
+			name := wallet.GetWalletName()
+			deposits, err := bank.GetTermDepositsOf(uid)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString("钱包: ")
+			sb.WriteString(strconv.Itoa(wallet.GetWalletOf(uid)))
+			sb.WriteString(name)
+			sb.WriteString("\n活期: ")
+			sb.WriteString(strconv.Itoa(bank.GetSavingsOf(uid)))
+			sb.WriteString(name)
+			for _, d := range deposits {
+				sb.WriteString("\n定期#")
+				sb.WriteString(strconv.FormatInt(d.ID, 10))
+				sb.WriteString(": 本金")
+				sb.WriteString(strconv.Itoa(d.Money))
+				sb.WriteString(" 利息")
+				sb.WriteString(strconv.Itoa(d.Interest))
+				sb.WriteString(" 到期")
+				sb.WriteString(time.Unix(d.Start, 0).AddDate(0, 0, d.Days).Format("01/02 15:04"))
+			}
+			if l := bank.GetLoanOf(uid); l.Debt > 0 {
+				sb.WriteString("\n贷款: 待还")
+				sb.WriteString(strconv.Itoa(l.Debt))
+				sb.WriteString(name)
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(sb.String()))
+		})
+
+	en.OnFullMatch("查看银行参数").SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			c := bank.GetConfig()
+			ctx.SendChain(message.Text(c.String()))
+		})
+
+	en.OnRegex(`^设置银行参数\s*(\S+?)\s*(\d+)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			value, _ := strconv.Atoi(matched[2])
+			err := bank.SetConfig(matched[1], value)
+			if errors.Is(err, bank.ErrNoSuchConfig) {
+				c := bank.GetConfig()
+				ctx.SendChain(message.Text("没有该参数, 当前参数:\n", c.String()))
+				return
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			ctx.SendChain(message.Text("设置成功"))
+		})
+}
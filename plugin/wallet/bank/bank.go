@@ -0,0 +1,494 @@
+// Package bank 银行: 活期存款、定期存款与贷款
+//
+// 存入银行的钱不在钱包中, 因此不会被打劫
+package bank
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/floatbox/file"
+	sql "github.com/FloatTech/sqlite"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+// Config 银行参数, 利率均为日利率千分比
+type Config struct {
+	ID          int64  `db:"id"`            // 恒为 0
+	DemandRate  int    `db:"demand_rate"`   // 活期利率
+	TermRate    int    `db:"term_rate"`     // 定期利率
+	LoanRate    int    `db:"loan_rate"`     // 贷款利率
+	MaxSavings  int    `db:"max_savings"`   // 活期存款上限
+	MaxTermDays int    `db:"max_term_days"` // 定期最长天数
+	MaxLoan     int    `db:"max_loan"`      // 贷款上限
+	RepayRatio  int    `db:"repay_ratio"`   // 签到收入自动还款比例(百分比)
+	LastSettle  string `db:"last_settle"`   // 上次结算日期
+}
+
+// Savings 活期账户
+type Savings struct {
+	UID   int64 `db:"uid"`
+	Money int   `db:"money"`
+}
+
+// TermDeposit 定期存款
+type TermDeposit struct {
+	ID       int64 `db:"id"`
+	UID      int64 `db:"uid"`
+	Money    int   `db:"money"`    // 本金
+	Rate     int   `db:"rate"`     // 存入时的利率
+	Days     int   `db:"days"`     // 存期
+	Start    int64 `db:"start"`    // 存入时间
+	Interest int   `db:"interest"` // 已累计利息
+}
+
+// Loan 贷款
+type Loan struct {
+	UID  int64 `db:"uid"`
+	Debt int   `db:"debt"` // 待还金额(含利息)
+	Time int64 `db:"time"` // 最近一次借款时间
+}
+
+type count struct {
+	N int64 `db:"n"`
+}
+
+// storage 银行数据库
+type storage struct {
+	sync.Mutex
+	db sql.Sqlite
+}
+
+var (
+	// ErrNotEnough 余额不足
+	ErrNotEnough = errors.New("余额不足")
+	// ErrOverLimit 超出上限
+	ErrOverLimit = errors.New("超出银行上限")
+	// ErrNoSuchDeposit 没有该定期存款
+	ErrNoSuchDeposit = errors.New("没有该定期存款")
+	// ErrNoSuchConfig 没有该参数
+	ErrNoSuchConfig = errors.New("没有该参数")
+
+	bdb = &storage{
+		db: sql.New("data/wallet/bank.db"),
+	}
+
+	defaultConfig = Config{
+		DemandRate:  0,
+		TermRate:    2,
+		LoanRate:    5,
+		MaxSavings:  100000,
+		MaxTermDays: 30,
+		MaxLoan:     5000,
+		RepayRatio:  50,
+	}
+)
+
+func init() {
+	if file.IsNotExist("data/wallet") {
+		err := os.MkdirAll("data/wallet", 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err := bdb.db.Open(time.Hour * 24)
+	if err != nil {
+		panic(err)
+	}
+	err = bdb.db.Create("config", &Config{})
+	if err != nil {
+		panic(err)
+	}
+	err = bdb.db.Create("savings", &Savings{})
+	if err != nil {
+		panic(err)
+	}
+	err = bdb.db.Create("term_deposit", &TermDeposit{})
+	if err != nil {
+		panic(err)
+	}
+	err = bdb.db.Create("loan", &Loan{})
+	if err != nil {
+		panic(err)
+	}
+	if !bdb.db.CanFind("config", "WHERE id = 0") {
+		err = bdb.db.Insert("config", &defaultConfig)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// configNames 参数中文名
+var configNames = []string{"活期利率", "定期利率", "贷款利率", "活期上限", "定期最长天数", "贷款上限", "还款比例"}
+
+// field 按中文名获取参数
+func (c *Config) field(name string) *int {
+	switch name {
+	case "活期利率":
+		return &c.DemandRate
+	case "定期利率":
+		return &c.TermRate
+	case "贷款利率":
+		return &c.LoanRate
+	case "活期上限":
+		return &c.MaxSavings
+	case "定期最长天数":
+		return &c.MaxTermDays
+	case "贷款上限":
+		return &c.MaxLoan
+	case "还款比例":
+		return &c.RepayRatio
+	}
+	return nil
+}
+
+// String 参数列表
+func (c *Config) String() string {
+	var sb strings.Builder
+	for i, name := range configNames {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(name)
+		sb.WriteString(": ")
+		sb.WriteString(strconv.Itoa(*c.field(name)))
+		switch {
+		case strings.HasSuffix(name, "利率"):
+			sb.WriteString("‰/日")
+		case name == "还款比例":
+			sb.WriteString("%")
+		}
+	}
+	return sb.String()
+}
+
+// GetConfig 获取银行参数
+func GetConfig() (c Config) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	return bdb.config()
+}
+
+// SetConfig 按中文名设置银行参数
+func SetConfig(name string, value int) error {
+	if value < 0 {
+		return errors.New("参数不能为负数")
+	}
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.config()
+	f := c.field(name)
+	if f == nil {
+		return ErrNoSuchConfig
+	}
+	*f = value
+	return bdb.db.Insert("config", &c)
+}
+
+// GetSavingsOf 获取活期余额
+func GetSavingsOf(uid int64) int {
+	bdb.Lock()
+	defer bdb.Unlock()
+	return bdb.savings(uid).Money
+}
+
+// Deposit 从钱包存入活期
+func Deposit(uid int64, amount int) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	s := bdb.savings(uid)
+	if s.Money+amount > bdb.config().MaxSavings {
+		return ErrOverLimit
+	}
+	err := ledger.Spend(uid, amount, "bank", 0, "活期存入")
+	if err != nil {
+		if errors.Is(err, ledger.ErrNotEnough) {
+			return ErrNotEnough
+		}
+		return err
+	}
+	s.Money += amount
+	err = bdb.db.Insert("savings", &s)
+	if err != nil {
+		_ = ledger.Earn(uid, amount, "bank", 0, "活期存入失败退回")
+	}
+	return err
+}
+
+// Withdraw 从活期取出到钱包
+func Withdraw(uid int64, amount int) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	s := bdb.savings(uid)
+	if s.Money < amount {
+		return ErrNotEnough
+	}
+	s.Money -= amount
+	err := bdb.db.Insert("savings", &s)
+	if err != nil {
+		return err
+	}
+	err = ledger.Earn(uid, amount, "bank", 0, "活期取出")
+	if err != nil {
+		s.Money += amount
+		_ = bdb.db.Insert("savings", &s)
+	}
+	return err
+}
+
+// NewTermDeposit 从钱包存入定期
+func NewTermDeposit(uid int64, amount, days int) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.config()
+	if days < 1 || days > c.MaxTermDays {
+		return errors.New("存期应在1~" + strconv.Itoa(c.MaxTermDays) + "天之间")
+	}
+	err := ledger.Spend(uid, amount, "bank", 0, "定期存入"+strconv.Itoa(days)+"天")
+	if err != nil {
+		if errors.Is(err, ledger.ErrNotEnough) {
+			return ErrNotEnough
+		}
+		return err
+	}
+	var n count
+	_ = bdb.db.Query("SELECT IFNULL(MAX(id), 0) FROM term_deposit;", &n)
+	err = bdb.db.Insert("term_deposit", &TermDeposit{
+		ID:    n.N + 1,
+		UID:   uid,
+		Money: amount,
+		Rate:  c.TermRate,
+		Days:  days,
+		Start: time.Now().Unix(),
+	})
+	if err != nil {
+		_ = ledger.Earn(uid, amount, "bank", 0, "定期存入失败退回")
+	}
+	return err
+}
+
+// GetTermDepositsOf 获取定期存款列表
+func GetTermDepositsOf(uid int64) (deposits []TermDeposit, err error) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	var d TermDeposit
+	err = bdb.db.FindFor("term_deposit", &d, "WHERE uid = ? ORDER BY id", func() error {
+		deposits = append(deposits, d)
+		return nil
+	}, uid)
+	if errors.Is(err, sql.ErrNullResult) {
+		err = nil
+	}
+	return
+}
+
+// CancelTermDeposit 提前支取定期, 只退还本金
+func CancelTermDeposit(uid, id int64) (principal int, err error) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	var d TermDeposit
+	err = bdb.db.Find("term_deposit", &d, "WHERE id = ? AND uid = ?", id, uid)
+	if err != nil {
+		return 0, ErrNoSuchDeposit
+	}
+	// 先删除定期再退还本金, 避免重复支取, 退还失败时恢复定期
+	err = bdb.db.Del("term_deposit", "WHERE id = ?", id)
+	if err != nil {
+		return
+	}
+	err = ledger.Earn(uid, d.Money, "bank", 0, "定期提前支取#"+strconv.FormatInt(id, 10))
+	if err != nil {
+		_ = bdb.db.Insert("term_deposit", &d)
+		return
+	}
+	return d.Money, nil
+}
+
+// GetLoanOf 获取贷款
+func GetLoanOf(uid int64) Loan {
+	bdb.Lock()
+	defer bdb.Unlock()
+	return bdb.loan(uid)
+}
+
+// Borrow 贷款到钱包
+func Borrow(uid int64, amount int) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	l := bdb.loan(uid)
+	if l.Debt+amount > bdb.config().MaxLoan {
+		return ErrOverLimit
+	}
+	l.Debt += amount
+	l.Time = time.Now().Unix()
+	err := bdb.db.Insert("loan", &l)
+	if err != nil {
+		return err
+	}
+	return ledger.Earn(uid, amount, "bank", 0, "贷款")
+}
+
+// Repay 从钱包还款, 最多还清全部欠款
+func Repay(uid int64, amount int) (repaid int, err error) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	return bdb.repay(uid, amount, "还款")
+}
+
+// AutoRepay 从签到等收入中按还款比例自动还款
+func AutoRepay(uid int64, income int) (repaid int, err error) {
+	bdb.Lock()
+	defer bdb.Unlock()
+	amount := income * bdb.config().RepayRatio / 100
+	if amount <= 0 {
+		return
+	}
+	return bdb.repay(uid, amount, "自动还款")
+}
+
+// Settle 按天结算利息并处理到期的定期存款, 同一天内重复调用无效
+func Settle(now time.Time) error {
+	bdb.Lock()
+	defer bdb.Unlock()
+	c := bdb.config()
+	today := now.Format("2006-01-02")
+	if c.LastSettle == "" {
+		c.LastSettle = today
+		return bdb.db.Insert("config", &c)
+	}
+	last, err := time.ParseInLocation("2006-01-02", c.LastSettle, now.Location())
+	if err != nil {
+		return err
+	}
+	days := int(now.Sub(last).Hours() / 24)
+	if days <= 0 {
+		return nil
+	}
+	for i := 0; i < days; i++ {
+		err = bdb.settleOnce(&c)
+		if err != nil {
+			return err
+		}
+	}
+	// 到期定期转入活期
+	var matured []TermDeposit
+	var d TermDeposit
+	_ = bdb.db.FindFor("term_deposit", &d, "WHERE start + days * 86400 <= ?", func() error {
+		matured = append(matured, d)
+		return nil
+	}, now.Unix())
+	for _, d := range matured {
+		s := bdb.savings(d.UID)
+		s.Money += d.Money + d.Interest
+		err = bdb.db.Insert("savings", &s)
+		if err != nil {
+			return err
+		}
+		err = bdb.db.Del("term_deposit", "WHERE id = ?", d.ID)
+		if err != nil {
+			return err
+		}
+	}
+	c.LastSettle = today
+	return bdb.db.Insert("config", &c)
+}
+
+// settleOnce 结算一天的利息 no lock
+func (s *storage) settleOnce(c *Config) error {
+	if c.DemandRate > 0 {
+		var sv Savings
+		var all []Savings
+		_ = s.db.FindFor("savings", &sv, "WHERE money > 0", func() error {
+			all = append(all, sv)
+			return nil
+		})
+		for _, sv := range all {
+			sv.Money += sv.Money * c.DemandRate / 1000
+			err := s.db.Insert("savings", &sv)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	var d TermDeposit
+	var deposits []TermDeposit
+	_ = s.db.FindFor("term_deposit", &d, "WHERE rate > 0", func() error {
+		deposits = append(deposits, d)
+		return nil
+	})
+	for _, d := range deposits {
+		d.Interest += d.Money * d.Rate / 1000
+		err := s.db.Insert("term_deposit", &d)
+		if err != nil {
+			return err
+		}
+	}
+	if c.LoanRate > 0 {
+		var l Loan
+		var loans []Loan
+		_ = s.db.FindFor("loan", &l, "WHERE debt > 0", func() error {
+			loans = append(loans, l)
+			return nil
+		})
+		for _, l := range loans {
+			// 利息向上取整, 避免小额贷款永不计息
+			l.Debt += (l.Debt*c.LoanRate + 999) / 1000
+			err := s.db.Insert("loan", &l)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// repay 还款 no lock
+func (s *storage) repay(uid int64, amount int, reason string) (repaid int, err error) {
+	l := s.loan(uid)
+	if l.Debt <= 0 {
+		return
+	}
+	repaid = amount
+	if repaid > l.Debt {
+		repaid = l.Debt
+	}
+	err = ledger.Spend(uid, repaid, "bank", 0, reason)
+	if err != nil {
+		if errors.Is(err, ledger.ErrNotEnough) {
+			err = ErrNotEnough
+		}
+		return 0, err
+	}
+	l.Debt -= repaid
+	if l.Debt == 0 {
+		return repaid, s.db.Del("loan", "WHERE uid = ?", uid)
+	}
+	return repaid, s.db.Insert("loan", &l)
+}
+
+// config 获取参数 no lock
+func (s *storage) config() (c Config) {
+	c = defaultConfig
+	_ = s.db.Find("config", &c, "WHERE id = 0")
+	return
+}
+
+// savings 获取活期 no lock
+func (s *storage) savings(uid int64) (sv Savings) {
+	sv.UID = uid
+	_ = s.db.Find("savings", &sv, "WHERE uid = ?", uid)
+	return
+}
+
+// loan 获取贷款 no lock
+func (s *storage) loan(uid int64) (l Loan) {
+	l.UID = uid
+	_ = s.db.Find("loan", &l, "WHERE uid = ?", uid)
+	return
+}
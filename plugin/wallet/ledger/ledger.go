@@ -0,0 +1,435 @@
+// Package ledger 钱包流水
+//
+// 所有插件对钱包余额的改动都应经由本包进行,
+// 以便记录来源插件、交易对象、原因与时间, 并支持冲正.
+// 入账用 Earn, 扣款用 Spend(余额不足时失败) 或 Deduct(扣至 0 为止),
+// 其它包内部直接改动余额的调用(如 niu.Sell)用 Track 包裹.
+package ledger
+
+import (
+	stdsql "database/sql"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/floatbox/file"
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	table         = "ledger"
+	snapshotTable = "snapshot"
+	// walletPath walletTable 与 wallet 包使用的数据库一致
+	walletPath  = "data/wallet/wallet.db"
+	walletTable = "storage"
+)
+
+// Record 一条流水
+type Record struct {
+	ID           int64  `db:"id"`           // 流水号
+	UID          int64  `db:"uid"`          // 钱包所有者
+	Amount       int    `db:"amount"`       // 实际变动金额
+	Balance      int    `db:"balance"`      // 变动后余额
+	Source       string `db:"source"`       // 来源插件
+	Counterparty int64  `db:"counterparty"` // 交易对象, 0 为系统
+	Reason       string `db:"reason"`       // 原因
+	Time         int64  `db:"time"`         // 时间戳
+	Reversal     int64  `db:"reversal"`     // 冲正关联的流水号, 0 为无
+}
+
+// Snapshot 每日余额快照, 记录当天最后一次变动后的余额, 没有变动的日子由 SnapshotAll 补全
+type Snapshot struct {
+	Key     string `db:"key"` // uid_date
+	UID     int64  `db:"uid"`
+	Date    int    `db:"date"` // 形如 20060102
+	Balance int    `db:"balance"`
+}
+
+// Gain 一段时间内的余额变化
+type Gain struct {
+	UID    int64
+	Before int // 期初余额
+	After  int // 期末余额
+}
+
+type user struct {
+	UID int64 `db:"uid"`
+}
+
+type maxID struct {
+	ID int64 `db:"id"`
+}
+
+// storage 流水数据库
+type storage struct {
+	sync.Mutex
+	db     sql.Sqlite
+	wallet *stdsql.DB // 钱包数据库, 只用于读取所有钱包生成快照, 写入一律经由 wallet 包
+}
+
+var (
+	// ErrNotEnough 余额不足
+	ErrNotEnough = errors.New("余额不足")
+	// ErrReversed 流水已被冲正
+	ErrReversed = errors.New("该流水已被冲正")
+	// ErrAmount 金额不是正数
+	ErrAmount = errors.New("金额必须大于 0")
+
+	ldb = &storage{
+		db: sql.New("data/wallet/ledger.db"),
+	}
+)
+
+func init() {
+	if file.IsNotExist("data/wallet") {
+		err := os.MkdirAll("data/wallet", 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+	err := ldb.db.Open(time.Hour * 24)
+	if err != nil {
+		panic(err)
+	}
+	err = ldb.db.Create(table, &Record{})
+	if err != nil {
+		panic(err)
+	}
+	err = ldb.db.Create(snapshotTable, &Snapshot{})
+	if err != nil {
+		panic(err)
+	}
+	ldb.wallet, err = stdsql.Open(sql.DriverName, walletPath)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Earn 向钱包存入 amount 并记录流水, amount 为 0 时什么也不做
+func Earn(uid int64, amount int, source string, counterparty int64, reason string) error {
+	if amount < 0 {
+		return ErrAmount
+	}
+	if amount == 0 {
+		return nil
+	}
+	ldb.Lock()
+	defer ldb.Unlock()
+	_, err := ldb.insert(uid, amount, source, counterparty, reason, 0)
+	return err
+}
+
+// Deduct 从钱包扣除 amount 并记录流水, 余额不足时扣至 0 为止, 用于罚款等强制扣款
+func Deduct(uid int64, amount int, source string, counterparty int64, reason string) error {
+	if amount < 0 {
+		return ErrAmount
+	}
+	if amount == 0 {
+		return nil
+	}
+	ldb.Lock()
+	defer ldb.Unlock()
+	_, err := ldb.insert(uid, -amount, source, counterparty, reason, 0)
+	return err
+}
+
+// Spend 从钱包扣除 amount, 余额不足时不扣款并返回 ErrNotEnough
+func Spend(uid int64, amount int, source string, counterparty int64, reason string) error {
+	if amount <= 0 {
+		return ErrAmount
+	}
+	ldb.Lock()
+	defer ldb.Unlock()
+	if amount > wallet.GetWalletOf(uid) {
+		return ErrNotEnough
+	}
+	_, err := ldb.insert(uid, -amount, source, counterparty, reason, 0)
+	return err
+}
+
+// Track 执行会直接改动 uid 钱包的 f, 并记录 f 前后的余额变动
+//
+// 用于无法改为经由本包的外部调用, 如 AnimeAPI 中 niu 包的出售与拍卖
+func Track(uid int64, source string, counterparty int64, reason string, f func() error) error {
+	ldb.Lock()
+	defer ldb.Unlock()
+	before := wallet.GetWalletOf(uid)
+	err := f()
+	if after := wallet.GetWalletOf(uid); after != before {
+		if _, rerr := ldb.record(uid, before, after, source, counterparty, reason, 0); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+	}
+	return err
+}
+
+// Transfer 从 from 向 to 转账 amount, 扣款与入账要么都成功要么都不生效
+func Transfer(from, to int64, amount int, source, reason string) error {
+	ldb.Lock()
+	defer ldb.Unlock()
+	return ldb.transfer(from, to, amount, source, reason)
+}
+
+// GetRecordsOf 分页获取流水, page 从 1 开始, 按时间由新到旧
+func GetRecordsOf(uid int64, page, size int) (records []Record, err error) {
+	ldb.Lock()
+	defer ldb.Unlock()
+	if page < 1 {
+		page = 1
+	}
+	var r Record
+	err = ldb.db.FindFor(table, &r, "WHERE uid = ? ORDER BY id DESC LIMIT ? OFFSET ?", func() error {
+		records = append(records, r)
+		return nil
+	}, uid, size, (page-1)*size)
+	if errors.Is(err, sql.ErrNullResult) {
+		err = nil
+	}
+	return
+}
+
+// CountRecordsOf 获取流水总数
+func CountRecordsOf(uid int64) (n int) {
+	ldb.Lock()
+	defer ldb.Unlock()
+	var c maxID
+	_ = ldb.db.Query("SELECT COUNT(1) FROM "+table+" WHERE uid = ?;", &c, uid)
+	return int(c.ID)
+}
+
+// GetRecord 按流水号获取流水
+func GetRecord(id int64) (r Record, err error) {
+	ldb.Lock()
+	defer ldb.Unlock()
+	err = ldb.db.Find(table, &r, "WHERE id = ?", id)
+	return
+}
+
+// Reverse 冲正一条流水, 返回新生成的冲正流水
+//
+// 冲正按原金额反向改动余额, 余额不足时扣至 0 为止
+func Reverse(id int64, operator int64) (r Record, err error) {
+	ldb.Lock()
+	defer ldb.Unlock()
+	var origin Record
+	err = ldb.db.Find(table, &origin, "WHERE id = ?", id)
+	if err != nil {
+		return
+	}
+	if origin.Reversal != 0 {
+		err = ErrReversed
+		return
+	}
+	r, err = ldb.insert(origin.UID, -origin.Amount, "wallet", operator, "冲正#"+strconv.FormatInt(id, 10), id)
+	if err != nil {
+		return
+	}
+	origin.Reversal = r.ID
+	err = ldb.db.Insert(table, &origin)
+	return
+}
+
+// insert 改动余额并写流水 no lock
+func (s *storage) insert(uid int64, money int, source string, counterparty int64, reason string, reversal int64) (r Record, err error) {
+	before := wallet.GetWalletOf(uid)
+	err = wallet.InsertWalletOf(uid, money)
+	if err != nil {
+		return
+	}
+	after := wallet.GetWalletOf(uid)
+	if after == before && reversal == 0 {
+		// 未产生实际变动(如余额已为 0 时扣款), 无需记录
+		return
+	}
+	return s.record(uid, before, after, source, counterparty, reason, reversal)
+}
+
+// record 写入已发生的余额变动 no lock
+func (s *storage) record(uid int64, before, after int, source string, counterparty int64, reason string, reversal int64) (r Record, err error) {
+	var m maxID
+	_ = s.db.Query("SELECT IFNULL(MAX(id), 0) FROM "+table+";", &m)
+	r = Record{
+		ID:           m.ID + 1,
+		UID:          uid,
+		Amount:       after - before,
+		Balance:      after,
+		Source:       source,
+		Counterparty: counterparty,
+		Reason:       reason,
+		Time:         time.Now().Unix(),
+		Reversal:     reversal,
+	}
+	err = s.db.Insert(table, &r)
+	if err != nil {
+		return
+	}
+	err = s.snapshot(uid, before, after)
+	return
+}
+
+// snapshot 更新当天余额快照 no lock
+func (s *storage) snapshot(uid int64, before, after int) error {
+	now := time.Now()
+	if !s.db.CanFind(snapshotTable, "WHERE uid = ?", uid) {
+		// 首次记录时补上前一天的余额作为期初
+		err := s.db.Insert(snapshotTable, newSnapshot(uid, now.AddDate(0, 0, -1), before))
+		if err != nil {
+			return err
+		}
+	}
+	return s.db.Insert(snapshotTable, newSnapshot(uid, now, after))
+}
+
+func newSnapshot(uid int64, t time.Time, balance int) *Snapshot {
+	date := DateOf(t)
+	return &Snapshot{
+		Key:     strconv.FormatInt(uid, 10) + "_" + strconv.Itoa(date),
+		UID:     uid,
+		Date:    date,
+		Balance: balance,
+	}
+}
+
+// SnapshotAll 为所有钱包记录 t 当天的余额快照, 使余额没有变动的用户也有每日记录
+func SnapshotAll(t time.Time) error {
+	ldb.Lock()
+	defer ldb.Unlock()
+	rows, err := ldb.wallet.Query("SELECT UID, Money FROM " + walletTable + ";")
+	if err != nil {
+		return err
+	}
+	var snapshots []*Snapshot
+	for rows.Next() {
+		var (
+			uid     int64
+			balance int
+		)
+		if err = rows.Scan(&uid, &balance); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		snapshots = append(snapshots, newSnapshot(uid, t, balance))
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, sn := range snapshots {
+		if !ldb.db.CanFind(snapshotTable, "WHERE uid = ?", sn.UID) {
+			// 首次记录时以同样的余额作为前一天的期初, 避免整个余额被计为涨幅
+			err = ldb.db.Insert(snapshotTable, newSnapshot(sn.UID, t.AddDate(0, 0, -1), sn.Balance))
+			if err != nil {
+				return err
+			}
+		}
+		if err = ldb.db.Insert(snapshotTable, sn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DateOf 将时间转换为快照日期
+func DateOf(t time.Time) int {
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+// GetSnapshotsOf 获取 since 当天及以后的余额快照, 按日期升序
+//
+// 结果的第一项为 since 之前最近的一次快照(若有), 作为期初余额
+func GetSnapshotsOf(uid int64, since time.Time) (snapshots []Snapshot, err error) {
+	ldb.Lock()
+	defer ldb.Unlock()
+	date := DateOf(since)
+	var sn Snapshot
+	if ldb.db.Find(snapshotTable, &sn, "WHERE uid = ? AND date < ? ORDER BY date DESC", uid, date) == nil {
+		snapshots = append(snapshots, sn)
+	}
+	err = ldb.db.FindFor(snapshotTable, &sn, "WHERE uid = ? AND date >= ? ORDER BY date", func() error {
+		snapshots = append(snapshots, sn)
+		return nil
+	}, uid, date)
+	if errors.Is(err, sql.ErrNullResult) {
+		err = nil
+	}
+	return
+}
+
+// GetAllUsers 获取所有有快照的用户
+func GetAllUsers() (uids []int64, err error) {
+	ldb.Lock()
+	defer ldb.Unlock()
+	var u user
+	err = ldb.db.QueryFor("SELECT DISTINCT uid FROM "+snapshotTable+";", &u, func() error {
+		uids = append(uids, u.UID)
+		return nil
+	})
+	if errors.Is(err, sql.ErrNullResult) {
+		err = nil
+	}
+	return
+}
+
+// GetGainsOf 获取 since 至今的余额变化, 按涨幅由高到低排序
+//
+// uids 为空时统计所有有快照的用户
+func GetGainsOf(since time.Time, uids ...int64) (gains []Gain, err error) {
+	ldb.Lock()
+	defer ldb.Unlock()
+	date := DateOf(since)
+	q := "SELECT uid, " +
+		"IFNULL((SELECT balance FROM " + snapshotTable + " b WHERE b.uid = a.uid AND b.date < ? ORDER BY b.date DESC LIMIT 1), 0), " +
+		"(SELECT balance FROM " + snapshotTable + " c WHERE c.uid = a.uid ORDER BY c.date DESC LIMIT 1) " +
+		"FROM (SELECT DISTINCT uid FROM " + snapshotTable + " WHERE date >= ?"
+	args := []any{date, date}
+	if len(uids) > 0 {
+		cond, sl := sql.QuerySet(" AND uid", "IN", uids)
+		q += cond
+		args = append(args, sl...)
+	}
+	q += ") a;"
+	var g Gain
+	err = ldb.db.QueryFor(q, &g, func() error {
+		gains = append(gains, g)
+		return nil
+	}, args...)
+	if errors.Is(err, sql.ErrNullResult) {
+		err = nil
+	}
+	sort.SliceStable(gains, func(i, j int) bool {
+		return gains[i].After-gains[i].Before > gains[j].After-gains[j].Before
+	})
+	return
+}
+
+// transfer 转账 no lock
+//
+// 扣款与入账都经由 wallet 包完成, 入账失败时退回扣款, 之后再写流水
+func (s *storage) transfer(from, to int64, amount int, source, reason string) error {
+	if amount <= 0 {
+		return ErrAmount
+	}
+	fromBefore, toBefore := wallet.GetWalletOf(from), wallet.GetWalletOf(to)
+	if amount > fromBefore {
+		return ErrNotEnough
+	}
+	if err := wallet.InsertWalletOf(from, -amount); err != nil {
+		return err
+	}
+	if err := wallet.InsertWalletOf(to, amount); err != nil {
+		if rerr := wallet.InsertWalletOf(from, amount); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	_, err := s.record(from, fromBefore, wallet.GetWalletOf(from), source, to, reason, 0)
+	if err != nil {
+		return err
+	}
+	_, err = s.record(to, toBefore, wallet.GetWalletOf(to), source, from, reason, 0)
+	return err
+}
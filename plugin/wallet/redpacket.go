@@ -0,0 +1,445 @@
+package wallet
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	sql "github.com/FloatTech/sqlite"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/sirupsen/logrus"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+// redPacketTimeout 红包过期时间, 过期后剩余金额退回
+const redPacketTimeout = time.Hour * 24
+
+// redPacket 红包
+type redPacket struct {
+	ID       int64  `db:"id"`
+	SelfID   int64  `db:"self_id"`  // 发红包时所在的bot
+	GID      int64  `db:"gid"`      // 群号
+	UID      int64  `db:"uid"`      // 发送者
+	Total    int    `db:"total"`    // 总额
+	Count    int    `db:"count"`    // 个数
+	Random   bool   `db:"random"`   // 是否拼手气
+	Password string `db:"password"` // 口令, 用“口令 xxx”领取, 为空则用“抢红包”领取
+	Shares   string `db:"shares"`   // 剩余的份额, 逗号分隔
+	Expire   int64  `db:"expire"`   // 过期时间
+	Done     bool   `db:"done"`     // 已领完或已退回
+}
+
+// redPacketClaim 领取记录
+type redPacketClaim struct {
+	Key      string `db:"key"` // packetid_uid
+	PacketID int64  `db:"packet_id"`
+	UID      int64  `db:"uid"`
+	Amount   int    `db:"amount"`
+	Time     int64  `db:"time"`
+}
+
+type maxRedPacketID struct {
+	ID int64 `db:"id"`
+}
+
+// redPacketDB 红包数据库
+type redPacketDB struct {
+	sync.Mutex
+	db sql.Sqlite
+	// passwords 群号 -> 口令 -> 红包ID
+	passwords map[int64]map[string]int64
+}
+
+var (
+	errRedPacketClaimed = errors.New("你已经领过这个红包了")
+	errRedPacketEmpty   = errors.New("红包已经被抢光了")
+)
+
+func init() {
+	rdb := &redPacketDB{
+		db:        sql.New(en.DataFolder() + "redpacket.db"),
+		passwords: make(map[int64]map[string]int64),
+	}
+	err := rdb.db.Open(time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	err = rdb.db.Create("packet", &redPacket{})
+	if err != nil {
+		panic(err)
+	}
+	err = rdb.db.Create("claim", &redPacketClaim{})
+	if err != nil {
+		panic(err)
+	}
+	rdb.loadPasswords()
+
+	// 定时退回过期红包
+	go func() {
+		for range time.NewTicker(time.Minute).C {
+			rdb.refundExpired()
+		}
+	}()
+
+	en.OnRegex(`^发(均分)?红包\s*(\d+)\s+(\d+)\s*(.*)$`, zero.OnlyGroup, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			total, _ := strconv.Atoi(matched[2])
+			count, _ := strconv.Atoi(matched[3])
+			password := strings.TrimSpace(matched[4])
+			if count <= 0 || count > 100 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("红包个数应在1~100之间"))
+				return
+			}
+			if total < count {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("每个红包至少1", wallet.GetWalletName()))
+				return
+			}
+			p, err := rdb.send(ctx, total, count, matched[1] == "", password)
+			if errors.Is(err, ledger.ErrNotEnough) {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("钱包余额不足，发红包失败"))
+				return
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:发红包失败:\n", err))
+				return
+			}
+			how := "发送“抢红包”"
+			if p.Password != "" {
+				how = "发送“口令 " + p.Password + "”"
+			}
+			ctx.SendChain(message.At(p.UID), message.Text("发了一个", p.Total, wallet.GetWalletName(), "的红包，共", p.Count, "个，", how, "即可领取！"))
+		})
+
+	en.OnFullMatch("抢红包", zero.OnlyGroup, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, ok := rdb.latestWithoutPassword(ctx.Event.GroupID, ctx.Event.UserID)
+			if !ok {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("现在没有可以抢的红包"))
+				return
+			}
+			rdb.handleClaim(ctx, id)
+		})
+
+	// 口令需要加前缀, 避免口令与其它指令相同时抢走指令
+	en.OnRegex(`^口令\s*(.+)$`, zero.OnlyGroup, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			password := strings.TrimSpace(ctx.State["regex_matched"].([]string)[1])
+			id, ok := rdb.matchPassword(ctx.Event.GroupID, password)
+			if !ok {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("没有这个口令的红包"))
+				return
+			}
+			rdb.handleClaim(ctx, id)
+		})
+}
+
+// splitRedPacket 拆分红包, 拼手气采用二倍均值法
+func splitRedPacket(total, count int, random bool) []int {
+	shares := make([]int, count)
+	if !random {
+		for i := range shares {
+			shares[i] = total / count
+		}
+		// 除不尽的部分给最后一个
+		shares[count-1] += total % count
+		return shares
+	}
+	remain := total
+	for i := 0; i < count-1; i++ {
+		left := count - i
+		limit := remain / left * 2
+		if limit <= 1 {
+			shares[i] = 1
+		} else {
+			shares[i] = 1 + rand.Intn(limit-1)
+		}
+		remain -= shares[i]
+	}
+	shares[count-1] = remain
+	rand.Shuffle(count, func(i, j int) {
+		shares[i], shares[j] = shares[j], shares[i]
+	})
+	return shares
+}
+
+func joinShares(shares []int) string {
+	s := make([]string, len(shares))
+	for i, v := range shares {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ",")
+}
+
+func parseShares(s string) (shares []int) {
+	if s == "" {
+		return
+	}
+	for _, v := range strings.Split(s, ",") {
+		n, _ := strconv.Atoi(v)
+		shares = append(shares, n)
+	}
+	return
+}
+
+// loadPasswords 加载未领完的口令红包
+func (rdb *redPacketDB) loadPasswords() {
+	rdb.Lock()
+	defer rdb.Unlock()
+	var p redPacket
+	_ = rdb.db.FindFor("packet", &p, "WHERE done = 0 AND password != ''", func() error {
+		rdb.addPassword(p.GID, p.Password, p.ID)
+		return nil
+	})
+}
+
+// addPassword no lock
+func (rdb *redPacketDB) addPassword(gid int64, password string, id int64) {
+	m, ok := rdb.passwords[gid]
+	if !ok {
+		m = make(map[string]int64)
+		rdb.passwords[gid] = m
+	}
+	m[password] = id
+}
+
+// delPassword no lock
+func (rdb *redPacketDB) delPassword(gid int64, password string) {
+	if m, ok := rdb.passwords[gid]; ok {
+		delete(m, password)
+		if len(m) == 0 {
+			delete(rdb.passwords, gid)
+		}
+	}
+}
+
+func (rdb *redPacketDB) matchPassword(gid int64, msg string) (id int64, ok bool) {
+	if msg == "" {
+		return
+	}
+	rdb.Lock()
+	defer rdb.Unlock()
+	id, ok = rdb.passwords[gid][msg]
+	return
+}
+
+// latestWithoutPassword 获取用户还未领取的最新无口令红包
+func (rdb *redPacketDB) latestWithoutPassword(gid, uid int64) (id int64, ok bool) {
+	rdb.Lock()
+	defer rdb.Unlock()
+	var p redPacket
+	err := rdb.db.Find("packet", &p,
+		"WHERE gid = ? AND done = 0 AND password = '' AND id NOT IN (SELECT packet_id FROM claim WHERE uid = ?) ORDER BY id DESC", gid, uid)
+	if err != nil {
+		return 0, false
+	}
+	return p.ID, true
+}
+
+// send 发红包
+func (rdb *redPacketDB) send(ctx *zero.Ctx, total, count int, random bool, password string) (p redPacket, err error) {
+	rdb.Lock()
+	defer rdb.Unlock()
+	if password != "" {
+		if _, ok := rdb.passwords[ctx.Event.GroupID][password]; ok {
+			return p, errors.New("本群已有相同口令的红包")
+		}
+	}
+	var m maxRedPacketID
+	_ = rdb.db.Query("SELECT IFNULL(MAX(id), 0) FROM packet;", &m)
+	p = redPacket{
+		ID:       m.ID + 1,
+		SelfID:   ctx.Event.SelfID,
+		GID:      ctx.Event.GroupID,
+		UID:      ctx.Event.UserID,
+		Total:    total,
+		Count:    count,
+		Random:   random,
+		Password: password,
+		Shares:   joinShares(splitRedPacket(total, count, random)),
+		Expire:   time.Now().Add(redPacketTimeout).Unix(),
+	}
+	err = ledger.Spend(p.UID, total, "wallet", 0, "发红包#"+strconv.FormatInt(p.ID, 10))
+	if err != nil {
+		return
+	}
+	err = rdb.db.Insert("packet", &p)
+	if err != nil {
+		_ = ledger.Earn(p.UID, total, "wallet", 0, "红包退款#"+strconv.FormatInt(p.ID, 10))
+		return
+	}
+	if password != "" {
+		rdb.addPassword(p.GID, password, p.ID)
+	}
+	return
+}
+
+// claim 领取红包, 返回领取金额与领完后的红包
+func (rdb *redPacketDB) claim(id, uid int64) (amount int, p redPacket, err error) {
+	rdb.Lock()
+	defer rdb.Unlock()
+	err = rdb.db.Find("packet", &p, "WHERE id = ?", id)
+	if err != nil {
+		return
+	}
+	if p.Done {
+		err = errRedPacketEmpty
+		return
+	}
+	key := strconv.FormatInt(id, 10) + "_" + strconv.FormatInt(uid, 10)
+	if rdb.db.CanFind("claim", "WHERE key = ?", key) {
+		err = errRedPacketClaimed
+		return
+	}
+	shares := parseShares(p.Shares)
+	if len(shares) == 0 {
+		err = errRedPacketEmpty
+		return
+	}
+	// 按拆分顺序依次领取
+	amount = shares[0]
+	p.Shares = joinShares(shares[1:])
+	p.Done = len(shares) == 1
+	err = rdb.db.Insert("claim", &redPacketClaim{
+		Key:      key,
+		PacketID: id,
+		UID:      uid,
+		Amount:   amount,
+		Time:     time.Now().Unix(),
+	})
+	if err != nil {
+		return
+	}
+	err = rdb.db.Insert("packet", &p)
+	if err != nil {
+		_ = rdb.db.Del("claim", "WHERE key = ?", key)
+		return
+	}
+	if p.Done && p.Password != "" {
+		rdb.delPassword(p.GID, p.Password)
+	}
+	err = ledger.Earn(uid, amount, "wallet", p.UID, "抢红包#"+strconv.FormatInt(id, 10))
+	return
+}
+
+// claims 获取红包领取记录, 按金额由高到低排序
+func (rdb *redPacketDB) claims(id int64) (claims []redPacketClaim) {
+	rdb.Lock()
+	defer rdb.Unlock()
+	var c redPacketClaim
+	_ = rdb.db.FindFor("claim", &c, "WHERE packet_id = ?", func() error {
+		claims = append(claims, c)
+		return nil
+	}, id)
+	sort.SliceStable(claims, func(i, j int) bool {
+		return claims[i].Amount > claims[j].Amount
+	})
+	return
+}
+
+func (rdb *redPacketDB) handleClaim(ctx *zero.Ctx, id int64) {
+	uid := ctx.Event.UserID
+	amount, p, err := rdb.claim(id, uid)
+	switch {
+	case errors.Is(err, errRedPacketClaimed), errors.Is(err, errRedPacketEmpty):
+		ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text(err))
+		return
+	case err != nil:
+		ctx.SendChain(message.Text("[ERROR]:领取红包失败:\n", err))
+		return
+	}
+	ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("你抢到了", ctx.CardOrNickName(p.UID), "的红包，获得", amount, wallet.GetWalletName()))
+	if p.Done {
+		ctx.SendChain(message.Text(rdb.leaderboard(ctx, &p)))
+	}
+}
+
+// memberName 群员的群名片或昵称
+//
+// 过期退款时的 ctx 来自 zero.GetBot, 没有 Event, 不能使用 ctx.CardOrNickName
+func memberName(ctx *zero.Ctx, gid, uid int64) string {
+	info := ctx.GetGroupMemberInfo(gid, uid, false)
+	if name := info.Get("card").String(); name != "" {
+		return name
+	}
+	if name := info.Get("nickname").String(); name != "" {
+		return name
+	}
+	return strconv.FormatInt(uid, 10)
+}
+
+// leaderboard 红包领取排行
+func (rdb *redPacketDB) leaderboard(ctx *zero.Ctx, p *redPacket) string {
+	claims := rdb.claims(p.ID)
+	var sb strings.Builder
+	sb.WriteString(memberName(ctx, p.GID, p.UID))
+	sb.WriteString("的红包")
+	if p.Done && len(claims) == p.Count {
+		sb.WriteString("已被抢光")
+	} else {
+		sb.WriteString("已过期")
+	}
+	sb.WriteString("，领取情况：")
+	for i, c := range claims {
+		sb.WriteString("\n")
+		sb.WriteString(memberName(ctx, p.GID, c.UID))
+		sb.WriteString(": ")
+		sb.WriteString(strconv.Itoa(c.Amount))
+		if i == 0 && p.Random && len(claims) > 1 {
+			sb.WriteString(" [手气最佳]")
+		}
+	}
+	return sb.String()
+}
+
+// refundExpired 退回过期红包的剩余金额
+func (rdb *redPacketDB) refundExpired() {
+	rdb.Lock()
+	var expired []redPacket
+	var p redPacket
+	_ = rdb.db.FindFor("packet", &p, "WHERE done = 0 AND expire <= ?", func() error {
+		expired = append(expired, p)
+		return nil
+	}, time.Now().Unix())
+	for i := range expired {
+		p := &expired[i]
+		remain := 0
+		for _, v := range parseShares(p.Shares) {
+			remain += v
+		}
+		p.Shares = ""
+		p.Done = true
+		err := rdb.db.Insert("packet", p)
+		if err != nil {
+			logrus.Warnln("[wallet] 红包过期处理失败:", err)
+			continue
+		}
+		if p.Password != "" {
+			rdb.delPassword(p.GID, p.Password)
+		}
+		if remain > 0 {
+			err = ledger.Earn(p.UID, remain, "wallet", 0, "红包退款#"+strconv.FormatInt(p.ID, 10))
+			if err != nil {
+				logrus.Warnln("[wallet] 红包退款失败:", err)
+			}
+		}
+	}
+	rdb.Unlock()
+	for i := range expired {
+		p := &expired[i]
+		ctx := zero.GetBot(p.SelfID)
+		if ctx == nil {
+			continue
+		}
+		ctx.SendGroupMessage(p.GID, message.Text(rdb.leaderboard(ctx, p), "\n剩余金额已退回"))
+	}
+}
@@ -0,0 +1,229 @@
+package wallet
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/FloatTech/AnimeAPI/wallet"
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/FloatTech/zbputils/img/text"
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"github.com/sirupsen/logrus"
+	"github.com/wcharczuk/go-chart/v2"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
+)
+
+// maxTrendDays 走势最多查看的天数
+const maxTrendDays = 90
+
+func init() {
+	// 每日为所有钱包记录快照
+	go func() {
+		for {
+			err := ledger.SnapshotAll(time.Now())
+			if err != nil {
+				logrus.Warnln("[wallet] 记录余额快照失败:", err)
+			}
+			now := time.Now()
+			time.Sleep(time.Until(time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 5, 0, now.Location())))
+		}
+	}()
+
+	en.OnRegex(`^钱包走势\s*(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\])?\s*(\d+)?天?$`).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			uid := ctx.Event.UserID
+			if matched[2] != "" {
+				uid, _ = strconv.ParseInt(matched[2], 10, 64)
+			}
+			days := 7
+			if matched[3] != "" {
+				days, _ = strconv.Atoi(matched[3])
+			}
+			if days < 2 || days > maxTrendDays {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("天数应在2~", maxTrendDays, "之间"))
+				return
+			}
+			now := time.Now()
+			since := now.AddDate(0, 0, 1-days)
+			snapshots, err := ledger.GetSnapshotsOf(uid, since)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(snapshots) == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("还没有任何余额记录"))
+				return
+			}
+			// 没有变动的日子沿用前一天的余额
+			xs := make([]time.Time, 0, days)
+			ys := make([]float64, 0, days)
+			balance, i := 0, 0
+			for d := 0; d < days; d++ {
+				day := since.AddDate(0, 0, d)
+				date := ledger.DateOf(day)
+				for i < len(snapshots) && snapshots[i].Date <= date {
+					balance = snapshots[i].Balance
+					i++
+				}
+				xs = append(xs, time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location()))
+				ys = append(ys, float64(balance))
+			}
+			data, err := drawTrend(ctx.CardOrNickName(uid)+"的"+wallet.GetWalletName()+"走势(近"+strconv.Itoa(days)+"天)", xs, ys)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.ImageBytes(data))
+		})
+
+	en.OnRegex(`^(全局)?钱包涨幅排名\s*(\d+)?天?$`, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			global := matched[1] != ""
+			days := 7
+			if matched[2] != "" {
+				days, _ = strconv.Atoi(matched[2])
+			}
+			if days < 1 || days > maxTrendDays {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("天数应在1~", maxTrendDays, "之间"))
+				return
+			}
+			var usergroup []int64
+			if global {
+				if !zero.SuperUserPermission(ctx) {
+					ctx.SendChain(message.Text("ERROR: 仅超级用户能查看全局排名"))
+					return
+				}
+			} else {
+				temp := ctx.GetThisGroupMemberListNoCache().Array()
+				usergroup = make([]int64, len(temp))
+				for i, info := range temp {
+					usergroup[i] = info.Get("user_id").Int()
+				}
+				if len(usergroup) == 0 {
+					ctx.SendChain(message.Text("ERROR: 获取群员列表失败"))
+					return
+				}
+			}
+			gains, err := ledger.GetGainsOf(time.Now().AddDate(0, 0, 1-days), usergroup...)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			var bars []chart.Value
+			for _, g := range gains {
+				if len(bars) >= 10 || g.After <= g.Before {
+					break
+				}
+				bars = append(bars, chart.Value{
+					Label: ctx.CardOrNickName(g.UID),
+					Value: float64(g.After - g.Before),
+				})
+			}
+			if len(bars) == 0 {
+				ctx.SendChain(message.Text("近", days, "天没有人的", wallet.GetWalletName(), "增加"))
+				return
+			}
+			title := wallet.GetWalletName() + "涨幅排名(近" + strconv.Itoa(days) + "天)"
+			if global {
+				title = "全局" + title
+			}
+			data, err := drawBars(title, bars)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.ImageBytes(data))
+		})
+}
+
+// loadFont 加载绘图字体
+func loadFont() (*truetype.Font, error) {
+	_, err := file.GetLazyData(text.FontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(text.FontFile)
+	if err != nil {
+		return nil, err
+	}
+	return freetype.ParseFont(b)
+}
+
+// drawBars 绘制柱状图, bars 需由高到低排列
+func drawBars(title string, bars []chart.Value) ([]byte, error) {
+	font, err := loadFont()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = chart.BarChart{
+		Font:  font,
+		Title: title,
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top: 40,
+			},
+		},
+		YAxis: chart.YAxis{
+			Range: &chart.ContinuousRange{
+				Min: 0,
+				Max: math.Ceil(bars[0].Value/10) * 10,
+			},
+		},
+		Height:   500,
+		BarWidth: 50,
+		Bars:     bars,
+	}.Render(chart.PNG, &buf)
+	return buf.Bytes(), err
+}
+
+// drawTrend 绘制折线图
+func drawTrend(title string, xs []time.Time, ys []float64) ([]byte, error) {
+	font, err := loadFont()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = chart.Chart{
+		Font:  font,
+		Title: title,
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top:  40,
+				Left: 20,
+			},
+		},
+		XAxis: chart.XAxis{
+			ValueFormatter: chart.TimeValueFormatterWithFormat("01-02"),
+		},
+		YAxis: chart.YAxis{
+			ValueFormatter: func(v any) string {
+				return strconv.Itoa(int(v.(float64)))
+			},
+		},
+		Height: 500,
+		Width:  800,
+		Series: []chart.Series{
+			chart.TimeSeries{
+				Style: chart.Style{
+					StrokeWidth: 3,
+					DotWidth:    4,
+				},
+				XValues: xs,
+				YValues: ys,
+			},
+		},
+	}.Render(chart.PNG, &buf)
+	return buf.Bytes(), err
+}
@@ -2,7 +2,7 @@
 package wallet
 
 import (
-	"math"
+	"errors"
 	"os"
 	"regexp"
 	"strconv"
@@ -16,32 +16,50 @@ import (
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
 	"github.com/FloatTech/zbputils/img/text"
-	"github.com/golang/freetype"
 	"github.com/wcharczuk/go-chart/v2"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/robbery/jail"
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/wallet/ledger"
 )
 
+var en = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+	DisableOnDefault: false,
+	Brief:            "钱包",
+	Help: "- 查看钱包排名\n" +
+		"- 钱包涨幅排名[天数]\n" +
+		"- 钱包走势[@xxx][天数]\n" +
+		"- 全局钱包排名\n" +
+		"- 全局钱包涨幅排名[天数]\n" +
+		"- 设置硬币名称XX\n" +
+		"- 管理钱包余额[+金额|-金额][@xxx]\n" +
+		"- 查看我的钱包|查看钱包余额[@xxx]\n" +
+		"- 钱包转账[金额][@xxx]\n" +
+		"- 发红包[总额] [个数] [口令]\n" +
+		"- 发均分红包[总额] [个数] [口令]\n" +
+		"- 抢红包|口令[红包口令]\n" +
+		"- 钱包流水[@xxx][页码]\n" +
+		"- 冲正流水[流水号]\n" +
+		"- 存款|取款[金额]\n" +
+		"- 定期存款[金额] [天数]\n" +
+		"- 提前支取[定期编号]\n" +
+		"- 贷款|还款[金额]\n" +
+		"- 查看我的银行\n" +
+		"- 查看银行参数\n" +
+		"- 设置银行参数[参数名] [值]\n" +
+		"注：仅超级用户能“管理钱包余额”、“冲正流水”、“设置银行参数”和查看全局排名\n" +
+		"银行中的钱不会被打劫, 利率为日利率千分比, 每日0点结算, 定期到期后本息转入活期\n" +
+		"贷款每日计息, 签到收入会按还款比例自动还款\n" +
+		"红包24小时内未领完的部分将退回\n",
+	PrivateDataFolder: "wallet",
+})
+
 func init() {
-	en := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
-		DisableOnDefault: false,
-		Brief:            "钱包",
-		Help: "- 查看钱包排名\n" +
-			"- 设置硬币名称XX\n" +
-			"- 管理钱包余额[+金额|-金额][@xxx]\n" +
-			"- 查看我的钱包|查看钱包余额[@xxx]\n" +
-			"- 钱包转账[金额][@xxx]\n" +
-			"注：仅超级用户能“管理钱包余额”\n",
-		PrivateDataFolder: "wallet",
-	})
-	cachePath := en.DataFolder() + "cache/"
 	coinNameFile := en.DataFolder() + "coin_name.txt"
 	go func() {
-		_ = os.RemoveAll(cachePath)
-		err := os.MkdirAll(cachePath, 0755)
-		if err != nil {
-			panic(err)
-		}
+		// 清理旧版本的排名缓存
+		_ = os.RemoveAll(en.DataFolder() + "cache/")
 		// 更改硬币名称
 		var coinName string
 		if file.IsExist(coinNameFile) {
@@ -57,20 +75,32 @@ func init() {
 		wallet.SetWalletName(coinName)
 	}()
 
-	en.OnFullMatch("查看钱包排名", zero.OnlyGroup).Limit(ctxext.LimitByGroup).SetBlock(true).
+	en.OnRegex(`^(查看|全局)钱包排名$`, zero.OnlyGroup).Limit(ctxext.LimitByGroup).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
-			gid := strconv.FormatInt(ctx.Event.GroupID, 10)
-			today := time.Now().Format("20060102")
-			drawedFile := cachePath + gid + today + "walletRank.png"
-			if file.IsExist(drawedFile) {
-				ctx.SendChain(message.Image("file:///" + file.BOTPATH + "/" + drawedFile))
-				return
+			global := ctx.State["regex_matched"].([]string)[1] == "全局"
+			var usergroup []int64
+			if global {
+				if !zero.SuperUserPermission(ctx) {
+					ctx.SendChain(message.Text("ERROR: 仅超级用户能查看全局排名"))
+					return
+				}
+				var err error
+				usergroup, err = ledger.GetAllUsers()
+				if err != nil {
+					ctx.SendChain(message.Text("ERROR: ", err))
+					return
+				}
+			} else {
+				// 无缓存获取群员列表
+				temp := ctx.GetThisGroupMemberListNoCache().Array()
+				usergroup = make([]int64, len(temp))
+				for i, info := range temp {
+					usergroup[i] = info.Get("user_id").Int()
+				}
 			}
-			// 无缓存获取群员列表
-			temp := ctx.GetThisGroupMemberListNoCache().Array()
-			usergroup := make([]int64, len(temp))
-			for i, info := range temp {
-				usergroup[i] = info.Get("user_id").Int()
+			if len(usergroup) == 0 {
+				ctx.SendChain(message.Text("ERROR: 当前没人获取过", wallet.GetWalletName()))
+				return
 			}
 			// 获取钱包信息
 			st, err := wallet.GetGroupWalletOf(true, usergroup...)
@@ -84,26 +114,6 @@ func init() {
 			} else if len(st) > 10 {
 				st = st[:10]
 			}
-			_, err = file.GetLazyData(text.FontFile, control.Md5File, true)
-			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return
-			}
-			b, err := os.ReadFile(text.FontFile)
-			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return
-			}
-			font, err := freetype.ParseFont(b)
-			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return
-			}
-			f, err := os.Create(drawedFile)
-			if err != nil {
-				ctx.SendChain(message.Text("ERROR: ", err))
-				return
-			}
 			var bars []chart.Value
 			for _, v := range st {
 				if v.Money != 0 {
@@ -113,31 +123,20 @@ func init() {
 					})
 				}
 			}
-			err = chart.BarChart{
-				Font:  font,
-				Title: wallet.GetWalletName() + "排名(1天只刷新1次)",
-				Background: chart.Style{
-					Padding: chart.Box{
-						Top: 40,
-					},
-				},
-				YAxis: chart.YAxis{
-					Range: &chart.ContinuousRange{
-						Min: 0,
-						Max: math.Ceil(bars[0].Value/10) * 10,
-					},
-				},
-				Height:   500,
-				BarWidth: 50,
-				Bars:     bars,
-			}.Render(chart.PNG, f)
-			_ = f.Close()
+			if len(bars) == 0 {
+				ctx.SendChain(message.Text("ERROR: 当前没人获取过", wallet.GetWalletName()))
+				return
+			}
+			title := wallet.GetWalletName() + "排名"
+			if global {
+				title = "全局" + title
+			}
+			data, err := drawBars(title, bars)
 			if err != nil {
-				_ = os.Remove(drawedFile)
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			ctx.SendChain(message.Image("file:///" + file.BOTPATH + "/" + drawedFile))
+			ctx.SendChain(message.ImageBytes(data))
 		})
 	en.OnPrefix("设置硬币名称", zero.OnlyToMe, zero.SuperUserPermission).SetBlock(true).
 		Handle(func(ctx *zero.Ctx) {
@@ -181,7 +180,11 @@ func init() {
 				ctx.SendChain(message.Text("管理失败:对方钱包余额不足，扣款失败"))
 				return
 			}
-			err = wallet.InsertWalletOf(uidInt, amount)
+			if amount >= 0 {
+				err = ledger.Earn(uidInt, amount, "wallet", ctx.Event.UserID, "管理钱包余额")
+			} else {
+				err = ledger.Spend(uidInt, -amount, "wallet", ctx.Event.UserID, "管理钱包余额")
+			}
 			if err != nil {
 				ctx.SendChain(message.Text("[ERROR]:管理失败，钱包坏掉了:\n", err))
 				return
@@ -208,7 +211,7 @@ func init() {
 			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("QQ号：", uidStr, "，的钱包有", money, wallet.GetWalletName()))
 		})
 
-	en.OnPrefix(`钱包转账`, zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByGroup).
+	en.OnPrefix(`钱包转账`, zero.OnlyGroup, jail.CheckFree).SetBlock(true).Limit(ctxext.LimitByGroup).
 		Handle(func(ctx *zero.Ctx) {
 			param := strings.TrimSpace(ctx.State["args"].(string))
 
@@ -236,22 +239,111 @@ func init() {
 			}
 
 			// 开始转账流程
-			if amount > wallet.GetWalletOf(ctx.Event.UserID) {
+			err = ledger.Transfer(ctx.Event.UserID, uidInt, amount, "wallet", "钱包转账")
+			if errors.Is(err, ledger.ErrNotEnough) {
 				ctx.SendChain(message.Text("[ERROR]:钱包余额不足，转账失败"))
 				return
 			}
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:转账失败，转账时银行被打劫:\n", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("转账成功:成功给"), message.At(uidInt), message.Text(",转账:", amount, wallet.GetWalletName()))
+		})
 
-			err = wallet.InsertWalletOf(ctx.Event.UserID, -amount)
+	en.OnRegex(`^钱包流水\s*(\[CQ:at,(?:\S*,)?qq=(\d+)(?:,\S*)?\])?\s*(\d+)?$`).SetBlock(true).Limit(ctxext.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			uid := ctx.Event.UserID
+			if matched[2] != "" {
+				uid, _ = strconv.ParseInt(matched[2], 10, 64)
+			}
+			page := 1
+			if matched[3] != "" {
+				page, _ = strconv.Atoi(matched[3])
+			}
+			total := ledger.CountRecordsOf(uid)
+			if total == 0 {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("还没有任何流水记录"))
+				return
+			}
+			pages := (total + recordsPerPage - 1) / recordsPerPage
+			if page < 1 || page > pages {
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("页码超出范围，共", pages, "页"))
+				return
+			}
+			records, err := ledger.GetRecordsOf(uid, page, recordsPerPage)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			_, err = file.GetLazyData(text.FontFile, control.Md5File, true)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:", err))
+				return
+			}
+			var sb strings.Builder
+			sb.WriteString(ctx.CardOrNickName(uid))
+			sb.WriteString(" 的钱包流水 (第")
+			sb.WriteString(strconv.Itoa(page))
+			sb.WriteString("/")
+			sb.WriteString(strconv.Itoa(pages))
+			sb.WriteString("页)\n")
+			for _, r := range records {
+				sb.WriteString(formatRecord(&r))
+				sb.WriteString("\n")
+			}
+			data, err := text.RenderToBase64(sb.String(), text.FontFile, 700, 20)
 			if err != nil {
-				ctx.SendChain(message.Text("[ERROR]:转账失败，扣款异常:\n", err))
+				ctx.SendChain(message.Text("[ERROR]:", err))
 				return
 			}
+			ctx.SendChain(message.Image("base64://" + binary.BytesToString(data)))
+		})
 
-			err = wallet.InsertWalletOf(uidInt, amount)
+	en.OnRegex(`^冲正流水\s*#?(\d+)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			id, err := strconv.ParseInt(ctx.State["regex_matched"].([]string)[1], 10, 64)
 			if err != nil {
-				ctx.SendChain(message.Text("[ERROR]:转账失败，转账时银行被打劫:\n", err))
+				ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("流水号处理失败"))
 				return
 			}
-			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("转账成功:成功给"), message.At(uidInt), message.Text(",转账:", amount, wallet.GetWalletName()))
+			r, err := ledger.Reverse(id, ctx.Event.UserID)
+			if err != nil {
+				ctx.SendChain(message.Text("[ERROR]:冲正失败:\n", err))
+				return
+			}
+			ctx.SendChain(message.Reply(ctx.Event.MessageID), message.Text("冲正成功:\n", formatRecord(&r)))
 		})
 }
+
+// recordsPerPage 每页流水条数
+const recordsPerPage = 15
+
+// formatRecord 格式化一条流水
+func formatRecord(r *ledger.Record) string {
+	var sb strings.Builder
+	sb.WriteString("#")
+	sb.WriteString(strconv.FormatInt(r.ID, 10))
+	sb.WriteString(" ")
+	sb.WriteString(time.Unix(r.Time, 0).Format("01/02 15:04"))
+	sb.WriteString(" ")
+	if r.Amount > 0 {
+		sb.WriteString("+")
+	}
+	sb.WriteString(strconv.Itoa(r.Amount))
+	sb.WriteString(" 余额:")
+	sb.WriteString(strconv.Itoa(r.Balance))
+	sb.WriteString(" [")
+	sb.WriteString(r.Source)
+	sb.WriteString("] ")
+	sb.WriteString(r.Reason)
+	if r.Counterparty != 0 {
+		sb.WriteString(" 对象:")
+		sb.WriteString(strconv.FormatInt(r.Counterparty, 10))
+	}
+	if r.Reversal != 0 && !strings.HasPrefix(r.Reason, "冲正#") {
+		sb.WriteString(" (已冲正)")
+	}
+	return sb.String()
+}
@@ -0,0 +1,492 @@
+package weiqi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+var errNotExist = errors.New("对局不存在, 发送「围棋 [9|13|19]」可创建对局。")
+
+type weiqiRoom struct {
+	gameroom.Room
+	game        *game
+	blackPlayer int64
+	blackName   string
+	whitePlayer int64
+	whiteName   string
+	drawPlayer  int64
+	scoring     bool           // 双方连续停一手后进入数子阶段
+	dead        map[point]bool // 数子阶段标记的死子
+	confirmed   int64          // 已确认数子结果的玩家
+	res         result         // 对局结束后的结果
+}
+
+// result 对局结果, 与 SGF 的 RE 属性相同, 如 B+R, W+3.5, 0
+type result string
+
+const drawn result = "0"
+
+// scores 黑白双方的得分
+func (r result) scores() (float64, float64) {
+	switch {
+	case strings.HasPrefix(string(r), "B+"):
+		return 1.0, 0.0
+	case strings.HasPrefix(string(r), "W+"):
+		return 0.0, 1.0
+	default:
+		return 0.5, 0.5
+	}
+}
+
+// resignResult 一方认输的结果
+func resignResult(loser stone) result {
+	if loser == blackStone {
+		return "W+R"
+	}
+	return "B+R"
+}
+
+// createGame 创建或加入对局
+func createGame(groupCode, senderUin int64, senderName string, selfID int64, size int) (msg message.Message, err error) {
+	room, ok := weiqiRooms.Load(groupCode)
+	if !ok {
+		if size == 0 {
+			size = 19
+		}
+		weiqiRooms.Store(groupCode, &weiqiRoom{
+			Room: gameroom.Room{
+				SelfID:     selfID,
+				GroupID:    groupCode,
+				Players:    []gameroom.Player{{UID: senderUin, Name: senderName}},
+				LastAction: time.Now(),
+			},
+			game:        newGame(size),
+			blackPlayer: senderUin,
+			blackName:   senderName,
+		})
+		msg = append(msg, message.Text("已创建新的 ", size, " 路围棋对局, 你执黑先行, 白方贴 ", komi, " 目, 发送「围棋」可加入对局。"))
+		return
+	}
+	msg = message.Message{message.At(senderUin)}
+	if room.whitePlayer != 0 {
+		msg = append(msg, message.Text("对局已在进行中, 无法创建或加入对局, 当前对局玩家为: "),
+			message.At(room.blackPlayer), message.At(room.whitePlayer),
+			message.Text(", 群主或管理员发送「围棋中断」可中断对局(自动判和)。"))
+		return
+	}
+	if senderUin == room.blackPlayer {
+		msg = append(msg, message.Text("请等候其他玩家加入游戏。"))
+		return
+	}
+	if size != 0 && size != room.game.board.size {
+		msg = append(msg, message.Text("已创建 ", room.game.board.size, " 路对局, 请发送「围棋」加入或等待对局结束之后创建新对局。"))
+		return
+	}
+	if err = room.Join(gameroom.Player{UID: senderUin, Name: senderName}, 2); err != nil {
+		return
+	}
+	room.whitePlayer = senderUin
+	room.whiteName = senderName
+	room.Touch()
+	boardImgEle, err := getBoardElement(room)
+	if err != nil {
+		return
+	}
+	msg = append(msg, message.Text("白方已加入对局, 请黑方落子。"), message.At(room.blackPlayer), boardImgEle)
+	return
+}
+
+// checkTurn 检查是否轮到发送者, 返回提示信息, 为空时可以走棋
+func (room *weiqiRoom) checkTurn(senderUin int64) string {
+	if room.blackPlayer == 0 || room.whitePlayer == 0 {
+		return "请等候其他玩家加入游戏。"
+	}
+	if room.playerOf(room.game.turn) != senderUin {
+		return "请等待对手落子。"
+	}
+	return ""
+}
+
+// play 落子, 数子阶段落子视为对死活有异议, 恢复对局
+func play(groupCode, senderUin int64, coord string) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	room, ok := weiqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if senderUin != room.blackPlayer && senderUin != room.whitePlayer {
+		return
+	}
+	if hint := room.checkTurn(senderUin); hint != "" {
+		msg = append(msg, message.Text(hint))
+		return
+	}
+	p, err := parsePoint(coord, room.game.board.size)
+	if err != nil {
+		msg = append(msg, message.Text("坐标「", coord, "」无效, 格式为列字母加行号, 如「落子 D4」。"))
+		return msg, nil
+	}
+	if err = room.game.play(p); err != nil {
+		msg = append(msg, message.Text("不能在 ", p, " 落子: ", err))
+		return msg, nil
+	}
+	resumed := room.scoring
+	room.scoring = false
+	room.dead = nil
+	room.confirmed = 0
+	room.Touch()
+	// 走子之后, 视为拒绝和棋
+	room.drawPlayer = 0
+	boardImgEle, err := getBoardElement(room)
+	if err != nil {
+		return
+	}
+	hint := "对手落子 " + p.String() + ", 游戏继续。"
+	if resumed {
+		hint = "对手对死活有异议, 在 " + p.String() + " 落子, 对局继续。"
+	}
+	msg = message.Message{message.At(room.playerOf(room.game.turn)), message.Text(hint), boardImgEle}
+	return
+}
+
+// passTurn 停一手, 双方连续停一手后进入数子阶段
+func passTurn(groupCode, senderUin int64) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	room, ok := weiqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if senderUin != room.blackPlayer && senderUin != room.whitePlayer {
+		return
+	}
+	if room.scoring {
+		msg = append(msg, message.Text("正在数子, 请标记死子或确认结果。"))
+		return
+	}
+	if hint := room.checkTurn(senderUin); hint != "" {
+		msg = append(msg, message.Text(hint))
+		return
+	}
+	room.Touch()
+	room.drawPlayer = 0
+	if !room.game.pass() {
+		msg = message.Message{message.At(room.playerOf(room.game.turn)), message.Text("对手停一手, 请落子或同样停一手进入数子阶段。")}
+		return
+	}
+	room.scoring = true
+	room.dead = make(map[point]bool)
+	return scoringMessage(room, "双方连续停一手, 进入数子阶段。")
+}
+
+// markDead 数子阶段标记或取消标记死子, 以整块棋为单位
+func markDead(groupCode, senderUin int64, coord string) (msg message.Message, err error) {
+	room, ok := weiqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if senderUin != room.blackPlayer && senderUin != room.whitePlayer {
+		return
+	}
+	msg = message.Message{message.At(senderUin)}
+	if !room.scoring {
+		msg = append(msg, message.Text("双方连续停一手后才能标记死子。"))
+		return
+	}
+	p, err := parsePoint(coord, room.game.board.size)
+	if err != nil || room.game.board.at(p) == empty {
+		msg = append(msg, message.Text("「", coord, "」处没有棋子。"))
+		return msg, nil
+	}
+	stones, _ := room.game.board.group(p)
+	toggle := !room.dead[p]
+	for _, s := range stones {
+		if toggle {
+			room.dead[s] = true
+		} else {
+			delete(room.dead, s)
+		}
+	}
+	room.confirmed = 0
+	room.Touch()
+	action := "标记"
+	if !toggle {
+		action = "取消标记"
+	}
+	return scoringMessage(room, "已"+action+" "+p.String()+" 所在的 "+strconv.Itoa(len(stones))+" 子为死子。")
+}
+
+// confirmScore 确认数子结果, 双方均确认后结束对局
+func confirmScore(groupCode, senderUin int64) (msg message.Message, err error) {
+	room, ok := weiqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if senderUin != room.blackPlayer && senderUin != room.whitePlayer {
+		return
+	}
+	msg = message.Message{message.At(senderUin)}
+	if !room.scoring {
+		msg = append(msg, message.Text("双方连续停一手后才能确认结果。"))
+		return
+	}
+	if room.confirmed == 0 {
+		room.confirmed = senderUin
+		opponent := room.blackPlayer
+		if senderUin == room.blackPlayer {
+			opponent = room.whitePlayer
+		}
+		msg = append(msg, message.Text("已确认数子结果, 等待对手确认。"), message.At(opponent))
+		return
+	}
+	if room.confirmed == senderUin {
+		return
+	}
+	blackScore, whiteScore := room.game.score(room.dead)
+	res := drawn
+	var hint string
+	switch {
+	case blackScore > whiteScore:
+		res = result("B+" + strconv.FormatFloat(blackScore-whiteScore, 'f', -1, 64))
+		hint = "黑方胜 " + strconv.FormatFloat(blackScore-whiteScore, 'f', -1, 64) + " 目。\n"
+	case whiteScore > blackScore:
+		res = result("W+" + strconv.FormatFloat(whiteScore-blackScore, 'f', -1, 64))
+		hint = "白方胜 " + strconv.FormatFloat(whiteScore-blackScore, 'f', -1, 64) + " 目。\n"
+	default:
+		hint = "和棋。\n"
+	}
+	boardImgEle, err := renderElement(room, true)
+	if err != nil {
+		return
+	}
+	text, err := finishGame(room, groupCode, res)
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, message.Text("双方确认结果, 游戏结束, ", scoreString(blackScore, whiteScore), hint, text), boardImgEle)
+	msg = append(msg, room.Audience()...)
+	return
+}
+
+// scoringMessage 数子阶段的提示
+func scoringMessage(room *weiqiRoom, hint string) (message.Message, error) {
+	boardImgEle, err := renderElement(room, true)
+	if err != nil {
+		return nil, err
+	}
+	blackScore, whiteScore := room.game.score(room.dead)
+	return message.Message{message.At(room.blackPlayer), message.At(room.whitePlayer),
+		message.Text(hint, "\n当前", scoreString(blackScore, whiteScore),
+			"发送「死子 坐标」标记或取消标记死子, 双方发送「确认结果」结束对局, 对死活有异议可直接落子继续对局。"),
+		boardImgEle}, nil
+}
+
+func scoreString(blackScore, whiteScore float64) string {
+	return "黑方 " + strconv.FormatFloat(blackScore, 'f', -1, 64) + " 目, 白方 " +
+		strconv.FormatFloat(whiteScore, 'f', -1, 64) + " 目 (含贴目 " + strconv.FormatFloat(komi, 'f', -1, 64) + "), "
+}
+
+// resign 认输
+func resign(groupCode, senderUin int64) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	room, ok := weiqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if senderUin != room.blackPlayer && senderUin != room.whitePlayer {
+		return
+	}
+	// 如果对局未建立, 中断对局
+	if room.blackPlayer == 0 || room.whitePlayer == 0 {
+		msg = closeRoom(groupCode, room, append(msg, message.Text("对局结束")))
+		return
+	}
+	loser := whiteStone
+	if senderUin == room.blackPlayer {
+		loser = blackStone
+	}
+	text, err := finishGame(room, groupCode, resignResult(loser))
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, message.Text("认输, 游戏结束。\n", text))
+	msg = append(msg, room.Audience()...)
+	return
+}
+
+// draw 和棋
+func draw(groupCode, senderUin int64) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	room, ok := weiqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if senderUin != room.blackPlayer && senderUin != room.whitePlayer {
+		return
+	}
+	room.Touch()
+	if room.drawPlayer == 0 {
+		room.drawPlayer = senderUin
+		msg = append(msg, message.Text("请求和棋, 发送「围棋和棋」接受和棋。落子视为拒绝和棋。"))
+		return
+	}
+	if room.drawPlayer == senderUin {
+		return
+	}
+	text, err := finishGame(room, groupCode, drawn)
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, message.Text("接受和棋, 游戏结束。\n", text))
+	msg = append(msg, room.Audience()...)
+	return
+}
+
+// abort 中断对局
+func abort(groupCode int64) (message.Message, error) {
+	if room, ok := weiqiRooms.Load(groupCode); ok {
+		return abortGame(room, groupCode, "对局已被管理员中断, 游戏结束。")
+	}
+	return nil, errNotExist
+}
+
+// abortGame 中断游戏, 不计算等级分
+func abortGame(room *weiqiRoom, groupCode int64, hint string) (message.Message, error) {
+	sgf := getSGF(room, drawn)
+	if len(room.game.moves) > 4 {
+		if _, err := newDBService().createRecord(sgf, room.game.board.size, room.blackPlayer, room.whitePlayer, room.blackName, room.whiteName); err != nil {
+			return nil, err
+		}
+	}
+	msg := message.Message{message.Text(hint)}
+	if room.blackPlayer != 0 {
+		msg = append(msg, message.At(room.blackPlayer))
+	}
+	if room.whitePlayer != 0 {
+		msg = append(msg, message.At(room.whitePlayer))
+	}
+	msg = append(msg, message.Text("\n\n"+sgf))
+	return closeRoom(groupCode, room, msg), nil
+}
+
+// finishGame 结束对局, 保存棋谱并计算等级分
+func finishGame(room *weiqiRoom, groupCode int64, res result) (string, error) {
+	weiqiRooms.Delete(groupCode)
+	room.res = res
+	sgf := getSGF(room, res)
+	if len(room.game.moves) <= 4 {
+		return sgf, nil
+	}
+	// 若落子次数超过 4 认为是有效对局, 存入数据库
+	id, err := newDBService().createRecord(sgf, room.game.board.size, room.blackPlayer, room.whitePlayer, room.blackName, room.whiteName)
+	if err != nil {
+		return "", err
+	}
+	eloString, err := getELOString(room, res)
+	if err != nil {
+		return "", err
+	}
+	return eloString + "棋谱编号 #" + strconv.Itoa(int(id)) + "\n" + sgf, nil
+}
+
+func (room *weiqiRoom) playerOf(s stone) int64 {
+	if s == blackStone {
+		return room.blackPlayer
+	}
+	return room.whitePlayer
+}
+
+// getBoardElement 获取棋盘图片的消息内容
+func getBoardElement(room *weiqiRoom) (message.Segment, error) {
+	return renderElement(room, false)
+}
+
+func renderElement(room *weiqiRoom, scoring bool) (message.Segment, error) {
+	data, err := renderBoard(room.game, room.dead, scoring)
+	if err != nil {
+		return message.Segment{}, err
+	}
+	return message.ImageBytes(data), nil
+}
+
+// getSGF 获取 SGF 格式的棋谱
+func getSGF(room *weiqiRoom, res result) string {
+	var sb strings.Builder
+	size := room.game.board.size
+	sb.WriteString(fmt.Sprintf("(;GM[1]FF[4]CA[UTF-8]SZ[%d]KM[%s]RU[Chinese]DT[%s]\nPB[%s]PW[%s]RE[%s]\n",
+		size, strconv.FormatFloat(komi, 'f', -1, 64), time.Now().Format("2006-01-02"), room.blackName, room.whiteName, res))
+	color := "B"
+	for _, p := range room.game.moves {
+		sb.WriteString(";")
+		sb.WriteString(color)
+		sb.WriteString("[")
+		sb.WriteString(sgfPoint(p, size))
+		sb.WriteString("]")
+		if color == "B" {
+			color = "W"
+		} else {
+			color = "B"
+		}
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// getELOString 更新并获得玩家等级分的文本内容
+func getELOString(room *weiqiRoom, res result) (string, error) {
+	blackScore, whiteScore := res.scores()
+	blackRate, whiteRate, err := ratings.Settle(room.blackPlayer, room.whitePlayer, room.blackName, room.whiteName, blackScore, whiteScore)
+	if err != nil {
+		return "", err
+	}
+	return "玩家等级分: \n" + room.blackName + ": " + strconv.Itoa(blackRate) + "\n" +
+		room.whiteName + ": " + strconv.Itoa(whiteRate) + "\n\n", nil
+}
+
+// getRanking 获取等级分排行榜
+func getRanking() (message.Message, error) {
+	eloList, err := ratings.Top(10)
+	if err != nil {
+		return nil, err
+	}
+	var msgBuilder strings.Builder
+	msgBuilder.WriteString("当前围棋等级分排行榜: \n\n")
+	for _, elo := range eloList {
+		msgBuilder.WriteString(elo.Name)
+		msgBuilder.WriteString(": ")
+		msgBuilder.WriteString(strconv.Itoa(elo.Rate))
+		msgBuilder.WriteString("\n")
+	}
+	return message.Message{message.Text(msgBuilder.String())}, nil
+}
+
+// rate 获取等级分
+func rate(senderUin int64, senderName string) (message.Message, error) {
+	rate, err := ratings.Get(senderUin)
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return nil, errors.New("无法获取等级分信息。")
+		}
+		return nil, errors.New("没有查找到等级分信息, 请至少进行一局对局。")
+	}
+	return message.Message{message.Text("玩家「", senderName, "」目前的围棋等级分: ", rate)}, nil
+}
+
+// getRecord 按编号获取棋谱
+func getRecord(id uint) (message.Message, error) {
+	r, err := newDBService().getRecordByID(id)
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.New("没有找到对局 #" + strconv.Itoa(int(id)) + "。")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return message.Message{message.Text("#", r.ID, " ", r.CreatedAt.Format("2006-01-02"), " ", r.Size, " 路\n", r.Data)}, nil
+}
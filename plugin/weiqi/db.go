@@ -0,0 +1,76 @@
+package weiqi
+
+import (
+	"os"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom/elo"
+)
+
+var (
+	weiqiDB *gorm.DB
+	ratings *elo.Table // 对局等级分
+)
+
+// record 对局棋谱, 为 SGF 格式
+type record struct {
+	gorm.Model
+	Data      string
+	Size      int
+	BlackUin  int64
+	WhiteUin  int64
+	BlackName string
+	WhiteName string
+}
+
+// weiqiDBService 数据库服务
+type weiqiDBService struct {
+	db *gorm.DB
+}
+
+// newDBService 创建数据库服务
+func newDBService() *weiqiDBService {
+	return &weiqiDBService{
+		db: weiqiDB,
+	}
+}
+
+// initDatabase init database
+func initDatabase(dbPath string) {
+	var err error
+	if _, err = os.Stat(dbPath); err != nil || os.IsNotExist(err) {
+		f, err := os.Create(dbPath)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+	}
+	weiqiDB, err = gorm.Open("sqlite3", dbPath)
+	if err != nil {
+		panic(err)
+	}
+	weiqiDB.AutoMigrate(&record{})
+	ratings = elo.NewTable(weiqiDB, "elos")
+}
+
+// createRecord 保存棋谱
+func (s *weiqiDBService) createRecord(data string, size int, blackUin, whiteUin int64, blackName, whiteName string) (uint, error) {
+	r := record{
+		Data:      data,
+		Size:      size,
+		BlackUin:  blackUin,
+		WhiteUin:  whiteUin,
+		BlackName: blackName,
+		WhiteName: whiteName,
+	}
+	err := s.db.Create(&r).Error
+	return r.ID, err
+}
+
+// getRecordByID 获取棋谱
+func (s *weiqiDBService) getRecordByID(id uint) (record, error) {
+	var r record
+	err := s.db.Where("id = ?", id).First(&r).Error
+	return r, err
+}
@@ -0,0 +1,153 @@
+package weiqi
+
+import (
+	"image/color"
+	"strconv"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/gg/factory"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+)
+
+// boardWidth 网格部分的边长, 各尺寸的棋盘图片大小相同
+const boardWidth = 648.0
+
+var (
+	boardColor     = color.RGBA{220, 180, 100, 255}
+	lineColor      = color.RGBA{40, 30, 20, 255}
+	highlightColor = color.RGBA{220, 40, 40, 255}
+)
+
+// starPoints 星位
+func starPoints(size int) []point {
+	var lines []int
+	switch size {
+	case 9:
+		return []point{{2, 2}, {6, 2}, {4, 4}, {2, 6}, {6, 6}}
+	case 13:
+		lines = []int{3, 6, 9}
+	default:
+		lines = []int{3, 9, 15}
+	}
+	points := make([]point, 0, 9)
+	for _, x := range lines {
+		for _, y := range lines {
+			points = append(points, point{x, y})
+		}
+	}
+	return points
+}
+
+// renderBoard 绘制棋盘, 数子阶段会标记死子与双方的地盘
+func renderBoard(g *game, dead map[point]bool, scoring bool) ([]byte, error) {
+	fontdata, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	size := g.board.size
+	cell := boardWidth / float64(size-1)
+	margin := cell
+	if margin < 48 {
+		margin = 48
+	}
+	pos := func(p point) (float64, float64) {
+		return margin + float64(p.x)*cell, margin + float64(size-1-p.y)*cell
+	}
+	width := int(boardWidth + 2*margin)
+	canvas := gg.NewContext(width, width)
+	canvas.SetColor(boardColor)
+	canvas.Clear()
+
+	// 网格与星位
+	canvas.SetColor(lineColor)
+	canvas.SetLineWidth(1.5)
+	for i := 0; i < size; i++ {
+		x1, y1 := pos(point{0, i})
+		x2, y2 := pos(point{size - 1, i})
+		canvas.DrawLine(x1, y1, x2, y2)
+		x1, y1 = pos(point{i, 0})
+		x2, y2 = pos(point{i, size - 1})
+		canvas.DrawLine(x1, y1, x2, y2)
+	}
+	canvas.Stroke()
+	for _, p := range starPoints(size) {
+		x, y := pos(p)
+		canvas.DrawCircle(x, y, 4)
+	}
+	canvas.Fill()
+
+	// 坐标, 位于边缘棋子的外侧
+	if err = canvas.ParseFontFace(fontdata, 20); err != nil {
+		return nil, err
+	}
+	offset := cell/2 + 14
+	for i := 0; i < size; i++ {
+		x, _ := pos(point{i, 0})
+		canvas.DrawStringAnchored(string(columnLetters[i]), x, margin-offset, 0.5, 0.5)
+		canvas.DrawStringAnchored(string(columnLetters[i]), x, float64(width)-margin+offset, 0.5, 0.5)
+		_, y := pos(point{0, i})
+		canvas.DrawStringAnchored(strconv.Itoa(i+1), margin-offset, y, 0.5, 0.5)
+		canvas.DrawStringAnchored(strconv.Itoa(i+1), float64(width)-margin+offset, y, 0.5, 0.5)
+	}
+
+	// 棋子
+	radius := cell * 0.47
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			p := point{x, y}
+			s := g.board.at(p)
+			if s == empty {
+				continue
+			}
+			cx, cy := pos(p)
+			canvas.DrawCircle(cx, cy, radius)
+			if s == blackStone {
+				canvas.SetColor(color.Black)
+				canvas.Fill()
+			} else {
+				canvas.SetColor(color.White)
+				canvas.FillPreserve()
+				canvas.SetColor(lineColor)
+				canvas.SetLineWidth(1)
+				canvas.Stroke()
+			}
+			// 死子打叉
+			if dead[p] {
+				canvas.SetColor(highlightColor)
+				canvas.SetLineWidth(2)
+				canvas.DrawLine(cx-radius/2, cy-radius/2, cx+radius/2, cy+radius/2)
+				canvas.DrawLine(cx-radius/2, cy+radius/2, cx+radius/2, cy-radius/2)
+				canvas.Stroke()
+			}
+		}
+	}
+
+	// 最后一手
+	if last := g.lastMove(); last != passMove && !scoring {
+		cx, cy := pos(last)
+		canvas.SetColor(highlightColor)
+		canvas.DrawCircle(cx, cy, radius*0.35)
+		canvas.Fill()
+	}
+
+	// 数子阶段用小方块标出地盘
+	if scoring {
+		for i, s := range g.territory(dead) {
+			p := point{i % size, i / size}
+			if s == empty || (g.board.at(p) == s && !dead[p]) {
+				continue
+			}
+			cx, cy := pos(p)
+			canvas.DrawRectangle(cx-radius/3, cy-radius/3, radius*2/3, radius*2/3)
+			if s == blackStone {
+				canvas.SetColor(color.Black)
+			} else {
+				canvas.SetColor(color.White)
+			}
+			canvas.Fill()
+		}
+	}
+	return factory.ToBytes(canvas.Image())
+}
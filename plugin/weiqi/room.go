@@ -0,0 +1,191 @@
+package weiqi
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+// roomTimeout 无人落子多久后中断对局
+const roomTimeout = 6 * time.Hour
+
+// weiqiRooms 各群正在进行的对局, 重启后恢复
+var weiqiRooms *gameroom.Manager[*weiqiRoom]
+
+func newRoomManager() *gameroom.Manager[*weiqiRoom] {
+	return gameroom.New(gameroom.Options[*weiqiRoom]{
+		Name:    "weiqi",
+		Brief:   "围棋",
+		Timeout: roomTimeout,
+		OnTimeout: func(groupCode int64, room *weiqiRoom) *gameroom.Event {
+			msg, err := abortGame(room, groupCode, "对局已超过 6 小时无人落子, 游戏结束。")
+			if err != nil {
+				msg = message.Message{message.Text("ERROR: ", err)}
+			}
+			return &gameroom.Event{Message: msg}
+		},
+		New: func() *weiqiRoom {
+			return &weiqiRoom{}
+		},
+	})
+}
+
+// passString 持久化时停一手的记法
+const passString = "pass"
+
+// savedRoom 对局的持久化内容, 着法与死子以 D4 格式的坐标保存
+type savedRoom struct {
+	gameroom.Room
+	Size        int      `json:"size"`
+	Moves       string   `json:"moves"`
+	BlackPlayer int64    `json:"black_player"`
+	BlackName   string   `json:"black_name"`
+	WhitePlayer int64    `json:"white_player"`
+	WhiteName   string   `json:"white_name"`
+	DrawPlayer  int64    `json:"draw_player"`
+	Scoring     bool     `json:"scoring"`
+	Dead        []string `json:"dead,omitempty"`
+	Confirmed   int64    `json:"confirmed"`
+}
+
+// MarshalJSON 保存对局
+func (room *weiqiRoom) MarshalJSON() ([]byte, error) {
+	moves := make([]string, 0, len(room.game.moves))
+	for _, p := range room.game.moves {
+		if p == passMove {
+			moves = append(moves, passString)
+			continue
+		}
+		moves = append(moves, p.String())
+	}
+	dead := make([]string, 0, len(room.dead))
+	for p := range room.dead {
+		dead = append(dead, p.String())
+	}
+	return json.Marshal(&savedRoom{
+		Room:        room.Room,
+		Size:        room.game.board.size,
+		Moves:       strings.Join(moves, " "),
+		BlackPlayer: room.blackPlayer,
+		BlackName:   room.blackName,
+		WhitePlayer: room.whitePlayer,
+		WhiteName:   room.whiteName,
+		DrawPlayer:  room.drawPlayer,
+		Scoring:     room.scoring,
+		Dead:        dead,
+		Confirmed:   room.confirmed,
+	})
+}
+
+// UnmarshalJSON 恢复对局, 由着法重新推演局面、提子与打劫状态
+func (room *weiqiRoom) UnmarshalJSON(data []byte) error {
+	var s savedRoom
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*room = weiqiRoom{
+		Room:        s.Room,
+		game:        newGame(s.Size),
+		blackPlayer: s.BlackPlayer,
+		blackName:   s.BlackName,
+		whitePlayer: s.WhitePlayer,
+		whiteName:   s.WhiteName,
+		drawPlayer:  s.DrawPlayer,
+		scoring:     s.Scoring,
+		confirmed:   s.Confirmed,
+	}
+	for _, m := range strings.Fields(s.Moves) {
+		if m == passString {
+			room.game.pass()
+			continue
+		}
+		p, err := parsePoint(m, s.Size)
+		if err != nil {
+			return err
+		}
+		if err = room.game.play(p); err != nil {
+			return err
+		}
+	}
+	if room.scoring {
+		room.dead = make(map[point]bool, len(s.Dead))
+		for _, d := range s.Dead {
+			p, err := parsePoint(d, s.Size)
+			if err != nil {
+				return err
+			}
+			room.dead[p] = true
+		}
+	}
+	return nil
+}
+
+// outcomeOf 有效对局结束后的胜者, 和棋没有胜者
+func outcomeOf(room *weiqiRoom) *gameroom.Outcome {
+	if room == nil || len(room.game.moves) <= 4 {
+		return nil
+	}
+	var o gameroom.Outcome
+	switch {
+	case strings.HasPrefix(string(room.res), "B+"):
+		o = gameroom.Win(room.blackPlayer)
+	case strings.HasPrefix(string(room.res), "W+"):
+		o = gameroom.Win(room.whitePlayer)
+	default:
+		return nil
+	}
+	return &o
+}
+
+// reportResult 对局结束后为胜者增加群等级经验与钱包奖励
+func reportResult(ctx *zero.Ctx, room *weiqiRoom) {
+	if o := outcomeOf(room); o != nil {
+		weiqiRooms.Report(ctx, ctx.Event.GroupID, *o)
+	}
+}
+
+// closeRoom 删除已结束的对局, 并通知观战者
+func closeRoom(groupCode int64, room *weiqiRoom, msg message.Message) message.Message {
+	weiqiRooms.Delete(groupCode)
+	return append(msg, room.Audience()...)
+}
+
+// watch 观战, 对局结束时会通知观战者
+func watch(groupCode, senderUin int64) (msg message.Message, err error) {
+	room, ok := weiqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	msg = message.Message{message.At(senderUin)}
+	if !room.Watch(senderUin) {
+		msg = append(msg, message.Text("你已经在对局或观战中了。"))
+		return
+	}
+	if room.whitePlayer == 0 {
+		msg = append(msg, message.Text("开始观战, 对局尚未开始, 对局结束时会通知你。"))
+		return
+	}
+	boardImgEle, err := renderElement(room, room.scoring)
+	if err != nil {
+		return
+	}
+	msg = append(msg, message.Text("开始观战, 对局结束时会通知你。当前对局: ", room.blackName, "(黑) vs ", room.whiteName, "(白)"), boardImgEle)
+	return
+}
+
+// unwatch 取消观战
+func unwatch(groupCode, senderUin int64) (message.Message, error) {
+	room, ok := weiqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if !room.Unwatch(senderUin) {
+		return message.Message{message.At(senderUin), message.Text("你没有在观战。")}, nil
+	}
+	return message.Message{message.At(senderUin), message.Text("已取消观战。")}, nil
+}
@@ -0,0 +1,44 @@
+package weiqi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+func TestWeiqiRoomJSON(t *testing.T) {
+	room := &weiqiRoom{
+		Room:        gameroom.Room{SelfID: 1, GroupID: 2, Spectators: []int64{5}},
+		game:        newGame(9),
+		blackPlayer: 3,
+		blackName:   "黑",
+		whitePlayer: 4,
+		whiteName:   "白",
+		scoring:     true,
+		confirmed:   3,
+	}
+	// 黑方在 E6 提掉白方 E5 一子, 之后双方停一手进入数子阶段
+	playAll(t, room.game, "E4", "E5", "D5", "A1", "F5", "A2", "E6", "", "")
+	room.dead = map[point]bool{{0, 0}: true, {0, 1}: true}
+	data, err := json.Marshal(room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &weiqiRoom{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restored.game.board.key(), room.game.board.key(); got != want {
+		t.Fatalf("局面 %s, want %s", got, want)
+	}
+	if restored.game.captures != room.game.captures || restored.game.passes != 2 || len(restored.game.moves) != 9 {
+		t.Fatalf("对局进程未恢复: %+v", restored.game)
+	}
+	if !restored.scoring || len(restored.dead) != 2 || !restored.dead[point{0, 1}] || restored.confirmed != 3 {
+		t.Fatalf("数子状态未恢复: %+v", restored)
+	}
+	if restored.whiteName != "白" || restored.GroupID != 2 || len(restored.Spectators) != 1 {
+		t.Fatalf("对局信息未恢复: %+v", restored)
+	}
+}
@@ -0,0 +1,281 @@
+package weiqi
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// stone 棋子颜色
+type stone int8
+
+const (
+	empty stone = iota
+	blackStone
+	whiteStone
+)
+
+func (s stone) other() stone {
+	return 3 - s
+}
+
+func (s stone) String() string {
+	switch s {
+	case blackStone:
+		return "黑方"
+	case whiteStone:
+		return "白方"
+	default:
+		return ""
+	}
+}
+
+// komi 贴目, 按数子法黑贴 3¾ 子, 即 7.5 目
+const komi = 7.5
+
+// 坐标字母, 按惯例跳过 I
+const columnLetters = "ABCDEFGHJKLMNOPQRST"
+
+// point 棋盘上的点, x 为从左到右的列, y 为从下到上的行
+type point struct {
+	x, y int
+}
+
+// passMove 停一手
+var passMove = point{-1, -1}
+
+var errInvalidPoint = errors.New("invalid point")
+
+// parsePoint 解析 D4 格式的坐标
+func parsePoint(s string, size int) (point, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return point{}, errInvalidPoint
+	}
+	x := strings.IndexByte(columnLetters, s[0])
+	y, err := strconv.Atoi(strings.TrimSpace(s[1:]))
+	if x < 0 || x >= size || err != nil || y < 1 || y > size {
+		return point{}, errInvalidPoint
+	}
+	return point{x, y - 1}, nil
+}
+
+func (p point) String() string {
+	if p == passMove {
+		return "停一手"
+	}
+	return string(columnLetters[p.x]) + strconv.Itoa(p.y+1)
+}
+
+// board 棋盘
+type board struct {
+	size int
+	grid []stone
+}
+
+func newBoard(size int) *board {
+	return &board{size: size, grid: make([]stone, size*size)}
+}
+
+func (b *board) valid(p point) bool {
+	return p.x >= 0 && p.x < b.size && p.y >= 0 && p.y < b.size
+}
+
+func (b *board) at(p point) stone {
+	return b.grid[p.y*b.size+p.x]
+}
+
+func (b *board) set(p point, s stone) {
+	b.grid[p.y*b.size+p.x] = s
+}
+
+func (b *board) clone() *board {
+	return &board{size: b.size, grid: append([]stone(nil), b.grid...)}
+}
+
+// key 局面的唯一标识, 用于判断打劫
+func (b *board) key() string {
+	data := make([]byte, len(b.grid))
+	for i, s := range b.grid {
+		data[i] = byte('0' + s)
+	}
+	return string(data)
+}
+
+func (b *board) neighbors(p point) []point {
+	result := make([]point, 0, 4)
+	for _, d := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+		if n := (point{p.x + d[0], p.y + d[1]}); b.valid(n) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// group p 所在的棋块及其气数
+func (b *board) group(p point) (stones []point, liberties int) {
+	color := b.at(p)
+	visited := map[point]bool{p: true}
+	libs := make(map[point]bool)
+	stack := []point{p}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		stones = append(stones, cur)
+		for _, n := range b.neighbors(cur) {
+			switch s := b.at(n); {
+			case s == empty:
+				libs[n] = true
+			case s == color && !visited[n]:
+				visited[n] = true
+				stack = append(stack, n)
+			}
+		}
+	}
+	return stones, len(libs)
+}
+
+var (
+	errOccupied = errors.New("该位置已有棋子")
+	errSuicide  = errors.New("禁止自杀")
+	errKo       = errors.New("打劫, 需要先在别处走一手")
+	errOutside  = errors.New("坐标超出棋盘")
+)
+
+// game 对局状态
+type game struct {
+	board    *board
+	turn     stone
+	previous string  // 上一手之前的局面, 禁止立即还原以处理打劫
+	moves    []point // 包括停一手
+	passes   int     // 连续停一手的次数
+	captures [3]int  // 双方提子数, 下标为提子方
+}
+
+func newGame(size int) *game {
+	return &game{board: newBoard(size), turn: blackStone}
+}
+
+// play 走子方在 p 处落子
+func (g *game) play(p point) error {
+	if !g.board.valid(p) {
+		return errOutside
+	}
+	if g.board.at(p) != empty {
+		return errOccupied
+	}
+	next := g.board.clone()
+	next.set(p, g.turn)
+	captured := 0
+	for _, n := range next.neighbors(p) {
+		if next.at(n) != g.turn.other() {
+			continue
+		}
+		if stones, libs := next.group(n); libs == 0 {
+			for _, s := range stones {
+				next.set(s, empty)
+			}
+			captured += len(stones)
+		}
+	}
+	if _, libs := next.group(p); libs == 0 {
+		return errSuicide
+	}
+	if next.key() == g.previous {
+		return errKo
+	}
+	g.previous = g.board.key()
+	g.board = next
+	g.captures[g.turn] += captured
+	g.moves = append(g.moves, p)
+	g.passes = 0
+	g.turn = g.turn.other()
+	return nil
+}
+
+// pass 停一手, 返回双方是否已连续停一手
+func (g *game) pass() bool {
+	g.previous = g.board.key()
+	g.moves = append(g.moves, passMove)
+	g.passes++
+	g.turn = g.turn.other()
+	return g.passes >= 2
+}
+
+// lastMove 最后一手, 没有时返回 passMove
+func (g *game) lastMove() point {
+	if len(g.moves) == 0 {
+		return passMove
+	}
+	return g.moves[len(g.moves)-1]
+}
+
+// territory 按数子法计算归属, 去除死子后只与一方相邻的空点归该方所有
+func (g *game) territory(dead map[point]bool) []stone {
+	b := g.board.clone()
+	for p := range dead {
+		b.set(p, empty)
+	}
+	owner := make([]stone, len(b.grid))
+	visited := make([]bool, len(b.grid))
+	for i, s := range b.grid {
+		if s != empty {
+			owner[i] = s
+			continue
+		}
+		if visited[i] {
+			continue
+		}
+		// 找出整块空地及其边界颜色
+		var region []int
+		var border stone
+		mixed := false
+		stack := []point{{i % b.size, i / b.size}}
+		visited[i] = true
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			region = append(region, cur.y*b.size+cur.x)
+			for _, n := range b.neighbors(cur) {
+				j := n.y*b.size + n.x
+				switch ns := b.grid[j]; {
+				case ns == empty && !visited[j]:
+					visited[j] = true
+					stack = append(stack, n)
+				case ns != empty && border == empty:
+					border = ns
+				case ns != empty && ns != border:
+					mixed = true
+				}
+			}
+		}
+		if mixed {
+			border = empty
+		}
+		for _, j := range region {
+			owner[j] = border
+		}
+	}
+	return owner
+}
+
+// score 数子法计算双方得分, 白方含贴目
+func (g *game) score(dead map[point]bool) (blackScore, whiteScore float64) {
+	for _, s := range g.territory(dead) {
+		switch s {
+		case blackStone:
+			blackScore++
+		case whiteStone:
+			whiteScore++
+		}
+	}
+	return blackScore, whiteScore + komi
+}
+
+// sgfPoint SGF 格式的坐标, 原点在左上角, 停一手为空
+func sgfPoint(p point, size int) string {
+	if p == passMove {
+		return ""
+	}
+	return string([]byte{byte('a' + p.x), byte('a' + size - 1 - p.y)})
+}
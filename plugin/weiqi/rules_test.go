@@ -0,0 +1,103 @@
+package weiqi
+
+import "testing"
+
+// playAll 依次落子, 坐标为空字符串时停一手
+func playAll(t *testing.T, g *game, moves ...string) {
+	t.Helper()
+	for _, s := range moves {
+		if s == "" {
+			g.pass()
+			continue
+		}
+		p, err := parsePoint(s, g.board.size)
+		if err != nil {
+			t.Fatalf("parsePoint(%q): %v", s, err)
+		}
+		if err = g.play(p); err != nil {
+			t.Fatalf("play(%s): %v", s, err)
+		}
+	}
+}
+
+func TestParsePoint(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		size  int
+		want  point
+		ok    bool
+	}{
+		{"A1", 19, point{0, 0}, true},
+		{"t19", 19, point{18, 18}, true},
+		{"J10", 19, point{8, 9}, true},
+		{"I5", 19, point{}, false},
+		{"K5", 9, point{}, false},
+		{"E10", 9, point{}, false},
+	} {
+		got, err := parsePoint(tc.input, tc.size)
+		if (err == nil) != tc.ok || (tc.ok && got != tc.want) {
+			t.Fatalf("parsePoint(%q, %d) = %v, %v", tc.input, tc.size, got, err)
+		}
+	}
+	if s := (point{8, 9}).String(); s != "J10" {
+		t.Fatalf("got %s", s)
+	}
+}
+
+func TestCaptureAndSuicide(t *testing.T) {
+	g := newGame(9)
+	// 黑方包围角上的白子并提掉
+	playAll(t, g, "B1", "A1", "A2")
+	if g.board.at(point{0, 0}) != empty || g.captures[blackStone] != 1 {
+		t.Fatal("white stone at A1 should be captured")
+	}
+	// 白方在 A1 落子是自杀
+	if err := g.play(point{0, 0}); err != errSuicide {
+		t.Fatalf("got %v, want errSuicide", err)
+	}
+	if err := g.play(point{1, 0}); err != errOccupied {
+		t.Fatalf("got %v, want errOccupied", err)
+	}
+}
+
+func TestKo(t *testing.T) {
+	g := newGame(9)
+	playAll(t, g, "D4", "E4", "C5", "F5", "D6", "E6", "E5", "D5")
+	// 白方 D5 提掉 E5, 黑方不能立即在 E5 提回
+	if g.board.at(point{4, 4}) != empty {
+		t.Fatal("E5 should be captured")
+	}
+	if err := g.play(point{4, 4}); err != errKo {
+		t.Fatalf("got %v, want errKo", err)
+	}
+	// 黑方在别处走一手后可以提回
+	playAll(t, g, "A9", "A8", "E5")
+	if g.board.at(point{3, 4}) != empty {
+		t.Fatal("D5 should be captured")
+	}
+}
+
+func TestScore(t *testing.T) {
+	g := newGame(9)
+	// 黑方占据左边四路, 白方占据右边五路
+	var moves []string
+	for y := 1; y <= 9; y++ {
+		moves = append(moves, "D"+string(rune('0'+y)), "E"+string(rune('0'+y)))
+	}
+	playAll(t, g, moves...)
+	black, white := g.score(nil)
+	if black != 36 || white != 45+komi {
+		t.Fatalf("score = %v, %v", black, white)
+	}
+	// 白方在黑空中的死子被标记后归黑方所有
+	playAll(t, g, "", "B5", "")
+	dead := map[point]bool{{1, 4}: true}
+	black, white = g.score(dead)
+	if black != 36 || white != 45+komi {
+		t.Fatalf("score with dead stones = %v, %v", black, white)
+	}
+	// 未标记死子时左边不属于任何一方
+	if black, _ = g.score(nil); black != 9 {
+		t.Fatalf("score without dead stones = %v", black)
+	}
+}
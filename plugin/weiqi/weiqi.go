@@ -0,0 +1,208 @@
+// Package weiqi 围棋
+package weiqi
+
+import (
+	"strconv"
+	"time"
+
+	ctrl "github.com/FloatTech/zbpctrl"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const helpString = `- 参与/创建一盘游戏：「围棋 [9|13|19]」(weiqi)，默认 19 路，创建者执黑先行，白方贴 7.5 目
+- 落子：「落子 D4」，列为字母 A~T（跳过 I），行为数字，从左下角起算
+- 停一手：「停一手」(pass)，双方连续停一手后进入数子阶段
+- 数子阶段标记或取消标记死子：「死子 D4」，以整块棋为单位
+- 确认数子结果：「确认结果」，双方均确认后按数子法判定胜负，对死活有异议可直接落子继续对局
+- 投降认输：「围棋认输」
+- 请求、接受和棋：「围棋和棋」
+- 中断对局：「围棋中断」（仅群主/管理员有效），6 小时无人落子的对局会自动中断，重启后对局不会丢失
+- 观战本群对局并在结束时收到通知：「围棋观战」，「取消围棋观战」
+- 查看等级分排行榜：「围棋排行榜」
+- 查看自己的等级分：「围棋等级分」
+- 查看棋谱：「围棋棋谱 #编号」，棋谱为 SGF 格式`
+
+var (
+	limit  = ctxext.NewLimiterManager(time.Microsecond*2500, 1)
+	engine = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+		DisableOnDefault:  false,
+		Brief:             "围棋",
+		Help:              helpString,
+		PrivateDataFolder: "weiqi",
+	}).ApplySingle(ctxext.GroupSingle)
+)
+
+func init() {
+	// 初始化数据库
+	dbFilePath := engine.DataFolder() + "weiqi.db"
+	initDatabase(dbFilePath)
+	// 恢复未结束的对局, 并开始超时计时
+	weiqiRooms = newRoomManager()
+	// 注册指令
+	engine.OnRegex(`^(?:围棋|weiqi)\s*(9|13|19)?(?:路)?$`, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			size, _ := strconv.Atoi(ctx.State["regex_matched"].([]string)[1])
+			weiqiRooms.Lock()
+			replyMessage, err := createGame(ctx.Event.GroupID, ctx.Event.UserID, ctx.Event.Sender.NickName, ctx.Event.SelfID, size)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^落子\s*([A-Ta-t]\s*\d{1,2})$`, zero.OnlyGroup, weiqiRooms.Rule()).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			coord := ctx.State["regex_matched"].([]string)[1]
+			weiqiRooms.Lock()
+			replyMessage, err := play(ctx.Event.GroupID, ctx.Event.UserID, coord)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatchGroup([]string{"停一手", "pass"}, zero.OnlyGroup, weiqiRooms.Rule()).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			weiqiRooms.Lock()
+			replyMessage, err := passTurn(ctx.Event.GroupID, ctx.Event.UserID)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^死子\s*([A-Ta-t]\s*\d{1,2})$`, zero.OnlyGroup, weiqiRooms.Rule()).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			coord := ctx.State["regex_matched"].([]string)[1]
+			weiqiRooms.Lock()
+			replyMessage, err := markDead(ctx.Event.GroupID, ctx.Event.UserID, coord)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("确认结果", zero.OnlyGroup, weiqiRooms.Rule()).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			weiqiRooms.Lock()
+			room, _ := weiqiRooms.Load(ctx.Event.GroupID)
+			replyMessage, err := confirmScore(ctx.Event.GroupID, ctx.Event.UserID)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+			reportResult(ctx, room)
+		})
+
+	engine.OnFullMatch("围棋认输", zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			weiqiRooms.Lock()
+			room, _ := weiqiRooms.Load(ctx.Event.GroupID)
+			replyMessage, err := resign(ctx.Event.GroupID, ctx.Event.UserID)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+			reportResult(ctx, room)
+		})
+
+	engine.OnFullMatch("围棋和棋", zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			weiqiRooms.Lock()
+			replyMessage, err := draw(ctx.Event.GroupID, ctx.Event.UserID)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("围棋中断", zero.OnlyGroup, zero.AdminPermission).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			weiqiRooms.Lock()
+			replyMessage, err := abort(ctx.Event.GroupID)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("围棋观战", zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			weiqiRooms.Lock()
+			replyMessage, err := watch(ctx.Event.GroupID, ctx.Event.UserID)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("取消围棋观战", zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			weiqiRooms.Lock()
+			replyMessage, err := unwatch(ctx.Event.GroupID, ctx.Event.UserID)
+			weiqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("围棋排行榜").SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			replyMessage, err := getRanking()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("围棋等级分").SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			replyMessage, err := rate(ctx.Event.UserID, ctx.Event.Sender.NickName)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^围棋棋谱\s*#?(\d+)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseUint(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			replyMessage, err := getRecord(uint(id))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+}
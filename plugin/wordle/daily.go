@@ -0,0 +1,219 @@
+package wordle
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+// dailyLength 每日挑战的单词长度
+const dailyLength = 5
+
+// shareEmoji 分享内容中每种提示对应的方块
+var shareEmoji = [...]string{
+	match:    "🟩",
+	exist:    "🟨",
+	notexist: "⬛",
+}
+
+// dailyRooms 进行中的每日挑战, 与挑战记录一样按群区分, 但每人每天只能在一个群挑战
+var dailyRooms = gameroom.New(gameroom.Options[*wordleRoom]{
+	Name:    "wordle",
+	Brief:   "每日猜单词",
+	Timeout: 120 * time.Second,
+	Warning: 15 * time.Second,
+	Key: func(ctx *zero.Ctx) int64 {
+		return dailyKey(ctx.Event.GroupID, ctx.Event.UserID)
+	},
+	OnWarn: func(_ int64, room *wordleRoom) *gameroom.Event {
+		return &gameroom.Event{Message: message.Message{message.At(room.Current().UID), message.Text("每日猜单词，你还有15s作答时间")}}
+	},
+	OnTimeout: func(_ int64, room *wordleRoom) *gameroom.Event {
+		msg, err := finishDaily(room, false)
+		if err != nil {
+			return &gameroom.Event{Message: message.Message{message.Text("ERROR: ", err)}}
+		}
+		return &gameroom.Event{Message: message.ReplyWithMessage(room.messageID, message.Text("每日猜单词超时，", msg))}
+	},
+})
+
+// dailyKey 每日挑战房间的键, 由群号与 QQ 号确定
+func dailyKey(gid, uid int64) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10)))
+	return int64(h.Sum64())
+}
+
+// dailyWord 当天的单词, 只由日期决定, 所有群所有人相同
+func dailyWord(list []string, date int) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strconv.Itoa(date)))
+	return list[h.Sum64()%uint64(len(list))]
+}
+
+// startDaily 开始今天的每日挑战, 开始即计入挑战次数, 中途放弃视为失败
+func startDaily(ctx *zero.Ctx, hard bool) {
+	gid, uid := ctx.Event.GroupID, ctx.Event.UserID
+	// 每日挑战固定使用内置词库, 不受群词库设置影响
+	list, err := getList(builtinList)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	if len(list[dailyLength]) == 0 {
+		ctx.SendChain(message.Text("ERROR: 内置词库中没有", dailyLength, "个字母的单词"))
+		return
+	}
+	r, err := wdb.getDaily(gid, uid)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	now := time.Now()
+	today := dateOf(now)
+	if r.Date == today {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("今天已经挑战过了, 明天再来吧\n", r.Grid)))
+		return
+	}
+	// 所有群的单词相同, 在其它群挑战过就不能再来一次
+	played, err := wdb.playedDaily(uid, today)
+	if err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	if played {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("今天已经在其它群挑战过了, 明天再来吧")))
+		return
+	}
+	target := dailyWord(list[dailyLength], today)
+	game := newWordleGame(target, list[dailyLength], hard)
+	_, img, _ := game("")
+	room := &wordleRoom{
+		Room:      gameroom.NewRoom(ctx),
+		messageID: ctx.Event.MessageID,
+		target:    target,
+		hard:      hard,
+		daily:     today,
+		list:      list[dailyLength],
+		play:      game,
+	}
+	dailyRooms.Lock()
+	err = dailyRooms.Create(dailyKey(gid, uid), room)
+	dailyRooms.Unlock()
+	if err != nil {
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text("你正在进行每日挑战")))
+		return
+	}
+	r.Streak = r.streak(now)
+	r.Date, r.Won, r.Grid = today, false, ""
+	r.Played++
+	if err = wdb.saveDaily(&r); err != nil {
+		ctx.SendChain(message.Text("ERROR: ", err))
+		return
+	}
+	msg := message.Message{
+		message.ImageBytes(img),
+		message.Text("每日挑战: 所有人今天的单词相同, 你有", dailyLength+1, "次机会猜出单词，单词长度为", dailyLength, "，请发送单词"),
+	}
+	if hard {
+		msg = append(msg, message.Text("\n困难模式: 已知的提示必须在之后的猜测中使用"))
+	}
+	ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, msg...))
+}
+
+// finishDaily 记录挑战结果, 返回分享内容与连胜信息, 失败时不公布答案以免剧透
+func finishDaily(room *wordleRoom, won bool) (string, error) {
+	r, err := wdb.getDaily(room.GroupID, room.Current().UID)
+	if err != nil {
+		return "", err
+	}
+	r.Date, r.Won, r.Grid = room.daily, won, shareText(room, won)
+	if won {
+		r.Wins++
+		r.Streak++
+		if r.Streak > r.MaxStreak {
+			r.MaxStreak = r.Streak
+		}
+	} else {
+		r.Streak = 0
+	}
+	if err = wdb.saveDaily(&r); err != nil {
+		return "", err
+	}
+	if won {
+		return "太棒了，你猜出来了！已连续挑战成功 " + strconv.Itoa(r.Streak) + " 天\n\n" + r.Grid, nil
+	}
+	return "今天的挑战失败了, 明天再来吧\n\n" + r.Grid, nil
+}
+
+// shareText 与原版游戏相同的方块分享内容, 困难模式在次数后加 *
+func shareText(room *wordleRoom, won bool) string {
+	var sb strings.Builder
+	sb.WriteString("每日猜单词 ")
+	sb.WriteString(formatDate(room.daily))
+	sb.WriteByte(' ')
+	if won {
+		sb.WriteString(strconv.Itoa(len(room.guesses)))
+	} else {
+		sb.WriteByte('X')
+	}
+	sb.WriteString("/" + strconv.Itoa(len(room.target)+1))
+	if room.hard {
+		sb.WriteByte('*')
+	}
+	for _, g := range room.guesses {
+		sb.WriteByte('\n')
+		for _, f := range feedback(room.target, g) {
+			sb.WriteString(shareEmoji[f])
+		}
+	}
+	return sb.String()
+}
+
+// formatDate 将 20260101 格式化为 2026-01-01
+func formatDate(date int) string {
+	s := strconv.Itoa(date)
+	if len(s) != 8 {
+		return s
+	}
+	return s[:4] + "-" + s[4:6] + "-" + s[6:]
+}
+
+// streak 当前连胜, 昨天或今天挑战成功才能延续
+func (r *dailyRecord) streak(now time.Time) int {
+	if r.Date == dateOf(now) || (r.Date == dateOf(now.AddDate(0, 0, -1)) && r.Won) {
+		return r.Streak
+	}
+	return 0
+}
+
+// String 每日挑战战绩
+func (r *dailyRecord) String() string {
+	now := time.Now()
+	if r.Played == 0 {
+		return "还没有参加过每日挑战, 发送「每日猜单词」开始"
+	}
+	var sb strings.Builder
+	sb.WriteString("每日挑战 ")
+	sb.WriteString(strconv.Itoa(r.Played))
+	sb.WriteString(" 次, 成功 ")
+	sb.WriteString(strconv.Itoa(r.Wins))
+	sb.WriteString(" 次, 胜率 ")
+	sb.WriteString(strconv.Itoa(r.Wins * 100 / r.Played))
+	sb.WriteString("%\n当前连胜 ")
+	sb.WriteString(strconv.Itoa(r.streak(now)))
+	sb.WriteString(" 天, 最长连胜 ")
+	sb.WriteString(strconv.Itoa(r.MaxStreak))
+	sb.WriteString(" 天")
+	if r.Date == dateOf(now) && r.Grid != "" {
+		sb.WriteString("\n\n")
+		sb.WriteString(r.Grid)
+	}
+	return sb.String()
+}
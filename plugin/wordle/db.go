@@ -0,0 +1,120 @@
+package wordle
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	sql "github.com/FloatTech/sqlite"
+)
+
+const (
+	configTable = "config"
+	dailyTable  = "daily"
+)
+
+// config 群设置
+type config struct {
+	GID  int64  `db:"gid"`
+	List string `db:"list"` // 出题使用的词库
+}
+
+// dailyRecord 群员的每日挑战记录
+type dailyRecord struct {
+	Key       string `db:"key"` // gid_uid
+	GID       int64  `db:"gid"`
+	UID       int64  `db:"uid"`
+	Date      int    `db:"date"` // 最近一次挑战的日期, 如 20260101
+	Won       bool   `db:"won"`
+	Grid      string `db:"grid"` // 最近一次挑战的分享内容
+	Streak    int    `db:"streak"`
+	MaxStreak int    `db:"max_streak"`
+	Played    int    `db:"played"`
+	Wins      int    `db:"wins"`
+}
+
+// storage 猜单词数据库
+type storage struct {
+	sync.RWMutex
+	db  sql.Sqlite
+	err error // 打开失败的原因, 此时只能使用内置词库, 每日挑战不可用
+}
+
+var wdb = &storage{}
+
+// open 打开数据库, 失败时记录原因, 之后的读写都返回该错误
+func (s *storage) open(path string) error {
+	s.db = sql.New(path)
+	s.err = s.db.Open(time.Hour * 24)
+	if s.err == nil {
+		s.err = s.db.Create(configTable, &config{})
+	}
+	if s.err == nil {
+		s.err = s.db.Create(dailyTable, &dailyRecord{})
+	}
+	return s.err
+}
+
+// listOf 群使用的词库, 未设置时为内置词库
+func (s *storage) listOf(gid int64) string {
+	s.RLock()
+	defer s.RUnlock()
+	if s.err != nil {
+		return builtinList
+	}
+	var c config
+	if err := s.db.Find(configTable, &c, "WHERE gid = ?", gid); err != nil || c.List == "" {
+		return builtinList
+	}
+	return c.List
+}
+
+func (s *storage) setList(gid int64, name string) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.db.Insert(configTable, &config{GID: gid, List: name})
+}
+
+// getDaily 获取群员的每日挑战记录, 没有记录时返回空记录
+func (s *storage) getDaily(gid, uid int64) (r dailyRecord, err error) {
+	s.RLock()
+	defer s.RUnlock()
+	if s.err != nil {
+		return r, s.err
+	}
+	key := strconv.FormatInt(gid, 10) + "_" + strconv.FormatInt(uid, 10)
+	err = s.db.Find(dailyTable, &r, "WHERE key = ?", key)
+	if errors.Is(err, sql.ErrNullResult) {
+		return dailyRecord{Key: key, GID: gid, UID: uid}, nil
+	}
+	return
+}
+
+// playedDaily 用户在 date 当天是否已在某个群挑战过
+func (s *storage) playedDaily(uid int64, date int) (bool, error) {
+	s.RLock()
+	defer s.RUnlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	return s.db.CanFind(dailyTable, "WHERE uid = ? AND date = ?", uid, date), nil
+}
+
+func (s *storage) saveDaily(r *dailyRecord) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	return s.db.Insert(dailyTable, r)
+}
+
+// dateOf 日期的数字表示, 如 20260101
+func dateOf(t time.Time) int {
+	y, m, d := t.Date()
+	return y*10000 + int(m)*100 + d
+}
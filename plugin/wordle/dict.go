@@ -0,0 +1,170 @@
+package wordle
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/FloatTech/floatbox/binary"
+	"github.com/FloatTech/floatbox/file"
+)
+
+// builtinList 内置的四级词库, 其它词库放在数据目录的 lists 文件夹下, 每行一个单词
+const builtinList = "CET4"
+
+// 支持的单词长度
+const (
+	minLength = 5
+	maxLength = 7
+)
+
+var listNameRe = regexp.MustCompile(`^[\w\p{Han}-]+$`)
+
+// wordList 按长度分组的词库, 每组已排序
+type wordList map[int][]string
+
+// total 词库中的单词数
+func (l wordList) total() (n int) {
+	for _, ws := range l {
+		n += len(ws)
+	}
+	return
+}
+
+func listDir() string {
+	return en.DataFolder() + "lists/"
+}
+
+// normalizeListName 词库名不区分大小写, 统一为大写
+func normalizeListName(name string) (string, error) {
+	if !listNameRe.MatchString(name) {
+		return "", errors.New("非法的词库名: " + name)
+	}
+	return strings.ToUpper(name), nil
+}
+
+// parseWordList 解析词库文本, 每行取第一个单词, 只保留支持长度的纯字母单词
+func parseWordList(data string) wordList {
+	l := make(wordList)
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		w := strings.ToLower(fields[0])
+		if len(w) < minLength || len(w) > maxLength || seen[w] || !isLetters(w) {
+			continue
+		}
+		seen[w] = true
+		l[len(w)] = append(l[len(w)], w)
+	}
+	for _, ws := range l {
+		sort.Strings(ws)
+	}
+	return l
+}
+
+func isLetters(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'a' || s[i] > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// getList 获取词库, 每次都从文件读取, 放入新的词库文件后无需重启
+func getList(name string) (wordList, error) {
+	name, err := normalizeListName(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == builtinList {
+		// 内置词库的文件末尾可能有空行
+		l := make(wordList)
+		for i := minLength; i <= maxLength; i++ {
+			for _, w := range words[i].cet4 {
+				if len(w) == i {
+					l[i] = append(l[i], w)
+				}
+			}
+		}
+		return l, nil
+	}
+	data, err := os.ReadFile(listFile(name))
+	if err != nil {
+		return nil, errors.New("未找到词库: " + name)
+	}
+	l := parseWordList(binary.BytesToString(data))
+	if l.total() == 0 {
+		return nil, errors.New("词库 " + name + " 中没有 5~7 个字母的单词")
+	}
+	return l, nil
+}
+
+// saveList 保存上传的词库, 覆盖同名词库
+func saveList(name, data string) (string, wordList, error) {
+	name, err := normalizeListName(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if name == builtinList {
+		return "", nil, errors.New("不能覆盖内置词库 " + builtinList)
+	}
+	l := parseWordList(data)
+	if l.total() == 0 {
+		return "", nil, errors.New("没有找到 5~7 个字母的单词")
+	}
+	if file.IsNotExist(listDir()) {
+		if err = os.MkdirAll(listDir(), 0755); err != nil {
+			return "", nil, err
+		}
+	}
+	var sb strings.Builder
+	for i := minLength; i <= maxLength; i++ {
+		for _, w := range l[i] {
+			sb.WriteString(w)
+			sb.WriteByte('\n')
+		}
+	}
+	return name, l, os.WriteFile(listFile(name), binary.StringToBytes(sb.String()), 0644)
+}
+
+// listFile 词库文件的路径, 手动放入的文件名可以不是大写
+func listFile(name string) string {
+	entries, _ := os.ReadDir(listDir())
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), name+".txt") {
+			return listDir() + e.Name()
+		}
+	}
+	return listDir() + name + ".txt"
+}
+
+// listNames 所有可用的词库
+func listNames() []string {
+	names := []string{builtinList}
+	entries, err := os.ReadDir(listDir())
+	if err != nil {
+		return names
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".txt")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if name, err = normalizeListName(name); err == nil && name != builtinList {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// contains 在已排序的单词中查找
+func contains(ws []string, w string) bool {
+	i := sort.SearchStrings(ws, w)
+	return i < len(ws) && ws[i] == w
+}
@@ -21,14 +21,18 @@ import (
 	ctrl "github.com/FloatTech/zbpctrl"
 	"github.com/FloatTech/zbputils/control"
 	"github.com/FloatTech/zbputils/ctxext"
+	"github.com/sirupsen/logrus"
 	zero "github.com/wdvxdr1123/ZeroBot"
 	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
 )
 
 var (
 	errLengthNotEnough = errors.New("length not enough")
 	errUnknownWord     = errors.New("unknown word")
 	errTimesRunOut     = errors.New("times run out")
+	errHardMode        = errors.New("困难模式")
 )
 
 const (
@@ -59,18 +63,25 @@ type dictionary map[int]struct {
 
 var words = make(dictionary)
 
-func init() {
-	en := control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+var (
+	en = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
 		DisableOnDefault: false,
 		Brief:            "猜单词",
 		Help: "- 个人猜单词\n" +
 			"- 团队猜单词\n" +
 			"- 团队六阶猜单词\n" +
-			"- 团队七阶猜单词",
+			"- 团队七阶猜单词\n" +
+			"- 个人困难猜单词 (困难模式下必须使用已知的提示: 绿色字母位置不变, 黄色字母必须出现)\n" +
+			"- 每日猜单词 (所有人的单词相同, 使用内置词库, 每人每天只能在一个群挑战一次)\n" +
+			"- 每日困难猜单词\n" +
+			"- 每日猜单词战绩\n" +
+			"- 猜单词词库\n" +
+			"- [群管] 设置猜单词词库 CET6\n" +
+			"- [超管] 上传猜单词词库 名称 换行后每行一个单词\n" +
+			"- 也可以将「名称.txt」放入数据目录的 lists 文件夹作为词库, 如 CET6, TOEFL, GRE",
 		PublicDataFolder: "Wordle",
-	}).ApplySingle(ctxext.NewGroupSingle("已经有正在进行的游戏..."))
-
-	en.OnRegex(`^(个人|团队)(五阶|六阶|七阶)?猜单词$`, zero.OnlyGroup, fcext.DoOnceOnSuccess(
+	})
+	initialized = fcext.DoOnceOnSuccess(
 		func(ctx *zero.Ctx) bool {
 			var errcnt uint32
 			var wg sync.WaitGroup
@@ -115,97 +126,288 @@ func init() {
 			}
 			return true
 		},
-	)).SetBlock(true).Limit(ctxext.LimitByUser).
+	)
+)
+
+func init() {
+	if err := wdb.open(en.DataFolder() + "wordle.db"); err != nil {
+		logrus.Errorln("[wordle] 打开数据库失败, 只能使用内置词库, 每日挑战不可用:", err)
+	}
+
+	en.OnRegex(`^(个人|团队)(困难)?(五阶|六阶|七阶)?猜单词$`, zero.OnlyGroup, initialized).SetBlock(true).Limit(ctxext.LimitByUser).
 		Handle(func(ctx *zero.Ctx) {
-			class := classdict[ctx.State["regex_matched"].([]string)[2]]
-			target := words[class].cet4[rand.Intn(len(words[class].cet4))]
+			matched := ctx.State["regex_matched"].([]string)
+			class := classdict[matched[3]]
+			listName := wdb.listOf(ctx.Event.GroupID)
+			list, err := getList(listName)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			if len(list[class]) == 0 {
+				ctx.SendChain(message.Text("ERROR: 词库 ", listName, " 中没有", class, "个字母的单词"))
+				return
+			}
+			target := list[class][rand.Intn(len(list[class]))]
 			tt, err := tl.Translate(target)
 			if err != nil {
 				ctx.SendChain(message.Text("ERROR: ", err))
 				return
 			}
-			game := newWordleGame(target)
+			hard := matched[2] != ""
+			game := newWordleGame(target, list[class], hard)
 			_, img, _ := game("")
-			ctx.Send(
-				message.ReplyWithMessage(ctx.Event.MessageID,
-					message.ImageBytes(img),
-					message.Text("你有", class+1, "次机会猜出单词，单词长度为", class, "，请发送单词"),
-				),
-			)
-			var next *zero.FutureEvent
-			if ctx.State["regex_matched"].([]string)[1] == "个人" {
-				next = zero.NewFutureEvent("message", 999, false, zero.RegexRule(fmt.Sprintf(`^([A-Z]|[a-z]){%d}$`, class)),
-					zero.OnlyGroup, ctx.CheckSession())
-			} else {
-				next = zero.NewFutureEvent("message", 999, false, zero.RegexRule(fmt.Sprintf(`^([A-Z]|[a-z]){%d}$`, class)),
-					zero.OnlyGroup, zero.CheckGroup(ctx.Event.GroupID))
+			room := &wordleRoom{
+				Room:      gameroom.NewRoom(ctx),
+				messageID: ctx.Event.MessageID,
+				target:    target,
+				meaning:   tt,
+				team:      matched[1] == "团队",
+				hard:      hard,
+				list:      list[class],
+				play:      game,
 			}
-			var win bool
-			recv, cancel := next.Repeat()
-			defer cancel()
-			tick := time.NewTimer(105 * time.Second)
-			after := time.NewTimer(120 * time.Second)
-			for {
-				select {
-				case <-tick.C:
-					ctx.SendChain(message.Text("猜单词，你还有15s作答时间"))
-				case <-after.C:
-					ctx.Send(
-						message.ReplyWithMessage(ctx.Event.MessageID,
-							message.Text("猜单词超时，游戏结束...答案是: ", target, "(", tt, ")"),
-						),
-					)
-					return
-				case c := <-recv:
-					tick.Reset(105 * time.Second)
-					after.Reset(120 * time.Second)
-					win, img, err = game(c.Event.Message.String())
-					switch {
-					case win:
-						tick.Stop()
-						after.Stop()
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.ImageBytes(img),
-								message.Text("太棒了，你猜出来了！答案是: ", target, "(", tt, ")"),
-							),
-						)
-						return
-					case err == errTimesRunOut:
-						tick.Stop()
-						after.Stop()
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.ImageBytes(img),
-								message.Text("游戏结束...答案是: ", target, "(", tt, ")"),
-							),
-						)
-						return
-					case err == errLengthNotEnough:
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.Text("单词长度错误"),
-							),
-						)
-					case err == errUnknownWord:
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.Text("你确定存在这样的单词吗？"),
-							),
-						)
-					default:
-						ctx.Send(
-							message.ReplyWithMessage(c.Event.MessageID,
-								message.ImageBytes(img),
-							),
-						)
-					}
+			rooms.Lock()
+			err = rooms.Create(gameroom.KeyOf(ctx), room)
+			rooms.Unlock()
+			if err != nil {
+				ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(err)))
+				return
+			}
+			msg := message.Message{
+				message.ImageBytes(img),
+				message.Text("你有", class+1, "次机会猜出单词，单词长度为", class, "，请发送单词"),
+			}
+			if hard {
+				msg = append(msg, message.Text("\n困难模式: 已知的提示必须在之后的猜测中使用"))
+			}
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, msg...))
+		})
+
+	en.OnRegex(`^每日(困难)?猜单词$`, zero.OnlyGroup, initialized).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			startDaily(ctx, ctx.State["regex_matched"].([]string)[1] != "")
+		})
+
+	en.OnFullMatch("每日猜单词战绩", zero.OnlyGroup).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			r, err := wdb.getDaily(ctx.Event.GroupID, ctx.Event.UserID)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.Text(r.String())))
+		})
+
+	en.OnFullMatch("猜单词词库", zero.OnlyGroup, initialized).SetBlock(true).Limit(ctxext.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			current := wdb.listOf(ctx.Event.GroupID)
+			var sb strings.Builder
+			sb.WriteString("本群词库: ")
+			sb.WriteString(current)
+			sb.WriteString("\n可用词库:")
+			for _, name := range listNames() {
+				l, err := getList(name)
+				if err != nil {
+					continue
 				}
+				sb.WriteString(fmt.Sprintf("\n%s: 五阶 %d, 六阶 %d, 七阶 %d", name, len(l[5]), len(l[6]), len(l[7])))
+			}
+			ctx.SendChain(message.Text(sb.String()))
+		})
+
+	en.OnRegex(`^设置猜单词词库\s*(\S+)$`, zero.OnlyGroup, zero.AdminPermission, initialized).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			name, err := normalizeListName(ctx.State["regex_matched"].([]string)[1])
+			if err == nil {
+				_, err = getList(name)
+			}
+			if err == nil {
+				err = wdb.setList(ctx.Event.GroupID, name)
+			}
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
 			}
+			ctx.SendChain(message.Text("已将本群的猜单词词库设置为 ", name, ", 将在下一局生效"))
 		})
+
+	en.OnRegex(`^上传猜单词词库\s*(\S+)\s*\n([\s\S]+)$`, zero.SuperUserPermission).SetBlock(true).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			name, l, err := saveList(matched[1], matched[2])
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.SendChain(message.Text("已保存词库 ", name, ": 五阶 ", len(l[5]), ", 六阶 ", len(l[6]), ", 七阶 ", len(l[7]),
+				"\n群管理员发送「设置猜单词词库 ", name, "」即可使用"))
+		})
+
+	// 每日挑战优先, 进行中的每日挑战按用户区分
+	en.OnRegex(`^[A-Za-z]{5,7}$`, zero.OnlyGroup, dailyRooms.Rule(canGuess)).
+		Handle(func(ctx *zero.Ctx) {
+			guess(ctx, dailyRooms)
+		})
+
+	en.OnRegex(`^[A-Za-z]{5,7}$`, zero.OnlyGroup, rooms.Rule(canGuess)).
+		Handle(func(ctx *zero.Ctx) {
+			guess(ctx, rooms)
+		})
+}
+
+// wordleRoom 一局猜单词
+type wordleRoom struct {
+	gameroom.Room
+	messageID any // 开局的消息, 超时时回复
+	target    string
+	meaning   string
+	team      bool     // 团队模式群内所有人都可以作答, 个人模式只有开局者可以作答
+	hard      bool     // 困难模式
+	daily     int      // 每日挑战的日期, 普通对局为 0
+	guesses   []string // 有效的猜测, 用于生成分享内容
+	list      []string // 开局词库中的单词, 与内置字典一起作为可以作答的单词
+	play      func(string) (bool, []byte, error)
+}
+
+// rooms 各群正在进行的猜单词
+var rooms = gameroom.New(gameroom.Options[*wordleRoom]{
+	Name:    "wordle",
+	Brief:   "猜单词",
+	Timeout: 120 * time.Second,
+	Warning: 15 * time.Second,
+	OnWarn: func(int64, *wordleRoom) *gameroom.Event {
+		return &gameroom.Event{Message: message.Message{message.Text("猜单词，你还有15s作答时间")}}
+	},
+	OnTimeout: func(_ int64, room *wordleRoom) *gameroom.Event {
+		return &gameroom.Event{Message: message.ReplyWithMessage(room.messageID,
+			message.Text("猜单词超时，游戏结束...答案是: ", room.target, "(", room.meaning, ")"),
+		)}
+	},
+})
+
+// canGuess 单词长度正确, 且个人模式下只有开局者可以作答, 只有词库中的单词才阻止后续插件处理
+func canGuess(ctx *zero.Ctx, room *wordleRoom) bool {
+	s := strings.ToLower(ctx.Event.Message.String())
+	if ctx.Event.GroupID != room.GroupID || len(s) != len(room.target) || !(room.team || room.IsPlayer(ctx.Event.UserID)) {
+		return false
+	}
+	if s == room.target || isWord(s, room.list) {
+		ctx.Block()
+	}
+	return true
+}
+
+// guess 处理一次猜测
+func guess(ctx *zero.Ctx, m *gameroom.Manager[*wordleRoom]) {
+	key := m.KeyOf(ctx)
+	m.Lock()
+	room, ok := m.Load(key)
+	if !ok {
+		m.Unlock()
+		return
+	}
+	room.Touch()
+	s := strings.ToLower(ctx.Event.Message.String())
+	win, img, err := room.play(s)
+	if win || err == nil || err == errTimesRunOut {
+		room.guesses = append(room.guesses, s)
+	}
+	if win || err == errTimesRunOut {
+		m.Delete(key)
+	}
+	m.Unlock()
+	switch {
+	case room.daily != 0 && (win || err == errTimesRunOut):
+		msg, e := finishDaily(room, win)
+		if e != nil {
+			ctx.SendChain(message.Text("ERROR: ", e))
+			return
+		}
+		ctx.Send(message.ReplyWithMessage(ctx.Event.MessageID, message.ImageBytes(img), message.Text(msg)))
+		if win {
+			m.Report(ctx, ctx.Event.GroupID, gameroom.Win(ctx.Event.UserID))
+		}
+	case win:
+		ctx.Send(
+			message.ReplyWithMessage(ctx.Event.MessageID,
+				message.ImageBytes(img),
+				message.Text("太棒了，你猜出来了！答案是: ", room.target, "(", room.meaning, ")"),
+			),
+		)
+		m.Report(ctx, ctx.Event.GroupID, gameroom.Win(ctx.Event.UserID))
+	case err == errTimesRunOut:
+		ctx.Send(
+			message.ReplyWithMessage(ctx.Event.MessageID,
+				message.ImageBytes(img),
+				message.Text("游戏结束...答案是: ", room.target, "(", room.meaning, ")"),
+			),
+		)
+	case err == errLengthNotEnough:
+		ctx.Send(
+			message.ReplyWithMessage(ctx.Event.MessageID,
+				message.Text("单词长度错误"),
+			),
+		)
+	case err == errUnknownWord:
+		ctx.Send(
+			message.ReplyWithMessage(ctx.Event.MessageID,
+				message.Text("你确定存在这样的单词吗？"),
+			),
+		)
+	case errors.Is(err, errHardMode):
+		ctx.Send(
+			message.ReplyWithMessage(ctx.Event.MessageID,
+				message.Text(err),
+			),
+		)
+	default:
+		ctx.Send(
+			message.ReplyWithMessage(ctx.Event.MessageID,
+				message.ImageBytes(img),
+			),
+		)
+	}
+}
+
+// feedback 每个字母的提示, 与图片中的颜色一致
+func feedback(target, s string) []int {
+	res := make([]int, len(s))
+	for i := range s {
+		switch {
+		case s[i] == target[i]:
+			res[i] = match
+		case strings.IndexByte(target, s[i]) != -1:
+			res[i] = exist
+		default:
+			res[i] = notexist
+		}
+	}
+	return res
 }
 
-func newWordleGame(target string) func(string) (bool, []byte, error) {
+// checkHardMode 困难模式下必须使用已知的提示: 绿色字母位置不变, 黄色字母必须出现
+func checkHardMode(target string, record []string, s string) error {
+	for _, r := range record {
+		for i, f := range feedback(target, r) {
+			switch {
+			case f == match && s[i] != r[i]:
+				return fmt.Errorf("%w: 第%d个字母必须是 %s", errHardMode, i+1, strings.ToUpper(r[i:i+1]))
+			case f == exist && strings.IndexByte(s, r[i]) == -1:
+				return fmt.Errorf("%w: 必须包含字母 %s", errHardMode, strings.ToUpper(r[i:i+1]))
+			}
+		}
+	}
+	return nil
+}
+
+// isWord 单词在内置字典或词库 list 中
+func isWord(s string, list []string) bool {
+	return contains(words[len(s)].dict, s) || contains(list, s)
+}
+
+// newWordleGame 开始一局, list 中的单词与内置字典中的单词都可以作答
+func newWordleGame(target string, list []string, hard bool) func(string) (bool, []byte, error) {
 	var class = len(target)
 	record := make([]string, 0, len(target)+1)
 	return func(s string) (win bool, data []byte, err error) {
@@ -218,11 +420,15 @@ func newWordleGame(target string) func(string) (bool, []byte, error) {
 					err = errLengthNotEnough
 					return
 				}
-				i := sort.SearchStrings(words[class].dict, s)
-				if i >= len(words[class].dict) || words[class].dict[i] != s {
+				if !isWord(s, list) {
 					err = errUnknownWord
 					return
 				}
+				if hard {
+					if err = checkHardMode(target, record, s); err != nil {
+						return
+					}
+				}
 			}
 			record = append(record, s)
 		}
@@ -232,17 +438,14 @@ func newWordleGame(target string) func(string) (bool, []byte, error) {
 		ctx.SetColor(color.RGBA{255, 255, 255, 255})
 		ctx.Clear()
 		for i := 0; i < class+1; i++ {
+			var hints []int
+			if len(record) > i {
+				hints = feedback(target, record[i])
+			}
 			for j := 0; j < class; j++ {
 				if len(record) > i {
 					ctx.DrawRectangle(float64(space+j*(side+4)), float64(space+i*(side+4)), float64(side), float64(side))
-					switch {
-					case record[i][j] == target[j]:
-						ctx.SetColor(colors[match])
-					case strings.IndexByte(target, record[i][j]) != -1:
-						ctx.SetColor(colors[exist])
-					default:
-						ctx.SetColor(colors[notexist])
-					}
+					ctx.SetColor(colors[hints[j]])
 					ctx.Fill()
 					ctx.SetColor(color.RGBA{255, 255, 255, 255})
 					ctx.DrawString(strings.ToUpper(string(record[i][j])), float64(10+j*(side+4)+7), float64(10+i*(side+4)+15))
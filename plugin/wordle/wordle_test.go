@@ -0,0 +1,77 @@
+package wordle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckHardMode(t *testing.T) {
+	// crane 对 cargo: c 位置正确, a r 存在
+	record := []string{"crane"}
+	for _, tc := range []struct {
+		guess string
+		ok    bool
+	}{
+		{"carol", true},
+		{"cairn", true},
+		{"arced", false}, // c 不在第一位
+		{"cloud", false}, // 缺少 a 与 r
+		{"chart", true},
+	} {
+		err := checkHardMode("cargo", record, tc.guess)
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.guess, err)
+		}
+		if !tc.ok && !errors.Is(err, errHardMode) {
+			t.Errorf("%s: 应违反困难模式", tc.guess)
+		}
+	}
+}
+
+func TestShareText(t *testing.T) {
+	room := &wordleRoom{target: "cargo", daily: 20260101, hard: true, guesses: []string{"crane", "cargo"}}
+	want := "每日猜单词 2026-01-01 2/6*\n🟩🟨🟨⬛⬛\n🟩🟩🟩🟩🟩"
+	if got := shareText(room, true); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	room.hard = false
+	want = "每日猜单词 2026-01-01 X/6\n🟩🟨🟨⬛⬛\n🟩🟩🟩🟩🟩"
+	if got := shareText(room, false); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestDaily(t *testing.T) {
+	if dailyKey(1, 2) == dailyKey(2, 1) || dailyKey(1, 2) != dailyKey(1, 2) {
+		t.Fatal("每日挑战的房间应按群与用户区分")
+	}
+	list := []string{"apple", "crane", "cargo", "light", "house"}
+	seen := make(map[string]bool)
+	for date := 20260101; date <= 20260131; date++ {
+		if dailyWord(list, date) != dailyWord(list, date) {
+			t.Fatalf("%d: 同一天的单词应相同", date)
+		}
+		seen[dailyWord(list, date)] = true
+	}
+	if len(seen) < 2 {
+		t.Fatal("不同日期的单词应有变化")
+	}
+}
+
+func TestParseWordList(t *testing.T) {
+	l := parseWordList("Apple 苹果\r\nbanana\nkiwi\napple\nstrange\nx-ray\n\nabsolute\n")
+	if len(l[5]) != 1 || l[5][0] != "apple" {
+		t.Fatalf("五阶 %v", l[5])
+	}
+	if len(l[6]) != 1 || len(l[7]) != 1 || l.total() != 3 {
+		t.Fatalf("词库 %v", l)
+	}
+	for _, name := range []string{"../etc", "a.b", ""} {
+		if _, err := normalizeListName(name); err == nil {
+			t.Errorf("%q 应为非法词库名", name)
+		}
+	}
+	if name, _ := normalizeListName("toefl"); name != "TOEFL" {
+		t.Fatalf("词库名 %s", name)
+	}
+}
@@ -0,0 +1,360 @@
+package xiangqi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+var errNotExist = errors.New("对局不存在, 发送「象棋」或「xiangqi」可创建对局。")
+
+type xiangqiRoom struct {
+	gameroom.Room
+	position    *position
+	moves       []move
+	notations   []string // 中文记谱, 与 moves 一一对应
+	redPlayer   int64
+	redName     string
+	blackPlayer int64
+	blackName   string
+	drawPlayer  int64
+	res         result // 对局结束后的结果
+}
+
+// result 对局结果, 按棋谱惯例表示
+type result string
+
+const (
+	redWon   result = "1-0"
+	blackWon result = "0-1"
+	drawn    result = "1/2-1/2"
+)
+
+// scores 红黑双方的得分
+func (r result) scores() (float64, float64) {
+	switch r {
+	case redWon:
+		return 1.0, 0.0
+	case blackWon:
+		return 0.0, 1.0
+	default:
+		return 0.5, 0.5
+	}
+}
+
+// createGame 创建或加入对局
+func createGame(groupCode, senderUin int64, senderName string, selfID int64) (msg message.Message, err error) {
+	room, ok := xiangqiRooms.Load(groupCode)
+	if !ok {
+		xiangqiRooms.Store(groupCode, &xiangqiRoom{
+			Room: gameroom.Room{
+				SelfID:     selfID,
+				GroupID:    groupCode,
+				Players:    []gameroom.Player{{UID: senderUin, Name: senderName}},
+				LastAction: time.Now(),
+			},
+			position:  newPosition(),
+			redPlayer: senderUin,
+			redName:   senderName,
+		})
+		msg = append(msg, message.Text("已创建新的象棋对局, 你执红先行, 发送「象棋」或「xiangqi」可加入对局。"))
+		return
+	}
+	msg = message.Message{message.At(senderUin)}
+	if room.blackPlayer != 0 {
+		msg = append(msg, message.Text("对局已在进行中, 无法创建或加入对局, 当前对局玩家为: "),
+			message.At(room.redPlayer), message.At(room.blackPlayer),
+			message.Text(", 群主或管理员发送「象棋中断」可中断对局(自动判和)。"))
+		return
+	}
+	if senderUin == room.redPlayer {
+		msg = append(msg, message.Text("请等候其他玩家加入游戏。"))
+		return
+	}
+	if err = room.Join(gameroom.Player{UID: senderUin, Name: senderName}, 2); err != nil {
+		return
+	}
+	room.blackPlayer = senderUin
+	room.blackName = senderName
+	room.Touch()
+	boardImgEle, err := getBoardElement(room)
+	if err != nil {
+		return
+	}
+	msg = append(msg, message.Text("黑方已加入对局, 请红方走棋。"), message.At(room.redPlayer), boardImgEle)
+	return
+}
+
+// play 走棋
+func play(groupCode, senderUin int64, moveStr string) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	room, ok := xiangqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	// 不是对局中的玩家, 忽略消息
+	if senderUin != room.redPlayer && senderUin != room.blackPlayer {
+		return
+	}
+	if room.redPlayer == 0 || room.blackPlayer == 0 {
+		msg = append(msg, message.Text("请等候其他玩家加入游戏。"))
+		return
+	}
+	if room.playerOf(room.position.turn) != senderUin {
+		msg = append(msg, message.Text("请等待对手走棋。"))
+		return
+	}
+	m, err := room.position.parseMove(moveStr)
+	if err != nil {
+		msg = append(msg, message.Text("着法「", moveStr, "」违规, 请检查, 格式为「炮二平五」或坐标「h2e2」。"))
+		return msg, nil
+	}
+	room.notations = append(room.notations, room.position.notation(m))
+	room.moves = append(room.moves, m)
+	room.position = room.position.apply(m)
+	room.Touch()
+	// 走子之后, 视为拒绝和棋
+	room.drawPlayer = 0
+	boardImgEle, err := getBoardElement(room)
+	if err != nil {
+		return
+	}
+	// 检查游戏是否结束
+	var hint string
+	var res result
+	switch {
+	case len(room.position.legalMoves()) == 0:
+		res = redWon
+		if room.position.turn == red {
+			res = blackWon
+		}
+		reason := "困毙"
+		if room.position.inCheck(room.position.turn) {
+			reason = "将死"
+		}
+		hint = room.position.turn.other().String() + "胜利, 因为" + reason + "。\n"
+	case room.position.idle >= idleLimit:
+		res = drawn
+		hint = "和棋, 因为双方 60 回合内均未吃子。\n"
+	}
+	if res != "" {
+		text, err := finishGame(room, groupCode, res)
+		if err != nil {
+			return nil, err
+		}
+		msg = append(msg, message.Text("游戏结束, ", hint, text), boardImgEle)
+		return append(msg, room.Audience()...), nil
+	}
+	// 提示玩家继续游戏
+	hint = "对手走了「" + room.notations[len(room.notations)-1] + "」, 游戏继续。"
+	if room.position.inCheck(room.position.turn) {
+		hint = "对手走了「" + room.notations[len(room.notations)-1] + "」, 将军!"
+	}
+	msg = message.Message{message.At(room.playerOf(room.position.turn)), message.Text(hint), boardImgEle}
+	return
+}
+
+// resign 认输
+func resign(groupCode, senderUin int64) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	room, ok := xiangqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if senderUin != room.redPlayer && senderUin != room.blackPlayer {
+		return
+	}
+	// 如果对局未建立, 中断对局
+	if room.redPlayer == 0 || room.blackPlayer == 0 {
+		msg = closeRoom(groupCode, room, append(msg, message.Text("对局结束")))
+		return
+	}
+	res := redWon
+	if senderUin == room.redPlayer {
+		res = blackWon
+	}
+	text, err := finishGame(room, groupCode, res)
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, message.Text("认输, 游戏结束。\n", text))
+	msg = append(msg, room.Audience()...)
+	return
+}
+
+// draw 和棋
+func draw(groupCode, senderUin int64) (msg message.Message, err error) {
+	msg = message.Message{message.At(senderUin)}
+	room, ok := xiangqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if senderUin != room.redPlayer && senderUin != room.blackPlayer {
+		return
+	}
+	room.Touch()
+	if room.drawPlayer == 0 {
+		room.drawPlayer = senderUin
+		msg = append(msg, message.Text("请求和棋, 发送「象棋和棋」接受和棋。走棋视为拒绝和棋。"))
+		return
+	}
+	if room.drawPlayer == senderUin {
+		return
+	}
+	text, err := finishGame(room, groupCode, drawn)
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, message.Text("接受和棋, 游戏结束。\n", text))
+	msg = append(msg, room.Audience()...)
+	return
+}
+
+// abort 中断对局
+func abort(groupCode int64) (message.Message, error) {
+	if room, ok := xiangqiRooms.Load(groupCode); ok {
+		return abortGame(room, groupCode, "对局已被管理员中断, 游戏结束。")
+	}
+	return nil, errNotExist
+}
+
+// abortGame 中断游戏, 不计算等级分
+func abortGame(room *xiangqiRoom, groupCode int64, hint string) (message.Message, error) {
+	recordString := getRecordString(room, drawn)
+	if len(room.moves) > 4 {
+		if _, err := newDBService().createRecord(recordString, room.redPlayer, room.blackPlayer, room.redName, room.blackName); err != nil {
+			return nil, err
+		}
+	}
+	msg := message.Message{message.Text(hint)}
+	if room.redPlayer != 0 {
+		msg = append(msg, message.At(room.redPlayer))
+	}
+	if room.blackPlayer != 0 {
+		msg = append(msg, message.At(room.blackPlayer))
+	}
+	msg = append(msg, message.Text("\n\n"+recordString))
+	return closeRoom(groupCode, room, msg), nil
+}
+
+// finishGame 结束对局, 保存棋谱并计算等级分
+func finishGame(room *xiangqiRoom, groupCode int64, res result) (string, error) {
+	xiangqiRooms.Delete(groupCode)
+	room.res = res
+	recordString := getRecordString(room, res)
+	if len(room.moves) <= 4 {
+		return recordString, nil
+	}
+	// 若走子次数超过 4 认为是有效对局, 存入数据库
+	id, err := newDBService().createRecord(recordString, room.redPlayer, room.blackPlayer, room.redName, room.blackName)
+	if err != nil {
+		return "", err
+	}
+	eloString, err := getELOString(room, res)
+	if err != nil {
+		return "", err
+	}
+	return eloString + "棋谱编号 #" + strconv.Itoa(int(id)) + "\n" + recordString, nil
+}
+
+func (room *xiangqiRoom) playerOf(s side) int64 {
+	if s == red {
+		return room.redPlayer
+	}
+	return room.blackPlayer
+}
+
+// getBoardElement 获取棋盘图片的消息内容
+func getBoardElement(room *xiangqiRoom) (message.Segment, error) {
+	var last *move
+	if len(room.moves) > 0 {
+		last = &room.moves[len(room.moves)-1]
+	}
+	data, err := renderBoard(room.position, last)
+	if err != nil {
+		return message.Segment{}, err
+	}
+	return message.ImageBytes(data), nil
+}
+
+// getRecordString 获取棋谱, 着法为 ICCS 格式, 附中文记谱
+func getRecordString(room *xiangqiRoom, res result) string {
+	var sb strings.Builder
+	sb.WriteString("[Game \"Chinese Chess\"]\n")
+	sb.WriteString(fmt.Sprintf("[Date \"%s\"]\n", time.Now().Format("2006-01-02")))
+	sb.WriteString(fmt.Sprintf("[Red \"%s\"]\n", room.redName))
+	sb.WriteString(fmt.Sprintf("[Black \"%s\"]\n", room.blackName))
+	sb.WriteString(fmt.Sprintf("[Result \"%s\"]\n", res))
+	sb.WriteString("[Format \"ICCS\"]\n\n")
+	for i, m := range room.moves {
+		if i%2 == 0 {
+			sb.WriteString(strconv.Itoa(i/2 + 1))
+			sb.WriteString(". ")
+		}
+		sb.WriteString(strings.ToUpper(m.String()))
+		sb.WriteString(" {")
+		sb.WriteString(room.notations[i])
+		sb.WriteString("} ")
+	}
+	sb.WriteString(string(res))
+	return sb.String()
+}
+
+// getELOString 更新并获得玩家等级分的文本内容
+func getELOString(room *xiangqiRoom, res result) (string, error) {
+	redScore, blackScore := res.scores()
+	redRate, blackRate, err := ratings.Settle(room.redPlayer, room.blackPlayer, room.redName, room.blackName, redScore, blackScore)
+	if err != nil {
+		return "", err
+	}
+	return "玩家等级分: \n" + room.redName + ": " + strconv.Itoa(redRate) + "\n" +
+		room.blackName + ": " + strconv.Itoa(blackRate) + "\n\n", nil
+}
+
+// getRanking 获取等级分排行榜
+func getRanking() (message.Message, error) {
+	eloList, err := ratings.Top(10)
+	if err != nil {
+		return nil, err
+	}
+	var msgBuilder strings.Builder
+	msgBuilder.WriteString("当前象棋等级分排行榜: \n\n")
+	for _, elo := range eloList {
+		msgBuilder.WriteString(elo.Name)
+		msgBuilder.WriteString(": ")
+		msgBuilder.WriteString(strconv.Itoa(elo.Rate))
+		msgBuilder.WriteString("\n")
+	}
+	return message.Message{message.Text(msgBuilder.String())}, nil
+}
+
+// rate 获取等级分
+func rate(senderUin int64, senderName string) (message.Message, error) {
+	rate, err := ratings.Get(senderUin)
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return nil, errors.New("无法获取等级分信息。")
+		}
+		return nil, errors.New("没有查找到等级分信息, 请至少进行一局对局。")
+	}
+	return message.Message{message.Text("玩家「", senderName, "」目前的象棋等级分: ", rate)}, nil
+}
+
+// getRecord 按编号获取棋谱
+func getRecord(id uint) (message.Message, error) {
+	r, err := newDBService().getRecordByID(id)
+	if err == gorm.ErrRecordNotFound {
+		return nil, errors.New("没有找到对局 #" + strconv.Itoa(int(id)) + "。")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return message.Message{message.Text("#", r.ID, " ", r.CreatedAt.Format("2006-01-02"), "\n", r.Data)}, nil
+}
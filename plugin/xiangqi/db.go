@@ -0,0 +1,74 @@
+package xiangqi
+
+import (
+	"os"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom/elo"
+)
+
+var (
+	xiangqiDB *gorm.DB
+	ratings   *elo.Table // 对局等级分
+)
+
+// record 对局棋谱, 着法为 ICCS 格式
+type record struct {
+	gorm.Model
+	Data      string
+	RedUin    int64
+	BlackUin  int64
+	RedName   string
+	BlackName string
+}
+
+// xiangqiDBService 数据库服务
+type xiangqiDBService struct {
+	db *gorm.DB
+}
+
+// newDBService 创建数据库服务
+func newDBService() *xiangqiDBService {
+	return &xiangqiDBService{
+		db: xiangqiDB,
+	}
+}
+
+// initDatabase init database
+func initDatabase(dbPath string) {
+	var err error
+	if _, err = os.Stat(dbPath); err != nil || os.IsNotExist(err) {
+		f, err := os.Create(dbPath)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+	}
+	xiangqiDB, err = gorm.Open("sqlite3", dbPath)
+	if err != nil {
+		panic(err)
+	}
+	xiangqiDB.AutoMigrate(&record{})
+	ratings = elo.NewTable(xiangqiDB, "elos")
+}
+
+// createRecord 保存棋谱
+func (s *xiangqiDBService) createRecord(data string, redUin, blackUin int64, redName, blackName string) (uint, error) {
+	r := record{
+		Data:      data,
+		RedUin:    redUin,
+		BlackUin:  blackUin,
+		RedName:   redName,
+		BlackName: blackName,
+	}
+	err := s.db.Create(&r).Error
+	return r.ID, err
+}
+
+// getRecordByID 获取棋谱
+func (s *xiangqiDBService) getRecordByID(id uint) (record, error) {
+	var r record
+	err := s.db.Where("id = ?", id).First(&r).Error
+	return r, err
+}
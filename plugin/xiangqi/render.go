@@ -0,0 +1,143 @@
+package xiangqi
+
+import (
+	"image/color"
+	"strconv"
+
+	"github.com/FloatTech/floatbox/file"
+	"github.com/FloatTech/gg"
+	"github.com/FloatTech/gg/factory"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/img/text"
+)
+
+const (
+	cellSize = 64.0
+	margin   = 64.0
+)
+
+var (
+	boardColor     = color.RGBA{240, 205, 140, 255}
+	lineColor      = color.RGBA{90, 50, 20, 255}
+	pieceFaceColor = color.RGBA{250, 235, 200, 255}
+	redPieceColor  = color.RGBA{200, 30, 30, 255}
+	highlightColor = color.RGBA{30, 120, 220, 255}
+)
+
+// point 棋盘上的点在图片中的坐标, 红方始终在下方
+func point(sq square) (float64, float64) {
+	return margin + float64(sq.file)*cellSize, margin + float64(ranks-1-sq.rank)*cellSize
+}
+
+// renderBoard 绘制局面, 并标记上一步的起止位置
+func renderBoard(p *position, last *move) ([]byte, error) {
+	fontdata, err := file.GetLazyData(text.BoldFontFile, control.Md5File, true)
+	if err != nil {
+		return nil, err
+	}
+	width := int(2*margin + (files-1)*cellSize)
+	height := int(2*margin + (ranks-1)*cellSize + cellSize/2)
+	canvas := gg.NewContext(width, height)
+	canvas.SetColor(boardColor)
+	canvas.Clear()
+
+	// 网格, 竖线在河界处断开
+	canvas.SetColor(lineColor)
+	canvas.SetLineWidth(2)
+	for r := 0; r < ranks; r++ {
+		x1, y := point(square{0, r})
+		x2, _ := point(square{files - 1, r})
+		canvas.DrawLine(x1, y, x2, y)
+	}
+	for f := 0; f < files; f++ {
+		if f == 0 || f == files-1 {
+			x, y1 := point(square{f, 0})
+			_, y2 := point(square{f, ranks - 1})
+			canvas.DrawLine(x, y1, x, y2)
+			continue
+		}
+		x, y1 := point(square{f, 0})
+		_, y2 := point(square{f, 4})
+		canvas.DrawLine(x, y1, x, y2)
+		_, y1 = point(square{f, 5})
+		_, y2 = point(square{f, ranks - 1})
+		canvas.DrawLine(x, y1, x, y2)
+	}
+	// 九宫斜线
+	for _, r := range []int{0, 7} {
+		x1, y1 := point(square{3, r})
+		x2, y2 := point(square{5, r + 2})
+		canvas.DrawLine(x1, y1, x2, y2)
+		canvas.DrawLine(x1, y2, x2, y1)
+	}
+	canvas.Stroke()
+	// 外框
+	x1, y1 := point(square{0, ranks - 1})
+	canvas.SetLineWidth(4)
+	canvas.DrawRectangle(x1-6, y1-6, (files-1)*cellSize+12, (ranks-1)*cellSize+12)
+	canvas.Stroke()
+
+	// 河界与坐标
+	if err = canvas.ParseFontFace(fontdata, cellSize*0.5); err != nil {
+		return nil, err
+	}
+	_, riverY := point(square{0, 4})
+	riverY -= cellSize / 2
+	canvas.DrawStringAnchored("楚 河", margin+2*cellSize, riverY, 0.5, 0.5)
+	canvas.DrawStringAnchored("汉 界", margin+6*cellSize, riverY, 0.5, 0.5)
+	if err = canvas.ParseFontFace(fontdata, cellSize*0.3); err != nil {
+		return nil, err
+	}
+	for f := 0; f < files; f++ {
+		x, top := point(square{f, ranks - 1})
+		_, bottom := point(square{f, 0})
+		canvas.DrawStringAnchored(strconv.Itoa(numberOf(f, black)), x, top-margin*0.6, 0.5, 0.5)
+		canvas.DrawStringAnchored(redNumerals[numberOf(f, red)], x, bottom+margin*0.6, 0.5, 0.5)
+		canvas.DrawStringAnchored(string(rune('a'+f)), x, bottom+margin*1.05, 0.5, 0.5)
+	}
+	for r := 0; r < ranks; r++ {
+		_, y := point(square{0, r})
+		canvas.DrawStringAnchored(strconv.Itoa(r), margin*0.35, y, 0.5, 0.5)
+	}
+
+	// 上一步
+	if last != nil {
+		canvas.SetColor(highlightColor)
+		canvas.SetLineWidth(3)
+		for _, sq := range []square{last.from, last.to} {
+			x, y := point(sq)
+			canvas.DrawRectangle(x-cellSize*0.48, y-cellSize*0.48, cellSize*0.96, cellSize*0.96)
+		}
+		canvas.Stroke()
+	}
+
+	// 棋子
+	if err = canvas.ParseFontFace(fontdata, cellSize*0.5); err != nil {
+		return nil, err
+	}
+	for r := 0; r < ranks; r++ {
+		for f := 0; f < files; f++ {
+			pc := p.board[r][f]
+			if pc.kind == none {
+				continue
+			}
+			x, y := point(square{f, r})
+			var pieceColor color.Color = color.Black
+			if pc.side == red {
+				pieceColor = redPieceColor
+			}
+			canvas.DrawCircle(x, y, cellSize*0.42)
+			canvas.SetColor(pieceFaceColor)
+			canvas.FillPreserve()
+			canvas.SetColor(lineColor)
+			canvas.SetLineWidth(2)
+			canvas.Stroke()
+			canvas.DrawCircle(x, y, cellSize*0.35)
+			canvas.SetColor(pieceColor)
+			canvas.SetLineWidth(1.5)
+			canvas.Stroke()
+			canvas.DrawStringAnchored(pc.String(), x, y, 0.5, 0.4)
+		}
+	}
+	return factory.ToBytes(canvas.Image())
+}
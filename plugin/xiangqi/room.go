@@ -0,0 +1,156 @@
+package xiangqi
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+// roomTimeout 无人走棋多久后中断对局
+const roomTimeout = 6 * time.Hour
+
+// xiangqiRooms 各群正在进行的对局, 重启后恢复
+var xiangqiRooms *gameroom.Manager[*xiangqiRoom]
+
+func newRoomManager() *gameroom.Manager[*xiangqiRoom] {
+	return gameroom.New(gameroom.Options[*xiangqiRoom]{
+		Name:    "xiangqi",
+		Brief:   "中国象棋",
+		Timeout: roomTimeout,
+		OnTimeout: func(groupCode int64, room *xiangqiRoom) *gameroom.Event {
+			msg, err := abortGame(room, groupCode, "对局已超过 6 小时无人走棋, 游戏结束。")
+			if err != nil {
+				msg = message.Message{message.Text("ERROR: ", err)}
+			}
+			return &gameroom.Event{Message: msg}
+		},
+		New: func() *xiangqiRoom {
+			return &xiangqiRoom{}
+		},
+	})
+}
+
+// savedRoom 对局的持久化内容, 着法以 ICCS 格式保存
+type savedRoom struct {
+	gameroom.Room
+	Moves       string `json:"moves"`
+	RedPlayer   int64  `json:"red_player"`
+	RedName     string `json:"red_name"`
+	BlackPlayer int64  `json:"black_player"`
+	BlackName   string `json:"black_name"`
+	DrawPlayer  int64  `json:"draw_player"`
+}
+
+// MarshalJSON 保存对局
+func (room *xiangqiRoom) MarshalJSON() ([]byte, error) {
+	moves := make([]string, 0, len(room.moves))
+	for _, m := range room.moves {
+		moves = append(moves, m.String())
+	}
+	return json.Marshal(&savedRoom{
+		Room:        room.Room,
+		Moves:       strings.Join(moves, " "),
+		RedPlayer:   room.redPlayer,
+		RedName:     room.redName,
+		BlackPlayer: room.blackPlayer,
+		BlackName:   room.blackName,
+		DrawPlayer:  room.drawPlayer,
+	})
+}
+
+// UnmarshalJSON 恢复对局, 由着法重新推演局面与中文记谱
+func (room *xiangqiRoom) UnmarshalJSON(data []byte) error {
+	var s savedRoom
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*room = xiangqiRoom{
+		Room:        s.Room,
+		position:    newPosition(),
+		redPlayer:   s.RedPlayer,
+		redName:     s.RedName,
+		blackPlayer: s.BlackPlayer,
+		blackName:   s.BlackName,
+		drawPlayer:  s.DrawPlayer,
+	}
+	for _, iccs := range strings.Fields(s.Moves) {
+		m, err := room.position.parseMove(iccs)
+		if err != nil {
+			return err
+		}
+		room.notations = append(room.notations, room.position.notation(m))
+		room.moves = append(room.moves, m)
+		room.position = room.position.apply(m)
+	}
+	return nil
+}
+
+// outcomeOf 有效对局结束后的胜者, 和棋没有胜者
+func outcomeOf(room *xiangqiRoom) *gameroom.Outcome {
+	if room == nil || len(room.moves) <= 4 {
+		return nil
+	}
+	var o gameroom.Outcome
+	switch room.res {
+	case redWon:
+		o = gameroom.Win(room.redPlayer)
+	case blackWon:
+		o = gameroom.Win(room.blackPlayer)
+	default:
+		return nil
+	}
+	return &o
+}
+
+// reportResult 对局结束后为胜者增加群等级经验与钱包奖励
+func reportResult(ctx *zero.Ctx, room *xiangqiRoom) {
+	if o := outcomeOf(room); o != nil {
+		xiangqiRooms.Report(ctx, ctx.Event.GroupID, *o)
+	}
+}
+
+// closeRoom 删除已结束的对局, 并通知观战者
+func closeRoom(groupCode int64, room *xiangqiRoom, msg message.Message) message.Message {
+	xiangqiRooms.Delete(groupCode)
+	return append(msg, room.Audience()...)
+}
+
+// watch 观战, 对局结束时会通知观战者
+func watch(groupCode, senderUin int64) (msg message.Message, err error) {
+	room, ok := xiangqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	msg = message.Message{message.At(senderUin)}
+	if !room.Watch(senderUin) {
+		msg = append(msg, message.Text("你已经在对局或观战中了。"))
+		return
+	}
+	if room.blackPlayer == 0 {
+		msg = append(msg, message.Text("开始观战, 对局尚未开始, 对局结束时会通知你。"))
+		return
+	}
+	boardImgEle, err := getBoardElement(room)
+	if err != nil {
+		return
+	}
+	msg = append(msg, message.Text("开始观战, 对局结束时会通知你。当前对局: ", room.redName, "(红) vs ", room.blackName, "(黑)"), boardImgEle)
+	return
+}
+
+// unwatch 取消观战
+func unwatch(groupCode, senderUin int64) (message.Message, error) {
+	room, ok := xiangqiRooms.Load(groupCode)
+	if !ok {
+		return nil, errNotExist
+	}
+	if !room.Unwatch(senderUin) {
+		return message.Message{message.At(senderUin), message.Text("你没有在观战。")}, nil
+	}
+	return message.Message{message.At(senderUin), message.Text("已取消观战。")}, nil
+}
@@ -0,0 +1,46 @@
+package xiangqi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/FloatTech/ZeroBot-Plugin/plugin/gameroom"
+)
+
+func TestXiangqiRoomJSON(t *testing.T) {
+	room := &xiangqiRoom{
+		Room:        gameroom.Room{SelfID: 1, GroupID: 2, Spectators: []int64{5}},
+		position:    newPosition(),
+		redPlayer:   3,
+		redName:     "红",
+		blackPlayer: 4,
+		blackName:   "黑",
+		drawPlayer:  3,
+	}
+	for _, s := range []string{"炮二平五", "马8进7", "马二进三", "车9平8"} {
+		m, err := room.position.parseMove(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		room.notations = append(room.notations, room.position.notation(m))
+		room.moves = append(room.moves, m)
+		room.position = room.position.apply(m)
+	}
+	data, err := json.Marshal(room)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &xiangqiRoom{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restored.position.fen(), room.position.fen(); got != want {
+		t.Fatalf("局面 %s, want %s", got, want)
+	}
+	if len(restored.notations) != 4 || restored.notations[3] != "车9平8" {
+		t.Fatalf("记谱未恢复: %v", restored.notations)
+	}
+	if restored.redName != "红" || restored.blackPlayer != 4 || restored.drawPlayer != 3 || restored.GroupID != 2 || len(restored.Spectators) != 1 {
+		t.Fatalf("对局信息未恢复: %+v", restored)
+	}
+}
@@ -0,0 +1,632 @@
+package xiangqi
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// side 执子方
+type side int8
+
+const (
+	red side = iota
+	black
+)
+
+func (s side) other() side {
+	return 1 - s
+}
+
+func (s side) String() string {
+	if s == red {
+		return "红方"
+	}
+	return "黑方"
+}
+
+// kind 棋子种类
+type kind int8
+
+const (
+	none kind = iota
+	king
+	advisor
+	elephant
+	horse
+	chariot
+	cannon
+	soldier
+)
+
+type piece struct {
+	kind kind
+	side side
+}
+
+// 红黑双方棋子的名称, 下标为 kind
+var pieceNames = [2][8]string{
+	{"", "帅", "仕", "相", "马", "车", "炮", "兵"},
+	{"", "将", "士", "象", "马", "车", "炮", "卒"},
+}
+
+func (p piece) String() string {
+	return pieceNames[p.side][p.kind]
+}
+
+const (
+	files = 9
+	ranks = 10
+)
+
+// square 棋盘上的点, file 为 a~i 列, rank 为 0~9 行, 红方在 0 行一侧
+type square struct {
+	file, rank int
+}
+
+func (sq square) valid() bool {
+	return sq.file >= 0 && sq.file < files && sq.rank >= 0 && sq.rank < ranks
+}
+
+// String ICCS 坐标, 如 h2
+func (sq square) String() string {
+	return string(rune('a'+sq.file)) + strconv.Itoa(sq.rank)
+}
+
+type move struct {
+	from, to square
+}
+
+// String ICCS 格式的着法, 如 h2-e2
+func (m move) String() string {
+	return m.from.String() + "-" + m.to.String()
+}
+
+// position 局面
+type position struct {
+	board [ranks][files]piece
+	turn  side
+	idle  int // 连续未吃子的半回合数
+}
+
+// 自然限着, 双方 60 回合内均未吃子判和
+const idleLimit = 120
+
+var backRank = [files]kind{chariot, horse, elephant, advisor, king, advisor, elephant, horse, chariot}
+
+// newPosition 开局局面
+func newPosition() *position {
+	p := &position{}
+	for f, k := range backRank {
+		p.board[0][f] = piece{k, red}
+		p.board[9][f] = piece{k, black}
+	}
+	for _, f := range []int{1, 7} {
+		p.board[2][f] = piece{cannon, red}
+		p.board[7][f] = piece{cannon, black}
+	}
+	for f := 0; f < files; f += 2 {
+		p.board[3][f] = piece{soldier, red}
+		p.board[6][f] = piece{soldier, black}
+	}
+	return p
+}
+
+func (p *position) at(sq square) piece {
+	return p.board[sq.rank][sq.file]
+}
+
+// forward 前进方向
+func forward(s side) int {
+	if s == red {
+		return 1
+	}
+	return -1
+}
+
+// inPalace 是否在 s 方的九宫内
+func inPalace(sq square, s side) bool {
+	if sq.file < 3 || sq.file > 5 {
+		return false
+	}
+	if s == red {
+		return sq.rank <= 2
+	}
+	return sq.rank >= 7
+}
+
+// ownHalf 是否在 s 方一侧 (未过河)
+func ownHalf(sq square, s side) bool {
+	if s == red {
+		return sq.rank <= 4
+	}
+	return sq.rank >= 5
+}
+
+var (
+	orthogonal = [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	diagonal   = [4][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+// pseudoMoves 不考虑将帅安全时 from 处棋子的走法
+func (p *position) pseudoMoves(from square) []move {
+	pc := p.at(from)
+	moves := make([]move, 0, 17)
+	add := func(to square) {
+		if to.valid() {
+			if target := p.at(to); target.kind == none || target.side != pc.side {
+				moves = append(moves, move{from, to})
+			}
+		}
+	}
+	switch pc.kind {
+	case king:
+		for _, d := range orthogonal {
+			if to := (square{from.file + d[0], from.rank + d[1]}); inPalace(to, pc.side) {
+				add(to)
+			}
+		}
+	case advisor:
+		for _, d := range diagonal {
+			if to := (square{from.file + d[0], from.rank + d[1]}); inPalace(to, pc.side) {
+				add(to)
+			}
+		}
+	case elephant:
+		for _, d := range diagonal {
+			eye := square{from.file + d[0], from.rank + d[1]}
+			to := square{from.file + 2*d[0], from.rank + 2*d[1]}
+			if to.valid() && ownHalf(to, pc.side) && p.at(eye).kind == none {
+				add(to)
+			}
+		}
+	case horse:
+		for _, d := range orthogonal {
+			leg := square{from.file + d[0], from.rank + d[1]}
+			if !leg.valid() || p.at(leg).kind != none {
+				continue
+			}
+			// 沿 d 方向走两格, 再向两侧偏一格
+			for _, offset := range []int{1, -1} {
+				add(square{from.file + 2*d[0] + offset*d[1], from.rank + 2*d[1] + offset*d[0]})
+			}
+		}
+	case chariot, cannon:
+		for _, d := range orthogonal {
+			screened := false
+			for to := (square{from.file + d[0], from.rank + d[1]}); to.valid(); to = (square{to.file + d[0], to.rank + d[1]}) {
+				target := p.at(to)
+				if pc.kind == chariot {
+					add(to)
+					if target.kind != none {
+						break
+					}
+					continue
+				}
+				if !screened {
+					if target.kind == none {
+						add(to)
+						continue
+					}
+					screened = true
+					continue
+				}
+				if target.kind != none {
+					add(to)
+					break
+				}
+			}
+		}
+	case soldier:
+		add(square{from.file, from.rank + forward(pc.side)})
+		if !ownHalf(from, pc.side) {
+			add(square{from.file + 1, from.rank})
+			add(square{from.file - 1, from.rank})
+		}
+	}
+	return moves
+}
+
+func (p *position) kingSquare(s side) (square, bool) {
+	for r := 0; r < ranks; r++ {
+		for f := 0; f < files; f++ {
+			if pc := p.board[r][f]; pc.kind == king && pc.side == s {
+				return square{f, r}, true
+			}
+		}
+	}
+	return square{}, false
+}
+
+// inCheck s 方是否被将军, 将帅在同一列且中间无子时也视为被将军
+func (p *position) inCheck(s side) bool {
+	k, ok := p.kingSquare(s)
+	if !ok {
+		return true
+	}
+	if p.kingsFacing() {
+		return true
+	}
+	for r := 0; r < ranks; r++ {
+		for f := 0; f < files; f++ {
+			pc := p.board[r][f]
+			if pc.kind == none || pc.side == s {
+				continue
+			}
+			for _, m := range p.pseudoMoves(square{f, r}) {
+				if m.to == k {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// kingsFacing 将帅是否对面
+func (p *position) kingsFacing() bool {
+	rk, ok1 := p.kingSquare(red)
+	bk, ok2 := p.kingSquare(black)
+	if !ok1 || !ok2 || rk.file != bk.file {
+		return false
+	}
+	for r := rk.rank + 1; r < bk.rank; r++ {
+		if p.board[r][rk.file].kind != none {
+			return false
+		}
+	}
+	return true
+}
+
+// apply 走棋后的新局面, 不检查合法性
+func (p *position) apply(m move) *position {
+	next := *p
+	captured := next.board[m.to.rank][m.to.file]
+	next.board[m.to.rank][m.to.file] = next.board[m.from.rank][m.from.file]
+	next.board[m.from.rank][m.from.file] = piece{}
+	next.turn = p.turn.other()
+	if captured.kind != none {
+		next.idle = 0
+	} else {
+		next.idle++
+	}
+	return &next
+}
+
+// legalMoves 走子方的所有合法着法
+func (p *position) legalMoves() []move {
+	var moves []move
+	for r := 0; r < ranks; r++ {
+		for f := 0; f < files; f++ {
+			if pc := p.board[r][f]; pc.kind == none || pc.side != p.turn {
+				continue
+			}
+			for _, m := range p.pseudoMoves(square{f, r}) {
+				if !p.apply(m).inCheck(p.turn) {
+					moves = append(moves, m)
+				}
+			}
+		}
+	}
+	return moves
+}
+
+func (p *position) isLegal(m move) bool {
+	if !m.from.valid() || !m.to.valid() {
+		return false
+	}
+	if pc := p.at(m.from); pc.kind == none || pc.side != p.turn {
+		return false
+	}
+	for _, pm := range p.pseudoMoves(m.from) {
+		if pm == m {
+			return !p.apply(m).inCheck(p.turn)
+		}
+	}
+	return false
+}
+
+var (
+	iccsRe     = regexp.MustCompile(`^([a-iA-I])([0-9])\s*-?\s*([a-iA-I])([0-9])$`)
+	errIllegal = errors.New("illegal move")
+)
+
+// 中文纵线数字, 红方使用汉字, 黑方使用阿拉伯数字, 输入时两者均可
+var numerals = map[rune]int{
+	'一': 1, '二': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+	'1': 1, '2': 2, '3': 3, '4': 4, '5': 5, '6': 6, '7': 7, '8': 8, '9': 9,
+	'１': 1, '２': 2, '３': 3, '４': 4, '５': 5, '６': 6, '７': 7, '８': 8, '９': 9,
+}
+
+var kindOfName = map[rune]kind{
+	'帅': king, '将': king, '帥': king,
+	'仕': advisor, '士': advisor,
+	'相': elephant, '象': elephant,
+	'马': horse, '馬': horse, '傌': horse,
+	'车': chariot, '車': chariot, '俥': chariot,
+	'炮': cannon, '砲': cannon, '包': cannon,
+	'兵': soldier, '卒': soldier,
+}
+
+// fileOf 将 s 方的纵线编号 (从己方右侧数起) 转换为列
+func fileOf(n int, s side) int {
+	if s == red {
+		return files - n
+	}
+	return n - 1
+}
+
+// numberOf 列在 s 方视角的纵线编号
+func numberOf(file int, s side) int {
+	if s == red {
+		return files - file
+	}
+	return file + 1
+}
+
+var redNumerals = []string{"", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+
+func numeralOf(n int, s side) string {
+	if s == red {
+		return redNumerals[n]
+	}
+	return strconv.Itoa(n)
+}
+
+// parseMove 解析 ICCS 坐标 (h2e2) 或中文记谱 (炮二平五) 格式的着法
+func (p *position) parseMove(s string) (move, error) {
+	s = strings.TrimSpace(s)
+	if matched := iccsRe.FindStringSubmatch(s); matched != nil {
+		m := move{
+			from: square{int(strings.ToLower(matched[1])[0] - 'a'), int(matched[2][0] - '0')},
+			to:   square{int(strings.ToLower(matched[3])[0] - 'a'), int(matched[4][0] - '0')},
+		}
+		if !p.isLegal(m) {
+			return m, errIllegal
+		}
+		return m, nil
+	}
+	rs := []rune(s)
+	if len(rs) != 4 {
+		return move{}, errIllegal
+	}
+	var candidates []square
+	var k kind
+	switch rs[0] {
+	case '前', '中', '后', '後':
+		var ok bool
+		if k, ok = kindOfName[rs[1]]; !ok {
+			return move{}, errIllegal
+		}
+		candidates = p.stacked(k, rs[0])
+	default:
+		var ok bool
+		if k, ok = kindOfName[rs[0]]; !ok {
+			return move{}, errIllegal
+		}
+		n, ok := numerals[rs[1]]
+		if !ok {
+			return move{}, errIllegal
+		}
+		f := fileOf(n, p.turn)
+		for r := 0; r < ranks; r++ {
+			if pc := p.board[r][f]; pc.kind == k && pc.side == p.turn {
+				candidates = append(candidates, square{f, r})
+			}
+		}
+	}
+	n, ok := numerals[rs[3]]
+	if !ok {
+		return move{}, errIllegal
+	}
+	var found []move
+	for _, from := range candidates {
+		to, ok := target(from, k, p.turn, rs[2], n)
+		if !ok {
+			continue
+		}
+		if m := (move{from, to}); p.isLegal(m) {
+			found = append(found, m)
+		}
+	}
+	if len(found) != 1 {
+		return move{}, errIllegal
+	}
+	return found[0], nil
+}
+
+// stacked 按 前/中/后 选择同一纵线上的同种棋子
+func (p *position) stacked(k kind, which rune) []square {
+	var result []square
+	for f := 0; f < files; f++ {
+		var column []square
+		for r := 0; r < ranks; r++ {
+			if pc := p.board[r][f]; pc.kind == k && pc.side == p.turn {
+				column = append(column, square{f, r})
+			}
+		}
+		if len(column) < 2 {
+			continue
+		}
+		// 按靠近对方的程度从前到后排列
+		sort.Slice(column, func(i, j int) bool {
+			return column[i].rank*forward(p.turn) > column[j].rank*forward(p.turn)
+		})
+		switch which {
+		case '前':
+			result = append(result, column[0])
+		case '中':
+			if len(column) == 3 {
+				result = append(result, column[1])
+			}
+		default:
+			result = append(result, column[len(column)-1])
+		}
+	}
+	return result
+}
+
+// target 由 进/退/平 与数字计算目标位置
+func target(from square, k kind, s side, action rune, n int) (square, bool) {
+	dir := forward(s)
+	switch action {
+	case '平':
+		return square{fileOf(n, s), from.rank}, true
+	case '进', '進':
+	case '退':
+		dir = -dir
+	default:
+		return square{}, false
+	}
+	switch k {
+	case king, chariot, cannon, soldier:
+		return square{from.file, from.rank + dir*n}, true
+	}
+	to := square{file: fileOf(n, s)}
+	df := to.file - from.file
+	if df < 0 {
+		df = -df
+	}
+	switch {
+	case k == advisor && df == 1:
+		to.rank = from.rank + dir
+	case k == elephant && df == 2:
+		to.rank = from.rank + 2*dir
+	case k == horse && df == 1:
+		to.rank = from.rank + 2*dir
+	case k == horse && df == 2:
+		to.rank = from.rank + dir
+	default:
+		return square{}, false
+	}
+	return to, true
+}
+
+// notation 着法的中文记谱
+func (p *position) notation(m move) string {
+	pc := p.at(m.from)
+	s := pc.side
+	var prefix string
+	var column []square
+	for r := 0; r < ranks; r++ {
+		if other := p.board[r][m.from.file]; other.kind == pc.kind && other.side == s {
+			column = append(column, square{m.from.file, r})
+		}
+	}
+	switch len(column) {
+	case 1:
+		prefix = pc.String() + numeralOf(numberOf(m.from.file, s), s)
+	case 2, 3:
+		sort.Slice(column, func(i, j int) bool {
+			return column[i].rank*forward(s) > column[j].rank*forward(s)
+		})
+		which := "后"
+		if column[0] == m.from {
+			which = "前"
+		} else if len(column) == 3 && column[1] == m.from {
+			which = "中"
+		}
+		prefix = which + pc.String()
+	default:
+		return m.String()
+	}
+	dr := (m.to.rank - m.from.rank) * forward(s)
+	switch {
+	case dr == 0:
+		return prefix + "平" + numeralOf(numberOf(m.to.file, s), s)
+	case pc.kind == king || pc.kind == chariot || pc.kind == cannon || pc.kind == soldier:
+		action := "进"
+		if dr < 0 {
+			action, dr = "退", -dr
+		}
+		return prefix + action + numeralOf(dr, s)
+	default:
+		action := "进"
+		if dr < 0 {
+			action = "退"
+		}
+		return prefix + action + numeralOf(numberOf(m.to.file, s), s)
+	}
+}
+
+// fenLetters FEN 中的棋子字母, 红方大写
+var fenLetters = [8]byte{0, 'k', 'a', 'b', 'n', 'r', 'c', 'p'}
+
+// fen 局面的 FEN 串
+func (p *position) fen() string {
+	var sb strings.Builder
+	for r := ranks - 1; r >= 0; r-- {
+		empty := 0
+		for f := 0; f < files; f++ {
+			pc := p.board[r][f]
+			if pc.kind == none {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				sb.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			c := fenLetters[pc.kind]
+			if pc.side == red {
+				c -= 'a' - 'A'
+			}
+			sb.WriteByte(c)
+		}
+		if empty > 0 {
+			sb.WriteString(strconv.Itoa(empty))
+		}
+		if r > 0 {
+			sb.WriteByte('/')
+		}
+	}
+	if p.turn == red {
+		sb.WriteString(" w")
+	} else {
+		sb.WriteString(" b")
+	}
+	return sb.String()
+}
+
+// parseFEN 解析 FEN 串, 仅用于测试与残局
+func parseFEN(s string) (*position, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return nil, errors.New("invalid fen")
+	}
+	rows := strings.Split(fields[0], "/")
+	if len(rows) != ranks {
+		return nil, errors.New("invalid fen")
+	}
+	p := &position{}
+	for i, row := range rows {
+		r, f := ranks-1-i, 0
+		for _, c := range row {
+			if c >= '1' && c <= '9' {
+				f += int(c - '0')
+				continue
+			}
+			sd := red
+			if c >= 'a' && c <= 'z' {
+				sd = black
+			} else {
+				c += 'a' - 'A'
+			}
+			k := kind(strings.IndexByte(string(fenLetters[:]), byte(c)))
+			if k <= none || f >= files {
+				return nil, errors.New("invalid fen")
+			}
+			p.board[r][f] = piece{k, sd}
+			f++
+		}
+		if f != files {
+			return nil, errors.New("invalid fen")
+		}
+	}
+	if fields[1] == "b" {
+		p.turn = black
+	}
+	return p, nil
+}
@@ -0,0 +1,100 @@
+package xiangqi
+
+import "testing"
+
+func perft(p *position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+	n := 0
+	for _, m := range p.legalMoves() {
+		n += perft(p.apply(m), depth-1)
+	}
+	return n
+}
+
+func TestPerft(t *testing.T) {
+	// 开局局面的已知结果
+	for depth, want := range []int{1, 44, 1920, 79666} {
+		if got := perft(newPosition(), depth); got != want {
+			t.Fatalf("perft(%d) = %d, want %d", depth, got, want)
+		}
+	}
+}
+
+func TestParseMove(t *testing.T) {
+	p := newPosition()
+	for _, tc := range []struct {
+		input, want string
+	}{
+		{"炮二平五", "h2-e2"},
+		{"马8进7", "h9-g7"},
+		{"h0g2", "h0-g2"},
+		{"马２进３", "b9-c7"},
+		{"车一进一", "i0-i1"},
+		{"象3进5", "c9-e7"},
+		{"兵七进一", "c3-c4"},
+	} {
+		m, err := p.parseMove(tc.input)
+		if err != nil {
+			t.Fatalf("parseMove(%q): %v", tc.input, err)
+		}
+		if m.String() != tc.want {
+			t.Fatalf("parseMove(%q) = %s, want %s", tc.input, m, tc.want)
+		}
+		p = p.apply(m)
+	}
+	for _, input := range []string{"炮8进8", "e0e2", "马8进7", "将5平6", "马二进四", "车1退1"} {
+		if _, err := p.parseMove(input); err == nil {
+			t.Fatalf("parseMove(%q) should fail", input)
+		}
+	}
+}
+
+func TestNotationRoundTrip(t *testing.T) {
+	// 红方两个车在同一纵线上, 需要使用前后区分
+	p, err := parseFEN("4k4/9/9/9/9/4R4/9/4R4/9/3K5 w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pos := range []*position{newPosition(), p} {
+		for _, m := range pos.legalMoves() {
+			s := pos.notation(m)
+			got, err := pos.parseMove(s)
+			if err != nil || got != m {
+				t.Fatalf("%s: notation %s parsed as %v, %v", m, s, got, err)
+			}
+		}
+	}
+	if s := p.notation(move{square{4, 4}, square{4, 8}}); s != "前车进四" {
+		t.Fatalf("got %s", s)
+	}
+}
+
+func TestRules(t *testing.T) {
+	for _, tc := range []struct {
+		name, fen string
+		moves     int
+		inCheck   bool
+	}{
+		// 将帅对面, 红帅只能离开该纵线
+		{"flying general", "4k4/9/9/9/9/9/9/9/9/4K4 w", 2, true},
+		// 双车错杀
+		{"checkmate", "R2k5/1R7/9/9/9/9/9/9/9/4K4 b", 0, true},
+		// 黑将无子可动, 困毙
+		{"stalemate", "3k5/4P4/3P5/9/9/9/9/9/9/4K4 b", 0, false},
+		// 马腿被蹩, 马只能走 d1, 帅不能走到与将对面的位置
+		{"horse leg", "4k4/9/9/9/9/9/9/9/1p7/1N1K5 w", 2, false},
+	} {
+		p, err := parseFEN(tc.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := len(p.legalMoves()); got != tc.moves {
+			t.Errorf("%s: %d legal moves, want %d", tc.name, got, tc.moves)
+		}
+		if got := p.inCheck(p.turn); got != tc.inCheck {
+			t.Errorf("%s: inCheck = %v, want %v", tc.name, got, tc.inCheck)
+		}
+	}
+}
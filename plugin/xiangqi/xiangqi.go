@@ -0,0 +1,170 @@
+// Package xiangqi 中国象棋
+package xiangqi
+
+import (
+	"strconv"
+	"time"
+
+	ctrl "github.com/FloatTech/zbpctrl"
+	"github.com/FloatTech/zbputils/control"
+	"github.com/FloatTech/zbputils/ctxext"
+	zero "github.com/wdvxdr1123/ZeroBot"
+	"github.com/wdvxdr1123/ZeroBot/message"
+)
+
+const helpString = `- 参与/创建一盘游戏：「象棋」(xiangqi)，创建者执红先行
+- 走棋：直接发送中文记谱如「炮二平五」「马8进7」「前车进一」，或坐标「走 h2e2」，红方纵线用汉字、黑方用数字，两者均可识别
+- 投降认输：「象棋认输」
+- 请求、接受和棋：「象棋和棋」
+- 中断对局：「象棋中断」（仅群主/管理员有效），6 小时无人走棋的对局会自动中断，重启后对局不会丢失
+- 观战本群对局并在结束时收到通知：「象棋观战」，「取消象棋观战」
+- 查看等级分排行榜：「象棋排行榜」
+- 查看自己的等级分：「象棋等级分」
+- 查看棋谱：「象棋棋谱 #编号」
+- 将死或困毙对方即获胜，双方 60 回合内均未吃子判和`
+
+var (
+	limit  = ctxext.NewLimiterManager(time.Microsecond*2500, 1)
+	engine = control.AutoRegister(&ctrl.Options[*zero.Ctx]{
+		DisableOnDefault:  false,
+		Brief:             "中国象棋",
+		Help:              helpString,
+		PrivateDataFolder: "xiangqi",
+	}).ApplySingle(ctxext.GroupSingle)
+)
+
+func init() {
+	// 初始化数据库
+	dbFilePath := engine.DataFolder() + "xiangqi.db"
+	initDatabase(dbFilePath)
+	// 恢复未结束的对局, 并开始超时计时
+	xiangqiRooms = newRoomManager()
+	// 注册指令
+	engine.OnFullMatchGroup([]string{"象棋", "xiangqi"}, zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			xiangqiRooms.Lock()
+			replyMessage, err := createGame(ctx.Event.GroupID, ctx.Event.UserID, ctx.Event.Sender.NickName, ctx.Event.SelfID)
+			xiangqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^(?:走\s*([a-iA-I][0-9]\s*-?\s*[a-iA-I][0-9])|([前中后後帅帥将仕士相象马馬傌车車俥炮砲包兵卒][一二三四五六七八九1-9１-９帅帥将仕士相象马馬傌车車俥炮砲包兵卒][进進退平][一二三四五六七八九1-9１-９]))$`,
+		zero.OnlyGroup, xiangqiRooms.Rule()).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			matched := ctx.State["regex_matched"].([]string)
+			moveStr := matched[1] + matched[2]
+			xiangqiRooms.Lock()
+			room, _ := xiangqiRooms.Load(ctx.Event.GroupID)
+			replyMessage, err := play(ctx.Event.GroupID, ctx.Event.UserID, moveStr)
+			xiangqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+			reportResult(ctx, room)
+		})
+
+	engine.OnFullMatch("象棋认输", zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			xiangqiRooms.Lock()
+			room, _ := xiangqiRooms.Load(ctx.Event.GroupID)
+			replyMessage, err := resign(ctx.Event.GroupID, ctx.Event.UserID)
+			xiangqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+			reportResult(ctx, room)
+		})
+
+	engine.OnFullMatch("象棋和棋", zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			xiangqiRooms.Lock()
+			replyMessage, err := draw(ctx.Event.GroupID, ctx.Event.UserID)
+			xiangqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("象棋中断", zero.OnlyGroup, zero.AdminPermission).SetBlock(true).Limit(limit.LimitByGroup).
+		Handle(func(ctx *zero.Ctx) {
+			xiangqiRooms.Lock()
+			replyMessage, err := abort(ctx.Event.GroupID)
+			xiangqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("象棋观战", zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			xiangqiRooms.Lock()
+			replyMessage, err := watch(ctx.Event.GroupID, ctx.Event.UserID)
+			xiangqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("取消象棋观战", zero.OnlyGroup).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			xiangqiRooms.Lock()
+			replyMessage, err := unwatch(ctx.Event.GroupID, ctx.Event.UserID)
+			xiangqiRooms.Unlock()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("象棋排行榜").SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			replyMessage, err := getRanking()
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnFullMatch("象棋等级分").SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			if ctx.Event.Sender == nil {
+				return
+			}
+			replyMessage, err := rate(ctx.Event.UserID, ctx.Event.Sender.NickName)
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+
+	engine.OnRegex(`^象棋棋谱\s*#?(\d+)$`).SetBlock(true).Limit(limit.LimitByUser).
+		Handle(func(ctx *zero.Ctx) {
+			id, _ := strconv.ParseUint(ctx.State["regex_matched"].([]string)[1], 10, 64)
+			replyMessage, err := getRecord(uint(id))
+			if err != nil {
+				ctx.SendChain(message.Text("ERROR: ", err))
+				return
+			}
+			ctx.Send(replyMessage)
+		})
+}